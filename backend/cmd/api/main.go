@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"log/slog"
@@ -10,7 +11,10 @@ import (
 	"sponsor-tracker/internal/auth"
 	"sponsor-tracker/internal/config"
 	"sponsor-tracker/internal/database"
+	"sponsor-tracker/internal/email"
+	"sponsor-tracker/internal/outbox"
 	"sponsor-tracker/internal/sync"
+	"sponsor-tracker/internal/webhook"
 )
 
 func main() {
@@ -30,13 +34,43 @@ func main() {
 	licences := sync.NewPostgresLicenceRepository(pool)
 	cfgRepo := sync.NewPostgresConfigRepository(pool)
 	runs := sync.NewPostgresSyncRunRepository(pool)
-	syncer := sync.NewSyncer(fetcher, orgs, licences, cfgRepo, runs)
+	snapshots := sync.NewPostgresSnapshotRepository(pool)
+	webhooks := webhook.NewService(webhook.NewPostgresStore(pool))
+	dispatcher := outbox.NewDispatcher(outbox.NewPostgresStore(pool))
+	dispatcher.Register("log", outbox.LogSink{})
+	dispatcher.Register("webhook", webhooks)
+	if cfg.SMTP.Enabled() {
+		emailStore := email.NewPostgresStore(pool)
+		alerts := email.NewNotifier(emailStore, api.ParseSavedSearchQuery)
+		dispatcher.Register("email", alerts)
+		go email.NewWorker(emailStore, email.NewSMTPSender(cfg.SMTP), alerts).Run(context.Background())
+	}
+	go dispatcher.Run(context.Background())
+	syncer := sync.NewSyncer(fetcher, orgs, licences, cfgRepo, runs, snapshots, sync.NewPostgresTransactor(pool), sync.NewPostgresOutboxRepository(pool))
 
 	dataReader := database.NewPostgresDataReader(pool)
 	userStore := auth.NewPostgresUserStore(pool)
 	sessionStore := auth.NewPostgresSessionStore(pool)
-	authService := auth.NewService(userStore, sessionStore)
-	server := api.NewServer(syncer, dataReader, authService)
+	policy, err := auth.LoadPasswordPolicy(cfg.Password.MinLength, cfg.Password.Blocklist)
+	if err != nil {
+		log.Fatalf("failed to load password policy: %v", err)
+	}
+	throttle := auth.NewThrottle(auth.NewPostgresThrottleStore(pool), auth.ThrottleLimits(cfg.LoginThrottle))
+	authService := auth.NewService(userStore, sessionStore, policy, throttle)
+	watchlists := database.NewPostgresWatchlistStore(pool)
+	notificationStore := database.NewPostgresNotificationStore(pool)
+	feeds := database.NewPostgresFeedStore(pool)
+	savedSearches := database.NewPostgresSavedSearchStore(pool)
+	annotations := database.NewPostgresAnnotationStore(pool)
+	server := api.NewServer(syncer, dataReader, authService, watchlists, webhooks, notificationStore, feeds, savedSearches, annotations, authService)
+	if cfg.SMTP.Enabled() {
+		server.EnableEmail()
+	}
+	proxies, err := cfg.Server.TrustedProxyPrefixes()
+	if err != nil {
+		log.Fatalf("failed to load trusted proxies: %v", err)
+	}
+	server.TrustProxies(proxies)
 
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
 	slog.Info("starting server", "address", addr)
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"sponsor-tracker/internal/config"
+	"sponsor-tracker/internal/database"
+)
+
+// backfill rebuilds the daily snapshots from the organisation and licence
+// history, e.g. after the snapshot tables are first created.
+func main() {
+	fromFlag := flag.String("from", "", "first day to rebuild (YYYY-MM-DD, default: day of the first sync run)")
+	toFlag := flag.String("to", "", "last day to rebuild (YYYY-MM-DD, default: today)")
+	flag.Parse()
+
+	cfg, err := config.Load("config.yaml", ".env")
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	pool, err := database.Connect(cfg.Database.ConnectionString())
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer pool.Close()
+
+	ctx := context.Background()
+
+	y, m, d := time.Now().UTC().Date()
+	to := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if *toFlag != "" {
+		to = parseDate("to", *toFlag)
+	}
+
+	var from time.Time
+	if *fromFlag != "" {
+		from = parseDate("from", *fromFlag)
+	} else {
+		first, ok, err := database.GetFirstTrackedDay(ctx, pool)
+		if err != nil {
+			log.Fatalf("failed to find first sync run: %v", err)
+		}
+		if !ok {
+			log.Fatal("no sync runs recorded; nothing to backfill")
+		}
+		from = first
+	}
+	if to.Before(from) {
+		log.Fatal("-to must not be before -from")
+	}
+
+	days := 0
+	err = database.RefreshDailySnapshots(ctx, pool, from, to, func(day time.Time) {
+		days++
+		if day.Day() == 1 || day.Equal(to) {
+			fmt.Printf("  %s\n", day.Format(time.DateOnly))
+		}
+	})
+	if err != nil {
+		log.Fatalf("backfill failed: %v", err)
+	}
+	fmt.Printf("Rebuilt %d daily snapshots from %s to %s\n", days, from.Format(time.DateOnly), to.Format(time.DateOnly))
+}
+
+// parseDate parses a YYYY-MM-DD flag value.
+func parseDate(name, value string) time.Time {
+	d, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		log.Fatalf("invalid -%s: must be a date (YYYY-MM-DD)", name)
+	}
+	return d
+}
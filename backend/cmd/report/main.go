@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sponsor-tracker/internal/config"
+	"sponsor-tracker/internal/database"
+	"sponsor-tracker/internal/lookup"
+)
+
+const usage = `usage: report <command> [flags]
+
+commands:
+  compare     differences in the register between two dates
+  downgrades  licences downgraded to B or removed between two dates
+  lookup      match a CSV or JSON file of employers against the register
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "compare":
+		runCompare(os.Args[2:])
+	case "downgrades":
+		runDowngrades(os.Args[2:])
+	case "lookup":
+		runLookup(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// connect loads configuration and returns a data reader for the main database.
+func connect() (*database.PostgresDataReader, func()) {
+	cfg, err := config.Load("config.yaml", ".env")
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	pool, err := database.Connect(cfg.Database.ConnectionString())
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	return database.NewPostgresDataReader(pool), pool.Close
+}
+
+// parseDate parses a required YYYY-MM-DD flag value.
+func parseDate(name, value string) time.Time {
+	if value == "" {
+		log.Fatalf("missing required flag: -%s", name)
+	}
+	d, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		log.Fatalf("invalid -%s: must be a date (YYYY-MM-DD)", name)
+	}
+	return d
+}
+
+func writeJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatalf("failed to write output: %v", err)
+	}
+}
+
+func runCompare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fromFlag := fs.String("from", "", "start date (YYYY-MM-DD)")
+	toFlag := fs.String("to", "", "end date (YYYY-MM-DD)")
+	asJSON := fs.Bool("json", false, "write JSON instead of text")
+	fs.Parse(args)
+
+	from := parseDate("from", *fromFlag)
+	to := parseDate("to", *toFlag)
+	if to.Before(from) {
+		log.Fatalf("-to must not be before -from")
+	}
+
+	data, closeDB := connect()
+	defer closeDB()
+
+	cmp, err := data.CompareRegister(context.Background(), database.EndOfDay(from), database.EndOfDay(to))
+	if err != nil {
+		log.Fatalf("compare failed: %v", err)
+	}
+
+	if *asJSON {
+		writeJSON(cmp)
+		return
+	}
+
+	fmt.Printf("Register changes from %s to %s:\n", *fromFlag, *toFlag)
+	fmt.Printf("  Organisations added:   %d\n", cmp.Summary.OrganisationsAdded)
+	fmt.Printf("  Organisations removed: %d\n", cmp.Summary.OrganisationsRemoved)
+	fmt.Printf("  Organisations changed: %d\n", cmp.Summary.OrganisationsChanged)
+	fmt.Printf("  Downgrades (A→B):      %d\n", cmp.Summary.Downgrades)
+	fmt.Printf("  Upgrades (B→A):        %d\n", cmp.Summary.Upgrades)
+	fmt.Printf("  Routes gained:         %d\n", cmp.Summary.RoutesGained)
+	fmt.Printf("  Routes lost:           %d\n", cmp.Summary.RoutesLost)
+
+	for _, d := range cmp.Organisations {
+		fmt.Printf("\n%s (%s, %s): %s\n", d.Name, d.TownCity, d.County, d.Change)
+		for _, l := range d.RoutesGained {
+			fmt.Printf("  + %s / %s (%s)\n", l.LicenceType, l.Route, l.Rating)
+		}
+		for _, l := range d.RoutesLost {
+			fmt.Printf("  - %s / %s (%s)\n", l.LicenceType, l.Route, l.Rating)
+		}
+		for _, rc := range d.RatingChanges {
+			fmt.Printf("  ~ %s / %s: %s → %s\n", rc.LicenceType, rc.Route, rc.From, rc.To)
+		}
+	}
+}
+
+func runDowngrades(args []string) {
+	fs := flag.NewFlagSet("downgrades", flag.ExitOnError)
+	fromFlag := fs.String("from", "", "first day (YYYY-MM-DD)")
+	toFlag := fs.String("to", "", "last day (YYYY-MM-DD)")
+	routeFlag := fs.String("route", "", "only this route")
+	countyFlag := fs.String("county", "", "only organisations in this county")
+	asJSON := fs.Bool("json", false, "write JSON instead of text")
+	fs.Parse(args)
+
+	from := parseDate("from", *fromFlag)
+	to := parseDate("to", *toFlag)
+	if to.Before(from) {
+		log.Fatalf("-to must not be before -from")
+	}
+
+	data, closeDB := connect()
+	defer closeDB()
+
+	report, err := data.GetDowngradeReport(context.Background(), database.DowngradeQuery{
+		From: from, To: database.EndOfDay(to), Route: *routeFlag, County: *countyFlag,
+	})
+	if err != nil {
+		log.Fatalf("downgrade report failed: %v", err)
+	}
+
+	if *asJSON {
+		writeJSON(report)
+		return
+	}
+
+	fmt.Printf("Downgrades and removals from %s to %s:\n", *fromFlag, *toFlag)
+	fmt.Printf("  Downgrades (A→B):      %d\n", report.Summary.Downgrades)
+	fmt.Printf("  Licences removed:      %d\n", report.Summary.LicencesRemoved)
+	fmt.Printf("  Organisations removed: %d (%d moved)\n", report.Summary.OrganisationsRemoved, report.Summary.OrganisationsMoved)
+
+	for _, e := range report.Entries {
+		run := "-"
+		if e.SyncRunID != nil {
+			run = fmt.Sprintf("#%d", *e.SyncRunID)
+		}
+		kind := e.Kind
+		if e.Moved {
+			kind += " (moved)"
+		}
+		fmt.Printf("\n%s  run %s  %s\n", e.OccurredAt.Format(time.RFC3339), run, kind)
+		fmt.Printf("  %s (%s, %s)\n", e.OrganisationName, e.TownCity, e.County)
+		switch {
+		case e.Kind == database.ReportDowngrade:
+			fmt.Printf("  ~ %s / %s: %s → %s\n", e.LicenceType, e.Route, e.PreviousRating, e.Rating)
+		case e.LicenceID != nil:
+			fmt.Printf("  - %s / %s (%s)\n", e.LicenceType, e.Route, e.Rating)
+		}
+	}
+}
+
+func runLookup(args []string) {
+	fs := flag.NewFlagSet("lookup", flag.ExitOnError)
+	inFlag := fs.String("in", "", "employers file (.csv with a header row, or .json)")
+	outFlag := fs.String("out", "", "results file (.csv or .json; default JSON to stdout)")
+	fs.Parse(args)
+
+	if *inFlag == "" {
+		log.Fatalf("missing required flag: -in")
+	}
+	in, err := os.Open(*inFlag)
+	if err != nil {
+		log.Fatalf("failed to open input: %v", err)
+	}
+	defer in.Close()
+
+	var inputs []database.LookupInput
+	if isCSV(*inFlag) {
+		inputs, err = lookup.ReadCSV(in)
+	} else {
+		inputs, err = lookup.ReadJSON(in)
+	}
+	if err != nil {
+		log.Fatalf("failed to read %s: %v", *inFlag, err)
+	}
+
+	data, closeDB := connect()
+	defer closeDB()
+
+	resp, err := data.Lookup(context.Background(), inputs)
+	if err != nil {
+		log.Fatalf("lookup failed: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "%d employers: %d matched, %d possible, %d not found\n",
+		len(resp.Results), resp.Summary.Matched, resp.Summary.Possible, resp.Summary.NotFound)
+
+	if *outFlag == "" {
+		writeJSON(resp)
+		return
+	}
+	out, err := os.Create(*outFlag)
+	if err != nil {
+		log.Fatalf("failed to create output: %v", err)
+	}
+	defer out.Close()
+
+	if isCSV(*outFlag) {
+		err = lookup.WriteCSV(out, resp.Results)
+	} else {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(resp)
+	}
+	if err != nil {
+		log.Fatalf("failed to write %s: %v", *outFlag, err)
+	}
+}
+
+// isCSV reports whether a file name has a .csv extension.
+func isCSV(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".csv")
+}
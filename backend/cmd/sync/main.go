@@ -27,7 +27,9 @@ func main() {
 	licences := sync.NewPostgresLicenceRepository(pool)
 	cfgRepo := sync.NewPostgresConfigRepository(pool)
 	runs := sync.NewPostgresSyncRunRepository(pool)
-	syncer := sync.NewSyncer(fetcher, orgs, licences, cfgRepo, runs)
+	snapshots := sync.NewPostgresSnapshotRepository(pool)
+	// Change events are written to the outbox and delivered by the API server
+	syncer := sync.NewSyncer(fetcher, orgs, licences, cfgRepo, runs, snapshots, sync.NewPostgresTransactor(pool), sync.NewPostgresOutboxRepository(pool))
 
 	result, err := syncer.Run(context.Background())
 	if err != nil {
@@ -43,6 +45,6 @@ func main() {
 	fmt.Printf("  Errors:               %d\n", len(result.Errors))
 
 	for i, e := range result.Errors {
-		fmt.Printf("  error %d: %v\n", i+1, e)
+		fmt.Printf("  error %d [%s] %s %s %s: %s\n", i+1, e.Stage, e.OrganisationName, e.LicenceType, e.Route, e.Message)
 	}
 }
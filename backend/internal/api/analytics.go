@@ -0,0 +1,34 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"sponsor-tracker/internal/database"
+)
+
+func (s *Server) handleAnalytics(w http.ResponseWriter, r *http.Request) {
+	aq, err := parseAnalyticsInput(r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	analytics, analyticsErr := s.data.GetAnalytics(r.Context(), aq)
+	writeJSON(w, analytics, analyticsErr)
+}
+
+// parseAnalyticsInput extracts group_by, route (the default) or county, and
+// the optional value restricting the result to one group.
+func parseAnalyticsInput(r *http.Request) (database.AnalyticsQuery, error) {
+	q := r.URL.Query()
+	aq := database.AnalyticsQuery{GroupBy: q.Get("group_by"), Value: q.Get("value")}
+	if aq.GroupBy == "" {
+		aq.GroupBy = database.DimensionRoute
+	}
+	if !slices.Contains(database.AnalyticsDimensions, aq.GroupBy) {
+		return database.AnalyticsQuery{}, fmt.Errorf("invalid group_by: must be one of %s", strings.Join(database.AnalyticsDimensions, ", "))
+	}
+	if len(aq.Value) > 200 {
+		return database.AnalyticsQuery{}, fmt.Errorf("value must not exceed 200 characters")
+	}
+	return aq, nil
+}
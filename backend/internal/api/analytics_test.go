@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"sponsor-tracker/internal/database"
+)
+
+func TestParseAnalyticsInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    database.AnalyticsQuery
+		wantErr bool
+	}{
+		{"defaults to route", "", database.AnalyticsQuery{GroupBy: "route"}, false},
+		{"county with value", "group_by=county&value=Kent", database.AnalyticsQuery{GroupBy: "county", Value: "Kent"}, false},
+		{"invalid group_by", "group_by=rating", database.AnalyticsQuery{}, true},
+		{"value too long", "value=" + strings.Repeat("a", 201), database.AnalyticsQuery{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/api/analytics?"+tt.query, nil)
+			got, err := parseAnalyticsInput(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if got != tt.want { t.Errorf("got %+v, want %+v", got, tt.want) }
+		})
+	}
+}
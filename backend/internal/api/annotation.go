@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"sponsor-tracker/internal/database"
+)
+
+// AnnotationStore manages the team's notes and tags on organisations. Notes
+// and tags are shared by every user. Methods taking an organisation return
+// found false if it does not exist.
+type AnnotationStore interface {
+	ListNotes(ctx context.Context, orgID int) ([]database.Note, bool, error)
+	GetNote(ctx context.Context, orgID, id int) (database.Note, bool, error)
+	AddNote(ctx context.Context, orgID, authorID int, text string) (database.Note, bool, error)
+	EditNote(ctx context.Context, orgID, id int, text string) (database.Note, bool, error)
+	DeleteNote(ctx context.Context, orgID, id int) (bool, error)
+	ListTags(ctx context.Context) ([]database.Tag, error)
+	ListOrganisationTags(ctx context.Context, orgID int) ([]database.OrganisationTag, bool, error)
+	TagOrganisation(ctx context.Context, orgID, userID int, name string) (bool, error)
+	UntagOrganisation(ctx context.Context, orgID int, name string) (bool, error)
+	DeleteTag(ctx context.Context, name string) (bool, error)
+}
+
+// maxNoteLength is the most characters a note may hold.
+const maxNoteLength = 10000
+
+// tagPattern matches a normalised tag name.
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9 _-]{0,49}$`)
+
+// noteInput is the body of note create and edit requests.
+type noteInput struct {
+	Text string `json:"text"`
+}
+
+func (s *Server) handleListNotes(w http.ResponseWriter, r *http.Request) {
+	orgID, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	notes, found, err := s.annotations.ListNotes(r.Context(), orgID)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, notes, err)
+}
+
+func (s *Server) handleAddNote(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	orgID, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	text, err := parseNoteInput(w, r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+
+	note, found, err := s.annotations.AddNote(r.Context(), orgID, user.ID, text)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	writeCreated(w, note)
+}
+
+// handleEditNote replaces the text of a note. Only its author may edit it.
+func (s *Server) handleEditNote(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	orgID, id, ok := notePath(w, r)
+	if !ok {
+		return
+	}
+	text, err := parseNoteInput(w, r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+
+	note, found, err := s.annotations.GetNote(r.Context(), orgID, id)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	if note.AuthorID == nil || *note.AuthorID != user.ID { http.Error(w, "forbidden", http.StatusForbidden); return }
+
+	note, found, err = s.annotations.EditNote(r.Context(), orgID, id, text)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, note, err)
+}
+
+// handleDeleteNote deletes a note. Its author or an admin may delete it.
+func (s *Server) handleDeleteNote(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	orgID, id, ok := notePath(w, r)
+	if !ok {
+		return
+	}
+	note, found, err := s.annotations.GetNote(r.Context(), orgID, id)
+	if err != nil || !found {
+		writeNoContent(w, found, err)
+		return
+	}
+	if user.Role > 10 && (note.AuthorID == nil || *note.AuthorID != user.ID) { http.Error(w, "forbidden", http.StatusForbidden); return }
+
+	found, err = s.annotations.DeleteNote(r.Context(), orgID, id)
+	writeNoContent(w, found, err)
+}
+
+func (s *Server) handleListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.annotations.ListTags(r.Context())
+	writeJSON(w, tags, err)
+}
+
+func (s *Server) handleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	name, err := parseTagName(r.PathValue("tag"))
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	found, err := s.annotations.DeleteTag(r.Context(), name)
+	writeNoContent(w, found, err)
+}
+
+func (s *Server) handleListOrganisationTags(w http.ResponseWriter, r *http.Request) {
+	orgID, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	tags, found, err := s.annotations.ListOrganisationTags(r.Context(), orgID)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, tags, err)
+}
+
+// handleTagOrganisation adds a tag to an organisation, creating the tag if it
+// is new. Tagging an organisation that already has the tag succeeds.
+func (s *Server) handleTagOrganisation(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	orgID, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	name, err := parseTagName(r.PathValue("tag"))
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	found, err := s.annotations.TagOrganisation(r.Context(), orgID, user.ID, name)
+	writeNoContent(w, found, err)
+}
+
+func (s *Server) handleUntagOrganisation(w http.ResponseWriter, r *http.Request) {
+	orgID, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	name, err := parseTagName(r.PathValue("tag"))
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	found, err := s.annotations.UntagOrganisation(r.Context(), orgID, name)
+	writeNoContent(w, found, err)
+}
+
+// notePath parses the organisation and note IDs of a note path, writing 400
+// and returning false if either is invalid.
+func notePath(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	orgID, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return 0, 0, false }
+	id, err := pathID(r, "note_id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return 0, 0, false }
+	return orgID, id, true
+}
+
+// parseNoteInput decodes a note request body and returns its text, trimmed
+// of surrounding spaces, which must be 1 to maxNoteLength characters.
+func parseNoteInput(w http.ResponseWriter, r *http.Request) (string, error) {
+	var input noteInput
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&input); err != nil {
+		return "", fmt.Errorf("invalid request body")
+	}
+	text := strings.TrimSpace(input.Text)
+	if text == "" || len([]rune(text)) > maxNoteLength {
+		return "", fmt.Errorf("text must be between 1 and %d characters", maxNoteLength)
+	}
+	return text, nil
+}
+
+// parseTagName normalises a tag name to lower case without surrounding
+// spaces. It must then be 1 to 50 characters of letters, digits, spaces,
+// hyphens and underscores, starting with a letter or digit.
+func parseTagName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !tagPattern.MatchString(name) {
+		return "", fmt.Errorf("invalid tag %q: must be 1 to 50 letters, digits, spaces, hyphens or underscores", name)
+	}
+	return name, nil
+}
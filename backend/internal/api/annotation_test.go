@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sponsor-tracker/internal/database"
+)
+
+// fakeAnnotations is an in-memory AnnotationStore for organisation 1.
+type fakeAnnotations struct {
+	notes map[int]database.Note
+	tags  map[string]bool
+}
+
+func (f *fakeAnnotations) ListNotes(_ context.Context, orgID int) ([]database.Note, bool, error) {
+	out := []database.Note{}
+	for _, n := range f.notes {
+		out = append(out, n)
+	}
+	return out, orgID == 1, nil
+}
+
+func (f *fakeAnnotations) GetNote(_ context.Context, orgID, id int) (database.Note, bool, error) {
+	n, ok := f.notes[id]
+	return n, ok && orgID == 1, nil
+}
+
+func (f *fakeAnnotations) AddNote(_ context.Context, orgID, authorID int, text string) (database.Note, bool, error) {
+	if orgID != 1 { return database.Note{}, false, nil }
+	n := database.Note{ID: len(f.notes) + 1, OrganisationID: orgID, AuthorID: &authorID, Text: text}
+	f.notes[n.ID] = n
+	return n, true, nil
+}
+
+func (f *fakeAnnotations) EditNote(ctx context.Context, orgID, id int, text string) (database.Note, bool, error) {
+	n, ok, _ := f.GetNote(ctx, orgID, id)
+	if !ok { return database.Note{}, false, nil }
+	n.History = append(n.History, database.NoteRevision{Text: n.Text})
+	n.Text = text
+	f.notes[id] = n
+	return n, true, nil
+}
+
+func (f *fakeAnnotations) DeleteNote(ctx context.Context, orgID, id int) (bool, error) {
+	_, ok, _ := f.GetNote(ctx, orgID, id)
+	if ok { delete(f.notes, id) }
+	return ok, nil
+}
+
+func (f *fakeAnnotations) ListTags(context.Context) ([]database.Tag, error) { return nil, nil }
+
+func (f *fakeAnnotations) ListOrganisationTags(_ context.Context, orgID int) ([]database.OrganisationTag, bool, error) {
+	return nil, orgID == 1, nil
+}
+
+func (f *fakeAnnotations) TagOrganisation(_ context.Context, orgID, _ int, name string) (bool, error) {
+	if orgID == 1 { f.tags[name] = true }
+	return orgID == 1, nil
+}
+
+func (f *fakeAnnotations) UntagOrganisation(_ context.Context, orgID int, name string) (bool, error) {
+	ok := orgID == 1 && f.tags[name]
+	delete(f.tags, name)
+	return ok, nil
+}
+
+func (f *fakeAnnotations) DeleteTag(_ context.Context, name string) (bool, error) {
+	ok := f.tags[name]
+	delete(f.tags, name)
+	return ok, nil
+}
+
+func TestNotes(t *testing.T) {
+	bobID := 4
+	store := &fakeAnnotations{notes: map[int]database.Note{
+		1: {ID: 1, OrganisationID: 1, AuthorID: &bobID, Text: "Bob's note"},
+	}, tags: map[string]bool{}}
+	auth := &fakeAuth{authUser: database.User{ID: 3, Username: "alice", Role: 50}}
+	s := NewServer(nil, &fakeData{}, auth, nil, nil, nil, nil, nil, store, nil).Routes()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Cookie", "session_token=tok")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/api/organisations/1/notes", `{"text": "  Called HR  "}`); w.Code != http.StatusCreated { t.Fatalf("add status = %d: %s", w.Code, w.Body) }
+	if n := store.notes[2]; n.Text != "Called HR" || *n.AuthorID != 3 { t.Errorf("added %+v", n) }
+	if w := do(http.MethodPost, "/api/organisations/1/notes", `{"text": " "}`); w.Code != http.StatusBadRequest { t.Errorf("empty note status = %d", w.Code) }
+	if w := do(http.MethodPost, "/api/organisations/2/notes", `{"text": "x"}`); w.Code != http.StatusNotFound { t.Errorf("missing organisation status = %d", w.Code) }
+
+	if w := do(http.MethodPut, "/api/organisations/1/notes/2", `{"text": "Called HR twice"}`); w.Code != http.StatusOK { t.Fatalf("edit status = %d: %s", w.Code, w.Body) }
+	if n := store.notes[2]; n.Text != "Called HR twice" || len(n.History) != 1 { t.Errorf("edited %+v", n) }
+
+	// Only the author may edit; the author or an admin may delete
+	if w := do(http.MethodPut, "/api/organisations/1/notes/1", `{"text": "Mine now"}`); w.Code != http.StatusForbidden { t.Errorf("edit other's note status = %d", w.Code) }
+	if w := do(http.MethodDelete, "/api/organisations/1/notes/1", ""); w.Code != http.StatusForbidden { t.Errorf("delete other's note status = %d", w.Code) }
+	auth.authUser.Role = 10
+	if w := do(http.MethodDelete, "/api/organisations/1/notes/1", ""); w.Code != http.StatusNoContent { t.Errorf("admin delete status = %d", w.Code) }
+	if w := do(http.MethodDelete, "/api/organisations/1/notes/9", ""); w.Code != http.StatusNotFound { t.Errorf("delete missing note status = %d", w.Code) }
+}
+
+func TestTags(t *testing.T) {
+	store := &fakeAnnotations{notes: map[int]database.Note{}, tags: map[string]bool{}}
+	auth := &fakeAuth{authUser: database.User{ID: 3, Username: "alice", Role: 50}}
+	s := NewServer(nil, &fakeData{}, auth, nil, nil, nil, nil, nil, store, nil).Routes()
+	do := func(method, path string) int {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Cookie", "session_token=tok")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := do(http.MethodPut, "/api/organisations/1/tags/%20Key%20Client"); code != http.StatusNoContent { t.Fatalf("tag status = %d", code) }
+	if !store.tags["key client"] { t.Errorf("tags = %v, want normalised tag", store.tags) }
+	if code := do(http.MethodPut, "/api/organisations/1/tags/a%2Fb"); code != http.StatusBadRequest { t.Errorf("invalid tag status = %d", code) }
+	if code := do(http.MethodPut, "/api/organisations/2/tags/x"); code != http.StatusNotFound { t.Errorf("missing organisation status = %d", code) }
+	if code := do(http.MethodDelete, "/api/tags/key%20client"); code != http.StatusForbidden { t.Errorf("non-admin delete tag status = %d", code) }
+	if code := do(http.MethodDelete, "/api/organisations/1/tags/key%20client"); code != http.StatusNoContent { t.Errorf("untag status = %d", code) }
+}
+
+func TestParseFilter_Tags(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/data?tag=Priority&tag=key+client", nil)
+	f, err := parseFilter(r)
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if len(f.Tags) != 2 || f.Tags[0] != "priority" || f.Tags[1] != "key client" { t.Errorf("tags = %q", f.Tags) }
+
+	r = httptest.NewRequest(http.MethodGet, "/api/data?tag=", nil)
+	if _, err := parseFilter(r); err == nil { t.Error("empty tag: expected error") }
+}
@@ -2,8 +2,16 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
 	"time"
+
+	"sponsor-tracker/internal/auth"
 )
 
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -15,7 +23,10 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
-	token, err := s.auth.Login(r.Context(), input.Username, input.Password)
+	token, err := s.auth.Login(r.Context(), input.Username, input.Password, s.clientIP(r))
+	if writeThrottled(w, err) {
+		return
+	}
 	if err != nil {
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
@@ -30,6 +41,58 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// writeThrottled writes 429 Too Many Requests with a Retry-After header and
+// returns true if err is an *auth.ThrottledError.
+func writeThrottled(w http.ResponseWriter, err error) bool {
+	var throttled *auth.ThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	http.Error(w, throttled.Error(), http.StatusTooManyRequests)
+	return true
+}
+
+// clientIP returns the IP address the request came from. X-Forwarded-For is
+// only read when the connection is from a trusted proxy, as any client could
+// set it: the client is the last address in it not itself a trusted proxy.
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !s.trustedProxy(host) {
+		return host
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+		if !s.trustedProxy(addr) {
+			return addr
+		}
+		host = addr
+	}
+	return host
+}
+
+// trustedProxy reports whether addr is one of the server's trusted proxies.
+func (s *Server) trustedProxy(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range s.proxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("session_token")
 	if err != nil {
@@ -68,3 +131,31 @@ func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
 		Role     int    `json:"role"`
 	}{user.ID, user.Username, user.Role}, nil)
 }
+
+// handleChangePassword changes the caller's password, given their current
+// one, and logs out all their other sessions. Wrong current passwords are
+// throttled like failed logins.
+func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	cookie, _ := r.Cookie("session_token")
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&input); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	err := s.auth.ChangePassword(r.Context(), user.ID, cookie.Value, input.CurrentPassword, input.NewPassword, s.clientIP(r))
+	if writeThrottled(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, auth.ErrWrongPassword):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, auth.ErrWeakPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeNoContent(w, true, err)
+	}
+}
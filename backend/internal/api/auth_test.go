@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"strings"
 	"testing"
+	"time"
 
+	"sponsor-tracker/internal/auth"
 	"sponsor-tracker/internal/database"
 )
 
@@ -18,9 +22,13 @@ type fakeAuth struct {
 	logoutErr  error
 	authUser   database.User
 	authErr    error
+	changeErr  error
+	changed    string // token passed to the last ChangePassword
+	loginIP    string // client IP passed to the last Login
 }
 
-func (f *fakeAuth) Login(_ context.Context, _, _ string) (string, error) {
+func (f *fakeAuth) Login(_ context.Context, _, _, clientIP string) (string, error) {
+	f.loginIP = clientIP
 	return f.loginToken, f.loginErr
 }
 
@@ -32,14 +40,71 @@ func (f *fakeAuth) Authenticate(_ context.Context, _ string) (database.User, err
 	return f.authUser, f.authErr
 }
 
-type fakeData struct{}
+func (f *fakeAuth) ChangePassword(_ context.Context, _ int, token, _, _, _ string) error {
+	f.changed = token
+	return f.changeErr
+}
+
+type fakeData struct {
+	exportRows []database.ExportRow
+	exportErr  error
+}
 
-func (f *fakeData) GetAll(_ context.Context, _, _ int, _ string) (*database.DataResponse, error) {
+func (f *fakeData) GetAll(_ context.Context, _ database.DataQuery) (*database.DataResponse, error) {
 	return &database.DataResponse{}, nil
 }
 
+func (f *fakeData) Suggest(_ context.Context, _ string, _ int) (*database.Suggestions, error) {
+	return &database.Suggestions{}, nil
+}
+
+func (f *fakeData) Lookup(_ context.Context, inputs []database.LookupInput) (*database.LookupResponse, error) {
+	results := make([]database.LookupResult, len(inputs))
+	for i, in := range inputs {
+		results[i] = database.LookupResult{Row: i + 1, Input: in, Status: database.LookupNotFound, Matches: []database.LookupMatch{}}
+	}
+	return &database.LookupResponse{Summary: database.LookupSummary{NotFound: len(inputs)}, Results: results}, nil
+}
+
+func (f *fakeData) Export(_ context.Context, _ database.OrganisationFilter, _ database.OrganisationSort, fn func(database.ExportRow) error) error {
+	for _, row := range f.exportRows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return f.exportErr
+}
+
+func (f *fakeData) GetStats(_ context.Context, _ database.StatsQuery) (*database.Stats, error) {
+	return &database.Stats{}, nil
+}
+
+func (f *fakeData) GetDowngradeReport(_ context.Context, dq database.DowngradeQuery) (*database.DowngradeReport, error) {
+	return &database.DowngradeReport{From: dq.From, To: dq.To, Entries: []database.DowngradeEntry{}}, nil
+}
+
+func (f *fakeData) GetAnalytics(_ context.Context, aq database.AnalyticsQuery) (*database.Analytics, error) {
+	return &database.Analytics{GroupBy: aq.GroupBy, Groups: []database.GroupAnalytics{}}, nil
+}
+
+func (f *fakeData) GetChanges(_ context.Context, _ database.ChangeQuery) (*database.ChangesResponse, error) {
+	return &database.ChangesResponse{}, nil
+}
+
+func (f *fakeData) GetSyncRuns(_ context.Context, _, _ int) (*database.SyncRunsResponse, error) {
+	return &database.SyncRunsResponse{}, nil
+}
+
+func (f *fakeData) GetSyncRun(_ context.Context, _ int) (database.SyncRun, bool, error) {
+	return database.SyncRun{}, false, nil
+}
+
+func (f *fakeData) CompareRegister(_ context.Context, _, _ time.Time) (*database.RegisterComparison, error) {
+	return &database.RegisterComparison{}, nil
+}
+
 func newTestServer(a *fakeAuth) *Server {
-	return NewServer(nil, &fakeData{}, a)
+	return NewServer(nil, &fakeData{}, a, newFakeWatchlists(), nil, nil, nil, nil, nil, nil)
 }
 
 func TestHandleLogin(t *testing.T) {
@@ -49,6 +114,7 @@ func TestHandleLogin(t *testing.T) {
 		auth       *fakeAuth
 		wantCode   int
 		wantCookie bool
+		wantRetry  string
 	}{
 		{
 			name:       "success",
@@ -69,12 +135,20 @@ func TestHandleLogin(t *testing.T) {
 			auth:     &fakeAuth{},
 			wantCode: http.StatusBadRequest,
 		},
+		{
+			name:      "throttled",
+			body:      `{"username":"alice","password":"correct"}`,
+			auth:      &fakeAuth{loginErr: fmt.Errorf("login: %w", &auth.ThrottledError{RetryAfter: 1500 * time.Millisecond})},
+			wantCode:  http.StatusTooManyRequests,
+			wantRetry: "2",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := newTestServer(tt.auth)
 			r := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(tt.body))
+			r.RemoteAddr = "192.0.2.1:1234"
 			w := httptest.NewRecorder()
 			s.handleLogin(w, r)
 
@@ -85,6 +159,41 @@ func TestHandleLogin(t *testing.T) {
 			if hasCookie != tt.wantCookie {
 				t.Errorf("hasCookie = %v, want %v", hasCookie, tt.wantCookie)
 			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetry {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetry)
+			}
+			if tt.wantCode != http.StatusBadRequest && tt.auth.loginIP != "192.0.2.1" {
+				t.Errorf("client IP = %q, want 192.0.2.1", tt.auth.loginIP)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	s := newTestServer(&fakeAuth{})
+	s.TrustProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")})
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"untrusted proxy", "192.0.2.1:1234", []string{"198.51.100.7"}, "192.0.2.1"},
+		{"trusted proxy", "10.0.0.5:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"spoofed entries ignored", "10.0.0.5:1234", []string{"203.0.113.9, 198.51.100.7"}, "198.51.100.7"},
+		{"chain of trusted proxies", "[::1]:1234", []string{"198.51.100.7, 10.1.2.3", "10.0.0.6"}, "198.51.100.7"},
+		{"trusted proxy without header", "10.0.0.5:1234", nil, "10.0.0.5"},
+		{"only trusted proxies", "10.0.0.5:1234", []string{"10.0.0.6"}, "10.0.0.6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, f := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", f)
+			}
+			if got := s.clientIP(r); got != tt.want { t.Errorf("clientIP = %q, want %q", got, tt.want) }
 		})
 	}
 }
@@ -192,6 +301,70 @@ func TestHandleMe(t *testing.T) {
 	}
 }
 
+func TestHandleChangePassword(t *testing.T) {
+	alice := database.User{ID: 1, Username: "alice", Role: 50}
+
+	tests := []struct {
+		name     string
+		body     string
+		auth     *fakeAuth
+		wantCode int
+	}{
+		{
+			name:     "changed",
+			body:     `{"current_password": "correct horse", "new_password": "battery staple"}`,
+			auth:     &fakeAuth{authUser: alice},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "wrong current password",
+			body:     `{"current_password": "wrong", "new_password": "battery staple"}`,
+			auth:     &fakeAuth{authUser: alice, changeErr: auth.ErrWrongPassword},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "throttled",
+			body:     `{"current_password": "wrong", "new_password": "battery staple"}`,
+			auth:     &fakeAuth{authUser: alice, changeErr: &auth.ThrottledError{RetryAfter: time.Minute}},
+			wantCode: http.StatusTooManyRequests,
+		},
+		{
+			name:     "weak new password",
+			body:     `{"current_password": "correct horse", "new_password": "password"}`,
+			auth:     &fakeAuth{authUser: alice, changeErr: fmt.Errorf("%w: too common", auth.ErrWeakPassword)},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid body",
+			body:     `not json`,
+			auth:     &fakeAuth{authUser: alice},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "store error",
+			body:     `{"current_password": "correct horse", "new_password": "battery staple"}`,
+			auth:     &fakeAuth{authUser: alice, changeErr: errors.New("db down")},
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/auth/password", strings.NewReader(tt.body))
+			r.Header.Set("Cookie", "session_token=tok")
+			w := httptest.NewRecorder()
+			newTestServer(tt.auth).Routes().ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCode == http.StatusNoContent && tt.auth.changed != "tok" {
+				t.Errorf("kept session = %q, want the caller's", tt.auth.changed)
+			}
+		})
+	}
+}
+
 func TestRequireRole(t *testing.T) {
 	admin := database.User{ID: 1, Username: "alice", Role: 10}
 	viewer := database.User{ID: 2, Username: "bob", Role: 50}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"sponsor-tracker/internal/database"
+)
+
+func (s *Server) handleDowngradeReport(w http.ResponseWriter, r *http.Request) {
+	dq, err := parseDowngradeInput(r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	report, reportErr := s.data.GetDowngradeReport(r.Context(), dq)
+	writeJSON(w, report, reportErr)
+}
+
+// parseDowngradeInput extracts the required from/to dates and the optional
+// route and county filters. The window runs from the start of from to the end
+// of to (UTC), so both days are included. It may not exceed 3660 days.
+func parseDowngradeInput(r *http.Request) (database.DowngradeQuery, error) {
+	from, err := extractDate(r, "from")
+	if err != nil { return database.DowngradeQuery{}, err }
+	to, err := extractDate(r, "to")
+	if err != nil { return database.DowngradeQuery{}, err }
+	if to.Before(from) {
+		return database.DowngradeQuery{}, fmt.Errorf("to must not be before from")
+	}
+	if to.Sub(from) >= 3660*24*time.Hour {
+		return database.DowngradeQuery{}, fmt.Errorf("date range must not exceed 3660 days")
+	}
+
+	q := r.URL.Query()
+	dq := database.DowngradeQuery{From: from, To: database.EndOfDay(to), Route: q.Get("route"), County: q.Get("county")}
+	for _, p := range []struct{ name, value string }{{"route", dq.Route}, {"county", dq.County}} {
+		if len(p.value) > 200 {
+			return database.DowngradeQuery{}, fmt.Errorf("%s must not exceed 200 characters", p.name)
+		}
+	}
+	return dq, nil
+}
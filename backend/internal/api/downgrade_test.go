@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"sponsor-tracker/internal/database"
+)
+
+func TestParseDowngradeInput(t *testing.T) {
+	day := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name    string
+		query   string
+		want    database.DowngradeQuery
+		wantErr bool
+	}{
+		{"window includes both days", "from=2026-03-01&to=2026-03-31", database.DowngradeQuery{From: day(3, 1), To: day(4, 1)}, false},
+		{"single day", "from=2026-03-01&to=2026-03-01", database.DowngradeQuery{From: day(3, 1), To: day(3, 2)}, false},
+		{"filters", "from=2026-03-01&to=2026-03-31&route=Skilled+Worker&county=Kent",
+			database.DowngradeQuery{From: day(3, 1), To: day(4, 1), Route: "Skilled Worker", County: "Kent"}, false},
+		{"missing to", "from=2026-03-01", database.DowngradeQuery{}, true},
+		{"to before from", "from=2026-03-01&to=2026-02-01", database.DowngradeQuery{}, true},
+		{"range too long", "from=2010-01-01&to=2026-03-01", database.DowngradeQuery{}, true},
+		{"county too long", "from=2026-03-01&to=2026-03-31&county=" + strings.Repeat("a", 201), database.DowngradeQuery{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/api/reports/downgrades?"+tt.query, nil)
+			got, err := parseDowngradeInput(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if got != tt.want { t.Errorf("got %+v, want %+v", got, tt.want) }
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"sponsor-tracker/internal/database"
+	"sponsor-tracker/internal/export"
+)
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	format, filter, sort, err := parseExportInput(r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+
+	date := time.Now().UTC()
+	if filter.AsOf != nil {
+		date = filter.AsOf.Add(-time.Nanosecond)
+	}
+	// Set before the writer is created, as it may start writing the file
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="register-%s.%s"`, date.Format(time.DateOnly), format))
+	cw := &countingWriter{w: w}
+	ew, err := export.NewWriter(format, cw)
+	if err == nil {
+		err = s.data.Export(r.Context(), filter, sort, ew.Write)
+	}
+	if err == nil {
+		err = ew.Close()
+	}
+	if err != nil {
+		slog.Error("export failed", "error", err, "bytes_written", cw.n)
+		// Once streaming has started the status is sent; the client sees a truncated file
+		if cw.n == 0 {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// parseExportInput extracts the export format and the same filter and sort
+// parameters as /api/data. format is csv (default), xlsx or ndjson.
+func parseExportInput(r *http.Request) (string, database.OrganisationFilter, database.OrganisationSort, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if !slices.Contains(export.Formats, format) {
+		return "", database.OrganisationFilter{}, database.OrganisationSort{}, fmt.Errorf("invalid format: must be one of %s", strings.Join(export.Formats, ", "))
+	}
+	filter, err := parseFilter(r)
+	if err != nil { return "", database.OrganisationFilter{}, database.OrganisationSort{}, err }
+	sort, err := parseDataSort(r, filter)
+	if err != nil { return "", database.OrganisationFilter{}, database.OrganisationSort{}, err }
+	return format, filter, sort, nil
+}
+
+// countingWriter counts the bytes written through it, so a handler can tell
+// whether a response has started.
+type countingWriter struct {
+	w http.ResponseWriter
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sponsor-tracker/internal/database"
+)
+
+func TestHandleExport(t *testing.T) {
+	rows := []database.ExportRow{{OrganisationID: 1, Name: "Acme Ltd", LicenceID: 10, LicenceType: "Worker", Route: "Skilled Worker", Rating: "A rating"}}
+
+	tests := []struct {
+		name            string
+		query           string
+		data            *fakeData
+		wantCode        int
+		wantType        string
+		wantBody        string
+		wantDisposition string
+	}{
+		{"csv by default", "", &fakeData{exportRows: rows}, http.StatusOK, "text/csv", "1,Acme Ltd,,,,,10,Worker", "attachment; filename=\"register-"},
+		{"xlsx", "?format=xlsx", &fakeData{exportRows: rows}, http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "PK", `.xlsx"`},
+		{"ndjson", "?format=ndjson", &fakeData{exportRows: rows}, http.StatusOK, "application/x-ndjson", `"licence_id":10`, ""},
+		{"as_of names the file", "?as_of=2026-02-01", &fakeData{}, http.StatusOK, "text/csv", "organisation_id,", `filename="register-2026-02-01.csv"`},
+		{"invalid format", "?format=pdf", &fakeData{}, http.StatusBadRequest, "", "invalid format", ""},
+		{"invalid filter", "?as_of=soon", &fakeData{}, http.StatusBadRequest, "", "invalid as_of", ""},
+		{"error before streaming", "", &fakeData{exportErr: errors.New("boom")}, http.StatusInternalServerError, "", "internal error", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(nil, tt.data, &fakeAuth{}, nil, nil, nil, nil, nil, nil, nil)
+			r := httptest.NewRequest(http.MethodGet, "/api/export"+tt.query, nil)
+			w := httptest.NewRecorder()
+			s.handleExport(w, r)
+
+			// The headers as sent with the status, not as left after the handler
+			header := w.Result().Header
+			if w.Code != tt.wantCode { t.Errorf("status = %d, want %d", w.Code, tt.wantCode) }
+			if tt.wantType != "" && header.Get("Content-Type") != tt.wantType {
+				t.Errorf("content type = %q, want %q", header.Get("Content-Type"), tt.wantType)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) { t.Errorf("body %q does not contain %q", w.Body.String(), tt.wantBody) }
+			if !strings.Contains(header.Get("Content-Disposition"), tt.wantDisposition) {
+				t.Errorf("disposition = %q, want %q", header.Get("Content-Disposition"), tt.wantDisposition)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"sponsor-tracker/internal/database"
+	"sponsor-tracker/internal/feed"
+)
+
+// FeedStore reads change feeds and manages users' private feed tokens.
+type FeedStore interface {
+	GetRecentChanges(ctx context.Context, fq database.FeedQuery) ([]database.ChangeEvent, error)
+	GetWatchedChanges(ctx context.Context, userID int, fq database.FeedQuery) ([]database.ChangeEvent, error)
+	FindFeedUser(ctx context.Context, token string) (int, bool, error)
+	CreateFeedToken(ctx context.Context, userID int) (string, error)
+	DeleteFeedToken(ctx context.Context, userID int) (bool, error)
+}
+
+// feedToken is the response to a feed token request.
+type feedToken struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+func (s *Server) handleChangesFeed(w http.ResponseWriter, r *http.Request) {
+	fq, err := parseFeedInput(r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	events, err := s.feeds.GetRecentChanges(r.Context(), fq)
+	writeFeed(w, feed.New(feedKey("changes", fq), "Sponsor register changes", requestURL(r), events), err)
+}
+
+func (s *Server) handleWatchlistFeed(w http.ResponseWriter, r *http.Request) {
+	fq, err := parseFeedInput(r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	userID, found, err := s.feeds.FindFeedUser(r.Context(), r.PathValue("token"))
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	var events []database.ChangeEvent
+	if err == nil {
+		events, err = s.feeds.GetWatchedChanges(r.Context(), userID, fq)
+	}
+	key := feedKey("watchlists/"+strconv.Itoa(userID), fq)
+	writeFeed(w, feed.New(key, "Watched sponsor changes", requestURL(r), events), err)
+}
+
+// handleCreateFeedToken issues the caller a new private watchlist feed URL,
+// revoking any previous one.
+func (s *Server) handleCreateFeedToken(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	token, err := s.feeds.CreateFeedToken(r.Context(), user.ID)
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	u := requestBase(r) + "/api/feeds/watchlists/" + token + "/changes.atom"
+	writeCreated(w, feedToken{Token: token, URL: u})
+}
+
+func (s *Server) handleDeleteFeedToken(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	found, err := s.feeds.DeleteFeedToken(r.Context(), user.ID)
+	writeNoContent(w, found, err)
+}
+
+// feedWindow is how far back feeds look for changes.
+const feedWindow = 30 * 24 * time.Hour
+
+// parseFeedInput extracts and validates the feed query parameters. route may
+// be repeated to select several routes; county matches exactly and search
+// matches part of an organisation's name or town, both case-insensitively.
+// limit defaults to 100 and must be between 1 and 500. Feeds cover the
+// changes of the last feedWindow.
+func parseFeedInput(r *http.Request) (database.FeedQuery, error) {
+	q := r.URL.Query()
+	fq := database.FeedQuery{Since: time.Now().Add(-feedWindow), Routes: q["route"], County: q.Get("county"), Search: q.Get("search"), Limit: 100}
+	if len(fq.Routes) > 20 {
+		return database.FeedQuery{}, fmt.Errorf("route must not be given more than 20 times")
+	}
+	for _, p := range append([]string{fq.County, fq.Search}, fq.Routes...) {
+		if len(p) > 200 {
+			return database.FeedQuery{}, fmt.Errorf("route, county and search must not exceed 200 characters")
+		}
+	}
+	if q.Has("limit") {
+		limit, err := extractInt(r, "limit")
+		if err == nil && (limit < 1 || limit > 500) { err = fmt.Errorf("limit must be between 1 and 500") }
+		if err != nil { return database.FeedQuery{}, err }
+		fq.Limit = limit
+	}
+	return fq, nil
+}
+
+// feedKey identifies a feed by its name and filters, in a canonical order so
+// that the feed ID does not depend on how the query string was written.
+func feedKey(name string, fq database.FeedQuery) string {
+	v := url.Values{}
+	if len(fq.Routes) > 0 {
+		routes := slices.Clone(fq.Routes)
+		slices.Sort(routes)
+		v["route"] = slices.Compact(routes)
+	}
+	if fq.County != "" {
+		v.Set("county", fq.County)
+	}
+	if fq.Search != "" {
+		v.Set("search", fq.Search)
+	}
+	if len(v) == 0 {
+		return name
+	}
+	return name + "?" + v.Encode()
+}
+
+// requestBase returns the scheme and host the request was made to.
+func requestBase(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// requestURL returns the absolute URL of the request.
+func requestURL(r *http.Request) string {
+	return requestBase(r) + r.URL.RequestURI()
+}
+
+// writeFeed writes f as an Atom document, or 500 if err is set.
+func writeFeed(w http.ResponseWriter, f feed.Feed, err error) {
+	if err != nil {
+		slog.Error("request failed", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", feed.ContentType)
+	if err := feed.Write(w, f); err != nil {
+		slog.Error("failed to write feed", "error", err)
+	}
+}
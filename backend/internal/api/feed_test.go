@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"sponsor-tracker/internal/database"
+)
+
+// fakeFeeds is an in-memory FeedStore with one token per user.
+type fakeFeeds struct {
+	events  []database.ChangeEvent
+	tokens  map[string]int
+	query   database.FeedQuery
+	watcher int
+}
+
+func (f *fakeFeeds) GetRecentChanges(_ context.Context, fq database.FeedQuery) ([]database.ChangeEvent, error) {
+	f.query = fq
+	return f.events, nil
+}
+
+func (f *fakeFeeds) GetWatchedChanges(_ context.Context, userID int, fq database.FeedQuery) ([]database.ChangeEvent, error) {
+	f.query, f.watcher = fq, userID
+	return f.events, nil
+}
+
+func (f *fakeFeeds) FindFeedUser(_ context.Context, token string) (int, bool, error) {
+	id, ok := f.tokens[token]
+	return id, ok, nil
+}
+
+func (f *fakeFeeds) CreateFeedToken(_ context.Context, userID int) (string, error) {
+	f.tokens["tok-"+strconv.Itoa(userID)] = userID
+	return "tok-" + strconv.Itoa(userID), nil
+}
+
+func (f *fakeFeeds) DeleteFeedToken(_ context.Context, userID int) (bool, error) {
+	_, ok := f.tokens["tok-"+strconv.Itoa(userID)]
+	delete(f.tokens, "tok-"+strconv.Itoa(userID))
+	return ok, nil
+}
+
+func newFeedServer(feeds *fakeFeeds) *Server {
+	alice := database.User{ID: 3, Username: "alice", Role: 50}
+	return NewServer(nil, &fakeData{}, &fakeAuth{authUser: alice}, nil, nil, nil, feeds, nil, nil, nil)
+}
+
+func TestChangesFeed(t *testing.T) {
+	feeds := &fakeFeeds{events: []database.ChangeEvent{
+		{EventType: database.EventOrganisationAdded, OccurredAt: time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC), OrganisationID: 8, OrganisationName: "Beta Ltd"},
+	}}
+	r := httptest.NewRequest(http.MethodGet, "/api/feeds/changes.atom?search=beta&route=Skilled+Worker&county=Kent&route=Scale-up&limit=20", nil)
+	w := httptest.NewRecorder()
+	newFeedServer(feeds).Routes().ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK { t.Fatalf("status = %d: %s", w.Code, w.Body) }
+	if ct := w.Header().Get("Content-Type"); ct != "application/atom+xml; charset=utf-8" { t.Errorf("content type = %q", ct) }
+	if since := time.Since(feeds.query.Since); since < feedWindow || since > feedWindow+time.Minute { t.Errorf("since = %v, want %v ago", feeds.query.Since, feedWindow) }
+	feeds.query.Since = time.Time{}
+	want := database.FeedQuery{Routes: []string{"Skilled Worker", "Scale-up"}, County: "Kent", Search: "beta", Limit: 20}
+	if !reflect.DeepEqual(feeds.query, want) { t.Errorf("query = %+v, want %+v", feeds.query, want) }
+	body := w.Body.String()
+	for _, s := range []string{
+		`<id>tag:sponsor-tracker,2026:changes?county=Kent&amp;route=Scale-up&amp;route=Skilled+Worker&amp;search=beta</id>`,
+		`<link rel="self" href="http://example.com/api/feeds/changes.atom?search=beta&amp;route=Skilled+Worker&amp;county=Kent&amp;route=Scale-up&amp;limit=20"`,
+		`<title>Beta Ltd added to the register</title>`,
+	} {
+		if !strings.Contains(body, s) { t.Errorf("feed does not contain %q:\n%s", s, body) }
+	}
+}
+
+func TestParseFeedInput(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    database.FeedQuery
+		wantErr string
+	}{
+		{"", database.FeedQuery{Limit: 100}, ""},
+		{"limit=500", database.FeedQuery{Limit: 500}, ""},
+		{"limit=0", database.FeedQuery{}, "limit must be between 1 and 500"},
+		{"limit=x", database.FeedQuery{}, "invalid limit"},
+		{"search=" + strings.Repeat("a", 201), database.FeedQuery{}, "must not exceed 200 characters"},
+		{strings.Repeat("route=a&", 21), database.FeedQuery{}, "more than 20 times"},
+	}
+	for _, tt := range tests {
+		got, err := parseFeedInput(httptest.NewRequest(http.MethodGet, "/api/feeds/changes.atom?"+tt.query, nil))
+		got.Since = time.Time{}
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) { t.Errorf("%q: err = %v, want containing %q", tt.query, err, tt.wantErr) }
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) { t.Errorf("%q: got %+v, %v; want %+v", tt.query, got, err, tt.want) }
+	}
+}
+
+func TestWatchlistFeed(t *testing.T) {
+	feeds := &fakeFeeds{tokens: map[string]int{}}
+	s := newFeedServer(feeds).Routes()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/feeds/token", nil)
+	r.Header.Set("Cookie", "session_token=tok")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated { t.Fatalf("create token status = %d", w.Code) }
+	var created feedToken
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.URL != "http://example.com/api/feeds/watchlists/"+created.Token+"/changes.atom" { t.Errorf("url = %q", created.URL) }
+
+	// The feed URL needs no session
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/feeds/watchlists/"+created.Token+"/changes.atom?county=Kent", nil))
+	if w.Code != http.StatusOK { t.Fatalf("feed status = %d: %s", w.Code, w.Body) }
+	if feeds.watcher != 3 || feeds.query.County != "Kent" { t.Errorf("watched changes for user %d with %+v", feeds.watcher, feeds.query) }
+	if !strings.Contains(w.Body.String(), "<id>tag:sponsor-tracker,2026:watchlists/3?county=Kent</id>") { t.Errorf("feed = %s", w.Body) }
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/feeds/watchlists/unknown/changes.atom", nil))
+	if w.Code != http.StatusNotFound { t.Errorf("unknown token status = %d, want 404", w.Code) }
+
+	r = httptest.NewRequest(http.MethodDelete, "/api/feeds/token", nil)
+	r.Header.Set("Cookie", "session_token=tok")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent { t.Errorf("delete token status = %d", w.Code) }
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/feeds/watchlists/"+created.Token+"/changes.atom", nil))
+	if w.Code != http.StatusNotFound { t.Errorf("revoked token status = %d, want 404", w.Code) }
+}
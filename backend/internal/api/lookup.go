@@ -0,0 +1,66 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"sponsor-tracker/internal/database"
+	"sponsor-tracker/internal/lookup"
+)
+
+// Bulk lookup limits per request.
+const (
+	maxLookupBytes = 1 << 20
+	maxLookupRows  = 1000
+)
+
+func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "invalid format: must be json or csv", http.StatusBadRequest)
+		return
+	}
+	inputs, status, err := parseLookupInput(w, r)
+	if err != nil { http.Error(w, err.Error(), status); return }
+
+	resp, err := s.data.Lookup(r.Context(), inputs)
+	if err != nil || format != "csv" {
+		writeJSON(w, resp, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	if err := lookup.WriteCSV(w, resp.Results); err != nil {
+		slog.Error("failed to write lookup CSV", "error", err)
+	}
+}
+
+// parseLookupInput reads the employer list from the request body: CSV when
+// the content type is text/csv, otherwise JSON. On error it also returns the
+// HTTP status to respond with.
+func parseLookupInput(w http.ResponseWriter, r *http.Request) ([]database.LookupInput, int, error) {
+	body := http.MaxBytesReader(w, r.Body, maxLookupBytes)
+
+	var inputs []database.LookupInput
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		inputs, err = lookup.ReadCSV(body)
+	case "", "application/json":
+		inputs, err = lookup.ReadJSON(body)
+	default:
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type: must be text/csv or application/json")
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if len(inputs) == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("no employers to look up")
+	}
+	if len(inputs) > maxLookupRows {
+		return nil, http.StatusBadRequest, fmt.Errorf("at most %d employers per request", maxLookupRows)
+	}
+	return inputs, 0, nil
+}
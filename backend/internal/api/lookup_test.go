@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleLookup(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        string
+		wantCode    int
+		wantBody    string
+	}{
+		{"json names", "", "application/json", `["Acme Ltd", {"name": "Beta Ltd"}]`, http.StatusOK, `"not_found":2`},
+		{"csv in, csv out", "?format=csv", "text/csv; charset=utf-8", "name,town\nAcme Ltd,Dover\n", http.StatusOK, "1,Acme Ltd,Dover,,not_found"},
+		{"csv without name column", "", "text/csv", "town\nDover\n", http.StatusBadRequest, "no name column"},
+		{"empty list", "", "application/json", `[]`, http.StatusBadRequest, "no employers"},
+		{"too many rows", "", "application/json", "[" + strings.Repeat(`"x",`, maxLookupRows) + `"x"]`, http.StatusBadRequest, "at most"},
+		{"unsupported type", "", "application/xml", `<a/>`, http.StatusUnsupportedMediaType, "unsupported"},
+		{"invalid format", "?format=xlsx", "application/json", `["x"]`, http.StatusBadRequest, "invalid format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(&fakeAuth{})
+			r := httptest.NewRequest(http.MethodPost, "/api/lookup"+tt.query, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			s.handleLookup(w, r)
+
+			if w.Code != tt.wantCode { t.Errorf("status = %d, want %d", w.Code, tt.wantCode) }
+			if !strings.Contains(w.Body.String(), tt.wantBody) { t.Errorf("body %q does not contain %q", w.Body.String(), tt.wantBody) }
+		})
+	}
+}
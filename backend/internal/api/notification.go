@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"slices"
+
+	"sponsor-tracker/internal/database"
+)
+
+// NotificationStore manages users' email notification settings.
+type NotificationStore interface {
+	GetSettings(ctx context.Context, userID int) (database.NotificationSettings, bool, error)
+	SaveSettings(ctx context.Context, s database.NotificationSettings) (database.NotificationSettings, error)
+	DeleteSettings(ctx context.Context, userID int) (bool, error)
+}
+
+// notificationInput is the body of a notification settings update.
+type notificationInput struct {
+	Email            string   `json:"email"`
+	WatchAlerts      bool     `json:"watch_alerts"`
+	DailyDigest      bool     `json:"daily_digest"`
+	DigestEventTypes []string `json:"digest_event_types"`
+	DigestRoutes     []string `json:"digest_routes"`
+	DigestCounties   []string `json:"digest_counties"`
+}
+
+func (s *Server) handleGetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	settings, found, err := s.notifications.GetSettings(r.Context(), user.ID)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, settings, err)
+}
+
+func (s *Server) handlePutNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	settings, err := parseNotificationInput(w, r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	settings.UserID = user.ID
+	saved, err := s.notifications.SaveSettings(r.Context(), settings)
+	writeJSON(w, saved, err)
+}
+
+func (s *Server) handleDeleteNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	found, err := s.notifications.DeleteSettings(r.Context(), user.ID)
+	writeNoContent(w, found, err)
+}
+
+// parseNotificationInput decodes and validates a notification settings body.
+// email must be a single address of at most 255 characters. The digest
+// criteria are optional: event types must be change event types, and routes
+// and counties may each hold up to 20 non-empty values of at most 200
+// characters.
+func parseNotificationInput(w http.ResponseWriter, r *http.Request) (database.NotificationSettings, error) {
+	var input notificationInput
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&input); err != nil {
+		return database.NotificationSettings{}, fmt.Errorf("invalid request body")
+	}
+
+	addr, err := mail.ParseAddress(input.Email)
+	if err != nil || addr.Address != input.Email || len(input.Email) > 255 {
+		return database.NotificationSettings{}, fmt.Errorf("email must be a valid address of at most 255 characters")
+	}
+	for _, et := range input.DigestEventTypes {
+		if !slices.Contains(database.EventTypes, et) {
+			return database.NotificationSettings{}, fmt.Errorf("invalid event type %q: must be one of %v", et, database.EventTypes)
+		}
+	}
+	for name, values := range map[string][]string{"digest_routes": input.DigestRoutes, "digest_counties": input.DigestCounties} {
+		if len(values) > 20 {
+			return database.NotificationSettings{}, fmt.Errorf("%s must not hold more than 20 values", name)
+		}
+		for _, v := range values {
+			if v == "" || len(v) > 200 {
+				return database.NotificationSettings{}, fmt.Errorf("each of %s must be between 1 and 200 characters", name)
+			}
+		}
+	}
+
+	return database.NotificationSettings{
+		Email:            input.Email,
+		WatchAlerts:      input.WatchAlerts,
+		DailyDigest:      input.DailyDigest,
+		DigestEventTypes: input.DigestEventTypes,
+		DigestRoutes:     input.DigestRoutes,
+		DigestCounties:   input.DigestCounties,
+	}, nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sponsor-tracker/internal/database"
+)
+
+func TestParseNotificationInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    database.NotificationSettings
+		wantErr string
+	}{
+		{
+			name: "alerts only",
+			body: `{"email":"alice@example.test","watch_alerts":true}`,
+			want: database.NotificationSettings{Email: "alice@example.test", WatchAlerts: true},
+		},
+		{
+			name: "digest with criteria",
+			body: `{"email":"alice@example.test","daily_digest":true,"digest_event_types":["licence_rerated"],"digest_routes":["Skilled Worker"],"digest_counties":["Kent"]}`,
+			want: database.NotificationSettings{Email: "alice@example.test", DailyDigest: true, DigestEventTypes: []string{"licence_rerated"}, DigestRoutes: []string{"Skilled Worker"}, DigestCounties: []string{"Kent"}},
+		},
+		{name: "missing email", body: `{"watch_alerts":true}`, wantErr: "email must be"},
+		{name: "display name", body: `{"email":"Alice <alice@example.test>"}`, wantErr: "email must be"},
+		{name: "unknown event type", body: `{"email":"alice@example.test","digest_event_types":["moved"]}`, wantErr: "invalid event type"},
+		{name: "empty county", body: `{"email":"alice@example.test","digest_counties":[""]}`, wantErr: "digest_counties"},
+		{name: "invalid body", body: `[]`, wantErr: "invalid request body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/api/notifications/settings", strings.NewReader(tt.body))
+			got, err := parseNotificationInput(httptest.NewRecorder(), r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) { t.Errorf("err = %v, want containing %q", err, tt.wantErr) }
+				return
+			}
+			if err != nil { t.Fatalf("unexpected error: %v", err) }
+			if !reflect.DeepEqual(got, tt.want) { t.Errorf("got %+v, want %+v", got, tt.want) }
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"sponsor-tracker/internal/database"
+)
+
+// SavedSearchStore manages the saved searches of authenticated users. Every
+// method is scoped to the given user's searches; found is false for another user's.
+type SavedSearchStore interface {
+	ListSavedSearches(ctx context.Context, userID int) ([]database.SavedSearch, error)
+	GetSavedSearch(ctx context.Context, userID, id int) (database.SavedSearch, bool, error)
+	CreateSavedSearch(ctx context.Context, search database.SavedSearch) (database.SavedSearch, error)
+	UpdateSavedSearch(ctx context.Context, search database.SavedSearch) (database.SavedSearch, bool, error)
+	DeleteSavedSearch(ctx context.Context, userID, id int) (bool, error)
+}
+
+// savedSearchParams are the /api/data parameters a saved search may hold:
+// its filters and sort, but not the page.
+var savedSearchParams = []string{
+	"search", "search_mode", "route", "licence_type", "rating", "county", "town",
+	"has_b_rating", "has_temporary_worker", "tag", "as_of", "sort", "order",
+}
+
+// pageParams are the /api/data parameters selecting a page of results and
+// whether it includes facet counts.
+var pageParams = []string{"from", "to", "limit", "cursor", "facets"}
+
+// savedSearchInput is the body of saved search create and update requests.
+type savedSearchInput struct {
+	Name   string `json:"name"`
+	Query  string `json:"query"`
+	Notify bool   `json:"notify"`
+}
+
+func (s *Server) handleListSavedSearches(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	searches, err := s.searches.ListSavedSearches(r.Context(), user.ID)
+	writeJSON(w, searches, err)
+}
+
+func (s *Server) handleCreateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	search, err := parseSavedSearchInput(w, r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	search.UserID = user.ID
+	if err := s.checkNotify(r.Context(), search); err != nil {
+		writeNotifyError(w, err)
+		return
+	}
+
+	created, err := s.searches.CreateSavedSearch(r.Context(), search)
+	if errors.Is(err, database.ErrSavedSearchNameTaken) { http.Error(w, err.Error(), http.StatusConflict); return }
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	writeCreated(w, created)
+}
+
+func (s *Server) handleGetSavedSearch(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	search, found, err := s.searches.GetSavedSearch(r.Context(), user.ID, id)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, search, err)
+}
+
+func (s *Server) handleUpdateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	search, err := parseSavedSearchInput(w, r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	search.ID, search.UserID = id, user.ID
+	if err := s.checkNotify(r.Context(), search); err != nil {
+		writeNotifyError(w, err)
+		return
+	}
+
+	updated, found, err := s.searches.UpdateSavedSearch(r.Context(), search)
+	if errors.Is(err, database.ErrSavedSearchNameTaken) { http.Error(w, err.Error(), http.StatusConflict); return }
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, updated, err)
+}
+
+func (s *Server) handleDeleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	found, err := s.searches.DeleteSavedSearch(r.Context(), user.ID, id)
+	writeNoContent(w, found, err)
+}
+
+// handleRunSavedSearch runs a saved search as /api/data would, with the page
+// given by the request's from/to or limit/cursor parameters.
+func (s *Server) handleRunSavedSearch(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	search, found, err := s.searches.GetSavedSearch(r.Context(), user.ID, id)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+
+	q, err := url.ParseQuery(search.Query)
+	if err != nil {
+		writeJSON(w, nil, fmt.Errorf("saved search %d: parse query: %w", search.ID, err))
+		return
+	}
+	for _, p := range pageParams {
+		if v, ok := r.URL.Query()[p]; ok {
+			q[p] = v
+		}
+	}
+	dq, err := parseGetDataInput(requestWithQuery(r, q))
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	data, dataErr := s.data.GetAll(r.Context(), dq)
+	writeJSON(w, data, dataErr)
+}
+
+// errNotifyUnavailable is returned by checkNotify when a search cannot notify
+// its owner.
+var errNotifyUnavailable = errors.New("notify requires email alerts")
+
+// checkNotify returns an error wrapping errNotifyUnavailable if a search has
+// notifications on but could not send them: email is not configured on the
+// server, or its owner has no notification settings to send them to.
+func (s *Server) checkNotify(ctx context.Context, search database.SavedSearch) error {
+	if !search.Notify {
+		return nil
+	}
+	if !s.emailEnabled {
+		return fmt.Errorf("%w, which are not enabled on this server", errNotifyUnavailable)
+	}
+	_, found, err := s.notifications.GetSettings(ctx, search.UserID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: set an email address in the notification settings first", errNotifyUnavailable)
+	}
+	return nil
+}
+
+// writeNotifyError writes a checkNotify error as 400 Bad Request, or as an
+// internal error if the settings could not be read.
+func writeNotifyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errNotifyUnavailable) { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	writeJSON(w, nil, err)
+}
+
+// ParseSavedSearchQuery parses a saved search's query into the organisations
+// it selects, as /api/data would.
+func ParseSavedSearchQuery(query string) (database.OrganisationFilter, error) {
+	return parseFilter(&http.Request{URL: &url.URL{RawQuery: query}})
+}
+
+// parseSavedSearchInput decodes and validates a saved search request body.
+// query holds /api/data parameters in URL query form, with or without a
+// leading "?", and is validated as /api/data would validate them. It is
+// saved in canonical form, with the parameters sorted by name. Notify cannot
+// be combined with as_of, whose results never change.
+func parseSavedSearchInput(w http.ResponseWriter, r *http.Request) (database.SavedSearch, error) {
+	var input savedSearchInput
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&input); err != nil {
+		return database.SavedSearch{}, fmt.Errorf("invalid request body")
+	}
+	if err := validateName(input.Name); err != nil {
+		return database.SavedSearch{}, err
+	}
+
+	q, err := url.ParseQuery(strings.TrimPrefix(input.Query, "?"))
+	if err != nil {
+		return database.SavedSearch{}, fmt.Errorf("invalid query")
+	}
+	for _, name := range slices.Sorted(maps.Keys(q)) {
+		if !slices.Contains(savedSearchParams, name) {
+			return database.SavedSearch{}, fmt.Errorf("query parameter %q cannot be saved: must be one of %s", name, strings.Join(savedSearchParams, ", "))
+		}
+	}
+	query := q.Encode()
+	if len(query) > 4000 {
+		return database.SavedSearch{}, fmt.Errorf("query must not exceed 4000 characters")
+	}
+
+	req := requestWithQuery(r, q)
+	filter, err := parseFilter(req)
+	if err != nil {
+		return database.SavedSearch{}, err
+	}
+	if _, err := parseDataSort(req, filter); err != nil {
+		return database.SavedSearch{}, err
+	}
+	if input.Notify && filter.AsOf != nil {
+		return database.SavedSearch{}, fmt.Errorf("notify cannot be used with as_of")
+	}
+	return database.SavedSearch{Name: strings.TrimSpace(input.Name), Query: query, Notify: input.Notify}, nil
+}
+
+// requestWithQuery returns a copy of r with its URL query replaced by q.
+func requestWithQuery(r *http.Request, q url.Values) *http.Request {
+	req := r.Clone(r.Context())
+	req.URL.RawQuery = q.Encode()
+	return req
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sponsor-tracker/internal/database"
+)
+
+// fakeSearches is an in-memory SavedSearchStore.
+type fakeSearches struct {
+	searches map[int]database.SavedSearch
+}
+
+func (f *fakeSearches) ListSavedSearches(_ context.Context, userID int) ([]database.SavedSearch, error) {
+	out := []database.SavedSearch{}
+	for _, s := range f.searches {
+		if s.UserID == userID { out = append(out, s) }
+	}
+	return out, nil
+}
+
+func (f *fakeSearches) GetSavedSearch(_ context.Context, userID, id int) (database.SavedSearch, bool, error) {
+	s, ok := f.searches[id]
+	return s, ok && s.UserID == userID, nil
+}
+
+func (f *fakeSearches) CreateSavedSearch(_ context.Context, search database.SavedSearch) (database.SavedSearch, error) {
+	for _, s := range f.searches {
+		if s.UserID == search.UserID && s.Name == search.Name { return database.SavedSearch{}, database.ErrSavedSearchNameTaken }
+	}
+	search.ID = len(f.searches) + 1
+	f.searches[search.ID] = search
+	return search, nil
+}
+
+func (f *fakeSearches) UpdateSavedSearch(ctx context.Context, search database.SavedSearch) (database.SavedSearch, bool, error) {
+	if _, ok, _ := f.GetSavedSearch(ctx, search.UserID, search.ID); !ok { return database.SavedSearch{}, false, nil }
+	f.searches[search.ID] = search
+	return search, true, nil
+}
+
+func (f *fakeSearches) DeleteSavedSearch(ctx context.Context, userID, id int) (bool, error) {
+	_, ok, _ := f.GetSavedSearch(ctx, userID, id)
+	if ok { delete(f.searches, id) }
+	return ok, nil
+}
+
+// fakeNotifications is a NotificationStore holding the settings of the users in it.
+type fakeNotifications struct {
+	users map[int]bool
+}
+
+func (f *fakeNotifications) GetSettings(_ context.Context, userID int) (database.NotificationSettings, bool, error) {
+	return database.NotificationSettings{UserID: userID, Email: "user@example.test"}, f.users[userID], nil
+}
+
+func (f *fakeNotifications) SaveSettings(_ context.Context, s database.NotificationSettings) (database.NotificationSettings, error) {
+	return s, nil
+}
+
+func (f *fakeNotifications) DeleteSettings(_ context.Context, userID int) (bool, error) {
+	return false, nil
+}
+
+// recordingData is a DataReader that records the query of the last GetAll.
+type recordingData struct {
+	fakeData
+	query database.DataQuery
+}
+
+func (d *recordingData) GetAll(_ context.Context, dq database.DataQuery) (*database.DataResponse, error) {
+	d.query = dq
+	return &database.DataResponse{}, nil
+}
+
+func TestSavedSearches(t *testing.T) {
+	searches := &fakeSearches{searches: map[int]database.SavedSearch{
+		9: {ID: 9, UserID: 4, Name: "Bob's", Query: "county=Kent"},
+	}}
+	data := &recordingData{}
+	alice := database.User{ID: 3, Username: "alice", Role: 50}
+	server := NewServer(nil, data, &fakeAuth{authUser: alice}, nil, nil, &fakeNotifications{users: map[int]bool{3: true}}, nil, searches, nil, nil)
+	server.EnableEmail()
+	s := server.Routes()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Cookie", "session_token=tok")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/saved-searches", `{"name": " Kent SW ", "query": "?route=Skilled+Worker&county=Kent&sort=town", "notify": true}`)
+	if w.Code != http.StatusCreated { t.Fatalf("create status = %d: %s", w.Code, w.Body) }
+	var created database.SavedSearch
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Name != "Kent SW" || created.Query != "county=Kent&route=Skilled+Worker&sort=town" || !created.Notify { t.Errorf("created %+v", created) }
+
+	if w := do(http.MethodPost, "/api/saved-searches", `{"name": "Kent SW", "query": ""}`); w.Code != http.StatusConflict { t.Errorf("duplicate name status = %d", w.Code) }
+
+	// Re-running applies the saved filters and sort to the requested page
+	w = do(http.MethodGet, "/api/saved-searches/2/data?limit=20&county=Leeds", "")
+	if w.Code != http.StatusOK { t.Fatalf("run status = %d: %s", w.Code, w.Body) }
+	if data.query.Filter.County != "Kent" || data.query.Sort.Field != database.SortTown || data.query.Limit != 20 { t.Errorf("query = %+v", data.query) }
+
+	w = do(http.MethodPut, "/api/saved-searches/2", `{"name": "Kent", "query": "county=Kent"}`)
+	if w.Code != http.StatusOK { t.Fatalf("update status = %d: %s", w.Code, w.Body) }
+	if s := searches.searches[2]; s.Name != "Kent" || s.Notify || s.Query != "county=Kent" { t.Errorf("updated %+v", s) }
+
+	// Another user's search is not found
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		if w := do(method, "/api/saved-searches/9", ""); w.Code != http.StatusNotFound { t.Errorf("%s other user's search status = %d", method, w.Code) }
+	}
+	if w := do(http.MethodGet, "/api/saved-searches/9/data?from=1&to=10", ""); w.Code != http.StatusNotFound { t.Errorf("run other user's search status = %d", w.Code) }
+
+	if w := do(http.MethodDelete, "/api/saved-searches/2", ""); w.Code != http.StatusNoContent { t.Errorf("delete status = %d", w.Code) }
+	w = do(http.MethodGet, "/api/saved-searches", "")
+	if strings.TrimSpace(w.Body.String()) != "[]" { t.Errorf("list = %s", w.Body) }
+}
+
+func TestSavedSearches_NotifyRequiresEmail(t *testing.T) {
+	tests := []struct {
+		name         string
+		emailEnabled bool
+		hasSettings  bool
+		want         int
+	}{
+		{"email not enabled", false, true, http.StatusBadRequest},
+		{"no notification settings", true, false, http.StatusBadRequest},
+		{"email enabled with settings", true, true, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alice := database.User{ID: 3, Username: "alice", Role: 50}
+			server := NewServer(nil, &fakeData{}, &fakeAuth{authUser: alice}, nil, nil, &fakeNotifications{users: map[int]bool{3: tt.hasSettings}}, nil, &fakeSearches{searches: map[int]database.SavedSearch{}}, nil, nil)
+			if tt.emailEnabled { server.EnableEmail() }
+			r := httptest.NewRequest(http.MethodPost, "/api/saved-searches", strings.NewReader(`{"name": "Kent", "query": "county=Kent", "notify": true}`))
+			r.Header.Set("Cookie", "session_token=tok")
+			w := httptest.NewRecorder()
+			server.Routes().ServeHTTP(w, r)
+			if w.Code != tt.want { t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body) }
+		})
+	}
+}
+
+func TestParseSavedSearchInput(t *testing.T) {
+	tests := []struct {
+		body    string
+		wantErr string
+	}{
+		{`{"name": "Kent", "query": "county=Kent&has_b_rating=true&as_of=2026-01-31"}`, ""},
+		{`{"name": "", "query": "county=Kent"}`, "name must be between 1 and 100 characters"},
+		{`{"name": "Kent", "query": "county=Kent&from=1&to=50"}`, `query parameter "from" cannot be saved`},
+		{`{"name": "Kent", "query": "county=Kent&countie=Kent"}`, `query parameter "countie" cannot be saved`},
+		{`{"name": "Kent", "query": "county=%zz"}`, "invalid query"},
+		{`{"name": "Kent", "query": "search_mode=exact"}`, "invalid search_mode"},
+		{`{"name": "Kent", "query": "sort=relevance"}`, "sort=relevance requires search"},
+		{`{"name": "Kent", "query": "as_of=2026-01-31", "notify": true}`, "notify cannot be used with as_of"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/saved-searches", strings.NewReader(tt.body))
+		_, err := parseSavedSearchInput(httptest.NewRecorder(), r)
+		if tt.wantErr == "" {
+			if err != nil { t.Errorf("%s: unexpected error: %v", tt.body, err) }
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) { t.Errorf("%s: err = %v, want containing %q", tt.body, err, tt.wantErr) }
+	}
+}
@@ -6,7 +6,11 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"sponsor-tracker/internal/database"
 	"sponsor-tracker/internal/sync"
@@ -14,26 +18,58 @@ import (
 
 // DataReader provides read-only access to the current application state.
 type DataReader interface {
-	GetAll(ctx context.Context, from, to int, search string) (*database.DataResponse, error)
+	GetAll(ctx context.Context, dq database.DataQuery) (*database.DataResponse, error)
+	GetChanges(ctx context.Context, cq database.ChangeQuery) (*database.ChangesResponse, error)
+	CompareRegister(ctx context.Context, from, to time.Time) (*database.RegisterComparison, error)
+	GetSyncRuns(ctx context.Context, from, to int) (*database.SyncRunsResponse, error)
+	GetSyncRun(ctx context.Context, id int) (database.SyncRun, bool, error)
+	Suggest(ctx context.Context, prefix string, limit int) (*database.Suggestions, error)
+	Lookup(ctx context.Context, inputs []database.LookupInput) (*database.LookupResponse, error)
+	Export(ctx context.Context, filter database.OrganisationFilter, sort database.OrganisationSort, fn func(database.ExportRow) error) error
+	GetStats(ctx context.Context, sq database.StatsQuery) (*database.Stats, error)
+	GetDowngradeReport(ctx context.Context, dq database.DowngradeQuery) (*database.DowngradeReport, error)
+	GetAnalytics(ctx context.Context, aq database.AnalyticsQuery) (*database.Analytics, error)
 }
 
-// Authenticator handles login, logout, and session validation.
+// Authenticator handles login, logout, session validation and password changes.
 type Authenticator interface {
-	Login(ctx context.Context, username, password string) (string, error)
+	Login(ctx context.Context, username, password, clientIP string) (string, error)
 	Logout(ctx context.Context, token string) error
 	Authenticate(ctx context.Context, token string) (database.User, error)
+	ChangePassword(ctx context.Context, userID int, token, current, password, clientIP string) error
 }
 
 // Server is the HTTP server handling API requests.
 type Server struct {
-	syncer *sync.Syncer
-	data   DataReader
-	auth   Authenticator
+	syncer        *sync.Syncer
+	data          DataReader
+	auth          Authenticator
+	watchlists    WatchlistStore
+	webhooks      WebhookManager
+	notifications NotificationStore
+	feeds         FeedStore
+	searches      SavedSearchStore
+	annotations   AnnotationStore
+	users         UserManager
+	emailEnabled  bool
+	proxies       []netip.Prefix
 }
 
 // NewServer creates a Server with the given dependencies.
-func NewServer(syncer *sync.Syncer, data DataReader, auth Authenticator) *Server {
-	return &Server{syncer: syncer, data: data, auth: auth}
+func NewServer(syncer *sync.Syncer, data DataReader, auth Authenticator, watchlists WatchlistStore, webhooks WebhookManager, notifications NotificationStore, feeds FeedStore, searches SavedSearchStore, annotations AnnotationStore, users UserManager) *Server {
+	return &Server{syncer: syncer, data: data, auth: auth, watchlists: watchlists, webhooks: webhooks, notifications: notifications, feeds: feeds, searches: searches, annotations: annotations, users: users}
+}
+
+// EnableEmail tells the server that email alerts are sent, so saved searches
+// may turn notifications on.
+func (s *Server) EnableEmail() {
+	s.emailEnabled = true
+}
+
+// TrustProxies tells the server which addresses are reverse proxies, so the
+// client IP of a request from one is read from X-Forwarded-For.
+func (s *Server) TrustProxies(proxies []netip.Prefix) {
+	s.proxies = proxies
 }
 
 // Routes registers all HTTP handlers and returns the root handler.
@@ -41,9 +77,64 @@ func (s *Server) Routes() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /api/sync", s.requireRole(10, s.handleSync))
 	mux.HandleFunc("GET /api/data", s.handleGetData)
+	mux.HandleFunc("GET /api/suggest", s.handleSuggest)
+	mux.HandleFunc("GET /api/export", s.requireRole(50, s.handleExport))
+	mux.HandleFunc("POST /api/lookup", s.requireRole(50, s.handleLookup))
+	mux.HandleFunc("GET /api/stats", s.handleGetStats)
+	mux.HandleFunc("GET /api/changes", s.handleGetChanges)
+	mux.HandleFunc("GET /api/compare", s.handleCompare)
+	mux.HandleFunc("GET /api/feeds/changes.atom", s.handleChangesFeed)
+	mux.HandleFunc("GET /api/feeds/watchlists/{token}/changes.atom", s.handleWatchlistFeed)
+	mux.HandleFunc("POST /api/feeds/token", s.requireRole(50, s.handleCreateFeedToken))
+	mux.HandleFunc("DELETE /api/feeds/token", s.requireRole(50, s.handleDeleteFeedToken))
+	mux.HandleFunc("GET /api/reports/downgrades", s.requireRole(50, s.handleDowngradeReport))
+	mux.HandleFunc("GET /api/analytics", s.requireRole(50, s.handleAnalytics))
+	mux.HandleFunc("GET /api/sync-runs", s.requireRole(50, s.handleGetSyncRuns))
+	mux.HandleFunc("GET /api/sync-runs/{id}", s.requireRole(50, s.handleGetSyncRun))
+	mux.HandleFunc("GET /api/watchlists", s.requireRole(50, s.handleListWatchlists))
+	mux.HandleFunc("POST /api/watchlists", s.requireRole(50, s.handleCreateWatchlist))
+	mux.HandleFunc("GET /api/watchlists/{id}", s.requireRole(50, s.handleGetWatchlist))
+	mux.HandleFunc("PATCH /api/watchlists/{id}", s.requireRole(50, s.handleRenameWatchlist))
+	mux.HandleFunc("DELETE /api/watchlists/{id}", s.requireRole(50, s.handleDeleteWatchlist))
+	mux.HandleFunc("POST /api/watchlists/{id}/organisations", s.requireRole(50, s.handleAddToWatchlist))
+	mux.HandleFunc("DELETE /api/watchlists/{id}/organisations/{org_id}", s.requireRole(50, s.handleRemoveFromWatchlist))
+	mux.HandleFunc("GET /api/saved-searches", s.requireRole(50, s.handleListSavedSearches))
+	mux.HandleFunc("POST /api/saved-searches", s.requireRole(50, s.handleCreateSavedSearch))
+	mux.HandleFunc("GET /api/saved-searches/{id}", s.requireRole(50, s.handleGetSavedSearch))
+	mux.HandleFunc("PUT /api/saved-searches/{id}", s.requireRole(50, s.handleUpdateSavedSearch))
+	mux.HandleFunc("DELETE /api/saved-searches/{id}", s.requireRole(50, s.handleDeleteSavedSearch))
+	mux.HandleFunc("GET /api/saved-searches/{id}/data", s.requireRole(50, s.handleRunSavedSearch))
+	mux.HandleFunc("GET /api/organisations/{id}/notes", s.requireRole(50, s.handleListNotes))
+	mux.HandleFunc("POST /api/organisations/{id}/notes", s.requireRole(50, s.handleAddNote))
+	mux.HandleFunc("PUT /api/organisations/{id}/notes/{note_id}", s.requireRole(50, s.handleEditNote))
+	mux.HandleFunc("DELETE /api/organisations/{id}/notes/{note_id}", s.requireRole(50, s.handleDeleteNote))
+	mux.HandleFunc("GET /api/organisations/{id}/tags", s.requireRole(50, s.handleListOrganisationTags))
+	mux.HandleFunc("PUT /api/organisations/{id}/tags/{tag}", s.requireRole(50, s.handleTagOrganisation))
+	mux.HandleFunc("DELETE /api/organisations/{id}/tags/{tag}", s.requireRole(50, s.handleUntagOrganisation))
+	mux.HandleFunc("GET /api/tags", s.requireRole(50, s.handleListTags))
+	mux.HandleFunc("DELETE /api/tags/{tag}", s.requireRole(10, s.handleDeleteTag))
+	mux.HandleFunc("GET /api/notifications/settings", s.requireRole(50, s.handleGetNotificationSettings))
+	mux.HandleFunc("PUT /api/notifications/settings", s.requireRole(50, s.handlePutNotificationSettings))
+	mux.HandleFunc("DELETE /api/notifications/settings", s.requireRole(50, s.handleDeleteNotificationSettings))
+	mux.HandleFunc("GET /api/webhooks", s.requireRole(10, s.handleListWebhooks))
+	mux.HandleFunc("POST /api/webhooks", s.requireRole(10, s.handleCreateWebhook))
+	mux.HandleFunc("GET /api/webhooks/{id}", s.requireRole(10, s.handleGetWebhook))
+	mux.HandleFunc("PUT /api/webhooks/{id}", s.requireRole(10, s.handleUpdateWebhook))
+	mux.HandleFunc("DELETE /api/webhooks/{id}", s.requireRole(10, s.handleDeleteWebhook))
+	mux.HandleFunc("GET /api/webhooks/{id}/deliveries", s.requireRole(10, s.handleGetWebhookDeliveries))
+	mux.HandleFunc("POST /api/webhooks/{id}/test", s.requireRole(10, s.handleTestWebhook))
+	mux.HandleFunc("GET /api/users", s.requireRole(10, s.handleListUsers))
+	mux.HandleFunc("POST /api/users", s.requireRole(10, s.handleCreateUser))
+	mux.HandleFunc("GET /api/users/{id}", s.requireRole(10, s.handleGetUser))
+	mux.HandleFunc("PATCH /api/users/{id}", s.requireRole(10, s.handleUpdateUser))
+	mux.HandleFunc("DELETE /api/users/{id}", s.requireRole(10, s.handleDeleteUser))
+	mux.HandleFunc("POST /api/users/{id}/password", s.requireRole(10, s.handleResetPassword))
+	mux.HandleFunc("GET /api/lockouts", s.requireRole(10, s.handleListLockouts))
+	mux.HandleFunc("DELETE /api/lockouts", s.requireRole(10, s.handleClearLockout))
 	mux.HandleFunc("POST /api/auth/login", s.handleLogin)
 	mux.HandleFunc("POST /api/auth/logout", s.handleLogout)
 	mux.HandleFunc("GET /api/auth/me", s.handleMe)
+	mux.HandleFunc("POST /api/auth/password", s.requireRole(50, s.handleChangePassword))
 	return mux
 }
 
@@ -53,38 +144,421 @@ func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleGetData(w http.ResponseWriter, r *http.Request) {
-	from, to, search, err := parseGetDataInput(r)
+	dq, err := parseGetDataInput(r)
 	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
-	data, dataErr := s.data.GetAll(r.Context(), from, to, search)
+	data, dataErr := s.data.GetAll(r.Context(), dq)
 	writeJSON(w, data, dataErr)
 }
 
-// parseGetDataInput extracts and validates the from/to/search query parameters.
-// from and to must be positive integers less than 1 billion, with to >= from.
-// search is optional (empty string if absent).
-func parseGetDataInput(r *http.Request) (int, int, string, error) {
+// parseGetDataInput extracts and validates the pagination, filter and sort
+// query parameters. A page is selected either by from/to or by limit with an
+// optional cursor; the two styles cannot be mixed. All filters are optional,
+// and facets=true adds facet counts to the response.
+func parseGetDataInput(r *http.Request) (database.DataQuery, error) {
+	var dq database.DataQuery
+	var err error
+	if dq.Filter, err = parseFilter(r); err != nil {
+		return database.DataQuery{}, err
+	}
+	if dq.Sort, err = parseDataSort(r, dq.Filter); err != nil {
+		return database.DataQuery{}, err
+	}
+
+	if dq.Facets, err = extractBool(r, "facets"); err != nil {
+		return database.DataQuery{}, err
+	}
+
+	q := r.URL.Query()
+	if !q.Has("limit") && !q.Has("cursor") {
+		if dq.From, dq.To, err = parseRange(r); err != nil {
+			return database.DataQuery{}, err
+		}
+		return dq, nil
+	}
+	if q.Has("from") || q.Has("to") {
+		return database.DataQuery{}, fmt.Errorf("from/to cannot be combined with limit or cursor")
+	}
+	if dq.Limit, dq.Cursor, err = parseKeyset(r, dq.Sort); err != nil {
+		return database.DataQuery{}, err
+	}
+	return dq, nil
+}
+
+// parseDataSort extracts the sort for a filtered organisation list. A fuzzy
+// search is sorted by relevance unless sort is given; relevance is only valid
+// with a fuzzy search.
+func parseDataSort(r *http.Request, filter database.OrganisationFilter) (database.OrganisationSort, error) {
+	sort, err := parseSort(r)
+	if err != nil {
+		return database.OrganisationSort{}, err
+	}
+	if filter.Fuzzy && filter.Search != "" && !r.URL.Query().Has("sort") {
+		sort = database.OrganisationSort{Field: database.SortRelevance, Desc: true}
+	}
+	if sort.Field == database.SortRelevance && (!filter.Fuzzy || filter.Search == "") {
+		return database.OrganisationSort{}, fmt.Errorf("sort=relevance requires search with search_mode=fuzzy")
+	}
+	return sort, nil
+}
+
+// parseKeyset extracts the limit and cursor parameters for keyset pagination.
+// limit is required and must be between 1 and 100. cursor, if given, must be
+// one returned by a previous call with the same sort and order.
+func parseKeyset(r *http.Request, sort database.OrganisationSort) (int, *database.PageCursor, error) {
+	limit, err := extractInt(r, "limit")
+	if err != nil { return 0, nil, err }
+	if limit < 1 || limit > 100 {
+		return 0, nil, fmt.Errorf("limit must be between 1 and 100")
+	}
+
+	s := r.URL.Query().Get("cursor")
+	if s == "" {
+		return limit, nil, nil
+	}
+	c, err := database.DecodePageCursor(s)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid cursor")
+	}
+	if c.Sort() != sort {
+		return 0, nil, fmt.Errorf("cursor does not match sort and order")
+	}
+	return limit, &c, nil
+}
+
+// parseFilter extracts and validates the organisation filter query parameters.
+// route may be repeated to select several routes. search_mode is substring
+// (default) or fuzzy. has_b_rating and has_temporary_worker are booleans.
+// as_of selects the register as it stood at a past instant (see parseAsOf).
+func parseFilter(r *http.Request) (database.OrganisationFilter, error) {
+	q := r.URL.Query()
+	f := database.OrganisationFilter{
+		Search:      q.Get("search"),
+		Routes:      q["route"],
+		LicenceType: q.Get("licence_type"),
+		Rating:      q.Get("rating"),
+		County:      q.Get("county"),
+		TownCity:    q.Get("town"),
+	}
+	if len(f.Search) > 200 {
+		return database.OrganisationFilter{}, fmt.Errorf("search must not exceed 200 characters")
+	}
+	if len(f.Routes) > 20 {
+		return database.OrganisationFilter{}, fmt.Errorf("route must not be given more than 20 times")
+	}
+	for _, p := range []struct{ name, value string }{
+		{"licence_type", f.LicenceType}, {"rating", f.Rating}, {"county", f.County}, {"town", f.TownCity},
+	} {
+		if len(p.value) > 200 {
+			return database.OrganisationFilter{}, fmt.Errorf("%s must not exceed 200 characters", p.name)
+		}
+	}
+	for _, route := range f.Routes {
+		if route == "" || len(route) > 200 {
+			return database.OrganisationFilter{}, fmt.Errorf("route must be between 1 and 200 characters")
+		}
+	}
+	if len(q["tag"]) > 20 {
+		return database.OrganisationFilter{}, fmt.Errorf("tag must not be given more than 20 times")
+	}
+	for _, tag := range q["tag"] {
+		name, err := parseTagName(tag)
+		if err != nil {
+			return database.OrganisationFilter{}, err
+		}
+		f.Tags = append(f.Tags, name)
+	}
+
+	switch q.Get("search_mode") {
+	case "", "substring":
+	case "fuzzy":
+		f.Fuzzy = true
+	default:
+		return database.OrganisationFilter{}, fmt.Errorf("invalid search_mode: must be substring or fuzzy")
+	}
+
+	var err error
+	if f.AsOf, err = parseAsOf(r); err != nil {
+		return database.OrganisationFilter{}, err
+	}
+	if f.HasBRating, err = extractBool(r, "has_b_rating"); err != nil {
+		return database.OrganisationFilter{}, err
+	}
+	if f.HasTemporaryWorker, err = extractBool(r, "has_temporary_worker"); err != nil {
+		return database.OrganisationFilter{}, err
+	}
+	return f, nil
+}
+
+// parseAsOf parses the optional as_of parameter: an RFC 3339 timestamp, or a
+// YYYY-MM-DD date meaning the end of that day (UTC) as for /api/compare.
+// It returns nil if as_of is absent.
+func parseAsOf(r *http.Request) (*time.Time, error) {
+	s := r.URL.Query().Get("as_of")
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid as_of: must be a timestamp or date (YYYY-MM-DD)")
+	}
+	t := database.EndOfDay(d)
+	return &t, nil
+}
+
+// parseRange extracts and validates the from/to pagination parameters.
+// from and to must be positive integers less than 1 billion, with to >= from
+// and a page size of at most 100.
+func parseRange(r *http.Request) (int, int, error) {
 	const maxVal = 1_000_000_000
 	from, err := extractInt(r, "from")
-	if err != nil { return 0, 0, "", err }
+	if err != nil { return 0, 0, err }
 	to, err := extractInt(r, "to")
-	if err != nil { return 0, 0, "", err }
+	if err != nil { return 0, 0, err }
 	if from < 1 || from > maxVal {
-		return 0, 0, "", fmt.Errorf("from must be between 1 and %d", maxVal)
+		return 0, 0, fmt.Errorf("from must be between 1 and %d", maxVal)
 	}
 	if to < 1 || to > maxVal {
-		return 0, 0, "", fmt.Errorf("to must be between 1 and %d", maxVal)
+		return 0, 0, fmt.Errorf("to must be between 1 and %d", maxVal)
 	}
 	if to < from {
-		return 0, 0, "", fmt.Errorf("to (%d) must be >= from (%d)", to, from)
+		return 0, 0, fmt.Errorf("to (%d) must be >= from (%d)", to, from)
 	}
 	if to-from+1 > 100 {
-		return 0, 0, "", fmt.Errorf("page size must not exceed 100")
+		return 0, 0, fmt.Errorf("page size must not exceed 100")
+	}
+	return from, to, nil
+}
+
+func (s *Server) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	prefix, limit, err := parseSuggestInput(r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	suggestions, suggestErr := s.data.Suggest(r.Context(), prefix, limit)
+	writeJSON(w, suggestions, suggestErr)
+}
+
+// parseSuggestInput extracts the typeahead prefix and limit. q is required,
+// trimmed, and at most 100 characters. limit defaults to 10 and must not exceed 20.
+func parseSuggestInput(r *http.Request) (string, int, error) {
+	q := r.URL.Query()
+	prefix := strings.TrimSpace(q.Get("q"))
+	if prefix == "" {
+		return "", 0, fmt.Errorf("missing required parameter: q")
+	}
+	if len(prefix) > 100 {
+		return "", 0, fmt.Errorf("q must not exceed 100 characters")
+	}
+
+	limit := 10
+	if q.Get("limit") != "" {
+		var err error
+		limit, err = extractInt(r, "limit")
+		if err != nil { return "", 0, err }
+		if limit < 1 || limit > 20 {
+			return "", 0, fmt.Errorf("limit must be between 1 and 20")
+		}
+	}
+	return prefix, limit, nil
+}
+
+func (s *Server) handleGetChanges(w http.ResponseWriter, r *http.Request) {
+	cq, err := parseGetChangesInput(r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	changes, changesErr := s.data.GetChanges(r.Context(), cq)
+	writeJSON(w, changes, changesErr)
+}
+
+func (s *Server) handleGetSyncRuns(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseRange(r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	runs, runsErr := s.data.GetSyncRuns(r.Context(), from, to)
+	writeJSON(w, runs, runsErr)
+}
+
+func (s *Server) handleGetSyncRun(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil { http.Error(w, "invalid id: must be an integer", http.StatusBadRequest); return }
+	run, found, err := s.data.GetSyncRun(r.Context(), id)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, run, err)
+}
+
+// parseGetChangesInput extracts and validates the change feed query parameters.
+// since is required and is either an RFC 3339 timestamp, a YYYY-MM-DD date, or
+// a cursor returned by a previous call. limit defaults to 100 and must not exceed 100.
+// type is an optional comma-separated list of event types.
+func parseGetChangesInput(r *http.Request) (database.ChangeQuery, error) {
+	q := r.URL.Query()
+	since := q.Get("since")
+	if since == "" {
+		return database.ChangeQuery{}, fmt.Errorf("missing required parameter: since")
+	}
+	after, err := parseSince(since)
+	if err != nil {
+		return database.ChangeQuery{}, err
+	}
+
+	limit := 100
+	if q.Get("limit") != "" {
+		limit, err = extractInt(r, "limit")
+		if err != nil { return database.ChangeQuery{}, err }
+		if limit < 1 || limit > 100 {
+			return database.ChangeQuery{}, fmt.Errorf("limit must be between 1 and 100")
+		}
+	}
+
+	var eventTypes []string
+	if types := q.Get("type"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			t = strings.TrimSpace(t)
+			if !slices.Contains(database.EventTypes, t) {
+				return database.ChangeQuery{}, fmt.Errorf("invalid type %q: must be one of %s", t, strings.Join(database.EventTypes, ", "))
+			}
+			eventTypes = append(eventTypes, t)
+		}
+	}
+
+	route := q.Get("route")
+	licenceType := q.Get("licence_type")
+	if len(route) > 100 || len(licenceType) > 50 {
+		return database.ChangeQuery{}, fmt.Errorf("route or licence_type too long")
+	}
+	return database.ChangeQuery{
+		After:       after,
+		Limit:       limit,
+		Route:       route,
+		LicenceType: licenceType,
+		EventTypes:  eventTypes,
+	}, nil
+}
+
+// parseSince interprets since as a timestamp, a date, or a change cursor.
+// Timestamps and dates include events occurring exactly at that instant.
+func parseSince(since string) (database.ChangeCursor, error) {
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return database.ChangeCursor{OccurredAt: t}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, since); err == nil {
+		return database.ChangeCursor{OccurredAt: t}, nil
+	}
+	c, err := database.DecodeChangeCursor(since)
+	if err != nil {
+		return database.ChangeCursor{}, fmt.Errorf("invalid since: must be a timestamp, date or cursor")
+	}
+	return c, nil
+}
+
+func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
+	sq, err := parseStatsInput(r, time.Now())
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	stats, statsErr := s.data.GetStats(r.Context(), sq)
+	writeJSON(w, stats, statsErr)
+}
+
+// parseStatsInput extracts the optional from/to dates of the daily series
+// and the optional breakdown dimension.
+// to defaults to today (UTC) and from to 89 days before to, giving 90 days.
+// The range must not exceed 3660 days.
+func parseStatsInput(r *http.Request, now time.Time) (database.StatsQuery, error) {
+	q := r.URL.Query()
+	y, m, d := now.UTC().Date()
+	to := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	var err error
+	if q.Get("to") != "" {
+		if to, err = extractDate(r, "to"); err != nil {
+			return database.StatsQuery{}, err
+		}
+	}
+	from := to.AddDate(0, 0, -89)
+	if q.Get("from") != "" {
+		if from, err = extractDate(r, "from"); err != nil {
+			return database.StatsQuery{}, err
+		}
+	}
+	if to.Before(from) {
+		return database.StatsQuery{}, fmt.Errorf("to must not be before from")
+	}
+	if to.Sub(from) >= 3660*24*time.Hour {
+		return database.StatsQuery{}, fmt.Errorf("date range must not exceed 3660 days")
+	}
+	breakdown := q.Get("breakdown")
+	if breakdown != "" && !slices.Contains(database.Dimensions, breakdown) {
+		return database.StatsQuery{}, fmt.Errorf("invalid breakdown: must be one of %s", strings.Join(database.Dimensions, ", "))
+	}
+	return database.StatsQuery{From: from, To: to, Breakdown: breakdown}, nil
+}
+
+func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseCompareInput(r)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	comparison, compareErr := s.data.CompareRegister(r.Context(), from, to)
+	writeJSON(w, comparison, compareErr)
+}
+
+// parseCompareInput extracts the from/to dates for a register comparison.
+// Both are required YYYY-MM-DD dates with to >= from. Each date is converted
+// to the end of that day (UTC), so the comparison includes that day's sync.
+func parseCompareInput(r *http.Request) (time.Time, time.Time, error) {
+	from, err := extractDate(r, "from")
+	if err != nil { return time.Time{}, time.Time{}, err }
+	to, err := extractDate(r, "to")
+	if err != nil { return time.Time{}, time.Time{}, err }
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("to must not be before from")
 	}
-	search := r.URL.Query().Get("search")
-	if len(search) > 200 {
-		return 0, 0, "", fmt.Errorf("search must not exceed 200 characters")
+	return database.EndOfDay(from), database.EndOfDay(to), nil
+}
+
+// extractDate parses a required YYYY-MM-DD query parameter.
+func extractDate(r *http.Request, name string) (time.Time, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return time.Time{}, fmt.Errorf("missing required parameter: %s", name)
+	}
+	v, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: must be a date (YYYY-MM-DD)", name)
 	}
-	return from, to, search, nil
+	return v, nil
+}
+
+// parseSort extracts and validates the sort and order query parameters.
+// sort defaults to name; order is asc or desc, defaulting to desc for
+// relevance and asc otherwise.
+func parseSort(r *http.Request) (database.OrganisationSort, error) {
+	q := r.URL.Query()
+	sort := database.OrganisationSort{Field: q.Get("sort")}
+	if sort.Field == "" {
+		sort.Field = database.SortName
+	}
+	if !slices.Contains(database.SortFields, sort.Field) {
+		return database.OrganisationSort{}, fmt.Errorf("invalid sort %q: must be one of %s", sort.Field, strings.Join(database.SortFields, ", "))
+	}
+	switch q.Get("order") {
+	case "":
+		sort.Desc = sort.Field == database.SortRelevance
+	case "asc":
+	case "desc":
+		sort.Desc = true
+	default:
+		return database.OrganisationSort{}, fmt.Errorf("invalid order: must be asc or desc")
+	}
+	return sort, nil
+}
+
+// extractBool parses an optional boolean query parameter (false if absent).
+func extractBool(r *http.Request, name string) (bool, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return false, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: must be true or false", name)
+	}
+	return v, nil
 }
 
 // extractInt parses a required integer query parameter.
@@ -101,6 +575,28 @@ func extractInt(r *http.Request, name string) (int, error) {
 	return v, nil
 }
 
+// writeCreated writes data as JSON with status 201 Created.
+func writeCreated(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		slog.Error("failed to encode response", "error", err)
+	}
+}
+
+// writeNoContent writes 204 No Content, or 404 if the target was not found.
+func writeNoContent(w http.ResponseWriter, found bool, err error) {
+	switch {
+	case err != nil:
+		slog.Error("request failed", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	case !found:
+		http.Error(w, "not found", http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
 func writeJSON(w http.ResponseWriter, data any, err error) {
 	if err != nil {
 		slog.Error("request failed", "error", err)
@@ -2,8 +2,13 @@ package api
 
 import (
 	"net/http"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"sponsor-tracker/internal/database"
 )
 
 func TestParseGetDataInput(t *testing.T) {
@@ -26,19 +31,294 @@ func TestParseGetDataInput(t *testing.T) {
 		{"non-integer from", "from=abc&to=20", 0, 0, "", true},
 		{"search too long", "from=1&to=20&search=" + strings.Repeat("a", 201), 0, 0, "", true},
 		{"search at limit", "from=1&to=20&search=" + strings.Repeat("a", 200), 1, 20, strings.Repeat("a", 200), false},
+		{"facets", "from=1&to=20&facets=true", 1, 20, "", false},
+		{"invalid facets", "from=1&to=20&facets=maybe", 0, 0, "", true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r, _ := http.NewRequest("GET", "/api/data?"+tt.query, nil)
-			from, to, search, err := parseGetDataInput(r)
+			dq, err := parseGetDataInput(r)
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
 			}
 			if err != nil { return }
-			if from != tt.wantFrom { t.Errorf("from = %d, want %d", from, tt.wantFrom) }
-			if to != tt.wantTo { t.Errorf("to = %d, want %d", to, tt.wantTo) }
-			if search != tt.wantSearch { t.Errorf("search = %q, want %q", search, tt.wantSearch) }
+			if dq.From != tt.wantFrom { t.Errorf("from = %d, want %d", dq.From, tt.wantFrom) }
+			if dq.To != tt.wantTo { t.Errorf("to = %d, want %d", dq.To, tt.wantTo) }
+			if dq.Filter.Search != tt.wantSearch { t.Errorf("search = %q, want %q", dq.Filter.Search, tt.wantSearch) }
+			if want := strings.Contains(tt.query, "facets=true"); dq.Facets != want { t.Errorf("facets = %v, want %v", dq.Facets, want) }
 		})
 	}
 }
+
+func TestParseGetDataInput_FuzzySort(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantSort database.OrganisationSort
+		wantErr  bool
+	}{
+		{"fuzzy defaults to relevance", "from=1&to=20&search=acme&search_mode=fuzzy", database.OrganisationSort{Field: "relevance", Desc: true}, false},
+		{"explicit sort wins", "from=1&to=20&search=acme&search_mode=fuzzy&sort=town", database.OrganisationSort{Field: "town"}, false},
+		{"relevance without fuzzy", "from=1&to=20&search=acme&sort=relevance", database.OrganisationSort{}, true},
+		{"relevance without search", "from=1&to=20&search_mode=fuzzy&sort=relevance", database.OrganisationSort{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/api/data?"+tt.query, nil)
+			dq, err := parseGetDataInput(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if err != nil { return }
+			if dq.Sort != tt.wantSort { t.Errorf("sort = %+v, want %+v", dq.Sort, tt.wantSort) }
+		})
+	}
+}
+
+func TestParseGetDataInput_Keyset(t *testing.T) {
+	cursor := database.EncodePageCursor(database.PageCursor{Field: database.SortCounty, Key: "Kent", ID: 7})
+	badKey := database.EncodePageCursor(database.PageCursor{Field: database.SortLicenceCount, Key: "Kent", ID: 7})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantLimit  int
+		wantCursor *database.PageCursor
+		wantErr    bool
+	}{
+		{"first page", "limit=20", 20, nil, false},
+		{"with cursor", "limit=20&sort=county&cursor=" + cursor, 20, &database.PageCursor{Field: database.SortCounty, Key: "Kent", ID: 7}, false},
+		{"cursor for another sort", "limit=20&sort=county&order=desc&cursor=" + cursor, 0, nil, true},
+		{"cursor without limit", "sort=county&cursor=" + cursor, 0, nil, true},
+		{"garbage cursor", "limit=20&cursor=abc", 0, nil, true},
+		{"cursor key of the wrong type", "limit=20&sort=licence_count&cursor=" + badKey, 0, nil, true},
+		{"limit over 100", "limit=101", 0, nil, true},
+		{"mixed with from/to", "limit=20&from=1&to=20", 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/api/data?"+tt.query, nil)
+			dq, err := parseGetDataInput(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if err != nil { return }
+			if dq.Limit != tt.wantLimit { t.Errorf("limit = %d, want %d", dq.Limit, tt.wantLimit) }
+			if !reflect.DeepEqual(dq.Cursor, tt.wantCursor) { t.Errorf("cursor = %+v, want %+v", dq.Cursor, tt.wantCursor) }
+		})
+	}
+}
+
+func TestParseSuggestInput(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantPrefix string
+		wantLimit  int
+		wantErr    bool
+	}{
+		{"default limit", "q=acm", "acm", 10, false},
+		{"trimmed with limit", "q=+acm+&limit=5", "acm", 5, false},
+		{"missing q", "limit=5", "", 0, true},
+		{"blank q", "q=+++", "", 0, true},
+		{"q too long", "q=" + strings.Repeat("a", 101), "", 0, true},
+		{"limit over 20", "q=acm&limit=21", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/api/suggest?"+tt.query, nil)
+			prefix, limit, err := parseSuggestInput(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if err != nil { return }
+			if prefix != tt.wantPrefix { t.Errorf("prefix = %q, want %q", prefix, tt.wantPrefix) }
+			if limit != tt.wantLimit { t.Errorf("limit = %d, want %d", limit, tt.wantLimit) }
+		})
+	}
+}
+
+func TestParseGetChangesInput(t *testing.T) {
+	cursor := database.EncodeChangeCursor(database.ChangeCursor{
+		OccurredAt: time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC),
+		EventType:  database.EventLicenceAdded,
+		EntityID:   42,
+	})
+
+	tests := []struct {
+		name      string
+		query     string
+		wantAfter database.ChangeCursor
+		wantLimit int
+		wantTypes []string
+		wantErr   bool
+	}{
+		{"timestamp", "since=2026-03-01T09:00:00Z", database.ChangeCursor{OccurredAt: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)}, 100, nil, false},
+		{"date", "since=2026-03-01", database.ChangeCursor{OccurredAt: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)}, 100, nil, false},
+		{"cursor", "since=" + cursor, database.ChangeCursor{OccurredAt: time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC), EventType: database.EventLicenceAdded, EntityID: 42}, 100, nil, false},
+		{"limit and types", "since=2026-03-01&limit=10&type=licence_rerated,licence_removed", database.ChangeCursor{OccurredAt: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)}, 10, []string{"licence_rerated", "licence_removed"}, false},
+		{"missing since", "limit=10", database.ChangeCursor{}, 0, nil, true},
+		{"garbage since", "since=yesterday", database.ChangeCursor{}, 0, nil, true},
+		{"limit over 100", "since=2026-03-01&limit=101", database.ChangeCursor{}, 0, nil, true},
+		{"limit zero", "since=2026-03-01&limit=0", database.ChangeCursor{}, 0, nil, true},
+		{"unknown type", "since=2026-03-01&type=licence_exploded", database.ChangeCursor{}, 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/api/changes?"+tt.query, nil)
+			cq, err := parseGetChangesInput(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if err != nil { return }
+			if !cq.After.OccurredAt.Equal(tt.wantAfter.OccurredAt) || cq.After.EventType != tt.wantAfter.EventType || cq.After.EntityID != tt.wantAfter.EntityID {
+				t.Errorf("after = %+v, want %+v", cq.After, tt.wantAfter)
+			}
+			if cq.Limit != tt.wantLimit { t.Errorf("limit = %d, want %d", cq.Limit, tt.wantLimit) }
+			if !slices.Equal(cq.EventTypes, tt.wantTypes) { t.Errorf("types = %v, want %v", cq.EventTypes, tt.wantTypes) }
+		})
+	}
+}
+
+func TestParseCompareInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{"valid", "from=2026-01-01&to=2026-02-01", time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC), false},
+		{"same day", "from=2026-01-01&to=2026-01-01", time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), false},
+		{"to before from", "from=2026-02-01&to=2026-01-01", time.Time{}, time.Time{}, true},
+		{"missing to", "from=2026-01-01", time.Time{}, time.Time{}, true},
+		{"not a date", "from=01/01/2026&to=2026-02-01", time.Time{}, time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/api/compare?"+tt.query, nil)
+			from, to, err := parseCompareInput(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if err != nil { return }
+			if !from.Equal(tt.wantFrom) { t.Errorf("from = %v, want %v", from, tt.wantFrom) }
+			if !to.Equal(tt.wantTo) { t.Errorf("to = %v, want %v", to, tt.wantTo) }
+		})
+	}
+}
+
+func TestParseStatsInput(t *testing.T) {
+	now := time.Date(2026, 3, 31, 15, 0, 0, 0, time.UTC)
+	day := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		query    string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantDim  string
+		wantErr  bool
+	}{
+		{"defaults to 90 days to today", "", day(1, 1), day(3, 31), "", false},
+		{"explicit range", "from=2026-02-01&to=2026-02-28", day(2, 1), day(2, 28), "", false},
+		{"to only", "to=2026-03-01", time.Date(2025, 12, 2, 0, 0, 0, 0, time.UTC), day(3, 1), "", false},
+		{"breakdown", "breakdown=county", day(1, 1), day(3, 31), "county", false},
+		{"invalid breakdown", "breakdown=town", time.Time{}, time.Time{}, "", true},
+		{"to before from", "from=2026-03-01&to=2026-02-01", time.Time{}, time.Time{}, "", true},
+		{"range too long", "from=2010-01-01&to=2026-03-01", time.Time{}, time.Time{}, "", true},
+		{"invalid date", "from=March", time.Time{}, time.Time{}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/api/stats?"+tt.query, nil)
+			sq, err := parseStatsInput(r, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if err != nil { return }
+			if !sq.From.Equal(tt.wantFrom) { t.Errorf("from = %v, want %v", sq.From, tt.wantFrom) }
+			if !sq.To.Equal(tt.wantTo) { t.Errorf("to = %v, want %v", sq.To, tt.wantTo) }
+			if sq.Breakdown != tt.wantDim { t.Errorf("breakdown = %q, want %q", sq.Breakdown, tt.wantDim) }
+		})
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    database.OrganisationFilter
+		wantErr bool
+	}{
+		{"empty", "", database.OrganisationFilter{}, false},
+		{
+			"all filters",
+			"search=acme&route=Skilled+Worker&route=Scale-up&licence_type=Worker&rating=A+rating&county=Kent&town=Dover&has_b_rating=true&has_temporary_worker=1",
+			database.OrganisationFilter{
+				Search: "acme", Routes: []string{"Skilled Worker", "Scale-up"}, LicenceType: "Worker", Rating: "A rating",
+				County: "Kent", TownCity: "Dover", HasBRating: true, HasTemporaryWorker: true,
+			},
+			false,
+		},
+		{"as_of date is end of day", "as_of=2026-02-01", database.OrganisationFilter{AsOf: ptr(time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC))}, false},
+		{"as_of timestamp", "as_of=2026-02-01T12:00:00Z", database.OrganisationFilter{AsOf: ptr(time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC))}, false},
+		{"invalid as_of", "as_of=last+week", database.OrganisationFilter{}, true},
+		{"fuzzy search", "search=acme+uk&search_mode=fuzzy", database.OrganisationFilter{Search: "acme uk", Fuzzy: true}, false},
+		{"invalid search mode", "search=acme&search_mode=regex", database.OrganisationFilter{}, true},
+		{"invalid bool", "has_b_rating=yes", database.OrganisationFilter{}, true},
+		{"empty route", "route=", database.OrganisationFilter{}, true},
+		{"county too long", "county=" + strings.Repeat("a", 201), database.OrganisationFilter{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/api/data?"+tt.query, nil)
+			got, err := parseFilter(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if err != nil { return }
+			if !reflect.DeepEqual(got, tt.want) { t.Errorf("got %+v, want %+v", got, tt.want) }
+		})
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    database.OrganisationSort
+		wantErr bool
+	}{
+		{"default", "", database.OrganisationSort{Field: "name"}, false},
+		{"town descending", "sort=town&order=desc", database.OrganisationSort{Field: "town", Desc: true}, false},
+		{"licence count ascending", "sort=licence_count&order=asc", database.OrganisationSort{Field: "licence_count"}, false},
+		{"relevance defaults to descending", "sort=relevance", database.OrganisationSort{Field: "relevance", Desc: true}, false},
+		{"unknown field", "sort=id", database.OrganisationSort{}, true},
+		{"invalid order", "sort=name&order=up", database.OrganisationSort{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/api/data?"+tt.query, nil)
+			got, err := parseSort(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
+			}
+			if err != nil { return }
+			if got != tt.want { t.Errorf("got %+v, want %+v", got, tt.want) }
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"sponsor-tracker/internal/auth"
+	"sponsor-tracker/internal/database"
+)
+
+// UserManager administers user accounts.
+type UserManager interface {
+	ListUsers(ctx context.Context) ([]database.User, error)
+	GetUser(ctx context.Context, id int) (database.User, bool, error)
+	CreateUser(ctx context.Context, username, password string, role int) (database.User, error)
+	UpdateUser(ctx context.Context, id int, role *int, disabled *bool) (bool, error)
+	ResetPassword(ctx context.Context, id int, password string) (bool, error)
+	DeleteUser(ctx context.Context, id int) (bool, error)
+	ListLoginThrottles(ctx context.Context) ([]database.LoginThrottle, error)
+	ClearLoginThrottle(ctx context.Context, scope, key string) (bool, error)
+}
+
+// Roles a user may be given.
+const (
+	roleAdmin  = 10
+	roleViewer = 50
+)
+
+// createUserInput is the body of user create requests.
+type createUserInput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     int    `json:"role"`
+}
+
+// updateUserInput is the body of user update requests. Absent fields are
+// left unchanged.
+type updateUserInput struct {
+	Role     *int  `json:"role"`
+	Disabled *bool `json:"disabled"`
+}
+
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.users.ListUsers(r.Context())
+	writeJSON(w, users, err)
+}
+
+func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var input createUserInput
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&input); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	input.Username = strings.TrimSpace(input.Username)
+	if input.Role == 0 {
+		input.Role = roleViewer
+	}
+	err := validateUsername(input.Username)
+	if err == nil { err = validateRole(input.Role) }
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+
+	user, err := s.users.CreateUser(r.Context(), input.Username, input.Password, input.Role)
+	if errors.Is(err, auth.ErrWeakPassword) { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	if errors.Is(err, database.ErrUsernameTaken) { http.Error(w, err.Error(), http.StatusConflict); return }
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	writeCreated(w, user)
+}
+
+func (s *Server) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	user, found, err := s.users.GetUser(r.Context(), id)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, user, err)
+}
+
+// handleUpdateUser changes a user's role or disables or re-enables them, and
+// returns the user. Admins cannot change their own account this way, so
+// there is always an admin left.
+func (s *Server) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	admin, _ := UserFromContext(r.Context())
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	var input updateUserInput
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&input); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if input.Role != nil {
+		if err := validateRole(*input.Role); err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	}
+	if id == admin.ID { http.Error(w, "you cannot change your own role or disable yourself", http.StatusConflict); return }
+
+	found, err := s.users.UpdateUser(r.Context(), id, input.Role, input.Disabled)
+	var user database.User
+	if err == nil && found {
+		user, found, err = s.users.GetUser(r.Context(), id)
+	}
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, user, err)
+}
+
+func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	admin, _ := UserFromContext(r.Context())
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	if id == admin.ID { http.Error(w, "you cannot delete yourself", http.StatusConflict); return }
+	found, err := s.users.DeleteUser(r.Context(), id)
+	writeNoContent(w, found, err)
+}
+
+// handleResetPassword sets a user's password and logs them out everywhere.
+func (s *Server) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	var input struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&input); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	found, err := s.users.ResetPassword(r.Context(), id, input.Password)
+	if errors.Is(err, auth.ErrWeakPassword) { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	writeNoContent(w, found, err)
+}
+
+// handleListLockouts lists the usernames and client IPs with recent failed
+// logins, and until when logins for them are refused.
+func (s *Server) handleListLockouts(w http.ResponseWriter, r *http.Request) {
+	throttles, err := s.users.ListLoginThrottles(r.Context())
+	writeJSON(w, throttles, err)
+}
+
+// handleClearLockout forgets the failed logins of the username or client IP
+// given by the scope and key query parameters, lifting any lock.
+func (s *Server) handleClearLockout(w http.ResponseWriter, r *http.Request) {
+	scope, key := r.URL.Query().Get("scope"), r.URL.Query().Get("key")
+	if scope != database.ThrottleUsername && scope != database.ThrottleIP { http.Error(w, "scope must be username or ip", http.StatusBadRequest); return }
+	if key == "" { http.Error(w, "key is required", http.StatusBadRequest); return }
+	found, err := s.users.ClearLoginThrottle(r.Context(), scope, key)
+	writeNoContent(w, found, err)
+}
+
+// validateUsername checks that a username has 1 to 100 characters and no
+// spaces.
+func validateUsername(username string) error {
+	if username == "" || len(username) > 100 || strings.ContainsAny(username, " \t\r\n") {
+		return fmt.Errorf("username must be between 1 and 100 characters without spaces")
+	}
+	return nil
+}
+
+// validateRole checks that a role is admin (10) or viewer (50).
+func validateRole(role int) error {
+	if role != roleAdmin && role != roleViewer {
+		return fmt.Errorf("role must be %d (admin) or %d (viewer)", roleAdmin, roleViewer)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sponsor-tracker/internal/auth"
+	"sponsor-tracker/internal/database"
+)
+
+// fakeUsers is an in-memory UserManager.
+type fakeUsers struct {
+	users     map[int]database.User
+	passwords map[int]string
+	throttles []database.LoginThrottle
+}
+
+func (f *fakeUsers) ListUsers(context.Context) ([]database.User, error) {
+	out := []database.User{}
+	for _, u := range f.users {
+		out = append(out, u)
+	}
+	return out, nil
+}
+
+func (f *fakeUsers) GetUser(_ context.Context, id int) (database.User, bool, error) {
+	u, ok := f.users[id]
+	return u, ok, nil
+}
+
+func (f *fakeUsers) CreateUser(_ context.Context, username, password string, role int) (database.User, error) {
+	if len(password) < 8 { return database.User{}, fmt.Errorf("%w: too short", auth.ErrWeakPassword) }
+	for _, u := range f.users {
+		if u.Username == username { return database.User{}, database.ErrUsernameTaken }
+	}
+	u := database.User{ID: len(f.users) + 1, Username: username, Role: role}
+	f.users[u.ID], f.passwords[u.ID] = u, password
+	return u, nil
+}
+
+func (f *fakeUsers) UpdateUser(_ context.Context, id int, role *int, disabled *bool) (bool, error) {
+	u, ok := f.users[id]
+	if role != nil { u.Role = *role }
+	if disabled != nil && !*disabled { u.DisabledAt = nil }
+	if disabled != nil && *disabled {
+		now := time.Now()
+		u.DisabledAt = &now
+	}
+	if ok { f.users[id] = u }
+	return ok, nil
+}
+
+func (f *fakeUsers) ResetPassword(_ context.Context, id int, password string) (bool, error) {
+	if len(password) < 8 { return false, fmt.Errorf("%w: too short", auth.ErrWeakPassword) }
+	_, ok := f.users[id]
+	if ok { f.passwords[id] = password }
+	return ok, nil
+}
+
+func (f *fakeUsers) DeleteUser(_ context.Context, id int) (bool, error) {
+	_, ok := f.users[id]
+	delete(f.users, id)
+	return ok, nil
+}
+
+func (f *fakeUsers) ListLoginThrottles(context.Context) ([]database.LoginThrottle, error) {
+	return f.throttles, nil
+}
+
+func (f *fakeUsers) ClearLoginThrottle(_ context.Context, scope, key string) (bool, error) {
+	for i, th := range f.throttles {
+		if th.Scope == scope && th.Key == key {
+			f.throttles = append(f.throttles[:i], f.throttles[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestUserManagement(t *testing.T) {
+	admin := database.User{ID: 1, Username: "alice", Role: 10}
+	users := &fakeUsers{users: map[int]database.User{1: admin}, passwords: map[int]string{}}
+	s := NewServer(nil, &fakeData{}, &fakeAuth{authUser: admin}, nil, nil, nil, nil, nil, nil, users).Routes()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Cookie", "session_token=tok")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/users", `{"username": " bob ", "password": "correct horse"}`)
+	if w.Code != http.StatusCreated { t.Fatalf("create status = %d: %s", w.Code, w.Body) }
+	if strings.Contains(w.Body.String(), "password") { t.Errorf("response exposes the password: %s", w.Body) }
+	var bob database.User
+	json.NewDecoder(w.Body).Decode(&bob)
+	if bob.Username != "bob" || bob.Role != 50 { t.Errorf("created %+v", bob) }
+
+	if w := do(http.MethodPatch, "/api/users/2", `{"role": 10, "disabled": true}`); w.Code != http.StatusOK { t.Fatalf("update status = %d: %s", w.Code, w.Body) }
+	if u := users.users[2]; u.Role != 10 || u.DisabledAt == nil { t.Errorf("updated %+v", u) }
+
+	tests := []struct {
+		method, path, body string
+		wantCode           int
+	}{
+		{http.MethodPost, "/api/users", `{"username": "bob", "password": "correct horse"}`, http.StatusConflict},
+		{http.MethodPost, "/api/users", `{"username": "carol", "password": "short"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/users", `{"username": "carol", "password": "correct horse", "role": 20}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/users", `{"username": "carol smith", "password": "correct horse"}`, http.StatusBadRequest},
+		{http.MethodPatch, "/api/users/2", `{"role": 1}`, http.StatusBadRequest},
+		{http.MethodPatch, "/api/users/9", `{"disabled": true}`, http.StatusNotFound},
+		{http.MethodPatch, "/api/users/1", `{"disabled": true}`, http.StatusConflict},
+		{http.MethodPost, "/api/users/2/password", `{"password": "battery staple"}`, http.StatusNoContent},
+		{http.MethodPost, "/api/users/2/password", `{"password": "short"}`, http.StatusBadRequest},
+		{http.MethodDelete, "/api/users/1", "", http.StatusConflict},
+		{http.MethodDelete, "/api/users/2", "", http.StatusNoContent},
+		{http.MethodGet, "/api/users/2", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := do(tt.method, tt.path, tt.body); w.Code != tt.wantCode { t.Errorf("%s %s %s: status = %d, want %d: %s", tt.method, tt.path, tt.body, w.Code, tt.wantCode, w.Body) }
+	}
+	if users.passwords[2] != "battery staple" { t.Errorf("password = %q, want reset", users.passwords[2]) }
+}
+
+func TestUserManagement_RequiresAdmin(t *testing.T) {
+	viewer := database.User{ID: 2, Username: "bob", Role: 50}
+	s := NewServer(nil, &fakeData{}, &fakeAuth{authUser: viewer}, nil, nil, nil, nil, nil, nil, &fakeUsers{})
+	r := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	r.Header.Set("Cookie", "session_token=tok")
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden { t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden) }
+}
+
+func TestLockouts(t *testing.T) {
+	admin := database.User{ID: 1, Username: "alice", Role: 10}
+	users := &fakeUsers{throttles: []database.LoginThrottle{{Scope: "username", Key: "bob", Failures: 10}, {Scope: "ip", Key: "192.0.2.1", Failures: 3}}}
+	s := NewServer(nil, &fakeData{}, &fakeAuth{authUser: admin}, nil, nil, nil, nil, nil, nil, users).Routes()
+	do := func(method, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Cookie", "session_token=tok")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodGet, "/api/lockouts")
+	var got []database.LoginThrottle
+	json.NewDecoder(w.Body).Decode(&got)
+	if w.Code != http.StatusOK || len(got) != 2 { t.Fatalf("list status = %d, got %+v", w.Code, got) }
+
+	tests := []struct {
+		path     string
+		wantCode int
+	}{
+		{"/api/lockouts?scope=username&key=bob", http.StatusNoContent},
+		{"/api/lockouts?scope=username&key=bob", http.StatusNotFound},
+		{"/api/lockouts?scope=ip&key=192.0.2.1", http.StatusNoContent},
+		{"/api/lockouts?scope=email&key=bob", http.StatusBadRequest},
+		{"/api/lockouts?scope=ip", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := do(http.MethodDelete, tt.path); w.Code != tt.wantCode { t.Errorf("DELETE %s: status = %d, want %d: %s", tt.path, w.Code, tt.wantCode, w.Body) }
+	}
+	if len(users.throttles) != 0 { t.Errorf("throttles left = %+v", users.throttles) }
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sponsor-tracker/internal/database"
+)
+
+// WatchlistStore manages the watchlists of authenticated users. Every method
+// is scoped to the given user's watchlists; found is false for another user's.
+type WatchlistStore interface {
+	ListWatchlists(ctx context.Context, userID int) ([]database.Watchlist, error)
+	CreateWatchlist(ctx context.Context, userID int, name string, orgIDs []int) (database.Watchlist, error)
+	RenameWatchlist(ctx context.Context, userID, id int, name string) (bool, error)
+	DeleteWatchlist(ctx context.Context, userID, id int) (bool, error)
+	AddToWatchlist(ctx context.Context, userID, id int, orgIDs []int) (int, bool, error)
+	RemoveFromWatchlist(ctx context.Context, userID, id, orgID int) (bool, error)
+	ViewWatchlist(ctx context.Context, userID, id int) (*database.WatchlistView, bool, error)
+}
+
+// maxWatchlistBody bounds watchlist request bodies, which hold at most
+// MaxWatchlistSize organisation IDs.
+const maxWatchlistBody = 64 << 10
+
+// watchlistInput is the body of watchlist create, rename and add requests.
+type watchlistInput struct {
+	Name            string `json:"name"`
+	OrganisationIDs []int  `json:"organisation_ids"`
+}
+
+func (s *Server) handleListWatchlists(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	watchlists, err := s.watchlists.ListWatchlists(r.Context(), user.ID)
+	writeJSON(w, watchlists, err)
+}
+
+func (s *Server) handleCreateWatchlist(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	input, err := parseWatchlistInput(w, r)
+	if err == nil { err = validateName(input.Name) }
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+
+	wl, err := s.watchlists.CreateWatchlist(r.Context(), user.ID, strings.TrimSpace(input.Name), input.OrganisationIDs)
+	if errors.Is(err, database.ErrWatchlistNameTaken) || errors.Is(err, database.ErrWatchlistFull) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	writeCreated(w, wl)
+}
+
+func (s *Server) handleGetWatchlist(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	view, found, err := s.watchlists.ViewWatchlist(r.Context(), user.ID, id)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, view, err)
+}
+
+func (s *Server) handleRenameWatchlist(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	input, err := parseWatchlistInput(w, r)
+	if err == nil { err = validateName(input.Name) }
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+
+	found, err := s.watchlists.RenameWatchlist(r.Context(), user.ID, id, strings.TrimSpace(input.Name))
+	if errors.Is(err, database.ErrWatchlistNameTaken) { http.Error(w, err.Error(), http.StatusConflict); return }
+	writeNoContent(w, found, err)
+}
+
+func (s *Server) handleDeleteWatchlist(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	found, err := s.watchlists.DeleteWatchlist(r.Context(), user.ID, id)
+	writeNoContent(w, found, err)
+}
+
+func (s *Server) handleAddToWatchlist(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	input, err := parseWatchlistInput(w, r)
+	if err == nil && len(input.OrganisationIDs) == 0 { err = fmt.Errorf("organisation_ids must not be empty") }
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+
+	added, found, err := s.watchlists.AddToWatchlist(r.Context(), user.ID, id, input.OrganisationIDs)
+	if errors.Is(err, database.ErrWatchlistFull) { http.Error(w, err.Error(), http.StatusConflict); return }
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, struct {
+		Added int `json:"added"`
+	}{added}, err)
+}
+
+func (s *Server) handleRemoveFromWatchlist(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	orgID, err := pathID(r, "org_id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	found, err := s.watchlists.RemoveFromWatchlist(r.Context(), user.ID, id, orgID)
+	writeNoContent(w, found, err)
+}
+
+// parseWatchlistInput decodes a watchlist request body of at most
+// maxWatchlistBody bytes holding at most MaxWatchlistSize organisation IDs.
+func parseWatchlistInput(w http.ResponseWriter, r *http.Request) (watchlistInput, error) {
+	var input watchlistInput
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWatchlistBody)).Decode(&input); err != nil {
+		return watchlistInput{}, fmt.Errorf("invalid request body")
+	}
+	if len(input.OrganisationIDs) > database.MaxWatchlistSize {
+		return watchlistInput{}, fmt.Errorf("organisation_ids must not hold more than %d IDs", database.MaxWatchlistSize)
+	}
+	return input, nil
+}
+
+// validateName checks that a watchlist or saved search name has 1 to 100
+// characters after trimming spaces.
+func validateName(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return fmt.Errorf("name must be between 1 and 100 characters")
+	}
+	return nil
+}
+
+// pathID parses a positive integer path parameter.
+func pathID(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s: must be a positive integer", name)
+	}
+	return id, nil
+}
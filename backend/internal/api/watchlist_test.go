@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sponsor-tracker/internal/database"
+)
+
+// fakeWatchlists is an in-memory WatchlistStore.
+type fakeWatchlists struct {
+	lists  map[int]*database.Watchlist
+	orgs   map[int]map[int]bool
+	nextID int
+}
+
+func newFakeWatchlists() *fakeWatchlists {
+	return &fakeWatchlists{lists: map[int]*database.Watchlist{}, orgs: map[int]map[int]bool{}, nextID: 1}
+}
+
+func (f *fakeWatchlists) find(userID, id int) (*database.Watchlist, bool) {
+	wl, ok := f.lists[id]
+	return wl, ok && wl.UserID == userID
+}
+
+func (f *fakeWatchlists) ListWatchlists(_ context.Context, userID int) ([]database.Watchlist, error) {
+	out := []database.Watchlist{}
+	for _, wl := range f.lists {
+		if wl.UserID == userID { out = append(out, *wl) }
+	}
+	return out, nil
+}
+
+func (f *fakeWatchlists) CreateWatchlist(_ context.Context, userID int, name string, orgIDs []int) (database.Watchlist, error) {
+	for _, wl := range f.lists {
+		if wl.UserID == userID && wl.Name == name { return database.Watchlist{}, database.ErrWatchlistNameTaken }
+	}
+	wl := &database.Watchlist{ID: f.nextID, UserID: userID, Name: name}
+	f.lists[wl.ID], f.orgs[wl.ID] = wl, map[int]bool{}
+	f.nextID++
+	f.AddToWatchlist(context.Background(), userID, wl.ID, orgIDs)
+	return *wl, nil
+}
+
+func (f *fakeWatchlists) RenameWatchlist(_ context.Context, userID, id int, name string) (bool, error) {
+	wl, ok := f.find(userID, id)
+	if ok { wl.Name = name }
+	return ok, nil
+}
+
+func (f *fakeWatchlists) DeleteWatchlist(_ context.Context, userID, id int) (bool, error) {
+	_, ok := f.find(userID, id)
+	if ok { delete(f.lists, id) }
+	return ok, nil
+}
+
+func (f *fakeWatchlists) AddToWatchlist(_ context.Context, userID, id int, orgIDs []int) (int, bool, error) {
+	wl, ok := f.find(userID, id)
+	if !ok { return 0, false, nil }
+	added := 0
+	for _, orgID := range orgIDs {
+		if !f.orgs[id][orgID] { f.orgs[id][orgID] = true; added++ }
+	}
+	wl.OrganisationCount = len(f.orgs[id])
+	return added, true, nil
+}
+
+func (f *fakeWatchlists) RemoveFromWatchlist(_ context.Context, userID, id, orgID int) (bool, error) {
+	wl, ok := f.find(userID, id)
+	if !ok || !f.orgs[id][orgID] { return false, nil }
+	delete(f.orgs[id], orgID)
+	wl.OrganisationCount = len(f.orgs[id])
+	return true, nil
+}
+
+func (f *fakeWatchlists) ViewWatchlist(_ context.Context, userID, id int) (*database.WatchlistView, bool, error) {
+	wl, ok := f.find(userID, id)
+	if !ok { return nil, false, nil }
+	return &database.WatchlistView{Watchlist: *wl, Organisations: []database.WatchedOrganisation{}}, true, nil
+}
+
+func TestWatchlistRoutes(t *testing.T) {
+	alice := database.User{ID: 1, Username: "alice", Role: 50}
+	store := newFakeWatchlists()
+	store.CreateWatchlist(context.Background(), 2, "Bob's list", nil)
+	s := NewServer(nil, &fakeData{}, &fakeAuth{authUser: alice}, store, nil, nil, nil, nil, nil, nil)
+	routes := s.Routes()
+
+	// Each step runs against the state left by the previous ones
+	steps := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"create", "POST", "/api/watchlists", `{"name":" Kent clients ","organisation_ids":[7,8]}`, http.StatusCreated, `"name":"Kent clients","created_at"`},
+		{"duplicate name", "POST", "/api/watchlists", `{"name":"Kent clients"}`, http.StatusConflict, "already exists"},
+		{"missing name", "POST", "/api/watchlists", `{"organisation_ids":[7]}`, http.StatusBadRequest, "name must be"},
+		{"list", "GET", "/api/watchlists", "", http.StatusOK, `"organisation_count":2`},
+		{"add", "POST", "/api/watchlists/2/organisations", `{"organisation_ids":[8,9]}`, http.StatusOK, `{"added":1}`},
+		{"add nothing", "POST", "/api/watchlists/2/organisations", `{"organisation_ids":[]}`, http.StatusBadRequest, "must not be empty"},
+		{"remove", "DELETE", "/api/watchlists/2/organisations/7", "", http.StatusNoContent, ""},
+		{"remove absent", "DELETE", "/api/watchlists/2/organisations/7", "", http.StatusNotFound, ""},
+		{"rename", "PATCH", "/api/watchlists/2", `{"name":"Clients"}`, http.StatusNoContent, ""},
+		{"view", "GET", "/api/watchlists/2", "", http.StatusOK, `"name":"Clients"`},
+		{"another user's list", "GET", "/api/watchlists/1", "", http.StatusNotFound, ""},
+		{"invalid id", "GET", "/api/watchlists/abc", "", http.StatusBadRequest, "invalid id"},
+		{"delete", "DELETE", "/api/watchlists/2", "", http.StatusNoContent, ""},
+		{"deleted", "GET", "/api/watchlists/2", "", http.StatusNotFound, ""},
+	}
+
+	for _, st := range steps {
+		r := httptest.NewRequest(st.method, st.path, strings.NewReader(st.body))
+		r.Header.Set("Cookie", "session_token=tok")
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+
+		if w.Code != st.wantCode { t.Errorf("%s: status = %d, want %d (%s)", st.name, w.Code, st.wantCode, w.Body.String()) }
+		if !strings.Contains(w.Body.String(), st.wantBody) { t.Errorf("%s: body %q does not contain %q", st.name, w.Body.String(), st.wantBody) }
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"sponsor-tracker/internal/database"
+)
+
+// WebhookManager manages webhook subscriptions and their delivery log.
+type WebhookManager interface {
+	ListWebhooks(ctx context.Context) ([]database.Webhook, error)
+	GetWebhook(ctx context.Context, id int) (database.Webhook, bool, error)
+	CreateWebhook(ctx context.Context, wh database.Webhook) (database.Webhook, error)
+	UpdateWebhook(ctx context.Context, wh database.Webhook) (database.Webhook, bool, error)
+	DeleteWebhook(ctx context.Context, id int) (bool, error)
+	GetDeliveries(ctx context.Context, id, limit int) ([]database.WebhookDelivery, bool, error)
+	SendTest(ctx context.Context, id int) (database.WebhookDelivery, bool, error)
+}
+
+// maxWebhookBody bounds webhook request bodies.
+const maxWebhookBody = 16 << 10
+
+// webhookInput is the body of webhook create and update requests.
+type webhookInput struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+	Routes     []string `json:"routes"`
+	Active     *bool    `json:"active"`
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := s.webhooks.ListWebhooks(r.Context())
+	writeJSON(w, webhooks, err)
+}
+
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	wh, err := parseWebhookInput(w, r, true)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	created, err := s.webhooks.CreateWebhook(r.Context(), wh)
+	if err != nil {
+		writeJSON(w, nil, err)
+		return
+	}
+	writeCreated(w, created)
+}
+
+func (s *Server) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	wh, found, err := s.webhooks.GetWebhook(r.Context(), id)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, wh, err)
+}
+
+func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	wh, err := parseWebhookInput(w, r, false)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	wh.ID = id
+	updated, found, err := s.webhooks.UpdateWebhook(r.Context(), wh)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, updated, err)
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	found, err := s.webhooks.DeleteWebhook(r.Context(), id)
+	writeNoContent(w, found, err)
+}
+
+func (s *Server) handleGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	limit := 50
+	if r.URL.Query().Has("limit") {
+		limit, err = extractInt(r, "limit")
+		if err == nil && (limit < 1 || limit > 500) { err = fmt.Errorf("limit must be between 1 and 500") }
+		if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	}
+	deliveries, found, err := s.webhooks.GetDeliveries(r.Context(), id, limit)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, deliveries, err)
+}
+
+func (s *Server) handleTestWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	delivery, found, err := s.webhooks.SendTest(r.Context(), id)
+	if err == nil && !found { http.Error(w, "not found", http.StatusNotFound); return }
+	writeJSON(w, delivery, err)
+}
+
+// parseWebhookInput decodes and validates a webhook request body. url must be
+// an absolute http or https URL of at most 2000 characters. secret must have
+// 16 to 200 characters; it is required on create and kept if omitted on
+// update. event_types must be change event types and routes may hold up to
+// 20 names; both default to all. active defaults to true.
+func parseWebhookInput(w http.ResponseWriter, r *http.Request, requireSecret bool) (database.Webhook, error) {
+	var input webhookInput
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBody)).Decode(&input); err != nil {
+		return database.Webhook{}, fmt.Errorf("invalid request body")
+	}
+
+	u, err := url.Parse(input.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(input.URL) > 2000 {
+		return database.Webhook{}, fmt.Errorf("url must be an absolute http or https URL of at most 2000 characters")
+	}
+	if (requireSecret || input.Secret != "") && (len(input.Secret) < 16 || len(input.Secret) > 200) {
+		return database.Webhook{}, fmt.Errorf("secret must be between 16 and 200 characters")
+	}
+	for _, et := range input.EventTypes {
+		if !slices.Contains(database.EventTypes, et) {
+			return database.Webhook{}, fmt.Errorf("invalid event type %q: must be one of %v", et, database.EventTypes)
+		}
+	}
+	if len(input.Routes) > 20 {
+		return database.Webhook{}, fmt.Errorf("routes must not hold more than 20 routes")
+	}
+	for _, route := range input.Routes {
+		if route == "" || len(route) > 200 {
+			return database.Webhook{}, fmt.Errorf("each route must be between 1 and 200 characters")
+		}
+	}
+
+	wh := database.Webhook{URL: input.URL, Secret: input.Secret, EventTypes: input.EventTypes, Routes: input.Routes, Active: true}
+	if input.Active != nil {
+		wh.Active = *input.Active
+	}
+	return wh, nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sponsor-tracker/internal/database"
+)
+
+func TestParseWebhookInput(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		requireSecret bool
+		want          database.Webhook
+		wantErr       string
+	}{
+		{
+			name:          "create with defaults",
+			body:          `{"url":"https://example.test/hook","secret":"0123456789abcdef"}`,
+			requireSecret: true,
+			want:          database.Webhook{URL: "https://example.test/hook", Secret: "0123456789abcdef", Active: true},
+		},
+		{
+			name: "update with filters keeps secret",
+			body: `{"url":"http://localhost:9000/","event_types":["licence_rerated"],"routes":["Skilled Worker"],"active":false}`,
+			want: database.Webhook{URL: "http://localhost:9000/", EventTypes: []string{"licence_rerated"}, Routes: []string{"Skilled Worker"}},
+		},
+		{name: "missing secret", body: `{"url":"https://example.test/hook"}`, requireSecret: true, wantErr: "secret must be"},
+		{name: "short secret", body: `{"url":"https://example.test/hook","secret":"short"}`, wantErr: "secret must be"},
+		{name: "relative url", body: `{"url":"/hook","secret":"0123456789abcdef"}`, wantErr: "url must be"},
+		{name: "other scheme", body: `{"url":"ftp://example.test/","secret":"0123456789abcdef"}`, wantErr: "url must be"},
+		{name: "unknown event type", body: `{"url":"https://example.test/","event_types":["licence_moved"]}`, wantErr: "invalid event type"},
+		{name: "empty route", body: `{"url":"https://example.test/","routes":[""]}`, wantErr: "each route must be"},
+		{name: "invalid body", body: `{"url":`, wantErr: "invalid request body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(tt.body))
+			got, err := parseWebhookInput(httptest.NewRecorder(), r, tt.requireSecret)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) { t.Errorf("err = %v, want containing %q", err, tt.wantErr) }
+				return
+			}
+			if err != nil { t.Fatalf("unexpected error: %v", err) }
+			if !reflect.DeepEqual(got, tt.want) { t.Errorf("got %+v, want %+v", got, tt.want) }
+		})
+	}
+}
+
+func TestWebhookRoutes_RequireAdmin(t *testing.T) {
+	viewer := database.User{ID: 2, Username: "viewer", Role: 50}
+	s := NewServer(nil, &fakeData{}, &fakeAuth{authUser: viewer}, nil, nil, nil, nil, nil, nil, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/webhooks/1/test", nil)
+	r.Header.Set("Cookie", "session_token=tok")
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden { t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden) }
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -15,6 +16,11 @@ const SessionDuration = 15 * time.Minute
 type UserStore interface {
 	FindUserByID(ctx context.Context, id int) (database.User, bool, error)
 	FindUserByUsername(ctx context.Context, username string) (database.User, bool, error)
+	GetUsers(ctx context.Context) ([]database.User, error)
+	InsertUser(ctx context.Context, u database.User) (int, error)
+	UpdateUser(ctx context.Context, id int, role *int, disabled *bool) (bool, error)
+	SetUserPassword(ctx context.Context, id int, passwordHash, keepSession string) (bool, error)
+	DeleteUser(ctx context.Context, id int) (bool, error)
 }
 
 // SessionStore is the subset of database operations needed by the auth service.
@@ -22,31 +28,53 @@ type SessionStore interface {
 	CreateSession(ctx context.Context, userID int, expiry time.Duration) (string, error)
 	FindSession(ctx context.Context, token string) (database.Session, bool, error)
 	DeleteSession(ctx context.Context, token string) error
+	DeleteUserSessions(ctx context.Context, userID int, except string) error
 	ExtendSession(ctx context.Context, token string, expiry time.Duration) error
 }
 
-// Service handles authentication logic.
+// ErrWrongPassword is returned by ChangePassword when the current password is wrong.
+var ErrWrongPassword = errors.New("current password is incorrect")
+
+// Service handles authentication logic. New passwords must satisfy policy,
+// and failed logins are limited by throttle; a nil throttle allows unlimited
+// attempts.
 type Service struct {
 	users    UserStore
 	sessions SessionStore
+	policy   *PasswordPolicy
+	throttle *Throttle
 }
 
 // NewService constructs an auth Service.
-func NewService(users UserStore, sessions SessionStore) *Service {
-	return &Service{users: users, sessions: sessions}
+func NewService(users UserStore, sessions SessionStore, policy *PasswordPolicy, throttle *Throttle) *Service {
+	return &Service{users: users, sessions: sessions, policy: policy, throttle: throttle}
 }
 
-// Login verifies credentials and returns a session token on success.
-func (s *Service) Login(ctx context.Context, username, password string) (string, error) {
+// Login verifies credentials and returns a session token on success. It
+// returns a *ThrottledError without checking the password while logins for
+// the username or client IP are refused after too many failures. clientIP
+// may be empty if unknown.
+func (s *Service) Login(ctx context.Context, username, password, clientIP string) (string, error) {
+	attempts, err := s.throttle.reserve(ctx, username, clientIP)
+	if err != nil {
+		var throttled *ThrottledError
+		if errors.As(err, &throttled) {
+			return "", err
+		}
+		return "", fmt.Errorf("login: %w", err)
+	}
 	user, found, err := s.users.FindUserByUsername(ctx, username)
 	if err != nil {
 		return "", fmt.Errorf("login: %w", err)
 	}
-	if !found {
+	if !found || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		if err := s.throttle.fail(ctx); err != nil {
+			return "", fmt.Errorf("login: %w", err)
+		}
 		return "", fmt.Errorf("invalid credentials")
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", fmt.Errorf("invalid credentials")
+	if err := s.throttle.succeed(ctx, attempts); err != nil {
+		return "", fmt.Errorf("login: %w", err)
 	}
 	token, err := s.sessions.CreateSession(ctx, user.ID, SessionDuration)
 	if err != nil {
@@ -82,5 +110,52 @@ func (s *Service) Authenticate(ctx context.Context, token string) (database.User
 	if !found {
 		return database.User{}, fmt.Errorf("authenticate: user not found")
 	}
+	if user.DisabledAt != nil {
+		return database.User{}, fmt.Errorf("authenticate: user disabled")
+	}
 	return user, nil
 }
+
+// ChangePassword replaces a user's password after checking their current one,
+// and logs them out of every session but the one identified by token. A
+// wrong current password counts as a failed login for the user and clientIP,
+// so it returns a *ThrottledError without checking the password while logins
+// are refused. It returns ErrWrongPassword if current is wrong, or an error
+// wrapping ErrWeakPassword if the policy rejects the new password.
+func (s *Service) ChangePassword(ctx context.Context, userID int, token, current, password, clientIP string) error {
+	user, found, err := s.users.FindUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("change password: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("change password: user not found")
+	}
+	attempts, err := s.throttle.reserve(ctx, user.Username, clientIP)
+	if err != nil {
+		var throttled *ThrottledError
+		if errors.As(err, &throttled) {
+			return err
+		}
+		return fmt.Errorf("change password: %w", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(current)); err != nil {
+		if err := s.throttle.fail(ctx); err != nil {
+			return fmt.Errorf("change password: %w", err)
+		}
+		return ErrWrongPassword
+	}
+	if err := s.throttle.succeed(ctx, attempts); err != nil {
+		return fmt.Errorf("change password: %w", err)
+	}
+	if password == current {
+		return fmt.Errorf("%w: must differ from your current password", ErrWeakPassword)
+	}
+	hash, err := s.hashPassword(password, user.Username)
+	if err != nil {
+		return err
+	}
+	if _, err := s.users.SetUserPassword(ctx, userID, hash, token); err != nil {
+		return fmt.Errorf("change password: %w", err)
+	}
+	return nil
+}
@@ -10,10 +10,12 @@ import (
 	"sponsor-tracker/internal/database"
 )
 
-// fakeUserStore is an in-memory UserStore for testing.
+// fakeUserStore is an in-memory UserStore for testing. Setting a password
+// ends the user's sessions in sessions, if set.
 type fakeUserStore struct {
 	byUsername map[string]database.User
 	byID       map[int]database.User
+	sessions   *fakeSessionStore
 	err        error
 }
 
@@ -33,6 +35,57 @@ func (f *fakeUserStore) FindUserByID(_ context.Context, id int) (database.User,
 	return u, ok, nil
 }
 
+func (f *fakeUserStore) GetUsers(context.Context) ([]database.User, error) {
+	out := []database.User{}
+	for _, u := range f.byID {
+		out = append(out, u)
+	}
+	return out, f.err
+}
+
+func (f *fakeUserStore) InsertUser(_ context.Context, u database.User) (int, error) {
+	if _, ok := f.byUsername[u.Username]; ok {
+		return 0, database.ErrUsernameTaken
+	}
+	u.ID = len(f.byID) + 1
+	f.put(u)
+	return u.ID, nil
+}
+
+func (f *fakeUserStore) UpdateUser(_ context.Context, id int, role *int, disabled *bool) (bool, error) {
+	u, ok := f.byID[id]
+	if role != nil { u.Role = *role }
+	if disabled != nil && !*disabled { u.DisabledAt = nil }
+	if disabled != nil && *disabled && u.DisabledAt == nil {
+		now := time.Now()
+		u.DisabledAt = &now
+	}
+	if ok { f.put(u) }
+	return ok, nil
+}
+
+func (f *fakeUserStore) SetUserPassword(ctx context.Context, id int, passwordHash, keepSession string) (bool, error) {
+	u, ok := f.byID[id]
+	if !ok { return false, nil }
+	u.PasswordHash = passwordHash
+	f.put(u)
+	if f.sessions != nil { return true, f.sessions.DeleteUserSessions(ctx, id, keepSession) }
+	return true, nil
+}
+
+func (f *fakeUserStore) DeleteUser(_ context.Context, id int) (bool, error) {
+	u, ok := f.byID[id]
+	delete(f.byID, id)
+	delete(f.byUsername, u.Username)
+	return ok, nil
+}
+
+// put stores a user under both keys.
+func (f *fakeUserStore) put(u database.User) {
+	f.byID[u.ID] = u
+	f.byUsername[u.Username] = u
+}
+
 // fakeSessionStore is an in-memory SessionStore for testing.
 type fakeSessionStore struct {
 	sessions  map[string]database.Session
@@ -64,6 +117,13 @@ func (f *fakeSessionStore) DeleteSession(_ context.Context, token string) error
 	return nil
 }
 
+func (f *fakeSessionStore) DeleteUserSessions(_ context.Context, userID int, except string) error {
+	for token, s := range f.sessions {
+		if s.UserID == userID && token != except { delete(f.sessions, token) }
+	}
+	return nil
+}
+
 func (f *fakeSessionStore) ExtendSession(_ context.Context, token string, expiry time.Duration) error {
 	if f.extendErr != nil {
 		return f.extendErr
@@ -125,8 +185,8 @@ func TestService_Login(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			svc := NewService(tt.users, tt.sessions)
-			token, err := svc.Login(context.Background(), tt.username, tt.password)
+			svc := NewService(tt.users, tt.sessions, DefaultPasswordPolicy(), nil)
+			token, err := svc.Login(context.Background(), tt.username, tt.password, "")
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("Login() err = %v, wantErr = %v", err, tt.wantErr)
 			}
@@ -158,7 +218,7 @@ func TestService_Logout(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			svc := NewService(&fakeUserStore{byUsername: map[string]database.User{}, byID: map[int]database.User{}}, tt.sessions)
+			svc := NewService(&fakeUserStore{byUsername: map[string]database.User{}, byID: map[int]database.User{}}, tt.sessions, DefaultPasswordPolicy(), nil)
 			err := svc.Logout(context.Background(), tok)
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("Logout() err = %v, wantErr = %v", err, tt.wantErr)
@@ -197,6 +257,12 @@ func TestService_Authenticate(t *testing.T) {
 			sessions: &fakeSessionStore{sessions: map[string]database.Session{tok: session}, extendErr: errors.New("db down")},
 			wantErr:  true,
 		},
+		{
+			name:     "disabled user",
+			users:    &fakeUserStore{byID: map[int]database.User{1: {ID: 1, Username: "alice", DisabledAt: &session.CreatedAt}}},
+			sessions: &fakeSessionStore{sessions: map[string]database.Session{tok: session}},
+			wantErr:  true,
+		},
 		{
 			name:     "user not found after session",
 			users:    &fakeUserStore{byID: map[int]database.User{}},
@@ -207,7 +273,7 @@ func TestService_Authenticate(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			svc := NewService(tt.users, tt.sessions)
+			svc := NewService(tt.users, tt.sessions, DefaultPasswordPolicy(), nil)
 			user, err := svc.Authenticate(context.Background(), tok)
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("Authenticate() err = %v, wantErr = %v", err, tt.wantErr)
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// Password length limits. bcrypt ignores everything after 72 bytes.
+const (
+	defaultMinPasswordLength = 8
+	maxPasswordBytes         = 72
+)
+
+// PasswordPolicy decides which new passwords are accepted: at least
+// MinLength characters, at most 72 bytes, not the username and not on the
+// list of common and breached passwords.
+type PasswordPolicy struct {
+	MinLength int
+	blocked   map[string]bool
+}
+
+// DefaultPasswordPolicy returns a policy requiring 8 characters and
+// rejecting the common passwords shipped with the application.
+func DefaultPasswordPolicy() *PasswordPolicy {
+	p, _ := newPasswordPolicy(defaultMinPasswordLength, strings.NewReader(commonPasswords))
+	return p
+}
+
+// LoadPasswordPolicy returns a policy requiring minLength characters, or 8
+// if it is zero, and rejecting the shipped common passwords and those in the
+// file at blocklistPath, if given. The file holds one password per line;
+// blank lines and lines starting with # are ignored.
+func LoadPasswordPolicy(minLength int, blocklistPath string) (*PasswordPolicy, error) {
+	if minLength == 0 {
+		minLength = defaultMinPasswordLength
+	}
+	if minLength < 1 || minLength > maxPasswordBytes {
+		return nil, fmt.Errorf("load password policy: min length must be between 1 and %d", maxPasswordBytes)
+	}
+	lists := []io.Reader{strings.NewReader(commonPasswords)}
+	if blocklistPath != "" {
+		f, err := os.Open(blocklistPath)
+		if err != nil {
+			return nil, fmt.Errorf("load password policy: %w", err)
+		}
+		defer f.Close()
+		lists = append(lists, strings.NewReader("\n"), f)
+	}
+	p, err := newPasswordPolicy(minLength, io.MultiReader(lists...))
+	if err != nil {
+		return nil, fmt.Errorf("load password policy: read %s: %w", blocklistPath, err)
+	}
+	return p, nil
+}
+
+func newPasswordPolicy(minLength int, blocklist io.Reader) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{MinLength: minLength, blocked: map[string]bool{}}
+	scanner := bufio.NewScanner(blocklist)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.blocked[strings.ToLower(line)] = true
+	}
+	return p, scanner.Err()
+}
+
+// Check returns an error wrapping ErrWeakPassword if the policy does not
+// accept password for the user with the given username.
+func (p *PasswordPolicy) Check(password, username string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, p.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("%w: must not exceed %d bytes", ErrWeakPassword, maxPasswordBytes)
+	}
+	lower := strings.ToLower(password)
+	if username != "" && lower == strings.ToLower(username) {
+		return fmt.Errorf("%w: must not be your username", ErrWeakPassword)
+	}
+	if p.blocked[lower] {
+		return fmt.Errorf("%w: too common, choose another", ErrWeakPassword)
+	}
+	return nil
+}
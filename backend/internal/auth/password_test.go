@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	p := DefaultPasswordPolicy()
+	tests := []struct {
+		password string
+		wantErr  bool
+	}{
+		{"correct horse", false},
+		{"short", true},
+		{"Password123", true},
+		{"QWERTYUIOP", true},
+		{"alice-smith", true},
+		{"ÄÖÜäöüßé", false},
+		{string(make([]byte, 73)), true},
+	}
+	for _, tt := range tests {
+		err := p.Check(tt.password, "Alice-Smith")
+		if (err != nil) != tt.wantErr { t.Errorf("Check(%q) err = %v, wantErr = %v", tt.password, err, tt.wantErr) }
+		if err != nil && !errors.Is(err, ErrWeakPassword) { t.Errorf("Check(%q) err = %v, want ErrWeakPassword", tt.password, err) }
+	}
+}
+
+func TestLoadPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	os.WriteFile(path, []byte("# ours\nSponsorTracker1\n\n"), 0o600)
+
+	p, err := LoadPasswordPolicy(12, path)
+	if err != nil { t.Fatalf("LoadPasswordPolicy: %v", err) }
+	if err := p.Check("correct horse", ""); err != nil { t.Errorf("accepted password rejected: %v", err) }
+	if err := p.Check("sponsortracker1", ""); err == nil { t.Error("blocklisted password accepted") }
+	if err := p.Check("password1234", ""); err == nil { t.Error("shipped common password accepted") }
+	if err := p.Check("horse staple", ""); err != nil { t.Errorf("12-character password rejected: %v", err) }
+	if err := p.Check("horsestaple", ""); err == nil { t.Error("11-character password accepted") }
+
+	if p, _ := LoadPasswordPolicy(0, ""); p.MinLength != 8 { t.Errorf("default min length = %d, want 8", p.MinLength) }
+	if _, err := LoadPasswordPolicy(8, filepath.Join(t.TempDir(), "missing.txt")); err == nil { t.Error("missing blocklist: expected error") }
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -25,6 +26,44 @@ func (s *PostgresUserStore) FindUserByUsername(ctx context.Context, username str
 	return database.FindUserByUsername(ctx, s.pool, username)
 }
 
+func (s *PostgresUserStore) GetUsers(ctx context.Context) ([]database.User, error) {
+	return database.GetUsers(ctx, s.pool)
+}
+
+func (s *PostgresUserStore) InsertUser(ctx context.Context, u database.User) (int, error) {
+	return database.InsertUser(ctx, s.pool, u)
+}
+
+func (s *PostgresUserStore) UpdateUser(ctx context.Context, id int, role *int, disabled *bool) (bool, error) {
+	return database.UpdateUser(ctx, s.pool, id, role, disabled)
+}
+
+// SetUserPassword sets a user's password hash and ends their sessions other
+// than keepSession in one transaction, returning false if they do not exist.
+func (s *PostgresUserStore) SetUserPassword(ctx context.Context, id int, passwordHash, keepSession string) (bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("set user password: begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	found, err := database.UpdateUserPassword(ctx, tx, id, passwordHash)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := database.DeleteUserSessions(ctx, tx, id, keepSession); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("set user password: commit: %w", err)
+	}
+	return true, nil
+}
+
+func (s *PostgresUserStore) DeleteUser(ctx context.Context, id int) (bool, error) {
+	return database.DeleteUser(ctx, s.pool, id)
+}
+
 // PostgresSessionStore implements SessionStore using PostgreSQL.
 type PostgresSessionStore struct {
 	pool *pgxpool.Pool
@@ -46,6 +85,39 @@ func (s *PostgresSessionStore) DeleteSession(ctx context.Context, token string)
 	return database.DeleteSession(ctx, s.pool, token)
 }
 
+func (s *PostgresSessionStore) DeleteUserSessions(ctx context.Context, userID int, except string) error {
+	return database.DeleteUserSessions(ctx, s.pool, userID, except)
+}
+
 func (s *PostgresSessionStore) ExtendSession(ctx context.Context, token string, expiry time.Duration) error {
 	return database.ExtendSession(ctx, s.pool, token, expiry)
 }
+
+// PostgresThrottleStore implements ThrottleStore using PostgreSQL.
+type PostgresThrottleStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresThrottleStore(pool *pgxpool.Pool) *PostgresThrottleStore {
+	return &PostgresThrottleStore{pool: pool}
+}
+
+func (s *PostgresThrottleStore) GetLoginThrottles(ctx context.Context, window time.Duration) ([]database.LoginThrottle, error) {
+	return database.GetLoginThrottles(ctx, s.pool, window)
+}
+
+func (s *PostgresThrottleStore) ReserveLoginAttempt(ctx context.Context, scope, key string, limits database.LoginLimits) (database.LoginAttempt, error) {
+	return database.ReserveLoginAttempt(ctx, s.pool, scope, key, limits)
+}
+
+func (s *PostgresThrottleStore) ReleaseLoginAttempt(ctx context.Context, attempt database.LoginAttempt) error {
+	return database.ReleaseLoginAttempt(ctx, s.pool, attempt)
+}
+
+func (s *PostgresThrottleStore) DeleteLoginThrottle(ctx context.Context, scope, key string) (bool, error) {
+	return database.DeleteLoginThrottle(ctx, s.pool, scope, key)
+}
+
+func (s *PostgresThrottleStore) DeleteStaleLoginThrottles(ctx context.Context, window time.Duration) error {
+	return database.DeleteStaleLoginThrottles(ctx, s.pool, window)
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"time"
+
+	"sponsor-tracker/internal/database"
+)
+
+// ThrottleStore is the subset of database operations needed by Throttle.
+type ThrottleStore interface {
+	GetLoginThrottles(ctx context.Context, window time.Duration) ([]database.LoginThrottle, error)
+	ReserveLoginAttempt(ctx context.Context, scope, key string, limits database.LoginLimits) (database.LoginAttempt, error)
+	ReleaseLoginAttempt(ctx context.Context, attempt database.LoginAttempt) error
+	DeleteLoginThrottle(ctx context.Context, scope, key string) (bool, error)
+	DeleteStaleLoginThrottles(ctx context.Context, window time.Duration) error
+}
+
+// ThrottleLimits sets when failed logins slow down and lock out further
+// attempts. From DelayAfter consecutive failures for a username or client
+// IP, each failure refuses logins for BaseDelay, doubling with every further
+// failure up to MaxDelay. From LockoutAfter failures, each failure refuses
+// logins for Lockout. Failures are forgotten after Window without one. Zero
+// values take the defaults in DefaultThrottleLimits.
+type ThrottleLimits struct {
+	UsernameDelayAfter   int
+	UsernameLockoutAfter int
+	IPDelayAfter         int
+	IPLockoutAfter       int
+	BaseDelay            time.Duration
+	MaxDelay             time.Duration
+	Lockout              time.Duration
+	Window               time.Duration
+}
+
+// DefaultThrottleLimits are the limits used for zero ThrottleLimits fields.
+// Client IPs get higher thresholds, as several users may share one.
+var DefaultThrottleLimits = ThrottleLimits{
+	UsernameDelayAfter:   3,
+	UsernameLockoutAfter: 10,
+	IPDelayAfter:         20,
+	IPLockoutAfter:       100,
+	BaseDelay:            time.Second,
+	MaxDelay:             time.Minute,
+	Lockout:              15 * time.Minute,
+	Window:               time.Hour,
+}
+
+// ThrottledError is returned by Login while logins for the username or the
+// client IP are refused.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("too many failed logins, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// Throttle tracks failed logins per username and per client IP and refuses
+// logins after too many. Its state is kept in the database, so it survives
+// restarts and is shared by every API server. A nil Throttle never refuses
+// a login.
+type Throttle struct {
+	store  ThrottleStore
+	limits ThrottleLimits
+}
+
+// NewThrottle constructs a Throttle, filling zero limits from DefaultThrottleLimits.
+func NewThrottle(store ThrottleStore, limits ThrottleLimits) *Throttle {
+	d := DefaultThrottleLimits
+	limits.UsernameDelayAfter = cmp.Or(limits.UsernameDelayAfter, d.UsernameDelayAfter)
+	limits.UsernameLockoutAfter = cmp.Or(limits.UsernameLockoutAfter, d.UsernameLockoutAfter)
+	limits.IPDelayAfter = cmp.Or(limits.IPDelayAfter, d.IPDelayAfter)
+	limits.IPLockoutAfter = cmp.Or(limits.IPLockoutAfter, d.IPLockoutAfter)
+	limits.BaseDelay = cmp.Or(limits.BaseDelay, d.BaseDelay)
+	limits.MaxDelay = cmp.Or(limits.MaxDelay, d.MaxDelay)
+	limits.Lockout = cmp.Or(limits.Lockout, d.Lockout)
+	limits.Window = cmp.Or(limits.Window, d.Window)
+	return &Throttle{store: store, limits: limits}
+}
+
+// reserve counts a login attempt as a failure for the username and client IP
+// before the password is checked, so concurrent attempts cannot all pass
+// before any is counted. It returns a ThrottledError, counting nothing, if
+// logins for either are currently refused. An empty ip is not counted.
+func (t *Throttle) reserve(ctx context.Context, username, ip string) ([]database.LoginAttempt, error) {
+	if t == nil {
+		return nil, nil
+	}
+	var attempts []database.LoginAttempt
+	for _, k := range t.keys(username, ip) {
+		a, err := t.store.ReserveLoginAttempt(ctx, k.scope, k.key, k.limits)
+		if err == nil && !a.Reserved {
+			// A lock set by a concurrent attempt may end before this one reads it
+			err = &ThrottledError{RetryAfter: max(a.RetryAfter(), time.Second)}
+		}
+		if err != nil {
+			for _, a := range attempts {
+				if err := t.store.ReleaseLoginAttempt(ctx, a); err != nil {
+					return nil, err
+				}
+			}
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, nil
+}
+
+// fail leaves the reserved attempts counted as failures, and forgets
+// failures older than the window.
+func (t *Throttle) fail(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.store.DeleteStaleLoginThrottles(ctx, t.limits.Window)
+}
+
+// succeed forgets the failed logins for the username and uncounts the
+// reserved attempt for the client IP. The IP's earlier failures are kept, so
+// logging in to one account does not reset the count for guessing others.
+func (t *Throttle) succeed(ctx context.Context, attempts []database.LoginAttempt) error {
+	for _, a := range attempts {
+		var err error
+		if a.Scope == database.ThrottleUsername {
+			_, err = t.store.DeleteLoginThrottle(ctx, a.Scope, a.Key)
+		} else {
+			err = t.store.ReleaseLoginAttempt(ctx, a)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the usernames and client IPs with recent failed logins or a
+// lock in force.
+func (t *Throttle) List(ctx context.Context) ([]database.LoginThrottle, error) {
+	return t.store.GetLoginThrottles(ctx, t.limits.Window)
+}
+
+// Clear forgets the failed logins of a username or client IP and lifts any
+// lock, returning false if there were none.
+func (t *Throttle) Clear(ctx context.Context, scope, key string) (bool, error) {
+	return t.store.DeleteLoginThrottle(ctx, scope, key)
+}
+
+// throttleKey is a username or client IP with its limits.
+type throttleKey struct {
+	scope, key string
+	limits     database.LoginLimits
+}
+
+func (t *Throttle) keys(username, ip string) []throttleKey {
+	keys := []throttleKey{{database.ThrottleUsername, username, t.limits.login(t.limits.UsernameDelayAfter, t.limits.UsernameLockoutAfter)}}
+	if ip != "" {
+		keys = append(keys, throttleKey{database.ThrottleIP, ip, t.limits.login(t.limits.IPDelayAfter, t.limits.IPLockoutAfter)})
+	}
+	return keys
+}
+
+// login returns the limits for a username or client IP with the given
+// thresholds.
+func (l ThrottleLimits) login(delayAfter, lockoutAfter int) database.LoginLimits {
+	return database.LoginLimits{
+		DelayAfter:   delayAfter,
+		LockoutAfter: lockoutAfter,
+		BaseDelay:    l.BaseDelay,
+		MaxDelay:     l.MaxDelay,
+		Lockout:      l.Lockout,
+		Window:       l.Window,
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"sponsor-tracker/internal/database"
+)
+
+// fakeThrottleStore is an in-memory ThrottleStore for testing, with its own
+// clock standing in for the database's. It does not expire failures after
+// the window.
+type fakeThrottleStore struct {
+	rows map[[2]string]database.LoginThrottle
+	now  time.Time
+}
+
+func (f *fakeThrottleStore) FindLoginThrottle(_ context.Context, scope, key string) (database.LoginThrottle, bool, error) {
+	th, ok := f.rows[[2]string{scope, key}]
+	return th, ok, nil
+}
+
+func (f *fakeThrottleStore) GetLoginThrottles(context.Context, time.Duration) ([]database.LoginThrottle, error) {
+	out := []database.LoginThrottle{}
+	for _, th := range f.rows {
+		out = append(out, th)
+	}
+	return out, nil
+}
+
+func (f *fakeThrottleStore) ReserveLoginAttempt(_ context.Context, scope, key string, l database.LoginLimits) (database.LoginAttempt, error) {
+	a := database.LoginAttempt{Scope: scope, Key: key, Now: f.now}
+	th := f.rows[[2]string{scope, key}]
+	if th.LockedUntil != nil && th.LockedUntil.After(f.now) {
+		a.LockedUntil = th.LockedUntil
+		return a, nil
+	}
+	th.Scope, th.Key = scope, key
+	th.Failures++
+	th.LastFailureAt = f.now
+	th.LockedUntil = nil
+	var wait time.Duration
+	switch {
+	case th.Failures >= l.LockoutAfter:
+		wait = l.Lockout
+	case th.Failures >= l.DelayAfter:
+		wait = min(l.BaseDelay<<min(th.Failures-l.DelayAfter, 30), l.MaxDelay)
+	}
+	if wait > 0 {
+		until := f.now.Add(wait)
+		th.LockedUntil = &until
+	}
+	f.rows[[2]string{scope, key}] = th
+	a.Reserved, a.LockedUntil = true, th.LockedUntil
+	return a, nil
+}
+
+func (f *fakeThrottleStore) ReleaseLoginAttempt(_ context.Context, a database.LoginAttempt) error {
+	th, ok := f.rows[[2]string{a.Scope, a.Key}]
+	if !ok {
+		return nil
+	}
+	th.Failures = max(th.Failures-1, 0)
+	if th.LockedUntil != nil && a.LockedUntil != nil && th.LockedUntil.Equal(*a.LockedUntil) {
+		th.LockedUntil = nil
+	}
+	f.rows[[2]string{a.Scope, a.Key}] = th
+	return nil
+}
+
+func (f *fakeThrottleStore) DeleteLoginThrottle(_ context.Context, scope, key string) (bool, error) {
+	_, ok := f.rows[[2]string{scope, key}]
+	delete(f.rows, [2]string{scope, key})
+	return ok, nil
+}
+
+func (f *fakeThrottleStore) DeleteStaleLoginThrottles(context.Context, time.Duration) error {
+	return nil
+}
+
+func TestService_LoginThrottle(t *testing.T) {
+	ctx := context.Background()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	bob := database.User{ID: 1, Username: "bob", PasswordHash: string(hash), Role: 50}
+	users := &fakeUserStore{byUsername: map[string]database.User{"bob": bob}, byID: map[int]database.User{1: bob}}
+	sessions := &fakeSessionStore{sessions: map[string]database.Session{}, nextToken: "tok"}
+	store := &fakeThrottleStore{rows: map[[2]string]database.LoginThrottle{}, now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	throttle := NewThrottle(store, ThrottleLimits{UsernameDelayAfter: 2, UsernameLockoutAfter: 4, IPDelayAfter: 5, Lockout: time.Hour})
+	svc := NewService(users, sessions, DefaultPasswordPolicy(), throttle)
+
+	// The first failure is not delayed; the second refuses logins for a second
+	if _, err := svc.Login(ctx, "bob", "wrong", "192.0.2.1"); err == nil || errors.As(err, new(*ThrottledError)) { t.Fatalf("first failure: err = %v", err) }
+	svc.Login(ctx, "bob", "wrong", "192.0.2.1")
+	var throttled *ThrottledError
+	if _, err := svc.Login(ctx, "bob", "correct horse", "192.0.2.2"); !errors.As(err, &throttled) || throttled.RetryAfter != time.Second { t.Fatalf("while delayed: err = %v", err) }
+
+	// Once the delay has passed the right password logs in, resetting the
+	// username count but not the IP one
+	store.now = store.now.Add(time.Second)
+	if _, err := svc.Login(ctx, "bob", "correct horse", "192.0.2.1"); err != nil { t.Fatalf("after delay: %v", err) }
+	if _, found, _ := store.FindLoginThrottle(ctx, database.ThrottleUsername, "bob"); found { t.Error("username failures kept after login") }
+	if th, _, _ := store.FindLoginThrottle(ctx, database.ThrottleIP, "192.0.2.1"); th.Failures != 2 { t.Errorf("IP failures = %d, want 2", th.Failures) }
+
+	// Unknown usernames count too, and lock out at the limit
+	for range 4 {
+		store.now = store.now.Add(time.Minute)
+		svc.Login(ctx, "nobody", "wrong", "")
+	}
+	store.now = store.now.Add(59 * time.Minute)
+	if _, err := svc.Login(ctx, "nobody", "wrong", ""); !errors.As(err, &throttled) || throttled.RetryAfter != time.Minute { t.Errorf("locked out: err = %v", err) }
+
+	// Clearing the lock lets the username log in again
+	if found, err := svc.ClearLoginThrottle(ctx, database.ThrottleUsername, "nobody"); err != nil || !found { t.Fatalf("clear = %v, %v", found, err) }
+	if _, err := svc.Login(ctx, "nobody", "wrong", ""); errors.As(err, &throttled) { t.Errorf("after clear: err = %v", err) }
+
+	// The client IP is throttled across usernames
+	for _, username := range []string{"carol", "dave", "erin"} {
+		svc.Login(ctx, username, "wrong", "192.0.2.1")
+	}
+	if _, err := svc.Login(ctx, "bob", "correct horse", "192.0.2.1"); !errors.As(err, &throttled) { t.Errorf("IP throttled: err = %v", err) }
+	if th, _, _ := store.FindLoginThrottle(ctx, database.ThrottleUsername, "bob"); th.Failures != 0 || th.LockedUntil != nil { t.Errorf("refused attempt counted for the username: %+v", th) }
+	if _, err := svc.Login(ctx, "bob", "correct horse", "192.0.2.9"); err != nil { t.Errorf("other IP: %v", err) }
+}
+
+func TestService_ChangePasswordThrottle(t *testing.T) {
+	ctx := context.Background()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	bob := database.User{ID: 1, Username: "bob", PasswordHash: string(hash), Role: 50}
+	users := &fakeUserStore{byUsername: map[string]database.User{"bob": bob}, byID: map[int]database.User{1: bob}}
+	store := &fakeThrottleStore{rows: map[[2]string]database.LoginThrottle{}, now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	throttle := NewThrottle(store, ThrottleLimits{UsernameDelayAfter: 2, UsernameLockoutAfter: 4, Lockout: time.Hour})
+	svc := NewService(users, &fakeSessionStore{sessions: map[string]database.Session{}}, DefaultPasswordPolicy(), throttle)
+
+	// Wrong current passwords count as failed logins for the user and IP
+	svc.ChangePassword(ctx, 1, "tok", "wrong", "battery staple", "192.0.2.1")
+	if err := svc.ChangePassword(ctx, 1, "tok", "wrong", "battery staple", "192.0.2.1"); !errors.Is(err, ErrWrongPassword) { t.Fatalf("second failure: err = %v", err) }
+	if th, _, _ := store.FindLoginThrottle(ctx, database.ThrottleIP, "192.0.2.1"); th.Failures != 2 { t.Errorf("IP failures = %d, want 2", th.Failures) }
+	var throttled *ThrottledError
+	if err := svc.ChangePassword(ctx, 1, "tok", "correct horse", "battery staple", "192.0.2.1"); !errors.As(err, &throttled) { t.Fatalf("while delayed: err = %v", err) }
+	if _, err := svc.Login(ctx, "bob", "correct horse", "192.0.2.2"); !errors.As(err, &throttled) { t.Errorf("login while delayed: err = %v", err) }
+
+	store.now = store.now.Add(time.Second)
+	if err := svc.ChangePassword(ctx, 1, "tok", "correct horse", "battery staple", "192.0.2.1"); err != nil { t.Fatalf("after delay: %v", err) }
+	if _, found, _ := store.FindLoginThrottle(ctx, database.ThrottleUsername, "bob"); found { t.Error("username failures kept after a correct password") }
+}
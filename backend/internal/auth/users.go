@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+	"sponsor-tracker/internal/database"
+)
+
+// bcryptCost is the bcrypt work factor for new password hashes, as used by
+// cmd/createuser.
+const bcryptCost = 12
+
+// ErrWeakPassword is wrapped by the errors returned for passwords that are
+// not accepted; the message says why.
+var ErrWeakPassword = errors.New("password rejected")
+
+// ListUsers returns every user, disabled or not.
+func (s *Service) ListUsers(ctx context.Context) ([]database.User, error) {
+	return s.users.GetUsers(ctx)
+}
+
+// GetUser returns a user by ID, disabled or not.
+func (s *Service) GetUser(ctx context.Context, id int) (database.User, bool, error) {
+	return s.users.FindUserByID(ctx, id)
+}
+
+// CreateUser creates a user with the given password and returns them. It
+// returns database.ErrUsernameTaken if the username is in use.
+func (s *Service) CreateUser(ctx context.Context, username, password string, role int) (database.User, error) {
+	hash, err := s.hashPassword(password, username)
+	if err != nil {
+		return database.User{}, err
+	}
+	id, err := s.users.InsertUser(ctx, database.User{Username: username, PasswordHash: hash, Role: role})
+	if err != nil {
+		return database.User{}, err
+	}
+	user, _, err := s.users.FindUserByID(ctx, id)
+	return user, err
+}
+
+// UpdateUser changes a user's role and disables or re-enables them together,
+// leaving nil fields unchanged, and returns false if they do not exist. A
+// role change takes effect on the user's next request; disabling logs the
+// user out everywhere.
+func (s *Service) UpdateUser(ctx context.Context, id int, role *int, disabled *bool) (bool, error) {
+	found, err := s.users.UpdateUser(ctx, id, role, disabled)
+	if err != nil || !found || disabled == nil || !*disabled {
+		return found, err
+	}
+	if err := s.sessions.DeleteUserSessions(ctx, id, ""); err != nil {
+		return false, fmt.Errorf("disable user: %w", err)
+	}
+	return true, nil
+}
+
+// ResetPassword sets a user's password, returning false if they do not exist.
+// The user is logged out everywhere.
+func (s *Service) ResetPassword(ctx context.Context, id int, password string) (bool, error) {
+	user, found, err := s.users.FindUserByID(ctx, id)
+	if err != nil || !found {
+		return false, err
+	}
+	hash, err := s.hashPassword(password, user.Username)
+	if err != nil {
+		return false, err
+	}
+	return s.users.SetUserPassword(ctx, id, hash, "")
+}
+
+// DeleteUser deletes a user and their sessions, returning false if they do
+// not exist.
+func (s *Service) DeleteUser(ctx context.Context, id int) (bool, error) {
+	return s.users.DeleteUser(ctx, id)
+}
+
+// ListLoginThrottles returns the usernames and client IPs with recent failed
+// logins or a lock in force; see Throttle.List.
+func (s *Service) ListLoginThrottles(ctx context.Context) ([]database.LoginThrottle, error) {
+	if s.throttle == nil {
+		return []database.LoginThrottle{}, nil
+	}
+	return s.throttle.List(ctx)
+}
+
+// ClearLoginThrottle lifts the lock on a username or client IP; see Throttle.Clear.
+func (s *Service) ClearLoginThrottle(ctx context.Context, scope, key string) (bool, error) {
+	if s.throttle == nil {
+		return false, nil
+	}
+	return s.throttle.Clear(ctx, scope, key)
+}
+
+// hashPassword checks a new password for the user with the given username
+// against the policy and hashes it with bcrypt.
+func (s *Service) hashPassword(password, username string) (string, error) {
+	if err := s.policy.Check(password, username); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(hash), nil
+}
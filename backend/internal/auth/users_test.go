@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"sponsor-tracker/internal/database"
+)
+
+func TestService_ManageUsers(t *testing.T) {
+	ctx := context.Background()
+	sessions := &fakeSessionStore{sessions: map[string]database.Session{}, nextToken: "tok"}
+	users := &fakeUserStore{byUsername: map[string]database.User{}, byID: map[int]database.User{}, sessions: sessions}
+	svc := NewService(users, sessions, DefaultPasswordPolicy(), nil)
+
+	if _, err := svc.CreateUser(ctx, "bob", "short", 50); !errors.Is(err, ErrWeakPassword) { t.Errorf("short password: err = %v", err) }
+	bob, err := svc.CreateUser(ctx, "bob", "correct horse", 50)
+	if err != nil { t.Fatalf("create: %v", err) }
+	if bob.Role != 50 || bcrypt.CompareHashAndPassword([]byte(bob.PasswordHash), []byte("correct horse")) != nil { t.Errorf("created %+v", bob) }
+	if _, err := svc.CreateUser(ctx, "bob", "correct horse", 50); !errors.Is(err, database.ErrUsernameTaken) { t.Errorf("duplicate: err = %v", err) }
+
+	// Disabling logs the user out and stops them logging in
+	svc.Login(ctx, "bob", "correct horse", "")
+	admin, yes, no := 10, true, false
+	if found, err := svc.UpdateUser(ctx, bob.ID, &admin, &yes); err != nil || !found { t.Fatalf("disable = %v, %v", found, err) }
+	if len(sessions.sessions) != 0 { t.Errorf("%d sessions left after disabling", len(sessions.sessions)) }
+	if _, err := svc.Authenticate(ctx, "tok"); err == nil { t.Error("disabled user authenticated") }
+	if u := users.byID[bob.ID]; u.Role != 10 || u.DisabledAt == nil { t.Errorf("updated %+v", u) }
+	if found, _ := svc.UpdateUser(ctx, bob.ID, nil, &no); !found { t.Error("enable: not found") }
+	if u := users.byID[bob.ID]; u.Role != 10 || u.DisabledAt != nil { t.Errorf("re-enabled %+v", u) }
+
+	// Resetting the password logs the user out
+	svc.Login(ctx, "bob", "correct horse", "")
+	if found, err := svc.ResetPassword(ctx, bob.ID, "battery staple"); err != nil || !found { t.Fatalf("reset = %v, %v", found, err) }
+	if len(sessions.sessions) != 0 { t.Errorf("%d sessions left after reset", len(sessions.sessions)) }
+	if _, err := svc.Login(ctx, "bob", "battery staple", ""); err != nil { t.Errorf("login with new password: %v", err) }
+	if found, _ := svc.ResetPassword(ctx, 99, "battery staple"); found { t.Error("reset missing user: found") }
+}
+
+func TestService_ChangePassword(t *testing.T) {
+	ctx := context.Background()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	alice := database.User{ID: 1, Username: "alice", PasswordHash: string(hash), Role: 50}
+	sessions := &fakeSessionStore{sessions: map[string]database.Session{
+		"here":  {Token: "here", UserID: 1},
+		"there": {Token: "there", UserID: 1},
+		"bob":   {Token: "bob", UserID: 2},
+	}}
+	users := &fakeUserStore{byUsername: map[string]database.User{"alice": alice}, byID: map[int]database.User{1: alice}, sessions: sessions}
+	svc := NewService(users, sessions, DefaultPasswordPolicy(), nil)
+
+	if err := svc.ChangePassword(ctx, 1, "here", "wrong", "battery staple", ""); !errors.Is(err, ErrWrongPassword) { t.Errorf("wrong current password: err = %v", err) }
+	if err := svc.ChangePassword(ctx, 1, "here", "correct horse", "password123", ""); !errors.Is(err, ErrWeakPassword) { t.Errorf("common password: err = %v", err) }
+	if err := svc.ChangePassword(ctx, 1, "here", "correct horse", "correct horse", ""); !errors.Is(err, ErrWeakPassword) { t.Errorf("unchanged password: err = %v", err) }
+	if len(sessions.sessions) != 3 { t.Errorf("%d sessions after failed changes, want 3", len(sessions.sessions)) }
+
+	if err := svc.ChangePassword(ctx, 1, "here", "correct horse", "battery staple", ""); err != nil { t.Fatalf("change: %v", err) }
+	if bcrypt.CompareHashAndPassword([]byte(users.byID[1].PasswordHash), []byte("battery staple")) != nil { t.Error("password not changed") }
+	if _, ok := sessions.sessions["there"]; ok { t.Error("other session kept") }
+	if _, ok := sessions.sessions["here"]; !ok { t.Error("current session ended") }
+	if _, ok := sessions.sessions["bob"]; !ok { t.Error("another user's session ended") }
+}
@@ -3,8 +3,10 @@ package config
 import (
 	"bufio"
 	"fmt"
+	"net/netip"
 	"os"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -19,14 +21,47 @@ type DatabaseConfig struct {
 
 // ServerConfig holds HTTP server settings
 type ServerConfig struct {
-	Port int `yaml:"port"`
+	Port           int      `yaml:"port"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// SMTPConfig holds outgoing email settings. Email is disabled if Host is empty.
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	From     string `yaml:"from"`
+}
+
+// PasswordConfig holds the policy for new passwords. A zero MinLength means
+// 8. Blocklist optionally names a file of passwords to reject, one per line,
+// in addition to the common passwords shipped with the application.
+type PasswordConfig struct {
+	MinLength int    `yaml:"min_length"`
+	Blocklist string `yaml:"blocklist"`
+}
+
+// LoginThrottleConfig holds the limits on failed logins per username and per
+// client IP. Zero values take the defaults of auth.DefaultThrottleLimits.
+type LoginThrottleConfig struct {
+	UsernameDelayAfter   int           `yaml:"username_delay_after"`
+	UsernameLockoutAfter int           `yaml:"username_lockout_after"`
+	IPDelayAfter         int           `yaml:"ip_delay_after"`
+	IPLockoutAfter       int           `yaml:"ip_lockout_after"`
+	BaseDelay            time.Duration `yaml:"base_delay"`
+	MaxDelay             time.Duration `yaml:"max_delay"`
+	Lockout              time.Duration `yaml:"lockout"`
+	Window               time.Duration `yaml:"window"`
 }
 
 // Config holds all application configuration
 type Config struct {
-	Server       ServerConfig   `yaml:"server"`
-	Database     DatabaseConfig `yaml:"database"`
-	TestDatabase DatabaseConfig `yaml:"test_database"`
+	Server        ServerConfig        `yaml:"server"`
+	Database      DatabaseConfig      `yaml:"database"`
+	TestDatabase  DatabaseConfig      `yaml:"test_database"`
+	SMTP          SMTPConfig          `yaml:"smtp"`
+	Password      PasswordConfig      `yaml:"password"`
+	LoginThrottle LoginThrottleConfig `yaml:"login_throttle"`
 }
 
 // Load reads configuration from config.yaml and .env files.
@@ -65,6 +100,39 @@ func (d *DatabaseConfig) ConnectionString() string {
 		d.User, password, d.Host, d.Port, d.Name)
 }
 
+// TrustedProxyPrefixes parses TrustedProxies, each an IP address or a CIDR
+// range.
+func (s *ServerConfig) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range s.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Enabled reports whether an SMTP server is configured.
+func (s *SMTPConfig) Enabled() bool {
+	return s.Host != ""
+}
+
+// Address returns the host:port of the SMTP server.
+func (s *SMTPConfig) Address() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+// Password returns the SMTP password from the SMTP_PASSWORD environment variable.
+func (s *SMTPConfig) Password() string {
+	return os.Getenv("SMTP_PASSWORD")
+}
+
 // loadEnvFile reads a .env file and sets environment variables
 func loadEnvFile(path string) error {
 	file, err := os.Open(path)
@@ -0,0 +1,301 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AnalyticsDimensions lists the dimensions analytics can be grouped by.
+var AnalyticsDimensions = []string{DimensionRoute, DimensionCounty}
+
+// AnalyticsQuery selects the tenure and churn analytics. GroupBy is
+// DimensionRoute or DimensionCounty; Value, if set, restricts the result to
+// one group.
+type AnalyticsQuery struct {
+	GroupBy string
+	Value   string
+}
+
+// MonthlyChurn is the share of tenures active at the start of a month (UTC)
+// that ended during it. ChurnRate is nil when none were active.
+type MonthlyChurn struct {
+	Month         string   `json:"month"`
+	ActiveAtStart int      `json:"active_at_start"`
+	Removed       int      `json:"removed"`
+	ChurnRate     *float64 `json:"churn_rate"`
+}
+
+// Cohort is the survival curve of the sponsors first seen in a month.
+// Survival[k] is the share whose first tenure was still active at the end of
+// the k-th month after the cohort month, for months that have ended.
+type Cohort struct {
+	Month    string    `json:"month"`
+	Size     int       `json:"size"`
+	Survival []float64 `json:"survival"`
+}
+
+// GroupAnalytics holds the tenure and churn metrics of one route or county.
+// MedianTenureDays is the Kaplan-Meier median over tenures that began after
+// tracking started, counting active tenures as censored; it is nil until
+// half of them are estimated to have ended. RelicensingRate is the share of
+// ended tenures followed by a later tenure of the same sponsor.
+type GroupAnalytics struct {
+	Value            string         `json:"value"`
+	Sponsors         int            `json:"sponsors"`
+	Active           int            `json:"active"`
+	MedianTenureDays *float64       `json:"median_tenure_days"`
+	Removals         int            `json:"removals"`
+	Relicensed       int            `json:"relicensed"`
+	RelicensingRate  *float64       `json:"relicensing_rate"`
+	MonthlyChurn     []MonthlyChurn `json:"monthly_churn"`
+	Cohorts          []Cohort       `json:"cohorts"`
+}
+
+// Analytics holds the tenure and churn metrics for every group.
+type Analytics struct {
+	GroupBy       string           `json:"group_by"`
+	TrackingStart *time.Time       `json:"tracking_start"`
+	GeneratedAt   time.Time        `json:"generated_at"`
+	Groups        []GroupAnalytics `json:"groups"`
+}
+
+// tenure is a continuous period in which a sponsor held at least one licence
+// in a group. Start is nil if it began before tracking; End is nil if active.
+type tenure struct {
+	value   string
+	sponsor string
+	start   *time.Time
+	end     *time.Time
+}
+
+// tenureQuery merges each sponsor's licence history within a group into
+// tenures. A sponsor is identified by organisation name, so an organisation
+// that moves keeps its tenure; licences that overlap or follow within
+// rerateWindow, e.g. a re-rating, join the same tenure.
+const tenureQuery = `
+WITH spans AS (
+	SELECT %s AS value, o.name AS sponsor,
+	       COALESCE(l.valid_from, '-infinity') AS s, COALESCE(l.valid_to, 'infinity') AS e
+	FROM licences l
+	JOIN organisations o ON o.id = l.organisation_id
+), marked AS (
+	SELECT value, sponsor, s, e,
+	       CASE WHEN s <= MAX(e) OVER (PARTITION BY value, sponsor ORDER BY s, e
+	                                   ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING) + INTERVAL '` + rerateWindow + `'
+	            THEN 0 ELSE 1 END AS new_tenure
+	FROM spans
+	WHERE @value = '' OR value = @value
+), numbered AS (
+	SELECT value, sponsor, s, e,
+	       SUM(new_tenure) OVER (PARTITION BY value, sponsor ORDER BY s, e) AS tenure
+	FROM marked
+)
+SELECT value, sponsor, NULLIF(MIN(s), '-infinity'), NULLIF(MAX(e), 'infinity')
+FROM numbered
+GROUP BY value, sponsor, tenure
+ORDER BY value, sponsor, MIN(s)`
+
+// GetAnalytics computes tenure and churn metrics per route or county from the
+// licence history. Monthly churn covers each month from the first sync run to
+// now.
+func GetAnalytics(ctx context.Context, q Querier, aq AnalyticsQuery, now time.Time) (*Analytics, error) {
+	if !slices.Contains(AnalyticsDimensions, aq.GroupBy) {
+		return nil, fmt.Errorf("get analytics: cannot group by %q", aq.GroupBy)
+	}
+
+	result := Analytics{GroupBy: aq.GroupBy, GeneratedAt: now, Groups: []GroupAnalytics{}}
+	first, tracked, err := GetFirstTrackedDay(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("get analytics: %w", err)
+	}
+	if tracked {
+		result.TrackingStart = &first
+	}
+
+	rows, err := q.Query(ctx, fmt.Sprintf(tenureQuery, dimensionExprs[aq.GroupBy]), pgx.NamedArgs{"value": aq.Value})
+	if err != nil {
+		return nil, fmt.Errorf("get analytics: %w", err)
+	}
+	defer rows.Close()
+
+	var tenures []tenure
+	for rows.Next() {
+		var t tenure
+		if err := rows.Scan(&t.value, &t.sponsor, &t.start, &t.end); err != nil {
+			return nil, fmt.Errorf("get analytics: scan row: %w", err)
+		}
+		tenures = append(tenures, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get analytics: %w", err)
+	}
+
+	// Group rows arrive ordered by value
+	for i := 0; i < len(tenures); {
+		j := i
+		for j < len(tenures) && tenures[j].value == tenures[i].value {
+			j++
+		}
+		result.Groups = append(result.Groups, analyseGroup(tenures[i].value, tenures[i:j], result.TrackingStart, now))
+		i = j
+	}
+	return &result, nil
+}
+
+// analyseGroup computes the metrics of one group from its tenures, which are
+// ordered by sponsor and then start.
+func analyseGroup(value string, tenures []tenure, trackingStart *time.Time, now time.Time) GroupAnalytics {
+	g := GroupAnalytics{Value: value, MonthlyChurn: []MonthlyChurn{}, Cohorts: []Cohort{}}
+
+	var durations []float64
+	var ended []bool
+	firstTenures := map[string]tenure{}
+	for i, t := range tenures {
+		if _, seen := firstTenures[t.sponsor]; !seen {
+			firstTenures[t.sponsor] = t
+			g.Sponsors++
+		}
+		if t.end == nil {
+			g.Active++
+		} else {
+			g.Removals++
+			if i+1 < len(tenures) && tenures[i+1].sponsor == t.sponsor {
+				g.Relicensed++
+			}
+		}
+		if t.start != nil {
+			end := now
+			if t.end != nil {
+				end = *t.end
+			}
+			durations = append(durations, end.Sub(*t.start).Hours()/24)
+			ended = append(ended, t.end != nil)
+		}
+	}
+	g.MedianTenureDays = kaplanMeierMedian(durations, ended)
+	g.RelicensingRate = ratio(g.Relicensed, g.Removals)
+
+	if trackingStart == nil {
+		return g
+	}
+	for month := monthStart(*trackingStart); month.Before(now); month = month.AddDate(0, 1, 0) {
+		next := month.AddDate(0, 1, 0)
+		mc := MonthlyChurn{Month: month.Format("2006-01")}
+		for _, t := range tenures {
+			if (t.start == nil || t.start.Before(month)) && (t.end == nil || !t.end.Before(month)) {
+				mc.ActiveAtStart++
+				if t.end != nil && t.end.Before(next) {
+					mc.Removed++
+				}
+			}
+		}
+		mc.ChurnRate = ratio(mc.Removed, mc.ActiveAtStart)
+		g.MonthlyChurn = append(g.MonthlyChurn, mc)
+	}
+
+	g.Cohorts = cohortSurvival(firstTenures, now)
+	return g
+}
+
+// cohortSurvival groups sponsors by the month their first tenure began and
+// returns each cohort's survival curve, oldest cohort first. Sponsors present
+// before tracking began belong to no cohort.
+func cohortSurvival(firstTenures map[string]tenure, now time.Time) []Cohort {
+	byMonth := map[time.Time][]tenure{}
+	for _, t := range firstTenures {
+		if t.start != nil {
+			m := monthStart(*t.start)
+			byMonth[m] = append(byMonth[m], t)
+		}
+	}
+	months := make([]time.Time, 0, len(byMonth))
+	for m := range byMonth {
+		months = append(months, m)
+	}
+	sort.Slice(months, func(i, j int) bool { return months[i].Before(months[j]) })
+
+	cohorts := make([]Cohort, 0, len(months))
+	for _, m := range months {
+		members := byMonth[m]
+		c := Cohort{Month: m.Format("2006-01"), Size: len(members), Survival: []float64{}}
+		for end := m.AddDate(0, 1, 0); !end.After(now); end = end.AddDate(0, 1, 0) {
+			surviving := 0
+			for _, t := range members {
+				if t.end == nil || !t.end.Before(end) {
+					surviving++
+				}
+			}
+			c.Survival = append(c.Survival, round(float64(surviving)/float64(len(members)), 4))
+		}
+		cohorts = append(cohorts, c)
+	}
+	return cohorts
+}
+
+// kaplanMeierMedian returns the Kaplan-Meier estimate of the median duration,
+// where ended reports whether each duration ended (true) or is still running
+// (false, censored). It returns nil if the estimated survival never falls to
+// one half.
+func kaplanMeierMedian(durations []float64, ended []bool) *float64 {
+	idx := make([]int, len(durations))
+	for i := range idx {
+		idx[i] = i
+	}
+	// At equal durations, events come before censorings
+	sort.Slice(idx, func(a, b int) bool {
+		if durations[idx[a]] != durations[idx[b]] {
+			return durations[idx[a]] < durations[idx[b]]
+		}
+		return ended[idx[a]] && !ended[idx[b]]
+	})
+
+	survival := 1.0
+	atRisk := len(idx)
+	for i := 0; i < len(idx); {
+		d := durations[idx[i]]
+		events, removed := 0, 0
+		for i < len(idx) && durations[idx[i]] == d {
+			if ended[idx[i]] {
+				events++
+			}
+			removed++
+			i++
+		}
+		if events > 0 {
+			survival *= 1 - float64(events)/float64(atRisk)
+			if survival <= 0.5 {
+				median := round(d, 1)
+				return &median
+			}
+		}
+		atRisk -= removed
+	}
+	return nil
+}
+
+// monthStart returns midnight UTC on the first day of t's month.
+func monthStart(t time.Time) time.Time {
+	y, m, _ := t.UTC().Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// ratio returns n/d rounded to four places, or nil if d is zero.
+func ratio(n, d int) *float64 {
+	if d == 0 {
+		return nil
+	}
+	r := round(float64(n)/float64(d), 4)
+	return &r
+}
+
+// round rounds x to the given number of decimal places.
+func round(x float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(x*p) / p
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKaplanMeierMedian(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []float64
+		ended     []bool
+		want      *float64
+	}{
+		{"all ended", []float64{10, 20, 30}, []bool{true, true, true}, ptr(20.0)},
+		{"censoring lowers the risk set", []float64{10, 20, 30, 40}, []bool{true, true, false, true}, ptr(20.0)},
+		{"too few ended", []float64{10, 20, 30}, []bool{true, false, false}, nil},
+		{"empty", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := kaplanMeierMedian(tt.durations, tt.ended)
+			if !reflect.DeepEqual(got, tt.want) { t.Errorf("got %v, want %v", deref(got), deref(tt.want)) }
+		})
+	}
+}
+
+func TestAnalyseGroup(t *testing.T) {
+	day := func(m time.Month, d int) *time.Time { v := time.Date(2026, m, d, 0, 0, 0, 0, time.UTC); return &v }
+	tracking := *day(1, 10)
+	now := *day(3, 15)
+
+	// Acme predates tracking and left in February; Beta joined in January,
+	// left in February and came back in March; Gamma joined in January
+	tenures := []tenure{
+		{"Kent", "Acme", nil, day(2, 10)},
+		{"Kent", "Beta", day(1, 20), day(2, 19)},
+		{"Kent", "Beta", day(3, 1), nil},
+		{"Kent", "Gamma", day(1, 25), nil},
+	}
+	g := analyseGroup("Kent", tenures, &tracking, now)
+
+	if g.Sponsors != 3 || g.Active != 2 || g.Removals != 2 || g.Relicensed != 1 {
+		t.Errorf("counts = %d sponsors, %d active, %d removals, %d relicensed", g.Sponsors, g.Active, g.Removals, g.Relicensed)
+	}
+	if deref(g.RelicensingRate) != 0.5 { t.Errorf("relicensing rate = %v", deref(g.RelicensingRate)) }
+	// Acme's start is unknown; Beta's first tenure ended after 30 days with
+	// Beta's second and Gamma's still running
+	if deref(g.MedianTenureDays) != 30.0 { t.Errorf("median = %v, want 30", deref(g.MedianTenureDays)) }
+
+	want := []MonthlyChurn{
+		{Month: "2026-01", ActiveAtStart: 1, Removed: 0, ChurnRate: ptr(0.0)},
+		{Month: "2026-02", ActiveAtStart: 3, Removed: 2, ChurnRate: ptr(0.6667)},
+		{Month: "2026-03", ActiveAtStart: 1, Removed: 0, ChurnRate: ptr(0.0)},
+	}
+	if !reflect.DeepEqual(g.MonthlyChurn, want) { t.Errorf("monthly churn = %+v", g.MonthlyChurn) }
+
+	// January cohort: Beta and Gamma; Beta's first tenure ended in February
+	wantCohorts := []Cohort{{Month: "2026-01", Size: 2, Survival: []float64{1, 0.5}}}
+	if !reflect.DeepEqual(g.Cohorts, wantCohorts) { t.Errorf("cohorts = %+v", g.Cohorts) }
+}
+
+func TestGetAnalytics(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+	pool.Exec(ctx, `DELETE FROM sync_runs`)
+
+	at := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 6, 0, 0, 0, time.UTC) }
+	InsertSyncRun(ctx, pool, SyncRun{StartTime: at(1, 10), EndTime: at(1, 10).Add(time.Minute)})
+
+	// Acme is re-rated in February and moves to another town in March, both
+	// within one tenure; it holds no other route
+	acme, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Dover", County: "Kent"}, true)
+	a1, _ := InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, true)
+	a2, _ := InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: RatingB, Route: "Skilled Worker"}, false)
+	moved, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Deal", County: "Kent"}, false)
+	a3, _ := InsertLicence(ctx, pool, Licence{OrganisationID: moved, LicenceType: "Worker", Rating: RatingB, Route: "Skilled Worker"}, false)
+	pool.Exec(ctx, `UPDATE licences SET valid_to = $2 WHERE id = $1`, a1, at(2, 1))
+	pool.Exec(ctx, `UPDATE licences SET valid_from = $2, valid_to = $3 WHERE id = $1`, a2, at(2, 1), at(3, 1).Add(time.Minute))
+	pool.Exec(ctx, `UPDATE licences SET valid_from = $2 WHERE id = $1`, a3, at(3, 1))
+
+	// Beta joins in January, leaves in February and returns in March
+	beta, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Leeds", County: "West Yorkshire"}, false)
+	b1, _ := InsertLicence(ctx, pool, Licence{OrganisationID: beta, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, false)
+	b2, _ := InsertLicence(ctx, pool, Licence{OrganisationID: beta, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, false)
+	pool.Exec(ctx, `UPDATE licences SET valid_from = $2, valid_to = $3 WHERE id = $1`, b1, at(1, 20), at(2, 20))
+	pool.Exec(ctx, `UPDATE licences SET valid_from = $2 WHERE id = $1`, b2, at(3, 5))
+
+	now := at(3, 15)
+	got, err := GetAnalytics(ctx, pool, AnalyticsQuery{GroupBy: DimensionRoute}, now)
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if len(got.Groups) != 1 || got.Groups[0].Value != "Skilled Worker" { t.Fatalf("groups = %+v", got.Groups) }
+	g := got.Groups[0]
+	if g.Sponsors != 2 || g.Active != 2 || g.Removals != 1 || g.Relicensed != 1 {
+		t.Errorf("counts = %d sponsors, %d active, %d removals, %d relicensed", g.Sponsors, g.Active, g.Removals, g.Relicensed)
+	}
+	if len(g.MonthlyChurn) != 3 || g.MonthlyChurn[1].Removed != 1 { t.Errorf("monthly churn = %+v", g.MonthlyChurn) }
+
+	got, _ = GetAnalytics(ctx, pool, AnalyticsQuery{GroupBy: DimensionCounty, Value: "Kent"}, now)
+	if len(got.Groups) != 1 || got.Groups[0].Sponsors != 1 || got.Groups[0].Removals != 0 { t.Errorf("Kent = %+v", got.Groups) }
+
+	if _, err := GetAnalytics(ctx, pool, AnalyticsQuery{GroupBy: DimensionRating}, now); err == nil { t.Error("expected error grouping by rating") }
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+	pool.Exec(ctx, `DELETE FROM sync_runs`)
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func deref(f *float64) any {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
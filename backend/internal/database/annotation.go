@@ -0,0 +1,432 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Note is a team member's note on an organisation. Author is nil once the
+// author's account is deleted. History holds the note's earlier texts,
+// oldest first.
+type Note struct {
+	ID             int            `json:"id"`
+	OrganisationID int            `json:"organisation_id"`
+	AuthorID       *int           `json:"-"`
+	Author         *string        `json:"author"`
+	Text           string         `json:"text"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	History        []NoteRevision `json:"history"`
+}
+
+// NoteRevision is an earlier text of a note and when it was written.
+type NoteRevision struct {
+	Text      string    `json:"text"`
+	WrittenAt time.Time `json:"written_at"`
+}
+
+// Tag is a team-wide tag and the number of organisations on the register
+// that carry it.
+type Tag struct {
+	Name              string `json:"name"`
+	OrganisationCount int    `json:"organisation_count"`
+}
+
+// OrganisationTag is a tag on an organisation, with who added it and when.
+// TaggedBy is nil once that user's account is deleted.
+type OrganisationTag struct {
+	Name     string    `json:"name"`
+	TaggedBy *string   `json:"tagged_by"`
+	TaggedAt time.Time `json:"tagged_at"`
+}
+
+const noteColumns = `n.id, n.organisation_id, n.author_id, u.username, n.text, n.created_at, n.updated_at`
+
+func scanNote(row pgx.Row) (Note, error) {
+	n := Note{History: []NoteRevision{}}
+	err := row.Scan(&n.ID, &n.OrganisationID, &n.AuthorID, &n.Author, &n.Text, &n.CreatedAt, &n.UpdatedAt)
+	return n, err
+}
+
+// OrganisationExists reports whether an organisation with the ID exists,
+// on the register or not.
+func OrganisationExists(ctx context.Context, q Querier, id int) (bool, error) {
+	var exists bool
+	if err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM organisations WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return false, fmt.Errorf("check organisation exists: %w", err)
+	}
+	return exists, nil
+}
+
+// InsertNote adds a note to an organisation and returns its ID.
+func InsertNote(ctx context.Context, q Querier, orgID, authorID int, text string) (int, error) {
+	var id int
+	err := q.QueryRow(ctx,
+		`INSERT INTO organisation_notes (organisation_id, author_id, text) VALUES ($1, $2, $3) RETURNING id`,
+		orgID, authorID, text,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("insert note: %w", err)
+	}
+	return id, nil
+}
+
+// GetNotes returns an organisation's notes, oldest first, with their history.
+func GetNotes(ctx context.Context, q Querier, orgID int) ([]Note, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+noteColumns+`
+		 FROM organisation_notes n LEFT JOIN users u ON u.id = n.author_id
+		 WHERE n.organisation_id = $1
+		 ORDER BY n.created_at, n.id`,
+		orgID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get notes: %w", err)
+	}
+	defer rows.Close()
+
+	notes := []Note{}
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get notes: scan row: %w", err)
+		}
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get notes: %w", err)
+	}
+	if err := addNoteHistory(ctx, q, notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// FindNote looks up a note on an organisation by ID, with its history.
+// Returns the note and true if found, or empty and false if not found.
+func FindNote(ctx context.Context, q Querier, orgID, id int) (Note, bool, error) {
+	n, err := scanNote(q.QueryRow(ctx,
+		`SELECT `+noteColumns+`
+		 FROM organisation_notes n LEFT JOIN users u ON u.id = n.author_id
+		 WHERE n.id = $1 AND n.organisation_id = $2`,
+		id, orgID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Note{}, false, nil
+	}
+	if err != nil {
+		return Note{}, false, fmt.Errorf("find note: %w", err)
+	}
+	notes := []Note{n}
+	if err := addNoteHistory(ctx, q, notes); err != nil {
+		return Note{}, false, err
+	}
+	return notes[0], true, nil
+}
+
+// addNoteHistory fills in the history of each note.
+func addNoteHistory(ctx context.Context, q Querier, notes []Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(notes))
+	ids := make([]int, len(notes))
+	for i, n := range notes {
+		index[n.ID], ids[i] = i, n.ID
+	}
+	rows, err := q.Query(ctx,
+		`SELECT note_id, text, written_at FROM organisation_note_revisions
+		 WHERE note_id = ANY($1) ORDER BY written_at, id`,
+		ids,
+	)
+	if err != nil {
+		return fmt.Errorf("get note history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noteID int
+		var rev NoteRevision
+		if err := rows.Scan(&noteID, &rev.Text, &rev.WrittenAt); err != nil {
+			return fmt.Errorf("get note history: scan row: %w", err)
+		}
+		n := &notes[index[noteID]]
+		n.History = append(n.History, rev)
+	}
+	return rows.Err()
+}
+
+// ReviseNote replaces a note's text, keeping the previous text in its
+// history, and returns false if the note does not exist.
+func ReviseNote(ctx context.Context, q Querier, id int, text string) (bool, error) {
+	_, err := q.Exec(ctx,
+		`INSERT INTO organisation_note_revisions (note_id, text, written_at)
+		 SELECT id, text, updated_at FROM organisation_notes WHERE id = $1`,
+		id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("revise note: %w", err)
+	}
+	tag, err := q.Exec(ctx, `UPDATE organisation_notes SET text = $2, updated_at = NOW() WHERE id = $1`, id, text)
+	if err != nil {
+		return false, fmt.Errorf("revise note: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteNote deletes a note on an organisation and its history, returning
+// false if it does not exist.
+func DeleteNote(ctx context.Context, q Querier, orgID, id int) (bool, error) {
+	tag, err := q.Exec(ctx, `DELETE FROM organisation_notes WHERE id = $1 AND organisation_id = $2`, id, orgID)
+	if err != nil {
+		return false, fmt.Errorf("delete note: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetTags returns every tag ordered by name, with the number of active
+// organisations carrying it.
+func GetTags(ctx context.Context, q Querier) ([]Tag, error) {
+	rows, err := q.Query(ctx,
+		`SELECT t.name, COUNT(o.id)
+		 FROM tags t
+		 LEFT JOIN organisation_tags ot ON ot.tag_id = t.id
+		 LEFT JOIN organisations o ON o.id = ot.organisation_id AND o.deleted_at IS NULL
+		 GROUP BY t.name
+		 ORDER BY t.name`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.Name, &t.OrganisationCount); err != nil {
+			return nil, fmt.Errorf("get tags: scan row: %w", err)
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// GetOrganisationTags returns an organisation's tags ordered by name.
+func GetOrganisationTags(ctx context.Context, q Querier, orgID int) ([]OrganisationTag, error) {
+	rows, err := q.Query(ctx,
+		`SELECT t.name, u.username, ot.tagged_at
+		 FROM organisation_tags ot
+		 JOIN tags t ON t.id = ot.tag_id
+		 LEFT JOIN users u ON u.id = ot.tagged_by
+		 WHERE ot.organisation_id = $1
+		 ORDER BY t.name`,
+		orgID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get organisation tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []OrganisationTag{}
+	for rows.Next() {
+		var t OrganisationTag
+		if err := rows.Scan(&t.Name, &t.TaggedBy, &t.TaggedAt); err != nil {
+			return nil, fmt.Errorf("get organisation tags: scan row: %w", err)
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// TagOrganisation adds a tag to an organisation, creating the tag if it is
+// new, and returns false if the organisation already had it.
+func TagOrganisation(ctx context.Context, q Querier, orgID, userID int, name string) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`WITH t AS (
+			INSERT INTO tags (name) VALUES ($3)
+			ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id
+		 )
+		 INSERT INTO organisation_tags (organisation_id, tag_id, tagged_by)
+		 SELECT $1, t.id, $2 FROM t
+		 ON CONFLICT DO NOTHING`,
+		orgID, userID, name,
+	)
+	if err != nil {
+		return false, fmt.Errorf("tag organisation: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// UntagOrganisation removes a tag from an organisation, returning false if
+// the organisation did not have it. The tag itself is kept.
+func UntagOrganisation(ctx context.Context, q Querier, orgID int, name string) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`DELETE FROM organisation_tags ot USING tags t
+		 WHERE ot.tag_id = t.id AND ot.organisation_id = $1 AND t.name = $2`,
+		orgID, name,
+	)
+	if err != nil {
+		return false, fmt.Errorf("untag organisation: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteTag deletes a tag and removes it from every organisation, returning
+// false if it does not exist.
+func DeleteTag(ctx context.Context, q Querier, name string) (bool, error) {
+	tag, err := q.Exec(ctx, `DELETE FROM tags WHERE name = $1`, name)
+	if err != nil {
+		return false, fmt.Errorf("delete tag: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// CarryAnnotations moves the notes and tags of a closed organisation to its
+// new version after a move (see successorOf) and returns that organisation's
+// ID, or false if there is none. It must be called after the organisation is
+// closed.
+func CarryAnnotations(ctx context.Context, q Querier, orgID int) (int, bool, error) {
+	var successor int
+	err := q.QueryRow(ctx,
+		`SELECT n.id
+		 FROM organisations o
+		 JOIN organisations n ON n.deleted_at IS NULL AND `+successorOf("n", "o")+`
+		 WHERE o.id = $1
+		 ORDER BY n.created_at DESC, n.id DESC
+		 LIMIT 1`,
+		orgID,
+	).Scan(&successor)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("carry annotations: %w", err)
+	}
+
+	if _, err := q.Exec(ctx, `UPDATE organisation_notes SET organisation_id = $2 WHERE organisation_id = $1`, orgID, successor); err != nil {
+		return 0, false, fmt.Errorf("carry annotations: move notes: %w", err)
+	}
+	_, err = q.Exec(ctx,
+		`WITH moved AS (DELETE FROM organisation_tags WHERE organisation_id = $1 RETURNING tag_id, tagged_by, tagged_at)
+		 INSERT INTO organisation_tags (organisation_id, tag_id, tagged_by, tagged_at)
+		 SELECT $2, tag_id, tagged_by, tagged_at FROM moved
+		 ON CONFLICT DO NOTHING`,
+		orgID, successor,
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("carry annotations: move tags: %w", err)
+	}
+	return successor, true, nil
+}
+
+// PostgresAnnotationStore manages notes and tags on organisations in PostgreSQL.
+type PostgresAnnotationStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresAnnotationStore(pool *pgxpool.Pool) *PostgresAnnotationStore {
+	return &PostgresAnnotationStore{pool: pool}
+}
+
+// ListNotes returns an organisation's notes, or false if it does not exist.
+func (s *PostgresAnnotationStore) ListNotes(ctx context.Context, orgID int) ([]Note, bool, error) {
+	if exists, err := OrganisationExists(ctx, s.pool, orgID); err != nil || !exists {
+		return nil, false, err
+	}
+	notes, err := GetNotes(ctx, s.pool, orgID)
+	return notes, err == nil, err
+}
+
+// GetNote returns a note on an organisation; see FindNote.
+func (s *PostgresAnnotationStore) GetNote(ctx context.Context, orgID, id int) (Note, bool, error) {
+	return FindNote(ctx, s.pool, orgID, id)
+}
+
+// AddNote adds a note to an organisation and returns it, or false if the
+// organisation does not exist.
+func (s *PostgresAnnotationStore) AddNote(ctx context.Context, orgID, authorID int, text string) (Note, bool, error) {
+	if exists, err := OrganisationExists(ctx, s.pool, orgID); err != nil || !exists {
+		return Note{}, false, err
+	}
+	id, err := InsertNote(ctx, s.pool, orgID, authorID, text)
+	if err != nil {
+		return Note{}, false, err
+	}
+	return FindNote(ctx, s.pool, orgID, id)
+}
+
+// EditNote replaces the text of a note on an organisation and returns it, or
+// false if it does not exist.
+func (s *PostgresAnnotationStore) EditNote(ctx context.Context, orgID, id int, text string) (Note, bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return Note{}, false, fmt.Errorf("edit note: begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the note so concurrent edits each keep the text they replace
+	var locked int
+	err = tx.QueryRow(ctx, `SELECT id FROM organisation_notes WHERE id = $1 AND organisation_id = $2 FOR UPDATE`, id, orgID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Note{}, false, nil
+	}
+	if err != nil {
+		return Note{}, false, fmt.Errorf("edit note: %w", err)
+	}
+	if _, err := ReviseNote(ctx, tx, id, text); err != nil {
+		return Note{}, false, err
+	}
+	note, _, err := FindNote(ctx, tx, orgID, id)
+	if err != nil {
+		return Note{}, false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Note{}, false, fmt.Errorf("edit note: commit: %w", err)
+	}
+	return note, true, nil
+}
+
+// DeleteNote deletes a note on an organisation; see DeleteNote.
+func (s *PostgresAnnotationStore) DeleteNote(ctx context.Context, orgID, id int) (bool, error) {
+	return DeleteNote(ctx, s.pool, orgID, id)
+}
+
+// ListTags returns every tag; see GetTags.
+func (s *PostgresAnnotationStore) ListTags(ctx context.Context) ([]Tag, error) {
+	return GetTags(ctx, s.pool)
+}
+
+// ListOrganisationTags returns an organisation's tags, or false if it does not exist.
+func (s *PostgresAnnotationStore) ListOrganisationTags(ctx context.Context, orgID int) ([]OrganisationTag, bool, error) {
+	if exists, err := OrganisationExists(ctx, s.pool, orgID); err != nil || !exists {
+		return nil, false, err
+	}
+	tags, err := GetOrganisationTags(ctx, s.pool, orgID)
+	return tags, err == nil, err
+}
+
+// TagOrganisation adds a tag to an organisation, returning false if the
+// organisation does not exist.
+func (s *PostgresAnnotationStore) TagOrganisation(ctx context.Context, orgID, userID int, name string) (bool, error) {
+	if exists, err := OrganisationExists(ctx, s.pool, orgID); err != nil || !exists {
+		return false, err
+	}
+	_, err := TagOrganisation(ctx, s.pool, orgID, userID, name)
+	return err == nil, err
+}
+
+// UntagOrganisation removes a tag from an organisation; see UntagOrganisation.
+func (s *PostgresAnnotationStore) UntagOrganisation(ctx context.Context, orgID int, name string) (bool, error) {
+	return UntagOrganisation(ctx, s.pool, orgID, name)
+}
+
+// DeleteTag deletes a tag everywhere; see DeleteTag.
+func (s *PostgresAnnotationStore) DeleteTag(ctx context.Context, name string) (bool, error) {
+	return DeleteTag(ctx, s.pool, name)
+}
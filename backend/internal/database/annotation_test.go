@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestAnnotationStore(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	cleanup := func() {
+		pool.Exec(ctx, `DELETE FROM organisation_notes`)
+		pool.Exec(ctx, `DELETE FROM organisation_tags`)
+		pool.Exec(ctx, `DELETE FROM tags`)
+		pool.Exec(ctx, `DELETE FROM users WHERE username LIKE 'annotation-test-%'`)
+		pool.Exec(ctx, `DELETE FROM licences`)
+		pool.Exec(ctx, `DELETE FROM organisations`)
+	}
+	cleanup()
+	defer cleanup()
+
+	alice, _ := InsertUser(ctx, pool, User{Username: "annotation-test-alice", PasswordHash: "x", Role: 50})
+	acme, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Dover", County: "Kent"}, false)
+	store := NewPostgresAnnotationStore(pool)
+
+	if _, found, err := store.AddNote(ctx, acme+1000, alice, "Hello"); err != nil || found { t.Errorf("note on missing organisation = %v, %v", found, err) }
+	note, found, err := store.AddNote(ctx, acme, alice, "Called HR")
+	if err != nil || !found { t.Fatalf("add note = %v, %v", found, err) }
+	if note.Author == nil || *note.Author != "annotation-test-alice" || note.Text != "Called HR" || len(note.History) != 0 { t.Errorf("added %+v", note) }
+
+	edited, found, err := store.EditNote(ctx, acme, note.ID, "Called HR twice")
+	if err != nil || !found { t.Fatalf("edit note = %v, %v", found, err) }
+	if edited.Text != "Called HR twice" || len(edited.History) != 1 || edited.History[0].Text != "Called HR" { t.Errorf("edited %+v", edited) }
+	if _, found, _ := store.EditNote(ctx, acme+1000, note.ID, "x"); found { t.Error("edited a note through another organisation") }
+
+	if found, err := store.TagOrganisation(ctx, acme, alice, "priority"); err != nil || !found { t.Fatalf("tag = %v, %v", found, err) }
+	if found, err := store.TagOrganisation(ctx, acme, alice, "priority"); err != nil || !found { t.Errorf("tag again = %v, %v", found, err) }
+	tags, _ := store.ListTags(ctx)
+	if !reflect.DeepEqual(tags, []Tag{{Name: "priority", OrganisationCount: 1}}) { t.Errorf("tags = %+v", tags) }
+
+	// Tags filter organisations, all given tags being required
+	where, args := OrganisationFilter{Tags: []string{"priority"}}.where(facetNone)
+	var n int
+	pool.QueryRow(ctx, `SELECT COUNT(*) FROM organisations o WHERE o.deleted_at IS NULL`+where, args).Scan(&n)
+	if n != 1 { t.Errorf("tagged organisations = %d, want 1", n) }
+	where, args = OrganisationFilter{Tags: []string{"priority", "client"}}.where(facetNone)
+	pool.QueryRow(ctx, `SELECT COUNT(*) FROM organisations o WHERE o.deleted_at IS NULL`+where, args).Scan(&n)
+	if n != 0 { t.Errorf("organisations with both tags = %d, want 0", n) }
+
+	// A move re-adds the organisation under a new ID; its notes and tags follow
+	moved, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Deal", County: "Kent"}, false)
+	CloseOrganisation(ctx, pool, acme)
+	successor, found, err := CarryAnnotations(ctx, pool, acme)
+	if err != nil || !found || successor != moved { t.Fatalf("carry = %d, %v, %v; want %d", successor, found, err, moved) }
+	notes, _, _ := store.ListNotes(ctx, moved)
+	if len(notes) != 1 || notes[0].ID != note.ID || len(notes[0].History) != 1 { t.Errorf("moved notes = %+v", notes) }
+	orgTags, _, _ := store.ListOrganisationTags(ctx, moved)
+	if len(orgTags) != 1 || orgTags[0].Name != "priority" { t.Errorf("moved tags = %+v", orgTags) }
+	if old, _, _ := store.ListOrganisationTags(ctx, acme); len(old) != 0 { t.Errorf("closed organisation still tagged %+v", old) }
+
+	other, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Leeds"}, false)
+	CloseOrganisation(ctx, pool, other)
+	if _, found, _ := CarryAnnotations(ctx, pool, other); found { t.Error("carried annotations without a successor") }
+
+	// A same-name organisation in another town and county is not a move
+	store.AddNote(ctx, moved, alice, "Keep")
+	InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "York", County: "North Yorkshire"}, false)
+	CloseOrganisation(ctx, pool, moved)
+	if _, found, _ := CarryAnnotations(ctx, pool, moved); found { t.Error("carried annotations to a same-name organisation elsewhere") }
+	if notes, _, _ := store.ListNotes(ctx, moved); len(notes) != 2 { t.Errorf("closed organisation kept %d notes, want 2", len(notes)) }
+
+	if found, err := store.UntagOrganisation(ctx, moved, "priority"); err != nil || !found { t.Errorf("untag = %v, %v", found, err) }
+	if found, err := store.DeleteTag(ctx, "priority"); err != nil || !found { t.Errorf("delete tag = %v, %v", found, err) }
+	if found, err := store.DeleteNote(ctx, moved, note.ID); err != nil || !found { t.Errorf("delete note = %v, %v", found, err) }
+}
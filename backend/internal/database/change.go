@@ -0,0 +1,318 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Change event types derived from the temporal columns of organisations and licences.
+const (
+	EventOrganisationAdded   = "organisation_added"
+	EventOrganisationRemoved = "organisation_removed"
+	EventLicenceAdded        = "licence_added"
+	EventLicenceRerated      = "licence_rerated"
+	EventLicenceRemoved      = "licence_removed"
+)
+
+// EventTypes lists every change event type.
+var EventTypes = []string{
+	EventLicenceAdded,
+	EventLicenceRemoved,
+	EventLicenceRerated,
+	EventOrganisationAdded,
+	EventOrganisationRemoved,
+}
+
+// ChangeEvent is a single change to the register.
+// Licence fields are empty for organisation events.
+type ChangeEvent struct {
+	Cursor           string    `json:"cursor"`
+	EventType        string    `json:"event_type"`
+	OccurredAt       time.Time `json:"occurred_at"`
+	OrganisationID   int       `json:"organisation_id"`
+	OrganisationName string    `json:"organisation_name"`
+	TownCity         string    `json:"town_city"`
+	County           string    `json:"county"`
+	LicenceID        *int      `json:"licence_id,omitempty"`
+	LicenceType      string    `json:"licence_type,omitempty"`
+	Route            string    `json:"route,omitempty"`
+	Rating           string    `json:"rating,omitempty"`
+	PreviousRating   string    `json:"previous_rating,omitempty"`
+}
+
+// Describe states the event as a phrase about its organisation, such as
+// "gained a Skilled Worker licence (Worker, A rating)".
+func (ev ChangeEvent) Describe() string {
+	switch ev.EventType {
+	case EventOrganisationAdded:
+		return "added to the register"
+	case EventOrganisationRemoved:
+		return "removed from the register"
+	case EventLicenceAdded:
+		return fmt.Sprintf("gained a %s licence (%s, %s)", ev.Route, ev.LicenceType, ev.Rating)
+	case EventLicenceRemoved:
+		return fmt.Sprintf("lost its %s licence (%s)", ev.Route, ev.LicenceType)
+	case EventLicenceRerated:
+		return fmt.Sprintf("%s licence (%s) re-rated from %s to %s", ev.Route, ev.LicenceType, ev.PreviousRating, ev.Rating)
+	}
+	return ev.EventType
+}
+
+// Key identifies the event by its type, the licence (or, for organisation
+// events, the organisation) it concerns and when it occurred, e.g.
+// "licence_rerated/93/1773295200000000". The temporal columns fix these once
+// a change is made, so the key never changes.
+func (ev ChangeEvent) Key() string {
+	entity := ev.OrganisationID
+	if ev.LicenceID != nil {
+		entity = *ev.LicenceID
+	}
+	return fmt.Sprintf("%s/%d/%d", ev.EventType, entity, ev.OccurredAt.UnixMicro())
+}
+
+// ChangeCursor identifies a position in the change feed.
+// Events are ordered by (OccurredAt, EventType, EntityID), where EntityID is
+// the licence ID for licence events and the organisation ID otherwise.
+type ChangeCursor struct {
+	OccurredAt time.Time `json:"t"`
+	EventType  string    `json:"e"`
+	EntityID   int       `json:"i"`
+}
+
+// EncodeChangeCursor returns the opaque string form of a cursor.
+func EncodeChangeCursor(c ChangeCursor) string {
+	return encodeCursor(c)
+}
+
+// DecodeChangeCursor parses a cursor produced by EncodeChangeCursor.
+func DecodeChangeCursor(s string) (ChangeCursor, error) {
+	var c ChangeCursor
+	if err := decodeCursor(s, &c); err != nil {
+		return ChangeCursor{}, fmt.Errorf("decode change cursor: %w", err)
+	}
+	if c.OccurredAt.IsZero() {
+		return ChangeCursor{}, fmt.Errorf("decode change cursor: missing timestamp")
+	}
+	return c, nil
+}
+
+// ChangeQuery selects a page of the change feed.
+// Events strictly after After are returned. A cursor with an empty EventType
+// and zero EntityID therefore includes events occurring exactly at OccurredAt.
+type ChangeQuery struct {
+	After       ChangeCursor
+	Limit       int
+	Route       string
+	LicenceType string
+	EventTypes  []string // empty = all event types
+}
+
+// ChangesResponse holds a page of the change feed.
+type ChangesResponse struct {
+	Events     []ChangeEvent `json:"events"`
+	NextCursor string        `json:"next_cursor"`
+	HasMore    bool          `json:"has_more"`
+}
+
+// ChangeFilter selects change events by type, route and county; empty fields
+// match every event. A licence event must be on one of Routes. An
+// organisation event has no route, so it matches when the same set of events
+// holds a matching licence event for the organisation, as an organisation's
+// licences are added and removed with it. Counties match case-insensitively.
+type ChangeFilter struct {
+	EventTypes []string
+	Routes     []string
+	Counties   []string
+}
+
+// Apply returns the events that match the filter, in order.
+func (f ChangeFilter) Apply(events []ChangeEvent) []ChangeEvent {
+	orgRoutes := map[int]bool{}
+	for _, ev := range events {
+		if ev.LicenceID != nil && (len(f.Routes) == 0 || slices.Contains(f.Routes, ev.Route)) {
+			orgRoutes[ev.OrganisationID] = true
+		}
+	}
+
+	var matched []ChangeEvent
+	for _, ev := range events {
+		if len(f.EventTypes) > 0 && !slices.Contains(f.EventTypes, ev.EventType) {
+			continue
+		}
+		if len(f.Routes) > 0 {
+			if ev.LicenceID != nil && !slices.Contains(f.Routes, ev.Route) {
+				continue
+			}
+			if ev.LicenceID == nil && !orgRoutes[ev.OrganisationID] {
+				continue
+			}
+		}
+		if len(f.Counties) > 0 && !slices.ContainsFunc(f.Counties, func(c string) bool { return strings.EqualFold(c, ev.County) }) {
+			continue
+		}
+		matched = append(matched, ev)
+	}
+	return matched
+}
+
+// rerateWindow is how close a licence's valid_from must be to its predecessor's
+// valid_to for the pair to be treated as a rating change. The sync closes the
+// old licence and inserts the new one in consecutive statements, so the gap is tiny.
+const rerateWindow = "1 minute"
+
+// changeEventsSince derives change events from the temporal columns.
+// A licence replaced within rerateWindow by one with the same organisation,
+// type and route is reported as a single licence_rerated event. since is a
+// SQL expression, usually a named argument; only events occurring at or after
+// it are derived, which each branch can read from an index on its temporal
+// column. An empty since derives every event.
+func changeEventsSince(since string) string {
+	bound := func(col string) string {
+		if since == "" {
+			return col + " IS NOT NULL"
+		}
+		return col + " >= " + since
+	}
+	return `WITH licence_events AS (
+	SELECT l.valid_from AS occurred_at,
+	       CASE WHEN prev.rating IS NULL THEN 'licence_added' ELSE 'licence_rerated' END AS event_type,
+	       l.id AS entity_id, l.organisation_id, l.id AS licence_id,
+	       l.licence_type, l.route, l.rating, COALESCE(prev.rating, '') AS previous_rating
+	FROM licences l
+	LEFT JOIN LATERAL (
+		SELECT p.rating FROM licences p
+		WHERE p.organisation_id = l.organisation_id
+		  AND p.licence_type = l.licence_type
+		  AND p.route = l.route
+		  AND p.id <> l.id
+		  AND p.rating <> l.rating
+		  AND p.valid_to BETWEEN l.valid_from - INTERVAL '` + rerateWindow + `' AND l.valid_from
+		ORDER BY p.valid_to DESC
+		LIMIT 1
+	) prev ON true
+	WHERE ` + bound("l.valid_from") + `
+	UNION ALL
+	SELECT l.valid_to, 'licence_removed', l.id, l.organisation_id, l.id,
+	       l.licence_type, l.route, l.rating, ''
+	FROM licences l
+	WHERE ` + bound("l.valid_to") + `
+	  AND NOT EXISTS (
+		SELECT 1 FROM licences n
+		WHERE n.organisation_id = l.organisation_id
+		  AND n.licence_type = l.licence_type
+		  AND n.route = l.route
+		  AND n.id <> l.id
+		  AND n.rating <> l.rating
+		  AND n.valid_from BETWEEN l.valid_to AND l.valid_to + INTERVAL '` + rerateWindow + `'
+	  )
+), events AS (
+	SELECT created_at AS occurred_at, 'organisation_added' AS event_type, id AS entity_id,
+	       id AS organisation_id, NULL::integer AS licence_id,
+	       '' AS licence_type, '' AS route, '' AS rating, '' AS previous_rating
+	FROM organisations
+	WHERE ` + bound("created_at") + `
+	UNION ALL
+	SELECT deleted_at, 'organisation_removed', id, id, NULL::integer, '', '', '', ''
+	FROM organisations
+	WHERE ` + bound("deleted_at") + `
+	UNION ALL
+	SELECT * FROM licence_events
+)`
+}
+
+// GetChanges returns the change events after cq.After, oldest first.
+// Route and licence type filters match licence events directly, and match
+// organisation events when the organisation has ever held such a licence.
+func GetChanges(ctx context.Context, q Querier, cq ChangeQuery) ([]ChangeEvent, error) {
+	query := changeEventsSince("@after_time") + `
+		SELECT ` + changeEventColumns + `
+		FROM events e
+		JOIN organisations o ON o.id = e.organisation_id
+		WHERE (e.occurred_at, e.event_type, e.entity_id) > (@after_time, @after_type, @after_id)`
+	args := pgx.NamedArgs{
+		"after_time":   cq.After.OccurredAt,
+		"after_type":   cq.After.EventType,
+		"after_id":     cq.After.EntityID,
+		"route":        cq.Route,
+		"licence_type": cq.LicenceType,
+		"event_types":  cq.EventTypes,
+		"limit":        cq.Limit,
+	}
+	if cq.Route != "" {
+		query += ` AND (e.route = @route OR (e.licence_id IS NULL AND EXISTS (
+			SELECT 1 FROM licences x WHERE x.organisation_id = e.organisation_id AND x.route = @route)))`
+	}
+	if cq.LicenceType != "" {
+		query += ` AND (e.licence_type = @licence_type OR (e.licence_id IS NULL AND EXISTS (
+			SELECT 1 FROM licences x WHERE x.organisation_id = e.organisation_id AND x.licence_type = @licence_type)))`
+	}
+	if len(cq.EventTypes) > 0 {
+		query += ` AND e.event_type = ANY(@event_types)`
+	}
+	query += ` ORDER BY e.occurred_at, e.event_type, e.entity_id`
+	if cq.Limit > 0 {
+		query += ` LIMIT @limit`
+	}
+
+	rows, err := q.Query(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("get changes: %w", err)
+	}
+	events, err := scanChangeEvents(rows)
+	if err != nil {
+		return nil, fmt.Errorf("get changes: %w", err)
+	}
+	return events, nil
+}
+
+// GetOrganisationChanges returns the change events of the given organisations
+// after since, oldest first.
+func GetOrganisationChanges(ctx context.Context, q Querier, orgIDs []int, since time.Time) ([]ChangeEvent, error) {
+	rows, err := q.Query(ctx, changeEventsSince("@since")+`
+		SELECT `+changeEventColumns+`
+		FROM events e
+		JOIN organisations o ON o.id = e.organisation_id
+		WHERE e.organisation_id = ANY(@ids) AND e.occurred_at > @since
+		ORDER BY e.occurred_at, e.event_type, e.entity_id`,
+		pgx.NamedArgs{"ids": orgIDs, "since": since})
+	if err != nil {
+		return nil, fmt.Errorf("get organisation changes: %w", err)
+	}
+	events, err := scanChangeEvents(rows)
+	if err != nil {
+		return nil, fmt.Errorf("get organisation changes: %w", err)
+	}
+	return events, nil
+}
+
+// changeEventColumns are the columns read by scanChangeEvents, selected from
+// events e joined to organisations o.
+const changeEventColumns = `e.occurred_at, e.event_type, e.entity_id, e.organisation_id,
+		       o.name, o.town_city, o.county,
+		       e.licence_id, e.licence_type, e.route, e.rating, e.previous_rating`
+
+// scanChangeEvents reads change events selected with changeEventColumns and
+// closes rows.
+func scanChangeEvents(rows pgx.Rows) ([]ChangeEvent, error) {
+	defer rows.Close()
+
+	events := []ChangeEvent{}
+	for rows.Next() {
+		var ev ChangeEvent
+		var entityID int
+		err := rows.Scan(&ev.OccurredAt, &ev.EventType, &entityID, &ev.OrganisationID,
+			&ev.OrganisationName, &ev.TownCity, &ev.County,
+			&ev.LicenceID, &ev.LicenceType, &ev.Route, &ev.Rating, &ev.PreviousRating)
+		if err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		ev.Cursor = EncodeChangeCursor(ChangeCursor{OccurredAt: ev.OccurredAt, EventType: ev.EventType, EntityID: entityID})
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestChangeCursor_RoundTrip(t *testing.T) {
+	want := ChangeCursor{OccurredAt: time.Date(2026, 3, 1, 9, 30, 0, 123456000, time.UTC), EventType: EventLicenceRerated, EntityID: 7}
+	got, err := DecodeChangeCursor(EncodeChangeCursor(want))
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if !got.OccurredAt.Equal(want.OccurredAt) || got.EventType != want.EventType || got.EntityID != want.EntityID {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for _, bad := range []string{"", "not base64!", "e30"} {
+		if _, err := DecodeChangeCursor(bad); err == nil {
+			t.Errorf("DecodeChangeCursor(%q): expected error", bad)
+		}
+	}
+}
+
+func TestGetChanges_DerivesEventsFromTemporalColumns(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+
+	// Existing org from the initial run: no organisation_added event
+	oldID, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Old Co", TownCity: "Leeds", County: ""}, true)
+	oldLic, _ := InsertLicence(ctx, pool, Licence{OrganisationID: oldID, LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"}, true)
+
+	// Re-rated: close and re-insert with a different rating
+	CloseLicence(ctx, pool, oldLic)
+	InsertLicence(ctx, pool, Licence{OrganisationID: oldID, LicenceType: "Worker", Rating: "B rating", Route: "Skilled Worker"}, false)
+
+	// New org with a licence, then removed
+	newID, _ := InsertOrganisation(ctx, pool, Organisation{Name: "New Co", TownCity: "York", County: ""}, false)
+	newLic, _ := InsertLicence(ctx, pool, Licence{OrganisationID: newID, LicenceType: "Temporary Worker", Rating: "A rating", Route: "Creative Worker"}, false)
+	CloseLicence(ctx, pool, newLic)
+	CloseOrganisation(ctx, pool, newID)
+
+	events, err := GetChanges(ctx, pool, ChangeQuery{})
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+
+	counts := map[string]int{}
+	for _, ev := range events {
+		counts[ev.EventType]++
+		if ev.EventType == EventLicenceRerated && ev.PreviousRating != "A rating" {
+			t.Errorf("rerated previous rating = %q, want A rating", ev.PreviousRating)
+		}
+	}
+	want := map[string]int{
+		EventLicenceRerated:      1,
+		EventOrganisationAdded:   1,
+		EventLicenceAdded:        1,
+		EventLicenceRemoved:      1,
+		EventOrganisationRemoved: 1,
+	}
+	for typ, n := range want {
+		if counts[typ] != n { t.Errorf("%s: got %d events, want %d", typ, counts[typ], n) }
+	}
+
+	// Route filter keeps the org events for an org that held the route
+	events, err = GetChanges(ctx, pool, ChangeQuery{Route: "Creative Worker"})
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if len(events) != 4 { t.Errorf("route filter: got %d events, want 4", len(events)) }
+
+	// Paging by cursor continues after the last event
+	first, err := GetChanges(ctx, pool, ChangeQuery{Limit: 2})
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	after, _ := DecodeChangeCursor(first[1].Cursor)
+	rest, err := GetChanges(ctx, pool, ChangeQuery{After: after})
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if len(rest) != 3 { t.Errorf("after cursor: got %d events, want 3", len(rest)) }
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+}
+
+func TestChangeFilter_Apply(t *testing.T) {
+	lic := func(id int) *int { return &id }
+	events := []ChangeEvent{
+		{EventType: EventOrganisationRemoved, OrganisationID: 1, County: "Kent"},
+		{EventType: EventLicenceRemoved, OrganisationID: 1, County: "Kent", LicenceID: lic(10), Route: "Skilled Worker"},
+		{EventType: EventOrganisationAdded, OrganisationID: 2, County: "Essex"},
+		{EventType: EventLicenceAdded, OrganisationID: 2, County: "Essex", LicenceID: lic(20), Route: "Scale-up"},
+		{EventType: EventLicenceRerated, OrganisationID: 3, County: "", LicenceID: lic(30), Route: "Skilled Worker"},
+	}
+
+	tests := []struct {
+		name   string
+		filter ChangeFilter
+		want   []int // indexes into events
+	}{
+		{"no filters", ChangeFilter{}, []int{0, 1, 2, 3, 4}},
+		{"event types", ChangeFilter{EventTypes: []string{EventLicenceRerated, EventOrganisationAdded}}, []int{2, 4}},
+		{"route includes organisation events with a matching licence", ChangeFilter{Routes: []string{"Skilled Worker"}}, []int{0, 1, 4}},
+		{"county is case-insensitive", ChangeFilter{Counties: []string{"kent"}}, []int{0, 1}},
+		{"all filters", ChangeFilter{EventTypes: []string{EventOrganisationAdded}, Routes: []string{"Scale-up"}, Counties: []string{"Essex"}}, []int{2}},
+		{"no match", ChangeFilter{Routes: []string{"Global Business Mobility"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.filter.Apply(events)
+			if len(got) != len(tt.want) { t.Fatalf("got %d events, want %d", len(got), len(tt.want)) }
+			for i, idx := range tt.want {
+				if got[i].OrganisationID != events[idx].OrganisationID || got[i].EventType != events[idx].EventType { t.Errorf("event %d = %+v, want %+v", i, got[i], events[idx]) }
+			}
+		})
+	}
+}
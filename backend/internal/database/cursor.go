@@ -0,0 +1,65 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// encodeCursor returns the opaque string form of a cursor value.
+func encodeCursor(v any) string {
+	b, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor parses a cursor produced by encodeCursor into v.
+func decodeCursor(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("invalid cursor encoding: %w", err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("invalid cursor: %w", err)
+	}
+	return nil
+}
+
+// PageCursor is a position in a keyset-paginated list of organisations: the
+// sort key and ID of the row to page from. Backward cursors fetch the rows
+// before that position rather than after it.
+type PageCursor struct {
+	Field    string `json:"f"`
+	Desc     bool   `json:"d"`
+	Key      string `json:"k"`
+	ID       int    `json:"i"`
+	Backward bool   `json:"b"`
+}
+
+// Sort returns the sort order the cursor was issued for.
+func (c PageCursor) Sort() OrganisationSort {
+	return OrganisationSort{Field: c.Field, Desc: c.Desc}
+}
+
+// EncodePageCursor returns the opaque string form of a page cursor.
+func EncodePageCursor(c PageCursor) string {
+	return encodeCursor(c)
+}
+
+// DecodePageCursor parses a cursor produced by EncodePageCursor. Its key must
+// be a value of the type of its sort field.
+func DecodePageCursor(s string) (PageCursor, error) {
+	var c PageCursor
+	if err := decodeCursor(s, &c); err != nil {
+		return PageCursor{}, fmt.Errorf("decode page cursor: %w", err)
+	}
+	if !slices.Contains(SortFields, c.Field) || c.ID == 0 {
+		return PageCursor{}, fmt.Errorf("decode page cursor: invalid position")
+	}
+	// The key is cast to the sort column's type in the page query
+	col, err := c.Sort().column(OrganisationFilter{})
+	if err != nil || !col.validKey(c.Key) {
+		return PageCursor{}, fmt.Errorf("decode page cursor: invalid key %q for sort %s", c.Key, c.Field)
+	}
+	return c, nil
+}
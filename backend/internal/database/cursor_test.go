@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPageCursor_RoundTrip(t *testing.T) {
+	want := PageCursor{Field: SortFirstSeen, Desc: true, Key: "2026-03-01 09:30:00+00", ID: 7, Backward: true}
+	got, err := DecodePageCursor(EncodePageCursor(want))
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if got != want { t.Errorf("got %+v, want %+v", got, want) }
+
+	bad := []string{
+		"", "not base64!",
+		EncodePageCursor(PageCursor{Field: "id", ID: 7}),
+		EncodePageCursor(PageCursor{Field: SortName, Key: "Acme"}),
+		EncodePageCursor(PageCursor{Field: SortFirstSeen, Key: "yesterday", ID: 7}),
+		EncodePageCursor(PageCursor{Field: SortLicenceCount, Key: "2.5", ID: 7}),
+		EncodePageCursor(PageCursor{Field: SortRelevance, Key: "high", ID: 7}),
+		EncodePageCursor(PageCursor{Field: SortName, Key: "Ac\x00me", ID: 7}),
+	}
+	good := []PageCursor{
+		{Field: SortFirstSeen, Key: "-infinity", ID: 7},
+		{Field: SortLastRatingChange, Key: "2026-03-01 09:30:00.123456+05:30", ID: 7},
+		{Field: SortLicenceCount, Key: "12", ID: 7},
+		{Field: SortRelevance, Key: "0.6666667", ID: 7},
+		{Field: SortTown, Key: "", ID: 7},
+	}
+	for _, c := range good {
+		if _, err := DecodePageCursor(EncodePageCursor(c)); err != nil { t.Errorf("DecodePageCursor(%+v): %v", c, err) }
+	}
+	for _, s := range bad {
+		if _, err := DecodePageCursor(s); err == nil {
+			t.Errorf("DecodePageCursor(%q): expected error", s)
+		}
+	}
+}
+
+func TestGetAll_KeysetPagination(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+
+	// Two organisations share a town so paging by town relies on the ID tiebreak
+	var ids []int
+	for _, org := range []Organisation{
+		{Name: "Acme Ltd", TownCity: "Leeds"},
+		{Name: "Beta Ltd", TownCity: "Dover"},
+		{Name: "Gamma Ltd", TownCity: "Leeds"},
+		{Name: "Delta Ltd", TownCity: "Bath"},
+		{Name: "Epsilon Ltd", TownCity: "York"},
+	} {
+		id, _ := InsertOrganisation(ctx, pool, org, false)
+		ids = append(ids, id)
+	}
+	want := []int{ids[3], ids[1], ids[0], ids[2], ids[4]}
+
+	reader := NewPostgresDataReader(pool)
+	dq := DataQuery{Limit: 2, Sort: OrganisationSort{Field: SortTown}}
+
+	var got []int
+	var pages []*DataResponse
+	for {
+		page, err := reader.GetAll(ctx, dq)
+		if err != nil { t.Fatalf("unexpected error: %v", err) }
+		pages = append(pages, page)
+		for _, org := range page.Organisations {
+			got = append(got, org.ID)
+		}
+		if page.NextCursor == "" { break }
+		c, err := DecodePageCursor(page.NextCursor)
+		if err != nil { t.Fatalf("decode next cursor: %v", err) }
+		dq.Cursor = &c
+	}
+	if len(pages) != 3 { t.Fatalf("got %d pages, want 3", len(pages)) }
+	if len(got) != len(want) { t.Fatalf("got %v, want %v", got, want) }
+	for i := range want {
+		if got[i] != want[i] { t.Fatalf("got %v, want %v", got, want) }
+	}
+	if pages[0].PrevCursor != "" { t.Errorf("first page has prev cursor") }
+	if pages[0].TotalOrganisations == nil || *pages[0].TotalOrganisations != 5 { t.Errorf("first page total = %v, want 5", pages[0].TotalOrganisations) }
+	if pages[1].TotalOrganisations != nil { t.Errorf("later page total = %d, want none", *pages[1].TotalOrganisations) }
+
+	// Paging back from the last page returns the middle page in sort order
+	c, err := DecodePageCursor(pages[2].PrevCursor)
+	if err != nil { t.Fatalf("decode prev cursor: %v", err) }
+	dq.Cursor = &c
+	back, err := reader.GetAll(ctx, dq)
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if len(back.Organisations) != 2 || back.Organisations[0].ID != want[2] || back.Organisations[1].ID != want[3] {
+		t.Errorf("back page = %+v, want IDs %d,%d", back.Organisations, want[2], want[3])
+	}
+	if back.PrevCursor == "" || back.NextCursor == "" { t.Errorf("middle page should have both cursors") }
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+}
@@ -3,6 +3,8 @@ package database
 import (
 	"context"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -10,12 +12,43 @@ import (
 
 // DataResponse holds a paginated view of the current application state.
 type DataResponse struct {
-	InitialRunTime     string         `json:"initial_run_time"`
-	TotalOrganisations int            `json:"total_organisations"`
-	From               int            `json:"from"`
-	To                 int            `json:"to"`
-	Organisations      []Organisation `json:"organisations"`
-	Licences           []Licence      `json:"licences"`
+	InitialRunTime     string          `json:"initial_run_time"`
+	LastSuccessfulSync *time.Time      `json:"last_successful_sync"`
+	AsOf               *time.Time      `json:"as_of,omitempty"`
+	TotalOrganisations *int            `json:"total_organisations,omitempty"`
+	From               int             `json:"from"`
+	To                 int             `json:"to"`
+	NextCursor         string          `json:"next_cursor,omitempty"`
+	PrevCursor         string          `json:"prev_cursor,omitempty"`
+	Organisations      []Organisation  `json:"organisations"`
+	Licences           []Licence       `json:"licences"`
+	Relevance          map[int]float64 `json:"relevance,omitempty"` // fuzzy search score by organisation ID
+	Facets             *Facets         `json:"facets,omitempty"`
+}
+
+// DataQuery selects the organisations returned by GetAll. A page is addressed
+// either by From and To, 1-based order numbers (To == 0 returns everything),
+// or, when Limit is set, by keyset: the Limit organisations following Cursor,
+// or the first Limit if Cursor is nil. The total is counted for every
+// From/To page but only for the first keyset page, as counting costs as much
+// as reading every page before it. Facet counts are only computed if Facets
+// is set.
+type DataQuery struct {
+	From   int
+	To     int
+	Limit  int
+	Cursor *PageCursor
+	Filter OrganisationFilter
+	Sort   OrganisationSort
+	Facets bool
+}
+
+// SyncRunsResponse holds a paginated list of sync runs, newest first.
+type SyncRunsResponse struct {
+	TotalRuns int       `json:"total_runs"`
+	From      int       `json:"from"`
+	To        int       `json:"to"`
+	Runs      []SyncRun `json:"runs"`
 }
 
 // PostgresDataReader provides read-only access to the current application state.
@@ -27,9 +60,11 @@ func NewPostgresDataReader(pool *pgxpool.Pool) *PostgresDataReader {
 	return &PostgresDataReader{pool: pool}
 }
 
-// GetAll returns a paginated view of the data. from and to are 1-based org
-// order numbers. If to == 0, all organisations and licences are returned.
-func (r *PostgresDataReader) GetAll(ctx context.Context, from, to int, search string) (*DataResponse, error) {
+// GetAll returns a paginated view of the data matching the query's filter, in
+// the query's order, with facet counts if requested. If the filter has AsOf set, the view
+// is of the register as it stood at that instant. Keyset pages carry cursors for the
+// next and previous pages when there are more organisations in that direction.
+func (r *PostgresDataReader) GetAll(ctx context.Context, dq DataQuery) (*DataResponse, error) {
 	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{
 		IsoLevel:   pgx.RepeatableRead,
 		AccessMode: pgx.ReadOnly,
@@ -44,34 +79,254 @@ func (r *PostgresDataReader) GetAll(ctx context.Context, from, to int, search st
 		return nil, fmt.Errorf("get all data: %w", err)
 	}
 
-	total, err := CountAllActiveOrganisations(ctx, tx, search)
+	lastSync, err := GetLastSyncTime(ctx, tx)
 	if err != nil {
 		return nil, fmt.Errorf("get all data: %w", err)
 	}
 
-	orgs, err := GetAllActiveOrganisations(ctx, tx, from, to, search)
+	var total *int
+	if dq.Limit == 0 || dq.Cursor == nil {
+		n, err := CountAllActiveOrganisations(ctx, tx, dq.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("get all data: %w", err)
+		}
+		total = &n
+	}
+
+	var orgs []Organisation
+	var next, prev string
+	if dq.Limit > 0 {
+		orgs, next, prev, err = getKeysetPage(ctx, tx, dq)
+	} else {
+		orgs, err = GetAllActiveOrganisations(ctx, tx, dq.From, dq.To, dq.Filter, dq.Sort)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("get all data: %w", err)
 	}
 
+	var facets *Facets
+	if dq.Facets {
+		if facets, err = GetFacets(ctx, tx, dq.Filter); err != nil {
+			return nil, fmt.Errorf("get all data: %w", err)
+		}
+	}
+
 	licences := []Licence{}
+	var relevance map[int]float64
 	if len(orgs) > 0 {
 		orgIDs := make([]int, len(orgs))
 		for i, org := range orgs {
 			orgIDs[i] = org.ID
 		}
-		licences, err = GetActiveLicencesByOrgIDs(ctx, tx, orgIDs)
+		if dq.Filter.AsOf != nil {
+			licences, err = GetLicencesByOrgIDsAt(ctx, tx, orgIDs, *dq.Filter.AsOf)
+		} else {
+			licences, err = GetActiveLicencesByOrgIDs(ctx, tx, orgIDs)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("get all data: %w", err)
 		}
+		if dq.Filter.fuzzySearch() {
+			relevance, err = GetSearchRelevance(ctx, tx, dq.Filter.Search, orgIDs)
+			if err != nil {
+				return nil, fmt.Errorf("get all data: %w", err)
+			}
+		}
 	}
 
 	return &DataResponse{
 		InitialRunTime:     initialRunTime,
+		LastSuccessfulSync: lastSync,
+		AsOf:               dq.Filter.AsOf,
 		TotalOrganisations: total,
-		From:               from,
-		To:                 to,
+		From:               dq.From,
+		To:                 dq.To,
+		NextCursor:         next,
+		PrevCursor:         prev,
 		Organisations:      orgs,
 		Licences:           licences,
+		Relevance:          relevance,
+		Facets:             facets,
 	}, nil
 }
+
+// getKeysetPage fetches a keyset page in sort order with cursors for the
+// adjacent pages. One extra row is fetched to tell whether another page
+// exists in the paging direction; the opposite direction always has one when
+// paging from a cursor, since the cursor row itself lies there.
+func getKeysetPage(ctx context.Context, q Querier, dq DataQuery) ([]Organisation, string, string, error) {
+	orgs, keys, err := GetActiveOrganisationsPage(ctx, q, dq.Filter, dq.Sort, dq.Cursor, dq.Limit+1)
+	if err != nil {
+		return nil, "", "", err
+	}
+	hasMore := len(orgs) > dq.Limit
+	if hasMore {
+		orgs, keys = orgs[:dq.Limit], keys[:dq.Limit]
+	}
+	backward := dq.Cursor != nil && dq.Cursor.Backward
+	if backward {
+		slices.Reverse(orgs)
+		slices.Reverse(keys)
+	}
+	if len(orgs) == 0 {
+		return orgs, "", "", nil
+	}
+
+	field := dq.Sort.Field
+	if field == "" {
+		field = SortName
+	}
+	cursorAt := func(i int, backward bool) string {
+		return EncodePageCursor(PageCursor{
+			Field:    field,
+			Desc:     dq.Sort.Desc,
+			Key:      keys[i],
+			ID:       orgs[i].ID,
+			Backward: backward,
+		})
+	}
+	var next, prev string
+	if hasMore || backward {
+		next = cursorAt(len(orgs)-1, false)
+	}
+	if dq.Cursor != nil && (hasMore || !backward) {
+		prev = cursorAt(0, true)
+	}
+	return orgs, next, prev, nil
+}
+
+// GetChanges returns a page of the change feed after cq.After.
+// NextCursor is the cursor of the last returned event, or cq.After re-encoded
+// when the page is empty, so clients can keep polling from it.
+func (r *PostgresDataReader) GetChanges(ctx context.Context, cq ChangeQuery) (*ChangesResponse, error) {
+	limit := cq.Limit
+	cq.Limit = limit + 1
+	events, err := GetChanges(ctx, r.pool, cq)
+	if err != nil {
+		return nil, fmt.Errorf("get changes page: %w", err)
+	}
+
+	hasMore := len(events) > limit
+	if hasMore {
+		events = events[:limit]
+	}
+	next := EncodeChangeCursor(cq.After)
+	if len(events) > 0 {
+		next = events[len(events)-1].Cursor
+	}
+	return &ChangesResponse{Events: events, NextCursor: next, HasMore: hasMore}, nil
+}
+
+// CompareRegister returns the differences in the register between two instants.
+// Both snapshots are read in the same transaction so a concurrent sync cannot
+// produce an inconsistent comparison.
+func (r *PostgresDataReader) CompareRegister(ctx context.Context, from, to time.Time) (*RegisterComparison, error) {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("compare register: begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := GetRegisterAt(ctx, tx, from)
+	if err != nil {
+		return nil, fmt.Errorf("compare register: %w", err)
+	}
+	after, err := GetRegisterAt(ctx, tx, to)
+	if err != nil {
+		return nil, fmt.Errorf("compare register: %w", err)
+	}
+
+	diffs, summary := CompareRegisters(before, after)
+	return &RegisterComparison{From: from, To: to, Summary: summary, Organisations: diffs}, nil
+}
+
+// GetSyncRuns returns a page of sync run history. from and to are 1-based
+// order numbers counted from the newest run.
+func (r *PostgresDataReader) GetSyncRuns(ctx context.Context, from, to int) (*SyncRunsResponse, error) {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get sync runs page: begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	total, err := CountSyncRuns(ctx, tx)
+	if err != nil {
+		return nil, fmt.Errorf("get sync runs page: %w", err)
+	}
+	runs, err := GetSyncRuns(ctx, tx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("get sync runs page: %w", err)
+	}
+	return &SyncRunsResponse{TotalRuns: total, From: from, To: to, Runs: runs}, nil
+}
+
+// Suggest returns typeahead suggestions for a name or town prefix.
+func (r *PostgresDataReader) Suggest(ctx context.Context, prefix string, limit int) (*Suggestions, error) {
+	return GetSuggestions(ctx, r.pool, prefix, limit)
+}
+
+// Lookup matches a list of employers against the current register. All rows
+// are matched in the same transaction so the results are consistent.
+func (r *PostgresDataReader) Lookup(ctx context.Context, inputs []LookupInput) (*LookupResponse, error) {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("lookup: begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	return LookupOrganisations(ctx, tx, inputs)
+}
+
+// Export streams the licences of the organisations matching the filter to fn,
+// one row per licence. See StreamExport.
+func (r *PostgresDataReader) Export(ctx context.Context, filter OrganisationFilter, sort OrganisationSort, fn func(ExportRow) error) error {
+	return StreamExport(ctx, r.pool, filter, sort, fn)
+}
+
+// GetStats returns current register totals and the daily series selected by
+// sq, read in one transaction.
+func (r *PostgresDataReader) GetStats(ctx context.Context, sq StatsQuery) (*Stats, error) {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get stats: begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	return GetStats(ctx, tx, sq)
+}
+
+// GetDowngradeReport returns the downgrades and removals selected by dq.
+func (r *PostgresDataReader) GetDowngradeReport(ctx context.Context, dq DowngradeQuery) (*DowngradeReport, error) {
+	return GetDowngradeReport(ctx, r.pool, dq)
+}
+
+// GetAnalytics returns tenure and churn metrics, read in one transaction.
+func (r *PostgresDataReader) GetAnalytics(ctx context.Context, aq AnalyticsQuery) (*Analytics, error) {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get analytics: begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	return GetAnalytics(ctx, tx, aq, time.Now().UTC())
+}
+
+// GetSyncRun returns a single sync run by ID.
+func (r *PostgresDataReader) GetSyncRun(ctx context.Context, id int) (SyncRun, bool, error) {
+	return FindSyncRunByID(ctx, r.pool, id)
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Downgrade report entry kinds.
+const (
+	ReportDowngrade           = "downgrade"            // licence re-rated from A to B
+	ReportLicenceRemoved      = "licence_removed"      // licence removed while its organisation stayed
+	ReportOrganisationRemoved = "organisation_removed" // licence removed with its organisation
+)
+
+// DowngradeQuery selects the downgrade report. Entries occurring at or after
+// From and before To are included. Route and County are optional filters.
+type DowngradeQuery struct {
+	From   time.Time
+	To     time.Time
+	Route  string
+	County string
+}
+
+// DowngradeEntry is one licence downgraded or removed. An organisation that
+// was removed with no active licences has a single entry with empty licence
+// fields. Moved is set for an organisation removal when the sync that removed
+// it added its new version (see successorOf), i.e. its address changed.
+type DowngradeEntry struct {
+	Kind             string    `json:"kind"`
+	OccurredAt       time.Time `json:"occurred_at"`
+	SyncRunID        *int      `json:"sync_run_id"`
+	OrganisationID   int       `json:"organisation_id"`
+	OrganisationName string    `json:"organisation_name"`
+	TownCity         string    `json:"town_city"`
+	County           string    `json:"county"`
+	Moved            bool      `json:"moved,omitempty"`
+	LicenceID        *int      `json:"licence_id,omitempty"`
+	LicenceType      string    `json:"licence_type,omitempty"`
+	Route            string    `json:"route,omitempty"`
+	Rating           string    `json:"rating,omitempty"`
+	PreviousRating   string    `json:"previous_rating,omitempty"`
+}
+
+// DowngradeSummary counts the entries of a downgrade report.
+type DowngradeSummary struct {
+	Downgrades           int `json:"downgrades"`
+	LicencesRemoved      int `json:"licences_removed"`
+	OrganisationsRemoved int `json:"organisations_removed"`
+	OrganisationsMoved   int `json:"organisations_moved"`
+}
+
+// DowngradeReport lists the downgrades and removals in a date window.
+type DowngradeReport struct {
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Route   string           `json:"route,omitempty"`
+	County  string           `json:"county,omitempty"`
+	Summary DowngradeSummary `json:"summary"`
+	Entries []DowngradeEntry `json:"entries"`
+}
+
+// GetDowngradeReport returns every licence re-rated from A to B, removed, or
+// removed with its organisation in the window, oldest first, each with the
+// sync run that observed it. The route filter matches licence entries
+// directly and organisation entries without licences when the organisation
+// has ever held the route.
+func GetDowngradeReport(ctx context.Context, q Querier, dq DowngradeQuery) (*DowngradeReport, error) {
+	query := changeEventsSince("@from") + `,
+	report AS (
+		SELECT e.occurred_at,
+		       CASE WHEN e.event_type = 'licence_rerated' THEN @kind_downgrade
+		            WHEN e.event_type = 'organisation_removed' OR EXISTS (
+		                SELECT 1 FROM organisations ro
+		                WHERE ro.id = e.organisation_id
+		                  AND e.occurred_at BETWEEN ro.deleted_at AND ro.deleted_at + INTERVAL '` + staleWindow + `'
+		            ) THEN @kind_organisation_removed
+		            ELSE @kind_licence_removed END AS kind,
+		       e.organisation_id, e.licence_id, e.licence_type, e.route, e.rating, e.previous_rating
+		FROM events e
+		WHERE e.occurred_at >= @from AND e.occurred_at < @to
+		  AND ((e.event_type = 'licence_rerated' AND e.previous_rating = @rating_a AND e.rating = @rating_b)
+		    OR e.event_type = 'licence_removed'
+		    OR (e.event_type = 'organisation_removed' AND NOT EXISTS (
+		        SELECT 1 FROM licences rl
+		        WHERE rl.organisation_id = e.organisation_id
+		          AND rl.valid_to BETWEEN e.occurred_at AND e.occurred_at + INTERVAL '` + staleWindow + `')))
+	)
+	SELECT r.kind, r.occurred_at, run.id, o.id, o.name, o.town_city, o.county,
+	       r.kind = @kind_organisation_removed AND EXISTS (
+	           SELECT 1 FROM organisations n WHERE ` + successorOf("n", "o") + `),
+	       r.licence_id, r.licence_type, r.route, r.rating, r.previous_rating
+	FROM report r
+	JOIN organisations o ON o.id = r.organisation_id
+	LEFT JOIN LATERAL (
+		SELECT sr.id FROM sync_runs sr
+		WHERE r.occurred_at BETWEEN sr.start_time AND sr.end_time
+		ORDER BY sr.start_time DESC
+		LIMIT 1
+	) run ON true
+	WHERE true`
+	args := pgx.NamedArgs{
+		"from":                      dq.From,
+		"to":                        dq.To,
+		"rating_a":                  RatingA,
+		"rating_b":                  RatingB,
+		"kind_downgrade":            ReportDowngrade,
+		"kind_licence_removed":      ReportLicenceRemoved,
+		"kind_organisation_removed": ReportOrganisationRemoved,
+	}
+	if dq.Route != "" {
+		query += ` AND (r.route = @route OR (r.licence_id IS NULL AND EXISTS (
+			SELECT 1 FROM licences x WHERE x.organisation_id = r.organisation_id AND x.route = @route)))`
+		args["route"] = dq.Route
+	}
+	if dq.County != "" {
+		query += ` AND o.county ILIKE @county`
+		args["county"] = escapeLike(dq.County)
+	}
+	query += ` ORDER BY r.occurred_at, o.name, r.licence_id NULLS FIRST`
+
+	rows, err := q.Query(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("get downgrade report: %w", err)
+	}
+	defer rows.Close()
+
+	report := DowngradeReport{From: dq.From, To: dq.To, Route: dq.Route, County: dq.County, Entries: []DowngradeEntry{}}
+	removed := map[int]bool{}
+	for rows.Next() {
+		var e DowngradeEntry
+		err := rows.Scan(&e.Kind, &e.OccurredAt, &e.SyncRunID, &e.OrganisationID, &e.OrganisationName, &e.TownCity, &e.County,
+			&e.Moved, &e.LicenceID, &e.LicenceType, &e.Route, &e.Rating, &e.PreviousRating)
+		if err != nil {
+			return nil, fmt.Errorf("get downgrade report: scan row: %w", err)
+		}
+		switch e.Kind {
+		case ReportDowngrade:
+			report.Summary.Downgrades++
+		case ReportLicenceRemoved:
+			report.Summary.LicencesRemoved++
+		case ReportOrganisationRemoved:
+			if !removed[e.OrganisationID] {
+				removed[e.OrganisationID] = true
+				report.Summary.OrganisationsRemoved++
+				if e.Moved {
+					report.Summary.OrganisationsMoved++
+				}
+			}
+		}
+		report.Entries = append(report.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get downgrade report: %w", err)
+	}
+	return &report, nil
+}
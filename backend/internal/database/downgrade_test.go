@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetDowngradeReport(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+	pool.Exec(ctx, `DELETE FROM sync_runs`)
+
+	at := func(d, h, m int) time.Time { return time.Date(2026, 3, d, h, m, 0, 0, time.UTC) }
+
+	// 2 March: Acme's Skilled Worker licence is downgraded to B
+	acme, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Dover", County: "Kent"}, true)
+	old, _ := InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, true)
+	rerated, _ := InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: RatingB, Route: "Skilled Worker"}, false)
+	pool.Exec(ctx, `UPDATE licences SET valid_to = $2 WHERE id = $1`, old, at(2, 6, 0))
+	pool.Exec(ctx, `UPDATE licences SET valid_from = $2 WHERE id = $1`, rerated, at(2, 6, 0))
+	InsertSyncRun(ctx, pool, SyncRun{StartTime: at(2, 5, 55), EndTime: at(2, 6, 10)})
+
+	// 3 March: Beta leaves the register, Gamma loses one licence, and Delta
+	// moves from Leeds to Wakefield
+	beta, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Leeds", County: "West Yorkshire"}, true)
+	betaLic, _ := InsertLicence(ctx, pool, Licence{OrganisationID: beta, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, true)
+	gamma, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Gamma Ltd", TownCity: "Dover", County: "Kent"}, true)
+	gammaLic, _ := InsertLicence(ctx, pool, Licence{OrganisationID: gamma, LicenceType: "Temporary Worker", Rating: RatingA, Route: "Creative Worker"}, true)
+	InsertLicence(ctx, pool, Licence{OrganisationID: gamma, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, true)
+	delta, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Delta Ltd", TownCity: "Leeds", County: "West Yorkshire"}, true)
+	deltaLic, _ := InsertLicence(ctx, pool, Licence{OrganisationID: delta, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, true)
+	moved, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Delta Ltd", TownCity: "Wakefield", County: "West Yorkshire"}, false)
+	pool.Exec(ctx, `UPDATE organisations SET created_at = $2 WHERE id = $1`, moved, at(3, 6, 2))
+	pool.Exec(ctx, `UPDATE organisations SET deleted_at = $2 WHERE id = ANY($1)`, []int{beta, delta}, at(3, 6, 5))
+	pool.Exec(ctx, `UPDATE licences SET valid_to = $2 WHERE id = ANY($1)`, []int{betaLic, gammaLic, deltaLic}, at(3, 6, 6))
+	run, _ := InsertSyncRun(ctx, pool, SyncRun{StartTime: at(3, 6, 0), EndTime: at(3, 6, 10)})
+
+	report, err := GetDowngradeReport(ctx, pool, DowngradeQuery{From: at(1, 0, 0), To: at(4, 0, 0)})
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+
+	want := []struct {
+		kind  string
+		name  string
+		moved bool
+	}{
+		{ReportDowngrade, "Acme Ltd", false},
+		{ReportOrganisationRemoved, "Beta Ltd", false},
+		{ReportOrganisationRemoved, "Delta Ltd", true},
+		{ReportLicenceRemoved, "Gamma Ltd", false},
+	}
+	if len(report.Entries) != len(want) { t.Fatalf("got %d entries, want %d: %+v", len(report.Entries), len(want), report.Entries) }
+	for i, w := range want {
+		e := report.Entries[i]
+		if e.Kind != w.kind || e.OrganisationName != w.name || e.Moved != w.moved {
+			t.Errorf("entry %d = %s %s moved=%v, want %s %s moved=%v", i, e.Kind, e.OrganisationName, e.Moved, w.kind, w.name, w.moved)
+		}
+	}
+	if e := report.Entries[0]; e.PreviousRating != RatingA || e.Rating != RatingB || e.SyncRunID == nil { t.Errorf("downgrade = %+v", e) }
+	if e := report.Entries[3]; e.Route != "Creative Worker" || e.SyncRunID == nil || *e.SyncRunID != run { t.Errorf("licence removal = %+v", e) }
+	if report.Summary != (DowngradeSummary{Downgrades: 1, LicencesRemoved: 1, OrganisationsRemoved: 2, OrganisationsMoved: 1}) {
+		t.Errorf("summary = %+v", report.Summary)
+	}
+
+	// Filters narrow the entries; the window excludes 2 March
+	report, _ = GetDowngradeReport(ctx, pool, DowngradeQuery{From: at(3, 0, 0), To: at(4, 0, 0), County: "kent"})
+	if len(report.Entries) != 1 || report.Entries[0].OrganisationName != "Gamma Ltd" { t.Errorf("county filter = %+v", report.Entries) }
+	report, _ = GetDowngradeReport(ctx, pool, DowngradeQuery{From: at(1, 0, 0), To: at(4, 0, 0), Route: "Skilled Worker"})
+	if len(report.Entries) != 3 { t.Errorf("route filter = %+v", report.Entries) }
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+	pool.Exec(ctx, `DELETE FROM sync_runs`)
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// QueuedEmail is an email waiting to be sent, or a record of one sent or
+// abandoned. DedupeKey identifies what the email is about, so the same alert
+// or digest is queued at most once.
+type QueuedEmail struct {
+	ID            int
+	DedupeKey     string
+	Recipient     string
+	Subject       string
+	Body          string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	SentAt        *time.Time
+	FailedAt      *time.Time
+	CreatedAt     time.Time
+}
+
+// EnqueueEmail queues an email for sending. It returns false, queuing
+// nothing, if an email with the same dedupe key was queued before.
+func EnqueueEmail(ctx context.Context, q Querier, e QueuedEmail) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`INSERT INTO email_queue (dedupe_key, recipient, subject, body)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (dedupe_key) DO NOTHING`,
+		e.DedupeKey, e.Recipient, e.Subject, e.Body,
+	)
+	if err != nil {
+		return false, fmt.Errorf("enqueue email: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ClaimDueEmails claims up to limit unsent emails due at now, oldest first,
+// counting an attempt for each. A claimed email is not due again until lease
+// has passed, so concurrent senders never claim the same email and one whose
+// sender stops is retried after the lease.
+func ClaimDueEmails(ctx context.Context, q Querier, now time.Time, lease time.Duration, limit int) ([]QueuedEmail, error) {
+	rows, err := q.Query(ctx,
+		`UPDATE email_queue SET attempts = attempts + 1, next_attempt_at = @now + @lease::interval
+		 WHERE id IN (
+			SELECT id FROM email_queue
+			WHERE sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= @now
+			ORDER BY next_attempt_at, id
+			LIMIT @limit
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id, dedupe_key, recipient, subject, body, attempts, next_attempt_at, last_error, sent_at, failed_at, created_at`,
+		pgx.NamedArgs{"now": now, "lease": lease, "limit": limit},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("claim due emails: %w", err)
+	}
+	defer rows.Close()
+
+	emails := []QueuedEmail{}
+	for rows.Next() {
+		var e QueuedEmail
+		err := rows.Scan(&e.ID, &e.DedupeKey, &e.Recipient, &e.Subject, &e.Body, &e.Attempts,
+			&e.NextAttemptAt, &e.LastError, &e.SentAt, &e.FailedAt, &e.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("claim due emails: scan row: %w", err)
+		}
+		emails = append(emails, e)
+	}
+	return emails, rows.Err()
+}
+
+// MarkEmailSent records that an email was sent.
+func MarkEmailSent(ctx context.Context, q Querier, id int, at time.Time) error {
+	if _, err := q.Exec(ctx, `UPDATE email_queue SET sent_at = $2, last_error = '' WHERE id = $1`, id, at); err != nil {
+		return fmt.Errorf("mark email sent: %w", err)
+	}
+	return nil
+}
+
+// RescheduleEmail records a failed attempt to send an email and when to retry it.
+func RescheduleEmail(ctx context.Context, q Querier, id int, errMsg string, next time.Time) error {
+	if _, err := q.Exec(ctx, `UPDATE email_queue SET last_error = $2, next_attempt_at = $3 WHERE id = $1`, id, errMsg, next); err != nil {
+		return fmt.Errorf("reschedule email: %w", err)
+	}
+	return nil
+}
+
+// AbandonEmail records a failed attempt to send an email after which it will
+// not be retried.
+func AbandonEmail(ctx context.Context, q Querier, id int, errMsg string, at time.Time) error {
+	if _, err := q.Exec(ctx, `UPDATE email_queue SET last_error = $2, failed_at = $3 WHERE id = $1`, id, errMsg, at); err != nil {
+		return fmt.Errorf("abandon email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ExportRow is one licence joined to its organisation, with the temporal
+// columns of both. Nil times mean the record existed before tracking began
+// (CreatedAt, ValidFrom) or is still open (DeletedAt, ValidTo).
+type ExportRow struct {
+	OrganisationID        int        `json:"organisation_id"`
+	Name                  string     `json:"name"`
+	TownCity              string     `json:"town_city"`
+	County                string     `json:"county"`
+	OrganisationCreatedAt *time.Time `json:"organisation_created_at"`
+	OrganisationDeletedAt *time.Time `json:"organisation_deleted_at"`
+	LicenceID             int        `json:"licence_id"`
+	LicenceType           string     `json:"licence_type"`
+	Route                 string     `json:"route"`
+	Rating                string     `json:"rating"`
+	ValidFrom             *time.Time `json:"valid_from"`
+	ValidTo               *time.Time `json:"valid_to"`
+}
+
+// ExportColumns names the fields of ExportRow in order, as in its JSON encoding.
+var ExportColumns = []string{
+	"organisation_id", "name", "town_city", "county", "organisation_created_at", "organisation_deleted_at",
+	"licence_id", "licence_type", "route", "rating", "valid_from", "valid_to",
+}
+
+// StreamExport calls fn for each licence active at filter.AsOf (or now) of
+// each organisation matching the filter, in the sort order and then by
+// licence ID. Organisations with no active licences are not included. It
+// stops at the first error returned by fn.
+func StreamExport(ctx context.Context, q Querier, filter OrganisationFilter, sort OrganisationSort, fn func(ExportRow) error) error {
+	if err := sort.validFor(filter); err != nil {
+		return fmt.Errorf("stream export: %w", err)
+	}
+	orderBy, err := sort.orderBy(filter, false)
+	if err != nil {
+		return fmt.Errorf("stream export: %w", err)
+	}
+	where, args := filter.where(facetNone)
+	query := `SELECT o.id, o.name, COALESCE(o.town_city, ''), COALESCE(o.county, ''), o.created_at, o.deleted_at,
+		        l.id, l.licence_type, l.route, l.rating, l.valid_from, l.valid_to
+		 FROM organisations o
+		 JOIN licences l ON l.organisation_id = o.id AND ` + filter.licenceActive("l") + `
+		 WHERE ` + filter.orgActive("o") + where + orderBy + `, l.id`
+
+	rows, err := q.Query(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("stream export: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row ExportRow
+		err := rows.Scan(&row.OrganisationID, &row.Name, &row.TownCity, &row.County,
+			&row.OrganisationCreatedAt, &row.OrganisationDeletedAt,
+			&row.LicenceID, &row.LicenceType, &row.Route, &row.Rating, &row.ValidFrom, &row.ValidTo)
+		if err != nil {
+			return fmt.Errorf("stream export: scan row: %w", err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("stream export: %w", err)
+	}
+	return nil
+}
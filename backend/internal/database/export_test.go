@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStreamExport_AsOf(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+
+	// Acme was on the register from before tracking and lost its Scale-up
+	// licence; Beta joined after the as_of instant
+	acme, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Dover", County: "Kent"}, true)
+	InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"}, true)
+	scaleUp, _ := InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: "A rating", Route: "Scale-up"}, true)
+	pool.Exec(ctx, `UPDATE licences SET valid_to = NOW() - INTERVAL '1 day' WHERE id = $1`, scaleUp)
+	beta, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Leeds"}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: beta, LicenceType: "Worker", Rating: "B rating", Route: "Skilled Worker"}, false)
+
+	collect := func(filter OrganisationFilter) []ExportRow {
+		t.Helper()
+		var rows []ExportRow
+		err := StreamExport(ctx, pool, filter, OrganisationSort{}, func(row ExportRow) error {
+			rows = append(rows, row)
+			return nil
+		})
+		if err != nil { t.Fatalf("unexpected error: %v", err) }
+		return rows
+	}
+
+	now := collect(OrganisationFilter{})
+	if len(now) != 2 || now[0].Name != "Acme Ltd" || now[0].Route != "Skilled Worker" || now[1].Name != "Beta Ltd" {
+		t.Errorf("current export = %+v", now)
+	}
+
+	asOf := time.Now().Add(-48 * time.Hour)
+	then := collect(OrganisationFilter{AsOf: &asOf})
+	if len(then) != 2 || then[0].OrganisationID != acme || then[1].LicenceID != scaleUp || then[1].ValidTo == nil {
+		t.Errorf("as_of export = %+v, want both Acme licences including the closed one", then)
+	}
+
+	reader := NewPostgresDataReader(pool)
+	data, err := reader.GetAll(ctx, DataQuery{From: 1, To: 10, Filter: OrganisationFilter{AsOf: &asOf}})
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if data.TotalOrganisations == nil || *data.TotalOrganisations != 1 || len(data.Licences) != 2 { t.Errorf("as_of data: %v orgs, %d licences, want 1, 2", data.TotalOrganisations, len(data.Licences)) }
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FeedQuery selects the most recent change events for a feed.
+// Empty fields match every event.
+type FeedQuery struct {
+	Since           time.Time // events before Since are left out
+	Routes          []string
+	County          string // exact county, case-insensitive
+	Search          string // organisation name or town/city, case-insensitive substring
+	OrganisationIDs []int  // nil = all organisations
+	Limit           int
+}
+
+// GetRecentChanges returns up to fq.Limit change events since fq.Since,
+// newest first. Only the events since fq.Since are derived, so the bound
+// keeps the query to the indexed recent rows. Route filters match licence
+// events directly, and match organisation events when the organisation has
+// ever held a licence on one of the routes.
+func GetRecentChanges(ctx context.Context, q Querier, fq FeedQuery) ([]ChangeEvent, error) {
+	query := changeEventsSince("@since") + `
+		SELECT ` + changeEventColumns + `
+		FROM events e
+		JOIN organisations o ON o.id = e.organisation_id
+		WHERE true`
+	args := pgx.NamedArgs{"since": fq.Since, "limit": fq.Limit}
+	if len(fq.Routes) > 0 {
+		query += ` AND (e.route = ANY(@routes) OR (e.licence_id IS NULL AND EXISTS (
+			SELECT 1 FROM licences x WHERE x.organisation_id = e.organisation_id AND x.route = ANY(@routes))))`
+		args["routes"] = fq.Routes
+	}
+	if fq.County != "" {
+		query += ` AND o.county ILIKE @county`
+		args["county"] = escapeLike(fq.County)
+	}
+	if fq.Search != "" {
+		query += ` AND (o.name ILIKE @search OR o.town_city ILIKE @search)`
+		args["search"] = "%" + escapeLike(fq.Search) + "%"
+	}
+	if fq.OrganisationIDs != nil {
+		query += ` AND e.organisation_id = ANY(@ids)`
+		args["ids"] = fq.OrganisationIDs
+	}
+	query += ` ORDER BY e.occurred_at DESC, e.event_type DESC, e.entity_id DESC`
+	if fq.Limit > 0 {
+		query += ` LIMIT @limit`
+	}
+
+	rows, err := q.Query(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("get recent changes: %w", err)
+	}
+	events, err := scanChangeEvents(rows)
+	if err != nil {
+		return nil, fmt.Errorf("get recent changes: %w", err)
+	}
+	return events, nil
+}
+
+// GetWatchedOrganisationIDs returns the IDs of the organisations on any of a
+// user's watchlists together with the IDs of their current versions, resolved
+// as in GetWatchedOrganisations.
+func GetWatchedOrganisationIDs(ctx context.Context, q Querier, userID int) ([]int, error) {
+	rows, err := q.Query(ctx,
+		`SELECT DISTINCT wo.organisation_id, cur.id
+		 FROM watchlists w
+		 JOIN watchlist_organisations wo ON wo.watchlist_id = w.id
+		 JOIN organisations o ON o.id = wo.organisation_id
+		 LEFT JOIN LATERAL (
+			SELECT c.id FROM organisations c
+			WHERE c.deleted_at IS NULL AND (c.id = o.id OR (`+successorOf("c", "o")+`))
+			ORDER BY c.id = o.id DESC, c.created_at DESC
+			LIMIT 1
+		 ) cur ON true
+		 WHERE w.user_id = $1
+		 ORDER BY wo.organisation_id`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get watched organisation ids: %w", err)
+	}
+	defer rows.Close()
+
+	seen := map[int]bool{}
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		var currentID *int
+		if err := rows.Scan(&id, &currentID); err != nil {
+			return nil, fmt.Errorf("get watched organisation ids: scan row: %w", err)
+		}
+		for _, v := range []*int{&id, currentID} {
+			if v != nil && !seen[*v] {
+				seen[*v] = true
+				ids = append(ids, *v)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get watched organisation ids: %w", err)
+	}
+	return ids, nil
+}
+
+// CreateFeedToken generates a new private feed token for a user, replacing
+// any previous one, and returns it.
+func CreateFeedToken(ctx context.Context, q Querier, userID int) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("create feed token: generate token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+
+	_, err := q.Exec(ctx,
+		`INSERT INTO feed_tokens (user_id, token) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET token = EXCLUDED.token, created_at = NOW()`,
+		userID, token,
+	)
+	if err != nil {
+		return "", fmt.Errorf("create feed token: %w", err)
+	}
+	return token, nil
+}
+
+// FindFeedTokenUser returns the ID of the user a feed token belongs to, or
+// false if the token does not exist or the user is disabled.
+func FindFeedTokenUser(ctx context.Context, q Querier, token string) (int, bool, error) {
+	var userID int
+	err := q.QueryRow(ctx, `SELECT f.user_id FROM feed_tokens f JOIN users u ON u.id = f.user_id WHERE f.token = $1 AND u.disabled_at IS NULL`, token).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("find feed token user: %w", err)
+	}
+	return userID, true, nil
+}
+
+// DeleteFeedToken revokes a user's feed token, returning false if they have none.
+func DeleteFeedToken(ctx context.Context, q Querier, userID int) (bool, error) {
+	tag, err := q.Exec(ctx, `DELETE FROM feed_tokens WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, fmt.Errorf("delete feed token: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// PostgresFeedStore reads change feeds and manages feed tokens in PostgreSQL.
+type PostgresFeedStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresFeedStore constructs a PostgresFeedStore.
+func NewPostgresFeedStore(pool *pgxpool.Pool) *PostgresFeedStore {
+	return &PostgresFeedStore{pool: pool}
+}
+
+// GetRecentChanges returns the most recent change events matching fq.
+func (s *PostgresFeedStore) GetRecentChanges(ctx context.Context, fq FeedQuery) ([]ChangeEvent, error) {
+	return GetRecentChanges(ctx, s.pool, fq)
+}
+
+// GetWatchedChanges returns the most recent change events matching fq of the
+// organisations on a user's watchlists, following moved organisations.
+func (s *PostgresFeedStore) GetWatchedChanges(ctx context.Context, userID int, fq FeedQuery) ([]ChangeEvent, error) {
+	ids, err := GetWatchedOrganisationIDs(ctx, s.pool, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []ChangeEvent{}, nil
+	}
+	fq.OrganisationIDs = ids
+	return GetRecentChanges(ctx, s.pool, fq)
+}
+
+// FindFeedUser returns the ID of the user a feed token belongs to.
+func (s *PostgresFeedStore) FindFeedUser(ctx context.Context, token string) (int, bool, error) {
+	return FindFeedTokenUser(ctx, s.pool, token)
+}
+
+// CreateFeedToken replaces a user's feed token and returns the new one.
+func (s *PostgresFeedStore) CreateFeedToken(ctx context.Context, userID int) (string, error) {
+	return CreateFeedToken(ctx, s.pool, userID)
+}
+
+// DeleteFeedToken revokes a user's feed token.
+func (s *PostgresFeedStore) DeleteFeedToken(ctx context.Context, userID int) (bool, error) {
+	return DeleteFeedToken(ctx, s.pool, userID)
+}
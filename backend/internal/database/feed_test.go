@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFeedStore(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	cleanup := func() {
+		pool.Exec(ctx, `DELETE FROM watchlists`)
+		pool.Exec(ctx, `DELETE FROM users WHERE username LIKE 'feed-test-%'`)
+		pool.Exec(ctx, `DELETE FROM licences`)
+		pool.Exec(ctx, `DELETE FROM organisations`)
+	}
+	cleanup()
+	defer cleanup()
+
+	alice, _ := InsertUser(ctx, pool, User{Username: "feed-test-alice", PasswordHash: "x", Role: 50})
+
+	acme, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Dover", County: "Kent"}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, false)
+	time.Sleep(10 * time.Millisecond)
+	beta, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Leeds", County: "West Yorkshire"}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: beta, LicenceType: "Worker", Rating: RatingA, Route: "Scale-up"}, false)
+
+	store := NewPostgresFeedStore(pool)
+	events, err := store.GetRecentChanges(ctx, FeedQuery{Limit: 10})
+	if err != nil { t.Fatalf("recent changes: %v", err) }
+	if len(events) != 4 || events[0].OrganisationID != beta || events[3].OrganisationID != acme { t.Fatalf("events = %+v, want newest first", events) }
+	if events, _ := store.GetRecentChanges(ctx, FeedQuery{Limit: 1}); len(events) != 1 { t.Errorf("limit 1 returned %d events", len(events)) }
+	if events, _ := store.GetRecentChanges(ctx, FeedQuery{Since: time.Now().Add(time.Hour), Limit: 10}); len(events) != 0 { t.Errorf("since an hour ahead returned %d events", len(events)) }
+
+	for _, tt := range []struct {
+		name string
+		fq   FeedQuery
+		want int
+	}{
+		{"route", FeedQuery{Routes: []string{"Scale-up"}}, beta},
+		{"county", FeedQuery{County: "kent"}, acme},
+		{"search town", FeedQuery{Search: "leed"}, beta},
+		{"organisations", FeedQuery{OrganisationIDs: []int{acme}}, acme},
+	} {
+		events, err := store.GetRecentChanges(ctx, tt.fq)
+		if err != nil { t.Fatalf("%s: %v", tt.name, err) }
+		if len(events) != 2 { t.Errorf("%s: got %d events, want 2", tt.name, len(events)); continue }
+		for _, ev := range events {
+			if ev.OrganisationID != tt.want { t.Errorf("%s: event for organisation %d, want %d", tt.name, ev.OrganisationID, tt.want) }
+		}
+	}
+
+	// Watchlist feeds follow a moved organisation to its current version
+	wl, _ := NewPostgresWatchlistStore(pool).CreateWatchlist(ctx, alice, "Clients", []int{acme})
+	time.Sleep(10 * time.Millisecond)
+	moved, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Canterbury", County: "Kent"}, false)
+	CloseOrganisation(ctx, pool, acme)
+	ids, err := GetWatchedOrganisationIDs(ctx, pool, alice)
+	if err != nil || len(ids) != 2 || ids[0] != acme || ids[1] != moved { t.Errorf("watched ids = %v, %v; want [%d %d]", ids, err, acme, moved) }
+	events, _ = store.GetWatchedChanges(ctx, alice, FeedQuery{Limit: 10})
+	if len(events) != 4 { t.Errorf("watched changes = %d events, want 4", len(events)) }
+	NewPostgresWatchlistStore(pool).DeleteWatchlist(ctx, alice, wl.ID)
+	if events, _ := store.GetWatchedChanges(ctx, alice, FeedQuery{Limit: 10}); len(events) != 0 { t.Errorf("empty watchlists returned %d events", len(events)) }
+
+	// Tokens are replaced on creation and can be revoked
+	first, err := store.CreateFeedToken(ctx, alice)
+	if err != nil || len(first) != 64 { t.Fatalf("create token = %q, %v", first, err) }
+	second, _ := store.CreateFeedToken(ctx, alice)
+	if _, found, _ := store.FindFeedUser(ctx, first); found { t.Error("replaced token still valid") }
+	if id, found, _ := store.FindFeedUser(ctx, second); !found || id != alice { t.Errorf("find token = %d, %v", id, found) }
+	if found, _ := store.DeleteFeedToken(ctx, alice); !found { t.Error("delete token failed") }
+	if _, found, _ := store.FindFeedUser(ctx, second); found { t.Error("revoked token still valid") }
+	if found, _ := store.DeleteFeedToken(ctx, alice); found { t.Error("deleted a missing token") }
+}
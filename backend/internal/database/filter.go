@@ -0,0 +1,268 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// OrganisationFilter restricts which active organisations are returned.
+// Zero values mean "no restriction". Routes, LicenceType and Rating are
+// licence-level predicates: an organisation matches if a single active
+// licence satisfies all of them. If AsOf is set, "active" means on the
+// register at that instant rather than now.
+type OrganisationFilter struct {
+	AsOf *time.Time
+
+	Search             string   // name or town/city, case-insensitive substring
+	Fuzzy              bool     // match Search by trigram similarity instead of substring
+	Routes             []string // any of these routes
+	LicenceType        string
+	Rating             string
+	County             string
+	TownCity           string
+	HasBRating         bool     // at least one active B-rated licence
+	HasTemporaryWorker bool     // at least one active Temporary Worker licence
+	Tags               []string // all of these team tags
+}
+
+// Facet dimensions, used to exclude a dimension's own filter when counting it.
+const (
+	facetNone        = ""
+	facetRoute       = "route"
+	facetLicenceType = "licence_type"
+	facetRating      = "rating"
+	facetCounty      = "county"
+	facetTownCity    = "town_city"
+)
+
+// where returns the SQL conditions (each prefixed with AND) and arguments for
+// the filter against organisations aliased as o. The filter for the except
+// dimension is left out, so facet counts reflect every other active filter.
+// If except is a licence-level dimension, every licence-level predicate is
+// left out: the facet query applies the others to the licence it counts with
+// licenceWhere, so they all hold for the same licence.
+func (f OrganisationFilter) where(except string) (string, pgx.NamedArgs) {
+	var sb strings.Builder
+	args := pgx.NamedArgs{}
+	if f.AsOf != nil {
+		args["as_of"] = *f.AsOf
+	}
+
+	if f.fuzzySearch() {
+		sb.WriteString(` AND (normalise_org_name(@fuzzy) <% normalise_org_name(o.name) OR @fuzzy <% o.town_city)`)
+		args["fuzzy"] = f.Search
+	} else if f.Search != "" {
+		sb.WriteString(` AND (o.name ILIKE @search OR o.town_city ILIKE @search)`)
+		args["search"] = "%" + escapeLike(f.Search) + "%"
+	}
+	if f.County != "" && except != facetCounty {
+		sb.WriteString(` AND o.county ILIKE @county`)
+		args["county"] = escapeLike(f.County)
+	}
+	if f.TownCity != "" && except != facetTownCity {
+		sb.WriteString(` AND o.town_city ILIKE @town_city`)
+		args["town_city"] = escapeLike(f.TownCity)
+	}
+
+	if except != facetRoute && except != facetLicenceType && except != facetRating {
+		if lic := f.licenceWhere("l", facetNone, args); lic != "" {
+			sb.WriteString(` AND EXISTS (SELECT 1 FROM licences l WHERE l.organisation_id = o.id AND ` + f.licenceActive("l") + lic + `)`)
+		}
+	}
+
+	if f.HasBRating {
+		sb.WriteString(` AND EXISTS (SELECT 1 FROM licences lb WHERE lb.organisation_id = o.id AND ` + f.licenceActive("lb") + ` AND lb.rating = @b_rating)`)
+		args["b_rating"] = RatingB
+	}
+	if f.HasTemporaryWorker {
+		sb.WriteString(` AND EXISTS (SELECT 1 FROM licences lt WHERE lt.organisation_id = o.id AND ` + f.licenceActive("lt") + ` AND lt.licence_type = @temporary_worker)`)
+		args["temporary_worker"] = LicenceTypeTemporaryWorker
+	}
+	if len(f.Tags) > 0 {
+		sb.WriteString(` AND (SELECT COUNT(DISTINCT t.name) FROM organisation_tags ot JOIN tags t ON t.id = ot.tag_id
+			WHERE ot.organisation_id = o.id AND t.name = ANY(@tags)) = @tag_count`)
+		args["tags"] = f.Tags
+		args["tag_count"] = len(f.Tags)
+	}
+	return sb.String(), args
+}
+
+// licenceWhere returns the SQL conditions (each prefixed with AND) for the
+// licence-level predicates of the filter against the licence aliased as a,
+// leaving out the except dimension, and adds their arguments to args.
+func (f OrganisationFilter) licenceWhere(a, except string, args pgx.NamedArgs) string {
+	var sb strings.Builder
+	if len(f.Routes) > 0 && except != facetRoute {
+		sb.WriteString(` AND ` + a + `.route = ANY(@routes)`)
+		args["routes"] = f.Routes
+	}
+	if f.LicenceType != "" && except != facetLicenceType {
+		sb.WriteString(` AND ` + a + `.licence_type = @licence_type`)
+		args["licence_type"] = f.LicenceType
+	}
+	if f.Rating != "" && except != facetRating {
+		sb.WriteString(` AND ` + a + `.rating = @rating`)
+		args["rating"] = f.Rating
+	}
+	return sb.String()
+}
+
+// orgActive returns the condition for the organisation aliased as a being on
+// the register, now or at AsOf. Organisations with a NULL created_at existed
+// before tracking began and count as present at any earlier instant. The
+// as_of argument is supplied by where.
+func (f OrganisationFilter) orgActive(a string) string {
+	if f.AsOf == nil {
+		return a + `.deleted_at IS NULL`
+	}
+	return `(` + a + `.created_at IS NULL OR ` + a + `.created_at <= @as_of) AND (` +
+		a + `.deleted_at IS NULL OR ` + a + `.deleted_at > @as_of)`
+}
+
+// licenceActive returns the condition for the licence aliased as a being
+// active, now or at AsOf, in the same way as orgActive.
+func (f OrganisationFilter) licenceActive(a string) string {
+	if f.AsOf == nil {
+		return a + `.valid_to IS NULL`
+	}
+	return `(` + a + `.valid_from IS NULL OR ` + a + `.valid_from <= @as_of) AND (` +
+		a + `.valid_to IS NULL OR ` + a + `.valid_to > @as_of)`
+}
+
+// fuzzySearch reports whether the filter has a search term matched by similarity.
+func (f OrganisationFilter) fuzzySearch() bool {
+	return f.Fuzzy && f.Search != ""
+}
+
+// relevanceExpr scores how well an organisation aliased as o matches the fuzzy
+// search term @fuzzy, from 0 to 1: the better of the word similarity of the
+// normalised names and of the town. Legal suffixes and punctuation are ignored,
+// so "acme (uk) limited" scores 1 against "Acme UK Ltd".
+const relevanceExpr = `GREATEST(
+		word_similarity(normalise_org_name(@fuzzy), normalise_org_name(o.name)),
+		word_similarity(@fuzzy, COALESCE(o.town_city, '')))`
+
+// GetSearchRelevance returns the relevance score of each of the given
+// organisations against a fuzzy search term, keyed by organisation ID.
+func GetSearchRelevance(ctx context.Context, q Querier, search string, orgIDs []int) (map[int]float64, error) {
+	rows, err := q.Query(ctx,
+		`SELECT o.id, `+relevanceExpr+`
+		 FROM organisations o
+		 WHERE o.id = ANY(@ids)`,
+		pgx.NamedArgs{"fuzzy": search, "ids": orgIDs})
+	if err != nil {
+		return nil, fmt.Errorf("get search relevance: %w", err)
+	}
+	defer rows.Close()
+
+	scores := map[int]float64{}
+	for rows.Next() {
+		var id int
+		var score float64
+		if err := rows.Scan(&id, &score); err != nil {
+			return nil, fmt.Errorf("get search relevance: scan row: %w", err)
+		}
+		scores[id] = score
+	}
+	return scores, rows.Err()
+}
+
+// FacetCount is the number of matching organisations with a given value.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets holds organisation counts per filter value. Each dimension is counted
+// with every other active filter applied but not its own, so clients can offer
+// the alternatives for a multi-select. HasBRating and HasTemporaryWorker count
+// the organisations matching all active filters that also satisfy that flag.
+type Facets struct {
+	Routes             []FacetCount `json:"routes"`
+	LicenceTypes       []FacetCount `json:"licence_types"`
+	Ratings            []FacetCount `json:"ratings"`
+	Counties           []FacetCount `json:"counties"`
+	Towns              []FacetCount `json:"towns"`
+	HasBRating         int          `json:"has_b_rating"`
+	HasTemporaryWorker int          `json:"has_temporary_worker"`
+}
+
+// maxFacetValues caps the number of values returned for a single facet.
+const maxFacetValues = 100
+
+// GetFacets computes facet counts for the active organisations matching the filter.
+func GetFacets(ctx context.Context, q Querier, filter OrganisationFilter) (*Facets, error) {
+	var facets Facets
+	var err error
+
+	licenceFacet := func(column, except string) ([]FacetCount, error) {
+		where, args := filter.where(except)
+		return queryFacet(ctx, q,
+			`SELECT fl.`+column+`, COUNT(DISTINCT o.id)
+			 FROM organisations o
+			 JOIN licences fl ON fl.organisation_id = o.id AND `+filter.licenceActive("fl")+filter.licenceWhere("fl", except, args)+`
+			 WHERE `+filter.orgActive("o")+where+`
+			 GROUP BY fl.`+column, args)
+	}
+	orgFacet := func(column, except string) ([]FacetCount, error) {
+		where, args := filter.where(except)
+		return queryFacet(ctx, q,
+			`SELECT COALESCE(o.`+column+`, ''), COUNT(*)
+			 FROM organisations o
+			 WHERE `+filter.orgActive("o")+where+`
+			 GROUP BY 1`, args)
+	}
+
+	if facets.Routes, err = licenceFacet("route", facetRoute); err != nil {
+		return nil, err
+	}
+	if facets.LicenceTypes, err = licenceFacet("licence_type", facetLicenceType); err != nil {
+		return nil, err
+	}
+	if facets.Ratings, err = licenceFacet("rating", facetRating); err != nil {
+		return nil, err
+	}
+	if facets.Counties, err = orgFacet("county", facetCounty); err != nil {
+		return nil, err
+	}
+	if facets.Towns, err = orgFacet("town_city", facetTownCity); err != nil {
+		return nil, err
+	}
+
+	withB := filter
+	withB.HasBRating = true
+	if facets.HasBRating, err = CountAllActiveOrganisations(ctx, q, withB); err != nil {
+		return nil, fmt.Errorf("get facets: %w", err)
+	}
+	withTemp := filter
+	withTemp.HasTemporaryWorker = true
+	if facets.HasTemporaryWorker, err = CountAllActiveOrganisations(ctx, q, withTemp); err != nil {
+		return nil, fmt.Errorf("get facets: %w", err)
+	}
+	return &facets, nil
+}
+
+// queryFacet runs a (value, count) grouping query and returns the most
+// frequent values first, up to maxFacetValues.
+func queryFacet(ctx context.Context, q Querier, query string, args pgx.NamedArgs) ([]FacetCount, error) {
+	args["facet_limit"] = maxFacetValues
+	rows, err := q.Query(ctx, query+` ORDER BY 2 DESC, 1 LIMIT @facet_limit`, args)
+	if err != nil {
+		return nil, fmt.Errorf("get facets: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []FacetCount{}
+	for rows.Next() {
+		var fc FacetCount
+		if err := rows.Scan(&fc.Value, &fc.Count); err != nil {
+			return nil, fmt.Errorf("get facets: scan row: %w", err)
+		}
+		counts = append(counts, fc)
+	}
+	return counts, rows.Err()
+}
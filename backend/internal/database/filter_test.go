@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOrganisationFilter_LicenceLevelPredicatesAndFacets(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+
+	acme, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Dover", County: "Kent"}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Temporary Worker", Rating: "B rating", Route: "Creative Worker"}, false)
+
+	beta, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Leeds", County: "West Yorkshire"}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: beta, LicenceType: "Worker", Rating: "B rating", Route: "Skilled Worker"}, false)
+
+	gamma, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Gamma Ltd", TownCity: "Canterbury", County: "Kent"}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: gamma, LicenceType: "Worker", Rating: "A rating", Route: "Global Business Mobility"}, false)
+
+	tests := []struct {
+		name   string
+		filter OrganisationFilter
+		want   int
+	}{
+		{"no filter", OrganisationFilter{}, 3},
+		{"route", OrganisationFilter{Routes: []string{"Skilled Worker"}}, 2},
+		{"multiple routes", OrganisationFilter{Routes: []string{"Skilled Worker", "Global Business Mobility"}}, 3},
+		{"county is case-insensitive", OrganisationFilter{County: "kent"}, 2},
+		{"town", OrganisationFilter{TownCity: "Leeds"}, 1},
+		// Acme has a Skilled Worker licence and a B rating, but not on the same licence
+		{"route and rating on same licence", OrganisationFilter{Routes: []string{"Skilled Worker"}, Rating: "B rating"}, 1},
+		{"has B rating", OrganisationFilter{HasBRating: true}, 2},
+		{"has temporary worker", OrganisationFilter{HasTemporaryWorker: true}, 1},
+		{"county and has B rating", OrganisationFilter{County: "Kent", HasBRating: true}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := CountAllActiveOrganisations(ctx, pool, tt.filter)
+			if err != nil { t.Fatalf("unexpected error: %v", err) }
+			if count != tt.want { t.Errorf("count = %d, want %d", count, tt.want) }
+			orgs, err := GetAllActiveOrganisations(ctx, pool, 1, 0, tt.filter, OrganisationSort{})
+			if err != nil { t.Fatalf("unexpected error: %v", err) }
+			if len(orgs) != tt.want { t.Errorf("got %d orgs, want %d", len(orgs), tt.want) }
+		})
+	}
+
+	// The county facet ignores the county filter itself
+	facets, err := GetFacets(ctx, pool, OrganisationFilter{County: "Kent"})
+	if err != nil { t.Fatalf("GetFacets failed: %v", err) }
+	if len(facets.Counties) != 2 || facets.Counties[0] != (FacetCount{"Kent", 2}) {
+		t.Errorf("counties = %+v, want Kent=2 first of 2", facets.Counties)
+	}
+	routes := map[string]int{}
+	for _, fc := range facets.Routes {
+		routes[fc.Value] = fc.Count
+	}
+	if routes["Skilled Worker"] != 1 || routes["Global Business Mobility"] != 1 || routes["Creative Worker"] != 1 {
+		t.Errorf("routes = %+v", facets.Routes)
+	}
+	if facets.HasBRating != 1 { t.Errorf("has_b_rating = %d, want 1", facets.HasBRating) }
+	if facets.HasTemporaryWorker != 1 { t.Errorf("has_temporary_worker = %d, want 1", facets.HasTemporaryWorker) }
+
+	// Licence facets count the licences that satisfy the other licence-level
+	// predicates: Acme's B rating is on its Creative Worker licence only
+	facets, err = GetFacets(ctx, pool, OrganisationFilter{Rating: "B rating", Routes: []string{"Skilled Worker"}})
+	if err != nil { t.Fatalf("GetFacets failed: %v", err) }
+	routes = map[string]int{}
+	for _, fc := range facets.Routes {
+		routes[fc.Value] = fc.Count
+	}
+	if len(routes) != 2 || routes["Skilled Worker"] != 1 || routes["Creative Worker"] != 1 { t.Errorf("routes with B rating = %+v", facets.Routes) }
+	if len(facets.Ratings) != 2 || facets.Ratings[0] != (FacetCount{"A rating", 1}) || facets.Ratings[1] != (FacetCount{"B rating", 1}) {
+		t.Errorf("ratings on Skilled Worker = %+v", facets.Ratings)
+	}
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+}
+
+func TestOrganisationFilter_FuzzySearch(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+
+	acme, _ := InsertOrganisation(ctx, pool, Organisation{Name: "A.C.M.E. (UK) Limited", TownCity: "Dover", County: "Kent"}, false)
+	acmeCo, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Consulting Services LLP", TownCity: "Leeds"}, false)
+	InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Leeds"}, false)
+
+	var norm string
+	pool.QueryRow(ctx, `SELECT normalise_org_name('A.C.M.E. (UK) Limited')`).Scan(&norm)
+	if norm != "acme uk" { t.Errorf("normalise_org_name = %q, want %q", norm, "acme uk") }
+
+	filter := OrganisationFilter{Search: "Acme UK Ltd", Fuzzy: true}
+	sort := OrganisationSort{Field: SortRelevance, Desc: true}
+	orgs, err := GetAllActiveOrganisations(ctx, pool, 1, 0, filter, sort)
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if len(orgs) == 0 || orgs[0].ID != acme { t.Fatalf("got %+v, want %d first", orgs, acme) }
+
+	scores, err := GetSearchRelevance(ctx, pool, filter.Search, []int{acme, acmeCo})
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if scores[acme] != 1 { t.Errorf("exact normalised match scored %v, want 1", scores[acme]) }
+	if scores[acmeCo] >= scores[acme] { t.Errorf("partial match scored %v, not below %v", scores[acmeCo], scores[acme]) }
+
+	// Misspelt search still finds the organisation
+	orgs, err = GetAllActiveOrganisations(ctx, pool, 1, 0, OrganisationFilter{Search: "acmee uk", Fuzzy: true}, sort)
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if len(orgs) == 0 || orgs[0].ID != acme { t.Errorf("misspelling: got %+v, want %d first", orgs, acme) }
+
+	if _, err := GetAllActiveOrganisations(ctx, pool, 1, 0, OrganisationFilter{Search: "acme"}, sort); err == nil {
+		t.Errorf("relevance sort without fuzzy search: expected error")
+	}
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+}
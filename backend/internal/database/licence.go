@@ -10,6 +10,15 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Ratings and licence types as they appear in the gov.uk register.
+const (
+	RatingA = "A rating"
+	RatingB = "B rating"
+
+	LicenceTypeWorker          = "Worker"
+	LicenceTypeTemporaryWorker = "Temporary Worker"
+)
+
 // Licence represents a sponsor licence record
 type Licence struct {
 	ID             int
@@ -25,19 +34,19 @@ type Licence struct {
 // If initialRun is true, valid_from is NULL (existed before tracking).
 // If initialRun is false, valid_from uses the database default (NOW()).
 // valid_to is always NULL (licence is active when inserted).
-func InsertLicence(ctx context.Context, pool *pgxpool.Pool, lic Licence, initialRun bool) (int, error) {
+func InsertLicence(ctx context.Context, q Querier, lic Licence, initialRun bool) (int, error) {
 	var id int
 	var err error
 
 	if initialRun {
-		err = pool.QueryRow(ctx,
+		err = q.QueryRow(ctx,
 			`INSERT INTO licences (organisation_id, licence_type, rating, route, valid_from)
 			 VALUES ($1, $2, $3, $4, NULL)
 			 RETURNING id`,
 			lic.OrganisationID, lic.LicenceType, lic.Rating, lic.Route,
 		).Scan(&id)
 	} else {
-		err = pool.QueryRow(ctx,
+		err = q.QueryRow(ctx,
 			`INSERT INTO licences (organisation_id, licence_type, rating, route)
 			 VALUES ($1, $2, $3, $4)
 			 RETURNING id`,
@@ -52,9 +61,9 @@ func InsertLicence(ctx context.Context, pool *pgxpool.Pool, lic Licence, initial
 }
 
 // FindActiveLicence finds a current (valid_to IS NULL) licence for an org, licence type, and route
-func FindActiveLicence(ctx context.Context, pool *pgxpool.Pool, orgID int, licenceType, route string) (Licence, bool, error) {
+func FindActiveLicence(ctx context.Context, q Querier, orgID int, licenceType, route string) (Licence, bool, error) {
 	var lic Licence
-	err := pool.QueryRow(ctx,
+	err := q.QueryRow(ctx,
 		`SELECT id, organisation_id, licence_type, rating, route, valid_from, valid_to
 		 FROM licences
 		 WHERE organisation_id = $1
@@ -74,8 +83,8 @@ func FindActiveLicence(ctx context.Context, pool *pgxpool.Pool, orgID int, licen
 }
 
 // CloseLicence sets valid_to to NOW() on a licence (marks it as ended)
-func CloseLicence(ctx context.Context, pool *pgxpool.Pool, licenceID int) error {
-	_, err := pool.Exec(ctx,
+func CloseLicence(ctx context.Context, q Querier, licenceID int) error {
+	_, err := q.Exec(ctx,
 		`UPDATE licences SET valid_to = NOW() WHERE id = $1`,
 		licenceID,
 	)
@@ -113,8 +122,8 @@ func GetAllLicencesForOrg(ctx context.Context, pool *pgxpool.Pool, orgID int) ([
 }
 
 // GetAllActiveLicences retrieves all licences that are currently active.
-func GetAllActiveLicences(ctx context.Context, pool *pgxpool.Pool) ([]Licence, error) {
-	rows, err := pool.Query(ctx,
+func GetAllActiveLicences(ctx context.Context, q Querier) ([]Licence, error) {
+	rows, err := q.Query(ctx,
 		`SELECT id, organisation_id, licence_type, rating, route, valid_from
 		 FROM licences
 		 WHERE valid_to IS NULL
@@ -163,3 +172,33 @@ func GetActiveLicencesByOrgIDs(ctx context.Context, q Querier, orgIDs []int) ([]
 	}
 	return licences, rows.Err()
 }
+
+// GetLicencesByOrgIDsAt retrieves the licences of the given organisations
+// that were active at the given instant. Licences with a NULL valid_from
+// existed before tracking began and count as active at any earlier instant.
+func GetLicencesByOrgIDsAt(ctx context.Context, q Querier, orgIDs []int, at time.Time) ([]Licence, error) {
+	rows, err := q.Query(ctx,
+		`SELECT id, organisation_id, licence_type, rating, route, valid_from, valid_to
+		 FROM licences
+		 WHERE organisation_id = ANY($1)
+		   AND (valid_from IS NULL OR valid_from <= $2)
+		   AND (valid_to IS NULL OR valid_to > $2)
+		 ORDER BY organisation_id`,
+		orgIDs, at,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get licences by org IDs at: %w", err)
+	}
+	defer rows.Close()
+
+	licences := []Licence{}
+	for rows.Next() {
+		var lic Licence
+		err := rows.Scan(&lic.ID, &lic.OrganisationID, &lic.LicenceType, &lic.Rating, &lic.Route, &lic.ValidFrom, &lic.ValidTo)
+		if err != nil {
+			return nil, fmt.Errorf("get licences by org IDs at: scan row: %w", err)
+		}
+		licences = append(licences, lic)
+	}
+	return licences, rows.Err()
+}
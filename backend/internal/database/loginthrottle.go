@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Login throttle scopes: failed logins are counted per username and per
+// client IP address.
+const (
+	ThrottleUsername = "username"
+	ThrottleIP       = "ip"
+)
+
+// LoginThrottle counts the recent failed logins for a username or client IP.
+// Logins for it are refused until LockedUntil, if set.
+type LoginThrottle struct {
+	Scope         string     `json:"scope"`
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+const loginThrottleColumns = `scope, key, failures, last_failure_at, locked_until`
+
+func scanLoginThrottle(row pgx.Row) (LoginThrottle, error) {
+	var t LoginThrottle
+	err := row.Scan(&t.Scope, &t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil)
+	return t, err
+}
+
+// FindLoginThrottle looks up the throttle for a username or client IP.
+// Returns it and true if found, or empty and false if not found.
+func FindLoginThrottle(ctx context.Context, q Querier, scope, key string) (LoginThrottle, bool, error) {
+	t, err := scanLoginThrottle(q.QueryRow(ctx,
+		`SELECT `+loginThrottleColumns+` FROM login_throttles WHERE scope = $1 AND key = $2`,
+		scope, key,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return LoginThrottle{}, false, nil
+	}
+	if err != nil {
+		return LoginThrottle{}, false, fmt.Errorf("find login throttle: %w", err)
+	}
+	return t, true, nil
+}
+
+// GetLoginThrottles returns the throttles with failures counted within the
+// window or a lock still in force, most recent failure first.
+func GetLoginThrottles(ctx context.Context, q Querier, window time.Duration) ([]LoginThrottle, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+loginThrottleColumns+` FROM login_throttles
+		 WHERE (failures > 0 AND last_failure_at > NOW() - $1::interval) OR locked_until > NOW()
+		 ORDER BY last_failure_at DESC, scope, key`,
+		window,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get login throttles: %w", err)
+	}
+	defer rows.Close()
+
+	throttles := []LoginThrottle{}
+	for rows.Next() {
+		t, err := scanLoginThrottle(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get login throttles: scan row: %w", err)
+		}
+		throttles = append(throttles, t)
+	}
+	return throttles, rows.Err()
+}
+
+// LoginLimits sets when failed logins for a username or client IP refuse
+// further attempts. From DelayAfter failures, each one refuses attempts for
+// BaseDelay, doubling with every further failure up to MaxDelay; from
+// LockoutAfter failures, each one refuses attempts for Lockout. Failures are
+// counted afresh after Window without one.
+type LoginLimits struct {
+	DelayAfter   int
+	LockoutAfter int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Lockout      time.Duration
+	Window       time.Duration
+}
+
+// LoginAttempt is the outcome of reserving a login attempt for a username or
+// client IP. If Reserved, the attempt has been counted as a failure and
+// LockedUntil is the lock that failure set, if any. If not, a lock was
+// already in force and LockedUntil is when it ends. Now is the database
+// clock when the attempt was made.
+type LoginAttempt struct {
+	Scope       string
+	Key         string
+	Reserved    bool
+	LockedUntil *time.Time
+	Now         time.Time
+}
+
+// RetryAfter returns how long a refused attempt must wait.
+func (a LoginAttempt) RetryAfter() time.Duration {
+	if a.Reserved || a.LockedUntil == nil {
+		return 0
+	}
+	return a.LockedUntil.Sub(a.Now)
+}
+
+// loginLockUntil is the lock set after the given number of failures, or NULL
+// while under the limits' DelayAfter. Doubling more than 30 times overflows
+// any sensible max_delay.
+func loginLockUntil(failures string) string {
+	return `CASE WHEN ` + failures + ` >= @lockout_after THEN NOW() + @lockout::interval
+		WHEN ` + failures + ` >= @delay_after THEN NOW() + LEAST(
+			@base_delay::interval * power(2, LEAST(` + failures + ` - @delay_after, 30)), @max_delay::interval)
+		END`
+}
+
+// ReserveLoginAttempt counts a login attempt for a username or client IP as
+// a failure before its password is checked, and locks further attempts if
+// that reaches the limits. Nothing is counted while a lock is in force. The
+// check and the count are one statement, so concurrent attempts cannot slip
+// past a lock, and every time is taken from the database clock.
+func ReserveLoginAttempt(ctx context.Context, q Querier, scope, key string, limits LoginLimits) (LoginAttempt, error) {
+	failures := `CASE WHEN t.last_failure_at > NOW() - @window::interval THEN t.failures + 1 ELSE 1 END`
+	a := LoginAttempt{Scope: scope, Key: key}
+	var reserved *int
+	var held *time.Time
+	err := q.QueryRow(ctx,
+		`WITH held AS (
+			SELECT locked_until FROM login_throttles WHERE scope = @scope AND key = @key FOR UPDATE
+		 ), reserved AS (
+			INSERT INTO login_throttles AS t (scope, key, failures, locked_until)
+			VALUES (@scope, @key, 1, `+loginLockUntil("1")+`)
+			ON CONFLICT (scope, key) DO UPDATE SET
+				failures = `+failures+`,
+				last_failure_at = NOW(),
+				locked_until = `+loginLockUntil(failures)+`
+			WHERE t.locked_until IS NULL OR t.locked_until <= NOW()
+			RETURNING failures, locked_until
+		 )
+		 SELECT (SELECT failures FROM reserved), (SELECT locked_until FROM reserved),
+			(SELECT locked_until FROM held), NOW()`,
+		pgx.NamedArgs{
+			"scope":         scope,
+			"key":           key,
+			"delay_after":   limits.DelayAfter,
+			"lockout_after": limits.LockoutAfter,
+			"base_delay":    limits.BaseDelay,
+			"max_delay":     limits.MaxDelay,
+			"lockout":       limits.Lockout,
+			"window":        limits.Window,
+		},
+	).Scan(&reserved, &a.LockedUntil, &held, &a.Now)
+	if err != nil {
+		return LoginAttempt{}, fmt.Errorf("reserve login attempt: %w", err)
+	}
+	a.Reserved = reserved != nil
+	if !a.Reserved {
+		a.LockedUntil = held
+	}
+	return a, nil
+}
+
+// ReleaseLoginAttempt uncounts a reserved attempt that turned out not to be
+// a failure, lifting the lock it set unless a later attempt has replaced it.
+func ReleaseLoginAttempt(ctx context.Context, q Querier, a LoginAttempt) error {
+	_, err := q.Exec(ctx,
+		`UPDATE login_throttles SET
+			failures = GREATEST(failures - 1, 0),
+			locked_until = CASE WHEN locked_until = $3 THEN NULL ELSE locked_until END
+		 WHERE scope = $1 AND key = $2`,
+		a.Scope, a.Key, a.LockedUntil,
+	)
+	if err != nil {
+		return fmt.Errorf("release login attempt: %w", err)
+	}
+	return nil
+}
+
+// DeleteLoginThrottle forgets the failures and any lock of a username or
+// client IP, returning false if there were none.
+func DeleteLoginThrottle(ctx context.Context, q Querier, scope, key string) (bool, error) {
+	tag, err := q.Exec(ctx, `DELETE FROM login_throttles WHERE scope = $1 AND key = $2`, scope, key)
+	if err != nil {
+		return false, fmt.Errorf("delete login throttle: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteStaleLoginThrottles removes the throttles whose last failure is older
+// than the window and whose lock, if any, has ended.
+func DeleteStaleLoginThrottles(ctx context.Context, q Querier, window time.Duration) error {
+	_, err := q.Exec(ctx,
+		`DELETE FROM login_throttles
+		 WHERE last_failure_at <= NOW() - $1::interval AND (locked_until IS NULL OR locked_until <= NOW())`,
+		window,
+	)
+	if err != nil {
+		return fmt.Errorf("delete stale login throttles: %w", err)
+	}
+	return nil
+}
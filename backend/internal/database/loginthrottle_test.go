@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottles(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	cleanup := func() {
+		pool.Exec(ctx, `DELETE FROM login_throttles WHERE key LIKE 'throttle-test-%'`)
+	}
+	cleanup()
+	defer cleanup()
+
+	limits := LoginLimits{DelayAfter: 2, LockoutAfter: 4, BaseDelay: time.Second, MaxDelay: time.Minute, Lockout: time.Hour, Window: time.Hour}
+	a, err := ReserveLoginAttempt(ctx, pool, ThrottleUsername, "throttle-test-bob", limits)
+	if err != nil || !a.Reserved || a.LockedUntil != nil { t.Fatalf("first attempt = %+v, %v", a, err) }
+	a, _ = ReserveLoginAttempt(ctx, pool, ThrottleUsername, "throttle-test-bob", limits)
+	if !a.Reserved || a.LockedUntil == nil || a.LockedUntil.Sub(a.Now) != time.Second { t.Fatalf("second attempt = %+v", a) }
+	locked := a
+
+	// Nothing is counted while locked
+	a, _ = ReserveLoginAttempt(ctx, pool, ThrottleUsername, "throttle-test-bob", limits)
+	if a.Reserved || a.RetryAfter() <= 0 || a.RetryAfter() > time.Second { t.Errorf("while locked = %+v", a) }
+	th, found, err := FindLoginThrottle(ctx, pool, ThrottleUsername, "throttle-test-bob")
+	if err != nil || !found || th.Failures != 2 { t.Errorf("find = %+v, %v, %v", th, found, err) }
+	if _, found, _ := FindLoginThrottle(ctx, pool, ThrottleIP, "throttle-test-bob"); found { t.Error("found under the wrong scope") }
+
+	// Releasing uncounts the attempt and lifts the lock it set
+	if err := ReleaseLoginAttempt(ctx, pool, locked); err != nil { t.Fatalf("release: %v", err) }
+	if th, _, _ := FindLoginThrottle(ctx, pool, ThrottleUsername, "throttle-test-bob"); th.Failures != 1 || th.LockedUntil != nil { t.Errorf("after release = %+v", th) }
+
+	// Failures older than the window are counted afresh
+	pool.Exec(ctx, `UPDATE login_throttles SET last_failure_at = NOW() - interval '2 hours' WHERE key = 'throttle-test-bob'`)
+	if a, _ := ReserveLoginAttempt(ctx, pool, ThrottleUsername, "throttle-test-bob", limits); !a.Reserved || a.LockedUntil != nil { t.Errorf("after window = %+v", a) }
+
+	// Concurrent attempts cannot get past the lock
+	pool.Exec(ctx, `DELETE FROM login_throttles WHERE key = 'throttle-test-bob'`)
+	limits.DelayAfter = 1
+	var wg sync.WaitGroup
+	var reserved atomic.Int32
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if a, err := ReserveLoginAttempt(ctx, pool, ThrottleUsername, "throttle-test-bob", limits); err == nil && a.Reserved { reserved.Add(1) }
+		}()
+	}
+	wg.Wait()
+	if n := reserved.Load(); n != 1 { t.Errorf("%d concurrent attempts reserved, want 1", n) }
+
+	// The lockout applies from LockoutAfter failures
+	pool.Exec(ctx, `UPDATE login_throttles SET failures = 3, locked_until = NULL WHERE key = 'throttle-test-bob'`)
+	if a, _ := ReserveLoginAttempt(ctx, pool, ThrottleUsername, "throttle-test-bob", limits); a.LockedUntil == nil || a.LockedUntil.Sub(a.Now) != time.Hour { t.Errorf("lockout = %+v", a) }
+
+	// Stale throttles are removed unless still locked
+	limits.DelayAfter = 2
+	ReserveLoginAttempt(ctx, pool, ThrottleIP, "throttle-test-192.0.2.1", limits)
+	pool.Exec(ctx, `UPDATE login_throttles SET last_failure_at = NOW() - interval '2 hours' WHERE key LIKE 'throttle-test-%'`)
+	if err := DeleteStaleLoginThrottles(ctx, pool, time.Hour); err != nil { t.Fatalf("delete stale: %v", err) }
+	throttles, _ := GetLoginThrottles(ctx, pool, time.Hour)
+	var keys []string
+	for _, th := range throttles {
+		if strings.HasPrefix(th.Key, "throttle-test-") { keys = append(keys, th.Key) }
+	}
+	if len(keys) != 1 || keys[0] != "throttle-test-bob" { t.Errorf("throttles left = %v, want the locked one", keys) }
+
+	if found, err := DeleteLoginThrottle(ctx, pool, ThrottleUsername, "throttle-test-bob"); err != nil || !found { t.Errorf("delete = %v, %v", found, err) }
+	if found, _ := DeleteLoginThrottle(ctx, pool, ThrottleUsername, "throttle-test-bob"); found { t.Error("deleted twice") }
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Lookup statuses for a single input row.
+const (
+	LookupMatched  = "matched"   // best match is at least LookupMatchThreshold
+	LookupPossible = "possible"  // similar names found, none confident enough
+	LookupNotFound = "not_found" // no similar active organisation
+)
+
+// LookupMatchThreshold is the confidence at or above which a match is reported as matched.
+const LookupMatchThreshold = 0.8
+
+// Lookup tuning: how many candidates are considered and returned per row, and
+// the confidence penalty when a town is given but the candidate is elsewhere.
+const (
+	lookupCandidates   = 10
+	lookupMaxMatches   = 3
+	lookupTownMismatch = 0.8
+)
+
+// LookupInput is one employer to look up. Postcode is carried through to the
+// result but not used for matching, since the register has no postcodes.
+type LookupInput struct {
+	Name     string `json:"name"`
+	TownCity string `json:"town"`
+	Postcode string `json:"postcode,omitempty"`
+}
+
+// LookupMatch is an active organisation matching a lookup input, with its
+// current licences. Confidence runs from 0 to 1.
+type LookupMatch struct {
+	OrganisationID int            `json:"organisation_id"`
+	Name           string         `json:"name"`
+	TownCity       string         `json:"town_city"`
+	County         string         `json:"county"`
+	Confidence     float64        `json:"confidence"`
+	Licences       []RatedLicence `json:"licences"`
+}
+
+// LookupResult is the outcome for one input row. Row is 1-based.
+type LookupResult struct {
+	Row     int           `json:"row"`
+	Input   LookupInput   `json:"input"`
+	Status  string        `json:"status"`
+	Matches []LookupMatch `json:"matches"`
+}
+
+// LookupSummary counts lookup results by status.
+type LookupSummary struct {
+	Matched  int `json:"matched"`
+	Possible int `json:"possible"`
+	NotFound int `json:"not_found"`
+}
+
+// LookupResponse holds the results of a bulk lookup, in input order.
+type LookupResponse struct {
+	Summary LookupSummary  `json:"summary"`
+	Results []LookupResult `json:"results"`
+}
+
+// LookupOrganisations matches each input against the active register by
+// trigram similarity of normalised names (see normalise_org_name), returning
+// the best matches per row with their current licences.
+func LookupOrganisations(ctx context.Context, q Querier, inputs []LookupInput) (*LookupResponse, error) {
+	resp := &LookupResponse{Results: make([]LookupResult, len(inputs))}
+	var orgIDs []int
+	for i, in := range inputs {
+		candidates, err := findLookupCandidates(ctx, q, in.Name)
+		if err != nil {
+			return nil, fmt.Errorf("lookup organisations: row %d: %w", i+1, err)
+		}
+		matches := rankMatches(candidates, in.TownCity)
+		result := LookupResult{Row: i + 1, Input: in, Status: lookupStatus(matches), Matches: matches}
+		switch result.Status {
+		case LookupMatched:
+			resp.Summary.Matched++
+		case LookupPossible:
+			resp.Summary.Possible++
+		default:
+			resp.Summary.NotFound++
+		}
+		for _, m := range matches {
+			orgIDs = append(orgIDs, m.OrganisationID)
+		}
+		resp.Results[i] = result
+	}
+
+	if len(orgIDs) == 0 {
+		return resp, nil
+	}
+	licences, err := GetActiveLicencesByOrgIDs(ctx, q, orgIDs)
+	if err != nil {
+		return nil, fmt.Errorf("lookup organisations: %w", err)
+	}
+	byOrg := map[int][]RatedLicence{}
+	for _, l := range licences {
+		byOrg[l.OrganisationID] = append(byOrg[l.OrganisationID], RatedLicence{l.LicenceType, l.Route, l.Rating})
+	}
+	for i := range resp.Results {
+		for j := range resp.Results[i].Matches {
+			m := &resp.Results[i].Matches[j]
+			m.Licences = byOrg[m.OrganisationID]
+			if m.Licences == nil {
+				m.Licences = []RatedLicence{}
+			}
+		}
+	}
+	return resp, nil
+}
+
+// findLookupCandidates returns the active organisations whose normalised name
+// is similar to name (pg_trgm similarity_threshold), most similar first, with
+// the similarity as their confidence.
+func findLookupCandidates(ctx context.Context, q Querier, name string) ([]LookupMatch, error) {
+	rows, err := q.Query(ctx,
+		`SELECT o.id, o.name, COALESCE(o.town_city, ''), COALESCE(o.county, ''),
+		        similarity(normalise_org_name(@name), normalise_org_name(o.name)) AS score
+		 FROM organisations o
+		 WHERE o.deleted_at IS NULL
+		   AND normalise_org_name(@name) % normalise_org_name(o.name)
+		 ORDER BY score DESC, o.id
+		 LIMIT @limit`,
+		pgx.NamedArgs{"name": name, "limit": lookupCandidates})
+	if err != nil {
+		return nil, fmt.Errorf("find lookup candidates: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []LookupMatch{}
+	for rows.Next() {
+		var m LookupMatch
+		if err := rows.Scan(&m.OrganisationID, &m.Name, &m.TownCity, &m.County, &m.Confidence); err != nil {
+			return nil, fmt.Errorf("find lookup candidates: scan row: %w", err)
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// rankMatches applies the town penalty to candidates when a town is given,
+// then returns the best lookupMaxMatches by confidence.
+func rankMatches(candidates []LookupMatch, town string) []LookupMatch {
+	town = strings.TrimSpace(town)
+	matches := slices.Clone(candidates)
+	if town != "" {
+		for i := range matches {
+			if !strings.EqualFold(strings.TrimSpace(matches[i].TownCity), town) {
+				matches[i].Confidence *= lookupTownMismatch
+			}
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b LookupMatch) int {
+		return cmp.Compare(b.Confidence, a.Confidence)
+	})
+	if len(matches) > lookupMaxMatches {
+		matches = matches[:lookupMaxMatches]
+	}
+	if matches == nil {
+		matches = []LookupMatch{}
+	}
+	return matches
+}
+
+// lookupStatus classifies a row by its best match.
+func lookupStatus(matches []LookupMatch) string {
+	switch {
+	case len(matches) == 0:
+		return LookupNotFound
+	case matches[0].Confidence >= LookupMatchThreshold:
+		return LookupMatched
+	default:
+		return LookupPossible
+	}
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRankMatches(t *testing.T) {
+	candidates := []LookupMatch{
+		{OrganisationID: 1, TownCity: "London", Confidence: 1},
+		{OrganisationID: 2, TownCity: "Leeds", Confidence: 0.9},
+		{OrganisationID: 3, TownCity: "Leeds", Confidence: 0.5},
+		{OrganisationID: 4, TownCity: "Leeds", Confidence: 0.4},
+	}
+
+	got := rankMatches(candidates, "")
+	if len(got) != 3 || got[0].OrganisationID != 1 { t.Errorf("no town: got %+v", got) }
+
+	// A candidate in another town is penalised below one in the given town
+	got = rankMatches(candidates, " leeds ")
+	if len(got) != 3 || got[0].OrganisationID != 2 || got[1].OrganisationID != 1 || got[1].Confidence != 0.8 {
+		t.Errorf("with town: got %+v", got)
+	}
+	if candidates[0].Confidence != 1 { t.Errorf("rankMatches modified its input") }
+
+	if s := lookupStatus(rankMatches(nil, "")); s != LookupNotFound { t.Errorf("no candidates: status %q", s) }
+	if s := lookupStatus(got); s != LookupMatched { t.Errorf("0.9 confidence: status %q", s) }
+	if s := lookupStatus(candidates[2:]); s != LookupPossible { t.Errorf("0.5 confidence: status %q", s) }
+}
+
+func TestLookupOrganisations(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+
+	acme, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Widgets Limited", TownCity: "Dover", County: "Kent"}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"}, false)
+	InsertOrganisation(ctx, pool, Organisation{Name: "Acme Widgets Ltd", TownCity: "Leeds"}, false)
+
+	resp, err := LookupOrganisations(ctx, pool, []LookupInput{
+		{Name: "ACME WIDGETS LTD.", TownCity: "Dover", Postcode: "CT17 9AA"},
+		{Name: "Completely Unrelated Bakery"},
+	})
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if resp.Summary != (LookupSummary{Matched: 1, NotFound: 1}) { t.Errorf("summary = %+v", resp.Summary) }
+
+	first := resp.Results[0]
+	if first.Row != 1 || first.Status != LookupMatched || first.Input.Postcode != "CT17 9AA" { t.Errorf("row 1 = %+v", first) }
+	if len(first.Matches) != 2 || first.Matches[0].OrganisationID != acme || first.Matches[0].Confidence != 1 {
+		t.Fatalf("row 1 matches = %+v, want Dover branch first with confidence 1", first.Matches)
+	}
+	if len(first.Matches[0].Licences) != 1 || first.Matches[0].Licences[0].Route != "Skilled Worker" {
+		t.Errorf("row 1 licences = %+v", first.Matches[0].Licences)
+	}
+	if first.Matches[1].Licences == nil { t.Errorf("match without licences should have an empty list") }
+
+	if resp.Results[1].Status != LookupNotFound || len(resp.Results[1].Matches) != 0 { t.Errorf("row 2 = %+v", resp.Results[1]) }
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+}
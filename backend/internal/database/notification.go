@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NotificationSettings is where and about what a user is emailed. With
+// WatchAlerts, changes to the organisations on the user's watchlists are
+// emailed after each sync. With DailyDigest, the previous day's register
+// changes matching the digest criteria are emailed each day; empty criteria
+// match every change.
+type NotificationSettings struct {
+	UserID           int       `json:"-"`
+	Email            string    `json:"email"`
+	WatchAlerts      bool      `json:"watch_alerts"`
+	DailyDigest      bool      `json:"daily_digest"`
+	DigestEventTypes []string  `json:"digest_event_types"`
+	DigestRoutes     []string  `json:"digest_routes"`
+	DigestCounties   []string  `json:"digest_counties"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// DigestFilter returns the filter selecting the changes in the user's digest.
+func (s NotificationSettings) DigestFilter() ChangeFilter {
+	return ChangeFilter{EventTypes: s.DigestEventTypes, Routes: s.DigestRoutes, Counties: s.DigestCounties}
+}
+
+const notificationSettingsColumns = `user_id, email, watch_alerts, daily_digest, digest_event_types, digest_routes, digest_counties, updated_at`
+
+func scanNotificationSettings(row pgx.Row) (NotificationSettings, error) {
+	var s NotificationSettings
+	err := row.Scan(&s.UserID, &s.Email, &s.WatchAlerts, &s.DailyDigest, &s.DigestEventTypes, &s.DigestRoutes, &s.DigestCounties, &s.UpdatedAt)
+	return s, err
+}
+
+// UpsertNotificationSettings creates or replaces a user's notification settings.
+func UpsertNotificationSettings(ctx context.Context, q Querier, s NotificationSettings) error {
+	_, err := q.Exec(ctx,
+		`INSERT INTO notification_settings (user_id, email, watch_alerts, daily_digest, digest_event_types, digest_routes, digest_counties)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (user_id) DO UPDATE
+		 SET email = EXCLUDED.email, watch_alerts = EXCLUDED.watch_alerts, daily_digest = EXCLUDED.daily_digest,
+		     digest_event_types = EXCLUDED.digest_event_types, digest_routes = EXCLUDED.digest_routes,
+		     digest_counties = EXCLUDED.digest_counties, updated_at = NOW()`,
+		s.UserID, s.Email, s.WatchAlerts, s.DailyDigest, nonNil(s.DigestEventTypes), nonNil(s.DigestRoutes), nonNil(s.DigestCounties),
+	)
+	if err != nil {
+		return fmt.Errorf("upsert notification settings: %w", err)
+	}
+	return nil
+}
+
+// FindNotificationSettings looks up a user's notification settings.
+// Returns the settings and true if found, or empty and false if not found.
+func FindNotificationSettings(ctx context.Context, q Querier, userID int) (NotificationSettings, bool, error) {
+	s, err := scanNotificationSettings(q.QueryRow(ctx,
+		`SELECT `+notificationSettingsColumns+` FROM notification_settings WHERE user_id = $1`, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return NotificationSettings{}, false, nil
+	}
+	if err != nil {
+		return NotificationSettings{}, false, fmt.Errorf("find notification settings: %w", err)
+	}
+	return s, true, nil
+}
+
+// GetNotificationSettings returns the settings of every enabled user who has
+// opted in to watch alerts or daily digests, ordered by user ID.
+func GetNotificationSettings(ctx context.Context, q Querier) ([]NotificationSettings, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+notificationSettingsColumns+` FROM notification_settings
+		 WHERE (watch_alerts OR daily_digest)
+		   AND user_id IN (SELECT id FROM users WHERE disabled_at IS NULL)
+		 ORDER BY user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("get notification settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := []NotificationSettings{}
+	for rows.Next() {
+		s, err := scanNotificationSettings(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get notification settings: scan row: %w", err)
+		}
+		settings = append(settings, s)
+	}
+	return settings, rows.Err()
+}
+
+// DeleteNotificationSettings deletes a user's notification settings,
+// returning false if they had none.
+func DeleteNotificationSettings(ctx context.Context, q Querier, userID int) (bool, error) {
+	tag, err := q.Exec(ctx, `DELETE FROM notification_settings WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, fmt.Errorf("delete notification settings: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// PostgresNotificationStore manages users' notification settings in PostgreSQL.
+type PostgresNotificationStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresNotificationStore(pool *pgxpool.Pool) *PostgresNotificationStore {
+	return &PostgresNotificationStore{pool: pool}
+}
+
+// GetSettings returns a user's notification settings, or false if they have none.
+func (s *PostgresNotificationStore) GetSettings(ctx context.Context, userID int) (NotificationSettings, bool, error) {
+	return FindNotificationSettings(ctx, s.pool, userID)
+}
+
+// SaveSettings creates or replaces a user's notification settings and
+// returns them.
+func (s *PostgresNotificationStore) SaveSettings(ctx context.Context, settings NotificationSettings) (NotificationSettings, error) {
+	if err := UpsertNotificationSettings(ctx, s.pool, settings); err != nil {
+		return NotificationSettings{}, err
+	}
+	saved, _, err := FindNotificationSettings(ctx, s.pool, settings.UserID)
+	return saved, err
+}
+
+// DeleteSettings deletes a user's notification settings; see
+// DeleteNotificationSettings.
+func (s *PostgresNotificationStore) DeleteSettings(ctx context.Context, userID int) (bool, error) {
+	return DeleteNotificationSettings(ctx, s.pool, userID)
+}
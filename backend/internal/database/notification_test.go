@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotificationSettings(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	cleanup := func() { pool.Exec(ctx, `DELETE FROM users WHERE username LIKE 'notify-test-%'`) }
+	cleanup()
+	defer cleanup()
+
+	alice, _ := InsertUser(ctx, pool, User{Username: "notify-test-alice", PasswordHash: "x", Role: 50})
+	bob, _ := InsertUser(ctx, pool, User{Username: "notify-test-bob", PasswordHash: "x", Role: 50})
+	store := NewPostgresNotificationStore(pool)
+
+	if _, found, _ := store.GetSettings(ctx, alice); found { t.Error("found settings before saving") }
+	saved, err := store.SaveSettings(ctx, NotificationSettings{UserID: alice, Email: "alice@example.test", WatchAlerts: true})
+	if err != nil { t.Fatalf("save: %v", err) }
+	if saved.Email != "alice@example.test" || !saved.WatchAlerts || saved.DigestRoutes == nil || saved.UpdatedAt.IsZero() { t.Errorf("saved %+v", saved) }
+
+	// Saving again replaces the settings
+	saved, _ = store.SaveSettings(ctx, NotificationSettings{UserID: alice, Email: "a@example.test", DailyDigest: true, DigestCounties: []string{"Kent"}})
+	if saved.Email != "a@example.test" || saved.WatchAlerts || !saved.DailyDigest || !reflect.DeepEqual(saved.DigestCounties, []string{"Kent"}) { t.Errorf("replaced %+v", saved) }
+
+	store.SaveSettings(ctx, NotificationSettings{UserID: bob, Email: "bob@example.test"})
+	opted, err := GetNotificationSettings(ctx, pool)
+	if err != nil { t.Fatalf("get: %v", err) }
+	if len(opted) != 1 || opted[0].UserID != alice { t.Errorf("opted-in users = %+v, want only alice", opted) }
+
+	if found, _ := store.DeleteSettings(ctx, alice); !found { t.Error("delete: not found") }
+	if found, _ := store.DeleteSettings(ctx, alice); found { t.Error("deleted twice") }
+}
+
+func TestEmailQueue(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	cleanup := func() { pool.Exec(ctx, `DELETE FROM email_queue`) }
+	cleanup()
+	defer cleanup()
+
+	queued, err := EnqueueEmail(ctx, pool, QueuedEmail{DedupeKey: "watch:1:a", Recipient: "alice@example.test", Subject: "s", Body: "b"})
+	if err != nil || !queued { t.Fatalf("enqueue: queued=%v err=%v", queued, err) }
+	if queued, _ := EnqueueEmail(ctx, pool, QueuedEmail{DedupeKey: "watch:1:a", Recipient: "alice@example.test"}); queued { t.Error("queued a duplicate") }
+	EnqueueEmail(ctx, pool, QueuedEmail{DedupeKey: "watch:2:a", Recipient: "bob@example.test", Subject: "s", Body: "b"})
+
+	now := time.Now().UTC().Add(time.Minute)
+	claimed, err := ClaimDueEmails(ctx, pool, now, 5*time.Minute, 1)
+	if err != nil { t.Fatalf("claim: %v", err) }
+	if len(claimed) != 1 || claimed[0].DedupeKey != "watch:1:a" || claimed[0].Attempts != 1 { t.Fatalf("claimed %+v", claimed) }
+	if !claimed[0].NextAttemptAt.Equal(now.Add(5 * time.Minute)) { t.Errorf("leased until %v, want %v", claimed[0].NextAttemptAt, now.Add(5*time.Minute)) }
+
+	// A claimed email is not claimed again within its lease
+	claimed2, _ := ClaimDueEmails(ctx, pool, now, 5*time.Minute, 10)
+	if len(claimed2) != 1 || claimed2[0].DedupeKey != "watch:2:a" { t.Errorf("second claim = %+v", claimed2) }
+
+	MarkEmailSent(ctx, pool, claimed[0].ID, now)
+	RescheduleEmail(ctx, pool, claimed2[0].ID, "connection refused", now.Add(time.Minute))
+	if due, _ := ClaimDueEmails(ctx, pool, now.Add(30*time.Second), time.Minute, 10); len(due) != 0 { t.Errorf("claimed before retry time: %+v", due) }
+	due, _ := ClaimDueEmails(ctx, pool, now.Add(time.Hour), time.Minute, 10)
+	if len(due) != 1 || due[0].Attempts != 2 || due[0].LastError != "connection refused" { t.Fatalf("retry claim = %+v", due) }
+
+	AbandonEmail(ctx, pool, due[0].ID, "mailbox unavailable", now)
+	if due, _ := ClaimDueEmails(ctx, pool, now.Add(48*time.Hour), time.Minute, 10); len(due) != 0 { t.Errorf("claimed sent or abandoned email: %+v", due) }
+}
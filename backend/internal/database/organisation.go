@@ -18,6 +18,26 @@ func escapeLike(s string) string {
 	return likeEscaper.Replace(s)
 }
 
+// staleWindow bounds how long after an organisation is closed its licences
+// are closed, and how long before it a replacement is inserted, within one
+// sync run. A sync now stamps every change with the NOW() of its single
+// transaction, but history written by earlier syncs, which closed stale
+// organisations and then licences in separate statements at the end of the
+// run, is spread over the run.
+const staleWindow = "1 hour"
+
+// successorOf returns the condition for the organisation aliased as n being
+// the new version of the closed organisation aliased as o after a move: one
+// with the same name and the same town/city or county, added by the sync that
+// closed o, so within staleWindow before its closure. A name alone does not
+// identify an organisation, so a same-name organisation that changes both, or
+// is added at any other time, is unrelated.
+func successorOf(n, o string) string {
+	return n + `.name = ` + o + `.name AND ` + n + `.id <> ` + o + `.id AND ` +
+		`(NULLIF(` + n + `.town_city, '') = ` + o + `.town_city OR NULLIF(` + n + `.county, '') = ` + o + `.county) AND ` +
+		n + `.created_at BETWEEN ` + o + `.deleted_at - INTERVAL '` + staleWindow + `' AND ` + o + `.deleted_at`
+}
+
 // Organisation represents a sponsor organisation
 type Organisation struct {
 	ID        int
@@ -31,19 +51,19 @@ type Organisation struct {
 // InsertOrganisation adds a new organisation and returns its ID.
 // If initialRun is true, created_at is set to NULL (existed before tracking).
 // If initialRun is false, created_at uses the database default (NOW()).
-func InsertOrganisation(ctx context.Context, pool *pgxpool.Pool, org Organisation, initialRun bool) (int, error) {
+func InsertOrganisation(ctx context.Context, q Querier, org Organisation, initialRun bool) (int, error) {
 	var id int
 	var err error
 
 	if initialRun {
-		err = pool.QueryRow(ctx,
+		err = q.QueryRow(ctx,
 			`INSERT INTO organisations (name, town_city, county, created_at)
 			 VALUES ($1, $2, $3, NULL)
 			 RETURNING id`,
 			org.Name, org.TownCity, org.County,
 		).Scan(&id)
 	} else {
-		err = pool.QueryRow(ctx,
+		err = q.QueryRow(ctx,
 			`INSERT INTO organisations (name, town_city, county)
 			 VALUES ($1, $2, $3)
 			 RETURNING id`,
@@ -59,9 +79,9 @@ func InsertOrganisation(ctx context.Context, pool *pgxpool.Pool, org Organisatio
 
 // FindActiveOrganisation looks up an organisation by name, town, and county
 // Returns the organisation and true if found, or empty and false if not found
-func FindActiveOrganisation(ctx context.Context, pool *pgxpool.Pool, name, townCity, county string) (Organisation, bool, error) {
+func FindActiveOrganisation(ctx context.Context, q Querier, name, townCity, county string) (Organisation, bool, error) {
 	var org Organisation
-	err := pool.QueryRow(ctx,
+	err := q.QueryRow(ctx,
 		`SELECT id, name, town_city, county, created_at, deleted_at
 		 FROM organisations
 		 WHERE name = $1
@@ -97,8 +117,8 @@ func GetOrganisationByID(ctx context.Context, pool *pgxpool.Pool, id int) (Organ
 }
 
 // CloseOrganisation sets deleted_at to NOW() on an organisation (marks it as removed).
-func CloseOrganisation(ctx context.Context, pool *pgxpool.Pool, orgID int) error {
-	_, err := pool.Exec(ctx,
+func CloseOrganisation(ctx context.Context, q Querier, orgID int) error {
+	_, err := q.Exec(ctx,
 		`UPDATE organisations SET deleted_at = NOW() WHERE id = $1`,
 		orgID,
 	)
@@ -108,14 +128,11 @@ func CloseOrganisation(ctx context.Context, pool *pgxpool.Pool, orgID int) error
 	return nil
 }
 
-// CountAllActiveOrganisations returns the total number of active organisations.
-// If search is non-empty, only organisations matching the search term (by name or town/city) are counted.
-func CountAllActiveOrganisations(ctx context.Context, q Querier, search string) (int, error) {
-	query := `SELECT COUNT(*) FROM organisations WHERE deleted_at IS NULL`
-	args := pgx.NamedArgs{"search": "%" + escapeLike(search) + "%"}
-	if search != "" {
-		query += ` AND (name ILIKE @search OR town_city ILIKE @search)`
-	}
+// CountAllActiveOrganisations returns the total number of active organisations
+// matching the filter (active at filter.AsOf, if set).
+func CountAllActiveOrganisations(ctx context.Context, q Querier, filter OrganisationFilter) (int, error) {
+	where, args := filter.where(facetNone)
+	query := `SELECT COUNT(*) FROM organisations o WHERE ` + filter.orgActive("o") + where
 	var count int
 	err := q.QueryRow(ctx, query, args).Scan(&count)
 	if err != nil {
@@ -124,27 +141,29 @@ func CountAllActiveOrganisations(ctx context.Context, q Querier, search string)
 	return count, nil
 }
 
-// GetAllActiveOrganisationsUnfiltered retrieves all active organisations with no pagination or search.
-func GetAllActiveOrganisationsUnfiltered(ctx context.Context, pool *pgxpool.Pool) ([]Organisation, error) {
-	return GetAllActiveOrganisations(ctx, pool, 1, 0, "")
+// GetAllActiveOrganisationsUnfiltered retrieves all active organisations with no pagination or filter.
+func GetAllActiveOrganisationsUnfiltered(ctx context.Context, q Querier) ([]Organisation, error) {
+	return GetAllActiveOrganisations(ctx, q, 1, 0, OrganisationFilter{}, OrganisationSort{})
 }
 
-// GetAllActiveOrganisations retrieves active organisations, optionally paginated and filtered.
+// GetAllActiveOrganisations retrieves active organisations, optionally paginated, filtered and sorted.
+// If filter.AsOf is set, organisations are those on the register at that instant.
 // from and to are 1-based order numbers. If to == 0, all organisations are returned.
-// If search is non-empty, only organisations matching by name or town/city are included.
-func GetAllActiveOrganisations(ctx context.Context, q Querier, from, to int, search string) ([]Organisation, error) {
-	query := `SELECT id, name, town_city, county, created_at
-		 FROM organisations
-		 WHERE deleted_at IS NULL`
-	args := pgx.NamedArgs{
-		"offset": from - 1,
-		"limit":  to - from + 1,
-		"search": "%" + escapeLike(search) + "%",
+func GetAllActiveOrganisations(ctx context.Context, q Querier, from, to int, filter OrganisationFilter, sort OrganisationSort) ([]Organisation, error) {
+	if err := sort.validFor(filter); err != nil {
+		return nil, fmt.Errorf("get all active organisations: %w", err)
 	}
-	if search != "" {
-		query += ` AND (name ILIKE @search OR town_city ILIKE @search)`
+	orderBy, err := sort.orderBy(filter, false)
+	if err != nil {
+		return nil, fmt.Errorf("get all active organisations: %w", err)
 	}
-	query += ` ORDER BY name`
+	where, args := filter.where(facetNone)
+	query := `SELECT o.id, o.name, o.town_city, o.county, o.created_at
+		 FROM organisations o
+		 WHERE ` + filter.orgActive("o") + where
+	args["offset"] = from - 1
+	args["limit"] = to - from + 1
+	query += orderBy
 	if to != 0 {
 		query += ` OFFSET @offset LIMIT @limit`
 	}
@@ -165,3 +184,59 @@ func GetAllActiveOrganisations(ctx context.Context, q Querier, from, to int, sea
 	}
 	return orgs, rows.Err()
 }
+
+// GetActiveOrganisationsPage retrieves up to limit active organisations
+// matching the filter using keyset pagination, along with each row's sort key
+// for building cursors. Rows come after the cursor in sort order, or before it
+// if the cursor is backward, in which case they are returned in reverse order.
+// A nil cursor starts from the beginning. The cursor must have been issued for
+// the same sort.
+func GetActiveOrganisationsPage(ctx context.Context, q Querier, filter OrganisationFilter, sort OrganisationSort, cursor *PageCursor, limit int) ([]Organisation, []string, error) {
+	if err := sort.validFor(filter); err != nil {
+		return nil, nil, fmt.Errorf("get active organisations page: %w", err)
+	}
+	col, err := sort.column(filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get active organisations page: %w", err)
+	}
+	backward := cursor != nil && cursor.Backward
+	orderBy, err := sort.orderBy(filter, backward)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get active organisations page: %w", err)
+	}
+	where, args := filter.where(facetNone)
+	query := `SELECT o.id, o.name, o.town_city, o.county, o.created_at, (` + col.expr + `)::text
+		 FROM organisations o
+		 WHERE ` + filter.orgActive("o") + where
+	if cursor != nil {
+		op := ">"
+		if sort.Desc != backward {
+			op = "<"
+		}
+		query += ` AND (` + col.expr + `, o.id) ` + op + ` (@cursor_key::` + col.sqlType + `, @cursor_id)`
+		args["cursor_key"] = cursor.Key
+		args["cursor_id"] = cursor.ID
+	}
+	query += orderBy + ` LIMIT @limit`
+	args["limit"] = limit
+
+	rows, err := q.Query(ctx, query, args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get active organisations page: %w", err)
+	}
+	defer rows.Close()
+
+	orgs := []Organisation{}
+	keys := []string{}
+	for rows.Next() {
+		var org Organisation
+		var key string
+		err := rows.Scan(&org.ID, &org.Name, &org.TownCity, &org.County, &org.CreatedAt, &key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get active organisations page: scan row: %w", err)
+		}
+		orgs = append(orgs, org)
+		keys = append(keys, key)
+	}
+	return orgs, keys, rows.Err()
+}
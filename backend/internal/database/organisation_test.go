@@ -91,7 +91,7 @@ func TestGetAllActiveOrganisations_ReturnsSortedByName(t *testing.T) {
 	idD, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Deleted Inc", TownCity: "Leeds", County: ""}, false)
 	CloseOrganisation(ctx, pool, idD)
 
-	orgs, err := GetAllActiveOrganisations(ctx, pool, 1, 0, "")
+	orgs, err := GetAllActiveOrganisations(ctx, pool, 1, 0, OrganisationFilter{}, OrganisationSort{})
 	if err != nil { t.Fatalf("unexpected error: %v", err) }
 	if len(orgs) != 2 { t.Fatalf("got %d orgs, want 2", len(orgs)) }
 	if orgs[0].ID != idA || orgs[1].ID != idZ { t.Error("orgs not sorted by name") }
@@ -112,11 +112,11 @@ func TestCountAllActiveOrganisations_WithSearch(t *testing.T) {
 	InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Acme Town", County: ""}, false)
 	InsertOrganisation(ctx, pool, Organisation{Name: "Gamma Inc", TownCity: "Leeds", County: ""}, false)
 
-	count, err := CountAllActiveOrganisations(ctx, pool, "acme")
+	count, err := CountAllActiveOrganisations(ctx, pool, OrganisationFilter{Search: "acme"})
 	if err != nil { t.Fatalf("unexpected error: %v", err) }
 	if count != 2 { t.Errorf("got %d, want 2 (matches name and town)", count) }
 
-	count, err = CountAllActiveOrganisations(ctx, pool, "")
+	count, err = CountAllActiveOrganisations(ctx, pool, OrganisationFilter{})
 	if err != nil { t.Fatalf("unexpected error: %v", err) }
 	if count != 3 { t.Errorf("got %d, want 3 (no filter)", count) }
 
@@ -136,18 +136,18 @@ func TestGetAllActiveOrganisations_WithSearch(t *testing.T) {
 	InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Acme Town", County: ""}, false)
 	InsertOrganisation(ctx, pool, Organisation{Name: "Gamma Inc", TownCity: "Leeds", County: ""}, false)
 
-	orgs, err := GetAllActiveOrganisations(ctx, pool, 1, 20, "acme")
+	orgs, err := GetAllActiveOrganisations(ctx, pool, 1, 20, OrganisationFilter{Search: "acme"}, OrganisationSort{})
 	if err != nil { t.Fatalf("unexpected error: %v", err) }
 	if len(orgs) != 2 { t.Fatalf("got %d orgs, want 2", len(orgs)) }
 	if orgs[0].Name != "Acme Corp" { t.Errorf("first org = %q, want Acme Corp", orgs[0].Name) }
 	if orgs[1].Name != "Beta Ltd" { t.Errorf("second org = %q, want Beta Ltd", orgs[1].Name) }
 
-	orgs, err = GetAllActiveOrganisations(ctx, pool, 2, 2, "acme")
+	orgs, err = GetAllActiveOrganisations(ctx, pool, 2, 2, OrganisationFilter{Search: "acme"}, OrganisationSort{})
 	if err != nil { t.Fatalf("unexpected error: %v", err) }
 	if len(orgs) != 1 { t.Fatalf("got %d orgs, want 1", len(orgs)) }
 	if orgs[0].Name != "Beta Ltd" { t.Errorf("org = %q, want Beta Ltd", orgs[0].Name) }
 
-	orgs, err = GetAllActiveOrganisations(ctx, pool, 21, 40, "acme")
+	orgs, err = GetAllActiveOrganisations(ctx, pool, 21, 40, OrganisationFilter{Search: "acme"}, OrganisationSort{})
 	if err != nil { t.Fatalf("unexpected error: %v", err) }
 	if len(orgs) != 0 { t.Errorf("got %d orgs, want 0 (past end)", len(orgs)) }
 
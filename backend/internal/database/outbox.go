@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// registerLockID is the advisory lock key held by register updates.
+const registerLockID = 7_142_001
+
+// OutboxEvent is a change event in the outbox.
+type OutboxEvent struct {
+	ID             int64
+	IdempotencyKey string
+	BatchKey       string
+	Event          ChangeEvent
+	CreatedAt      time.Time
+}
+
+// LockRegister takes a lock held until the end of the transaction that
+// serialises register updates. Without it, a sync could commit outbox events
+// with lower IDs than those of a sync that committed first, and a dispatcher
+// that had passed those IDs would never deliver them.
+func LockRegister(ctx context.Context, q Querier) error {
+	if _, err := q.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, registerLockID); err != nil {
+		return fmt.Errorf("lock register: %w", err)
+	}
+	return nil
+}
+
+// WriteOutbox writes the change events made in the current transaction to the
+// outbox as one batch and returns how many it wrote. Every change made in a
+// transaction is stamped with the transaction's start time, so these are the
+// events occurring at or after NOW(); it must therefore be called in the
+// transaction that made the changes. Each event's idempotency key is its
+// ChangeEvent.Key, and events already in the outbox are skipped.
+func WriteOutbox(ctx context.Context, q Querier) (int, error) {
+	var now time.Time
+	if err := q.QueryRow(ctx, `SELECT NOW()`).Scan(&now); err != nil {
+		return 0, fmt.Errorf("write outbox: %w", err)
+	}
+	events, err := GetChanges(ctx, q, ChangeQuery{After: ChangeCursor{OccurredAt: now}})
+	if err != nil {
+		return 0, fmt.Errorf("write outbox: %w", err)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	keys := make([]string, len(events))
+	bodies := make([]string, len(events))
+	for i, ev := range events {
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return 0, fmt.Errorf("write outbox: %w", err)
+		}
+		keys[i], bodies[i] = ev.Key(), string(b)
+	}
+	tag, err := q.Exec(ctx,
+		`INSERT INTO outbox_events (idempotency_key, batch_key, event)
+		 SELECT k, $1, e::jsonb FROM unnest($2::text[], $3::text[]) WITH ORDINALITY AS u(k, e, n)
+		 ORDER BY n
+		 ON CONFLICT (idempotency_key) DO NOTHING`,
+		"sync:"+now.UTC().Format(time.RFC3339Nano), keys, bodies,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("write outbox: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// StartOutboxCursor creates a sink's cursor at the end of the outbox if it has
+// none, so a new sink receives only the events written after it started.
+func StartOutboxCursor(ctx context.Context, q Querier, sink string) error {
+	_, err := q.Exec(ctx,
+		`INSERT INTO outbox_cursors (sink, last_event_id)
+		 SELECT $1, COALESCE(MAX(id), 0) FROM outbox_events
+		 ON CONFLICT (sink) DO NOTHING`,
+		sink,
+	)
+	if err != nil {
+		return fmt.Errorf("start outbox cursor: %w", err)
+	}
+	return nil
+}
+
+// OutboxClaim is a sink's cursor leased to one dispatcher while it delivers
+// the batch after LastEventID.
+type OutboxClaim struct {
+	Sink        string
+	LastEventID int64
+	LeasedUntil time.Time
+}
+
+// ClaimOutboxCursor leases a sink's cursor to the caller for the given time
+// if there are events after it, and returns the claim. It returns false if
+// the sink has no cursor or no later events, or another dispatcher holds an
+// unexpired lease. A lease that runs out, because its dispatcher stopped,
+// lets another claim the same batch.
+func ClaimOutboxCursor(ctx context.Context, q Querier, sink string, lease time.Duration) (OutboxClaim, bool, error) {
+	c := OutboxClaim{Sink: sink}
+	err := q.QueryRow(ctx,
+		`UPDATE outbox_cursors c SET leased_until = NOW() + $2::interval
+		 WHERE sink = $1
+		   AND (leased_until IS NULL OR leased_until <= NOW())
+		   AND EXISTS (SELECT 1 FROM outbox_events e WHERE e.id > c.last_event_id)
+		 RETURNING last_event_id, leased_until`,
+		sink, lease,
+	).Scan(&c.LastEventID, &c.LeasedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return OutboxClaim{}, false, nil
+	}
+	if err != nil {
+		return OutboxClaim{}, false, fmt.Errorf("claim outbox cursor: %w", err)
+	}
+	return c, true, nil
+}
+
+// AdvanceOutboxCursor records that the events up to lastID were delivered to
+// a sink and ends the claim's lease. It does nothing if the cursor has moved
+// since it was claimed.
+func AdvanceOutboxCursor(ctx context.Context, q Querier, c OutboxClaim, lastID int64) error {
+	_, err := q.Exec(ctx,
+		`UPDATE outbox_cursors SET last_event_id = $3, leased_until = NULL, updated_at = NOW()
+		 WHERE sink = $1 AND last_event_id = $2`,
+		c.Sink, c.LastEventID, lastID,
+	)
+	if err != nil {
+		return fmt.Errorf("advance outbox cursor: %w", err)
+	}
+	return nil
+}
+
+// ReleaseOutboxCursor ends a claim's lease without advancing the cursor, so
+// the batch may be claimed again at once. It does nothing if the lease has
+// since been claimed by another dispatcher.
+func ReleaseOutboxCursor(ctx context.Context, q Querier, c OutboxClaim) error {
+	_, err := q.Exec(ctx,
+		`UPDATE outbox_cursors SET leased_until = NULL WHERE sink = $1 AND leased_until = $2`,
+		c.Sink, c.LeasedUntil,
+	)
+	if err != nil {
+		return fmt.Errorf("release outbox cursor: %w", err)
+	}
+	return nil
+}
+
+// GetOutboxBatch returns the events of the first batch after afterID in ID
+// order, or none if there is no later event. Register updates are serialised,
+// so the events of a batch have consecutive IDs.
+func GetOutboxBatch(ctx context.Context, q Querier, afterID int64) ([]OutboxEvent, error) {
+	rows, err := q.Query(ctx,
+		`SELECT id, idempotency_key, batch_key, event, created_at
+		 FROM outbox_events
+		 WHERE id > $1
+		   AND batch_key = (SELECT batch_key FROM outbox_events WHERE id > $1 ORDER BY id LIMIT 1)
+		 ORDER BY id`,
+		afterID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get outbox batch: %w", err)
+	}
+	defer rows.Close()
+
+	events := []OutboxEvent{}
+	for rows.Next() {
+		var e OutboxEvent
+		var body []byte
+		if err := rows.Scan(&e.ID, &e.IdempotencyKey, &e.BatchKey, &body, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("get outbox batch: scan row: %w", err)
+		}
+		if err := json.Unmarshal(body, &e.Event); err != nil {
+			return nil, fmt.Errorf("get outbox batch: decode event %d: %w", e.ID, err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get outbox batch: %w", err)
+	}
+	return events, nil
+}
+
+// PruneOutbox deletes the events written before cutoff that have been
+// delivered to all of the given sinks, and returns how many it deleted.
+func PruneOutbox(ctx context.Context, q Querier, sinks []string, cutoff time.Time) (int64, error) {
+	tag, err := q.Exec(ctx,
+		`DELETE FROM outbox_events
+		 WHERE created_at < $2
+		   AND id <= (SELECT MIN(last_event_id) FROM outbox_cursors WHERE sink = ANY($1))`,
+		sinks, cutoff,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("prune outbox: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
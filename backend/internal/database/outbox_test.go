@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	cleanup := func() {
+		pool.Exec(ctx, `DELETE FROM outbox_cursors`)
+		pool.Exec(ctx, `DELETE FROM outbox_events`)
+		pool.Exec(ctx, `DELETE FROM licences`)
+		pool.Exec(ctx, `DELETE FROM organisations`)
+	}
+	cleanup()
+	defer cleanup()
+
+	if err := StartOutboxCursor(ctx, pool, "early"); err != nil { t.Fatalf("start cursor: %v", err) }
+
+	tx, err := pool.Begin(ctx)
+	if err != nil { t.Fatalf("begin: %v", err) }
+	defer tx.Rollback(ctx)
+	if err := LockRegister(ctx, tx); err != nil { t.Fatalf("lock register: %v", err) }
+	acme, _ := InsertOrganisation(ctx, tx, Organisation{Name: "Acme Ltd", TownCity: "Dover", County: "Kent"}, false)
+	InsertLicence(ctx, tx, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, false)
+	n, err := WriteOutbox(ctx, tx)
+	if err != nil || n != 2 { t.Fatalf("write outbox = %d, %v; want 2", n, err) }
+	// Writing again adds nothing: the events are already in the outbox
+	if n, err := WriteOutbox(ctx, tx); err != nil || n != 0 { t.Errorf("rewrite outbox = %d, %v; want 0", n, err) }
+	if err := tx.Commit(ctx); err != nil { t.Fatalf("commit: %v", err) }
+
+	// A sink started after the write only receives later events
+	if err := StartOutboxCursor(ctx, pool, "late"); err != nil { t.Fatalf("start cursor: %v", err) }
+	if _, ok, err := ClaimOutboxCursor(ctx, pool, "late", time.Minute); err != nil || ok { t.Fatalf("claim late cursor = %v, %v; want nothing to claim", ok, err) }
+
+	claim, ok, err := ClaimOutboxCursor(ctx, pool, "early", time.Minute)
+	if err != nil || !ok { t.Fatalf("claim early cursor = %v, %v", ok, err) }
+	batch, err := GetOutboxBatch(ctx, pool, claim.LastEventID)
+	if err != nil { t.Fatalf("get batch: %v", err) }
+	if len(batch) != 2 { t.Fatalf("batch has %d events, want 2", len(batch)) }
+	if batch[0].BatchKey != batch[1].BatchKey || batch[0].BatchKey == "" { t.Errorf("batch keys = %q, %q", batch[0].BatchKey, batch[1].BatchKey) }
+	if batch[0].Event.OrganisationID != acme || batch[0].IdempotencyKey != batch[0].Event.Key() { t.Errorf("event = %+v", batch[0]) }
+
+	// The lease keeps other dispatchers off the batch until it is released or runs out
+	if _, ok, _ := ClaimOutboxCursor(ctx, pool, "early", time.Minute); ok { t.Error("claimed a leased cursor") }
+	if err := ReleaseOutboxCursor(ctx, pool, claim); err != nil { t.Fatalf("release: %v", err) }
+	claim, ok, _ = ClaimOutboxCursor(ctx, pool, "early", time.Minute)
+	if !ok { t.Fatal("could not reclaim a released cursor") }
+	pool.Exec(ctx, `UPDATE outbox_cursors SET leased_until = NOW() - interval '1 second' WHERE sink = 'early'`)
+	if _, ok, _ := ClaimOutboxCursor(ctx, pool, "early", time.Minute); !ok { t.Error("could not claim an expired lease") }
+
+	// Events are pruned once every sink has received them
+	if n, _ := PruneOutbox(ctx, pool, []string{"early", "late"}, time.Now().Add(time.Hour)); n != 0 { t.Errorf("pruned %d undelivered events", n) }
+	if err := AdvanceOutboxCursor(ctx, pool, claim, batch[1].ID); err != nil { t.Fatalf("advance cursor: %v", err) }
+	if _, ok, _ := ClaimOutboxCursor(ctx, pool, "early", time.Minute); ok { t.Error("claimed a cursor with no later events") }
+	if n, _ := PruneOutbox(ctx, pool, []string{"early", "late"}, time.Now().Add(-time.Hour)); n != 0 { t.Errorf("pruned %d events newer than the cutoff", n) }
+	if n, err := PruneOutbox(ctx, pool, []string{"early", "late"}, time.Now().Add(time.Hour)); err != nil || n != 2 { t.Errorf("prune = %d, %v; want 2", n, err) }
+}
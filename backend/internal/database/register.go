@@ -0,0 +1,234 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RegisterRow is one licence of an organisation as it stood at a point in time.
+// Licence fields are empty for an organisation with no active licences.
+type RegisterRow struct {
+	OrganisationID int
+	Name           string
+	TownCity       string
+	County         string
+	LicenceType    string
+	Route          string
+	Rating         string
+}
+
+// EndOfDay returns the instant at which the given date ends, i.e. midnight UTC
+// of the following day. Date-based reports use it so a day includes its sync.
+func EndOfDay(date time.Time) time.Time {
+	y, m, d := date.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+// GetRegisterAt reconstructs the register as it stood at the given instant.
+// Records with a NULL created_at/valid_from existed before tracking began and
+// are treated as present at any earlier instant.
+func GetRegisterAt(ctx context.Context, q Querier, at time.Time) ([]RegisterRow, error) {
+	rows, err := q.Query(ctx,
+		`SELECT o.id, o.name, o.town_city, o.county,
+		        COALESCE(l.licence_type, ''), COALESCE(l.route, ''), COALESCE(l.rating, '')
+		 FROM organisations o
+		 LEFT JOIN licences l ON l.organisation_id = o.id
+		   AND (l.valid_from IS NULL OR l.valid_from <= @at)
+		   AND (l.valid_to IS NULL OR l.valid_to > @at)
+		 WHERE (o.created_at IS NULL OR o.created_at <= @at)
+		   AND (o.deleted_at IS NULL OR o.deleted_at > @at)
+		 ORDER BY o.name, o.town_city, o.county`,
+		pgx.NamedArgs{"at": at},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get register at: %w", err)
+	}
+	defer rows.Close()
+
+	register := []RegisterRow{}
+	for rows.Next() {
+		var r RegisterRow
+		err := rows.Scan(&r.OrganisationID, &r.Name, &r.TownCity, &r.County, &r.LicenceType, &r.Route, &r.Rating)
+		if err != nil {
+			return nil, fmt.Errorf("get register at: scan row: %w", err)
+		}
+		register = append(register, r)
+	}
+	return register, rows.Err()
+}
+
+// Organisation-level outcomes of a register comparison.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// LicenceKey identifies a licence within an organisation.
+type LicenceKey struct {
+	LicenceType string `json:"licence_type"`
+	Route       string `json:"route"`
+}
+
+// RatedLicence is a licence held by an organisation with its rating.
+type RatedLicence struct {
+	LicenceType string `json:"licence_type"`
+	Route       string `json:"route"`
+	Rating      string `json:"rating"`
+}
+
+// RatingChange is a licence whose rating differs between two dates.
+type RatingChange struct {
+	LicenceType string `json:"licence_type"`
+	Route       string `json:"route"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+}
+
+// OrganisationDiff describes how one organisation changed between two dates.
+// Organisations are matched by name, town/city and county, so an organisation
+// that was removed and re-added between the dates is compared as one.
+type OrganisationDiff struct {
+	Name          string         `json:"name"`
+	TownCity      string         `json:"town_city"`
+	County        string         `json:"county"`
+	Change        string         `json:"change"`
+	RoutesGained  []RatedLicence `json:"routes_gained,omitempty"`
+	RoutesLost    []RatedLicence `json:"routes_lost,omitempty"`
+	RatingChanges []RatingChange `json:"rating_changes,omitempty"`
+}
+
+// ComparisonSummary counts the changes in a register comparison.
+type ComparisonSummary struct {
+	OrganisationsAdded   int `json:"organisations_added"`
+	OrganisationsRemoved int `json:"organisations_removed"`
+	OrganisationsChanged int `json:"organisations_changed"`
+	Downgrades           int `json:"downgrades"`
+	Upgrades             int `json:"upgrades"`
+	RoutesGained         int `json:"routes_gained"`
+	RoutesLost           int `json:"routes_lost"`
+}
+
+// RegisterComparison is the difference in the register between two instants.
+type RegisterComparison struct {
+	From          time.Time          `json:"from"`
+	To            time.Time          `json:"to"`
+	Summary       ComparisonSummary  `json:"summary"`
+	Organisations []OrganisationDiff `json:"organisations"`
+}
+
+type orgKey struct {
+	name, townCity, county string
+}
+
+// CompareRegisters returns the per-organisation differences between two
+// register snapshots, sorted by name, town/city and county. Organisations
+// with no differences are omitted.
+func CompareRegisters(before, after []RegisterRow) ([]OrganisationDiff, ComparisonSummary) {
+	beforeOrgs := groupRegister(before)
+	afterOrgs := groupRegister(after)
+
+	keys := make([]orgKey, 0, len(beforeOrgs)+len(afterOrgs))
+	for k := range beforeOrgs {
+		keys = append(keys, k)
+	}
+	for k := range afterOrgs {
+		if _, ok := beforeOrgs[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		if keys[i].townCity != keys[j].townCity {
+			return keys[i].townCity < keys[j].townCity
+		}
+		return keys[i].county < keys[j].county
+	})
+
+	var summary ComparisonSummary
+	diffs := []OrganisationDiff{}
+	for _, k := range keys {
+		was, wasPresent := beforeOrgs[k]
+		now, isPresent := afterOrgs[k]
+		diff := OrganisationDiff{Name: k.name, TownCity: k.townCity, County: k.county}
+
+		for lk, rating := range now {
+			if oldRating, ok := was[lk]; !ok {
+				diff.RoutesGained = append(diff.RoutesGained, RatedLicence{lk.LicenceType, lk.Route, rating})
+			} else if oldRating != rating {
+				diff.RatingChanges = append(diff.RatingChanges, RatingChange{lk.LicenceType, lk.Route, oldRating, rating})
+			}
+		}
+		for lk, rating := range was {
+			if _, ok := now[lk]; !ok {
+				diff.RoutesLost = append(diff.RoutesLost, RatedLicence{lk.LicenceType, lk.Route, rating})
+			}
+		}
+
+		switch {
+		case !wasPresent:
+			diff.Change = DiffAdded
+			summary.OrganisationsAdded++
+		case !isPresent:
+			diff.Change = DiffRemoved
+			summary.OrganisationsRemoved++
+		case len(diff.RoutesGained) > 0 || len(diff.RoutesLost) > 0 || len(diff.RatingChanges) > 0:
+			diff.Change = DiffChanged
+			summary.OrganisationsChanged++
+		default:
+			continue
+		}
+
+		sortRatedLicences(diff.RoutesGained)
+		sortRatedLicences(diff.RoutesLost)
+		sort.Slice(diff.RatingChanges, func(i, j int) bool {
+			a, b := diff.RatingChanges[i], diff.RatingChanges[j]
+			if a.LicenceType != b.LicenceType {
+				return a.LicenceType < b.LicenceType
+			}
+			return a.Route < b.Route
+		})
+		summary.RoutesGained += len(diff.RoutesGained)
+		summary.RoutesLost += len(diff.RoutesLost)
+		for _, rc := range diff.RatingChanges {
+			switch {
+			case rc.From == RatingA && rc.To == RatingB:
+				summary.Downgrades++
+			case rc.From == RatingB && rc.To == RatingA:
+				summary.Upgrades++
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, summary
+}
+
+// groupRegister indexes register rows by organisation, then by licence.
+func groupRegister(rows []RegisterRow) map[orgKey]map[LicenceKey]string {
+	orgs := make(map[orgKey]map[LicenceKey]string)
+	for _, r := range rows {
+		k := orgKey{r.Name, r.TownCity, r.County}
+		if orgs[k] == nil {
+			orgs[k] = make(map[LicenceKey]string)
+		}
+		if r.LicenceType != "" || r.Route != "" {
+			orgs[k][LicenceKey{r.LicenceType, r.Route}] = r.Rating
+		}
+	}
+	return orgs
+}
+
+func sortRatedLicences(ls []RatedLicence) {
+	sort.Slice(ls, func(i, j int) bool {
+		if ls[i].LicenceType != ls[j].LicenceType {
+			return ls[i].LicenceType < ls[j].LicenceType
+		}
+		return ls[i].Route < ls[j].Route
+	})
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareRegisters(t *testing.T) {
+	before := []RegisterRow{
+		{Name: "Acme Ltd", TownCity: "London", LicenceType: "Worker", Route: "Skilled Worker", Rating: RatingA},
+		{Name: "Acme Ltd", TownCity: "London", LicenceType: "Temporary Worker", Route: "Creative Worker", Rating: RatingA},
+		{Name: "Gone Ltd", TownCity: "Leeds", LicenceType: "Worker", Route: "Skilled Worker", Rating: RatingA},
+		{Name: "Same Ltd", TownCity: "York", LicenceType: "Worker", Route: "Skilled Worker", Rating: RatingA},
+	}
+	after := []RegisterRow{
+		{Name: "Acme Ltd", TownCity: "London", LicenceType: "Worker", Route: "Skilled Worker", Rating: RatingB},
+		{Name: "Acme Ltd", TownCity: "London", LicenceType: "Worker", Route: "Global Business Mobility", Rating: RatingA},
+		{Name: "New Ltd", TownCity: "Hull", LicenceType: "Worker", Route: "Skilled Worker", Rating: RatingA},
+		{Name: "Same Ltd", TownCity: "York", LicenceType: "Worker", Route: "Skilled Worker", Rating: RatingA},
+	}
+
+	diffs, summary := CompareRegisters(before, after)
+	if len(diffs) != 3 { t.Fatalf("got %d diffs, want 3", len(diffs)) }
+
+	acme := diffs[0]
+	if acme.Name != "Acme Ltd" || acme.Change != DiffChanged { t.Errorf("diff 0 = %s %s, want Acme Ltd changed", acme.Name, acme.Change) }
+	if len(acme.RatingChanges) != 1 || acme.RatingChanges[0].From != RatingA || acme.RatingChanges[0].To != RatingB {
+		t.Errorf("Acme rating changes = %+v", acme.RatingChanges)
+	}
+	if len(acme.RoutesGained) != 1 || acme.RoutesGained[0].Route != "Global Business Mobility" {
+		t.Errorf("Acme routes gained = %+v", acme.RoutesGained)
+	}
+	if len(acme.RoutesLost) != 1 || acme.RoutesLost[0].Route != "Creative Worker" {
+		t.Errorf("Acme routes lost = %+v", acme.RoutesLost)
+	}
+
+	if diffs[1].Name != "Gone Ltd" || diffs[1].Change != DiffRemoved { t.Errorf("diff 1 = %s %s, want Gone Ltd removed", diffs[1].Name, diffs[1].Change) }
+	if diffs[2].Name != "New Ltd" || diffs[2].Change != DiffAdded { t.Errorf("diff 2 = %s %s, want New Ltd added", diffs[2].Name, diffs[2].Change) }
+
+	want := ComparisonSummary{
+		OrganisationsAdded:   1,
+		OrganisationsRemoved: 1,
+		OrganisationsChanged: 1,
+		Downgrades:           1,
+		RoutesGained:         2,
+		RoutesLost:           2,
+	}
+	if summary != want { t.Errorf("summary = %+v, want %+v", summary, want) }
+}
+
+func TestEndOfDay(t *testing.T) {
+	got := EndOfDay(time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC))
+	want := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !got.Equal(want) { t.Errorf("got %v, want %v", got, want) }
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrSavedSearchNameTaken is returned when a user already has a saved search with the name.
+var ErrSavedSearchNameTaken = errors.New("a saved search with this name already exists")
+
+// SavedSearch is a named /api/data search of a user's. Query holds its
+// parameters as given to /api/data, which are parsed again wherever the
+// search is run. With Notify, the user is emailed when organisations enter or
+// leave its results after a sync.
+type SavedSearch struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	Notify    bool      `json:"notify"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const savedSearchColumns = `id, user_id, name, query, notify, created_at, updated_at`
+
+func scanSavedSearch(row pgx.Row) (SavedSearch, error) {
+	var s SavedSearch
+	err := row.Scan(&s.ID, &s.UserID, &s.Name, &s.Query, &s.Notify, &s.CreatedAt, &s.UpdatedAt)
+	return s, err
+}
+
+// InsertSavedSearch creates a saved search and returns its ID.
+// It returns ErrSavedSearchNameTaken if the user already has one with the name.
+func InsertSavedSearch(ctx context.Context, q Querier, s SavedSearch) (int, error) {
+	var id int
+	err := q.QueryRow(ctx,
+		`INSERT INTO saved_searches (user_id, name, query, notify) VALUES ($1, $2, $3, $4) RETURNING id`,
+		s.UserID, s.Name, s.Query, s.Notify,
+	).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrSavedSearchNameTaken
+	}
+	if err != nil {
+		return 0, fmt.Errorf("insert saved search: %w", err)
+	}
+	return id, nil
+}
+
+// GetSavedSearches returns a user's saved searches ordered by name.
+func GetSavedSearches(ctx context.Context, q Querier, userID int) ([]SavedSearch, error) {
+	return querySavedSearches(ctx, q, "get saved searches",
+		`SELECT `+savedSearchColumns+` FROM saved_searches WHERE user_id = $1 ORDER BY name`, userID)
+}
+
+// GetNotifyingSavedSearches returns every enabled user's saved searches with
+// notifications on, ordered by user and ID.
+func GetNotifyingSavedSearches(ctx context.Context, q Querier) ([]SavedSearch, error) {
+	return querySavedSearches(ctx, q, "get notifying saved searches",
+		`SELECT `+savedSearchColumns+` FROM saved_searches
+		 WHERE notify AND user_id IN (SELECT id FROM users WHERE disabled_at IS NULL)
+		 ORDER BY user_id, id`)
+}
+
+func querySavedSearches(ctx context.Context, q Querier, op, query string, args ...any) ([]SavedSearch, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	searches := []SavedSearch{}
+	for rows.Next() {
+		s, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		searches = append(searches, s)
+	}
+	return searches, rows.Err()
+}
+
+// FindSavedSearch looks up one of a user's saved searches by ID.
+// Returns the search and true if found, or empty and false if not found.
+func FindSavedSearch(ctx context.Context, q Querier, userID, id int) (SavedSearch, bool, error) {
+	s, err := scanSavedSearch(q.QueryRow(ctx,
+		`SELECT `+savedSearchColumns+` FROM saved_searches WHERE id = $1 AND user_id = $2`,
+		id, userID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return SavedSearch{}, false, nil
+	}
+	if err != nil {
+		return SavedSearch{}, false, fmt.Errorf("find saved search: %w", err)
+	}
+	return s, true, nil
+}
+
+// UpdateSavedSearch replaces the name, query and notify setting of
+// one of a user's saved searches, returning false if it does not exist and
+// ErrSavedSearchNameTaken if the name is in use.
+func UpdateSavedSearch(ctx context.Context, q Querier, s SavedSearch) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`UPDATE saved_searches SET name = $3, query = $4, notify = $5, updated_at = NOW()
+		 WHERE id = $1 AND user_id = $2`,
+		s.ID, s.UserID, s.Name, s.Query, s.Notify,
+	)
+	if isUniqueViolation(err) {
+		return false, ErrSavedSearchNameTaken
+	}
+	if err != nil {
+		return false, fmt.Errorf("update saved search: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteSavedSearch deletes one of a user's saved searches, returning false
+// if it does not exist.
+func DeleteSavedSearch(ctx context.Context, q Querier, userID, id int) (bool, error) {
+	tag, err := q.Exec(ctx, `DELETE FROM saved_searches WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("delete saved search: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// MatchOrganisations returns those of the given organisations that the filter
+// selects, in ID order. With AsOf set, it tests them against the register as
+// it stood at that instant.
+func MatchOrganisations(ctx context.Context, q Querier, filter OrganisationFilter, orgIDs []int) ([]int, error) {
+	where, args := filter.where(facetNone)
+	args["org_ids"] = orgIDs
+	rows, err := q.Query(ctx,
+		`SELECT o.id FROM organisations o WHERE o.id = ANY(@org_ids) AND `+filter.orgActive("o")+where+` ORDER BY o.id`,
+		args,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("match organisations: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("match organisations: scan row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// PostgresSavedSearchStore manages users' saved searches in PostgreSQL.
+type PostgresSavedSearchStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresSavedSearchStore(pool *pgxpool.Pool) *PostgresSavedSearchStore {
+	return &PostgresSavedSearchStore{pool: pool}
+}
+
+// ListSavedSearches returns a user's saved searches.
+func (s *PostgresSavedSearchStore) ListSavedSearches(ctx context.Context, userID int) ([]SavedSearch, error) {
+	return GetSavedSearches(ctx, s.pool, userID)
+}
+
+// GetSavedSearch returns one of a user's saved searches; see FindSavedSearch.
+func (s *PostgresSavedSearchStore) GetSavedSearch(ctx context.Context, userID, id int) (SavedSearch, bool, error) {
+	return FindSavedSearch(ctx, s.pool, userID, id)
+}
+
+// CreateSavedSearch saves a search and returns it.
+func (s *PostgresSavedSearchStore) CreateSavedSearch(ctx context.Context, search SavedSearch) (SavedSearch, error) {
+	id, err := InsertSavedSearch(ctx, s.pool, search)
+	if err != nil {
+		return SavedSearch{}, err
+	}
+	created, _, err := FindSavedSearch(ctx, s.pool, search.UserID, id)
+	return created, err
+}
+
+// UpdateSavedSearch replaces a user's saved search and returns it, or false
+// if it does not exist; see UpdateSavedSearch.
+func (s *PostgresSavedSearchStore) UpdateSavedSearch(ctx context.Context, search SavedSearch) (SavedSearch, bool, error) {
+	found, err := UpdateSavedSearch(ctx, s.pool, search)
+	if err != nil || !found {
+		return SavedSearch{}, false, err
+	}
+	return FindSavedSearch(ctx, s.pool, search.UserID, search.ID)
+}
+
+// DeleteSavedSearch deletes a user's saved search; see DeleteSavedSearch.
+func (s *PostgresSavedSearchStore) DeleteSavedSearch(ctx context.Context, userID, id int) (bool, error) {
+	return DeleteSavedSearch(ctx, s.pool, userID, id)
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSavedSearchStore(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	cleanup := func() {
+		pool.Exec(ctx, `DELETE FROM saved_searches`)
+		pool.Exec(ctx, `DELETE FROM users WHERE username LIKE 'search-test-%'`)
+	}
+	cleanup()
+	defer cleanup()
+
+	alice, _ := InsertUser(ctx, pool, User{Username: "search-test-alice", PasswordHash: "x", Role: 50})
+	bob, _ := InsertUser(ctx, pool, User{Username: "search-test-bob", PasswordHash: "x", Role: 50})
+	store := NewPostgresSavedSearchStore(pool)
+
+	created, err := store.CreateSavedSearch(ctx, SavedSearch{UserID: alice, Name: "Kent SW", Query: "county=Kent&route=Skilled+Worker", Notify: true})
+	if err != nil { t.Fatalf("create: %v", err) }
+	if created.ID == 0 || created.Query != "county=Kent&route=Skilled+Worker" || !created.Notify || created.CreatedAt.IsZero() { t.Errorf("created %+v", created) }
+	if _, err := store.CreateSavedSearch(ctx, SavedSearch{UserID: alice, Name: "Kent SW"}); err != ErrSavedSearchNameTaken { t.Errorf("duplicate name: err = %v", err) }
+	if _, err := store.CreateSavedSearch(ctx, SavedSearch{UserID: bob, Name: "Kent SW"}); err != nil { t.Errorf("same name for another user: %v", err) }
+
+	if _, found, _ := store.GetSavedSearch(ctx, bob, created.ID); found { t.Error("bob found alice's search") }
+	if _, found, _ := store.UpdateSavedSearch(ctx, SavedSearch{ID: created.ID, UserID: bob, Name: "Mine"}); found { t.Error("bob updated alice's search") }
+
+	updated, found, err := store.UpdateSavedSearch(ctx, SavedSearch{ID: created.ID, UserID: alice, Name: "Kent", Query: "county=Kent"})
+	if err != nil || !found { t.Fatalf("update = %v, %v", found, err) }
+	if updated.Name != "Kent" || updated.Query != "county=Kent" || updated.Notify { t.Errorf("updated %+v", updated) }
+
+	notifying, _ := GetNotifyingSavedSearches(ctx, pool)
+	if len(notifying) != 0 { t.Errorf("%d searches notifying, want 0", len(notifying)) }
+	list, _ := store.ListSavedSearches(ctx, alice)
+	if len(list) != 1 || list[0].ID != created.ID { t.Errorf("list = %+v", list) }
+
+	if found, _ := store.DeleteSavedSearch(ctx, bob, created.ID); found { t.Error("bob deleted alice's search") }
+	if found, err := store.DeleteSavedSearch(ctx, alice, created.ID); err != nil || !found { t.Errorf("delete = %v, %v", found, err) }
+}
+
+func TestMatchOrganisations(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	cleanup := func() {
+		pool.Exec(ctx, `DELETE FROM licences`)
+		pool.Exec(ctx, `DELETE FROM organisations`)
+	}
+	cleanup()
+	defer cleanup()
+
+	acme, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Dover", County: "Kent"}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, false)
+	beta, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Leeds", County: "West Yorkshire"}, false)
+	time.Sleep(10 * time.Millisecond)
+	before := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	gamma, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Gamma Ltd", TownCity: "Deal", County: "Kent"}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: gamma, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, false)
+	CloseOrganisation(ctx, pool, acme)
+
+	all := []int{acme, beta, gamma}
+	kentSW := OrganisationFilter{County: "Kent", Routes: []string{"Skilled Worker"}}
+	if ids, err := MatchOrganisations(ctx, pool, kentSW, all); err != nil || !reflect.DeepEqual(ids, []int{gamma}) { t.Errorf("now = %v, %v; want [%d]", ids, err, gamma) }
+	kentSW.AsOf = &before
+	if ids, err := MatchOrganisations(ctx, pool, kentSW, all); err != nil || !reflect.DeepEqual(ids, []int{acme}) { t.Errorf("before = %v, %v; want [%d]", ids, err, acme) }
+	if ids, _ := MatchOrganisations(ctx, pool, OrganisationFilter{}, []int{beta}); !reflect.DeepEqual(ids, []int{beta}) { t.Errorf("unfiltered = %v, want only the given organisations", ids) }
+}
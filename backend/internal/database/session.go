@@ -69,6 +69,19 @@ func DeleteSession(ctx context.Context, q Querier, token string) error {
 	return nil
 }
 
+// DeleteUserSessions removes a user's sessions, logging them out everywhere,
+// except the session identified by the except token if it is not empty.
+func DeleteUserSessions(ctx context.Context, q Querier, userID int, except string) error {
+	_, err := q.Exec(ctx,
+		`DELETE FROM sessions WHERE user_id = $1 AND token <> $2`,
+		userID, except,
+	)
+	if err != nil {
+		return fmt.Errorf("delete user sessions: %w", err)
+	}
+	return nil
+}
+
 // ExtendSession resets the expiry of a session to now + expiry duration.
 func ExtendSession(ctx context.Context, q Querier, token string, expiry time.Duration) error {
 	_, err := q.Exec(ctx,
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Snapshot breakdown dimensions stored in daily_snapshot_counts.
+const (
+	DimensionRoute       = "route"
+	DimensionLicenceType = "licence_type"
+	DimensionRating      = "rating"
+	DimensionCounty      = "county"
+)
+
+// Dimensions lists every snapshot breakdown dimension.
+var Dimensions = []string{DimensionRoute, DimensionLicenceType, DimensionRating, DimensionCounty}
+
+// dimensionExprs are the grouping expressions for each dimension over
+// licences l joined to organisations o.
+var dimensionExprs = map[string]string{
+	DimensionRoute:       `l.route`,
+	DimensionLicenceType: `l.licence_type`,
+	DimensionRating:      `l.rating`,
+	DimensionCounty:      `COALESCE(o.county, '')`,
+}
+
+// RefreshDailySnapshot recomputes the snapshot for one day (UTC) from the
+// temporal tables: the register at the end of the day and the change events
+// during it. A re-rating counts as one licence removed and one added, as well
+// as one re-rated. For the current day this is the register as it stands now.
+func RefreshDailySnapshot(ctx context.Context, pool *pgxpool.Pool, date time.Time) error {
+	y, m, d := date.UTC().Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	at := EndOfDay(day)
+	register := OrganisationFilter{AsOf: &at}
+	args := pgx.NamedArgs{
+		"date":     day.Format(time.DateOnly),
+		"day":      day,
+		"as_of":    at,
+		"rating_a": RatingA,
+		"rating_b": RatingB,
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("refresh daily snapshot: begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM daily_snapshots WHERE snapshot_date = @date`, args); err != nil {
+		return fmt.Errorf("refresh daily snapshot: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, changeEventsSince("@day")+`,
+		day_events AS (
+			SELECT event_type, rating, previous_rating FROM events
+			WHERE occurred_at > @day AND occurred_at <= @as_of
+		)
+		INSERT INTO daily_snapshots (
+			snapshot_date, organisations, licences, b_rated_sponsors,
+			organisations_added, organisations_removed,
+			licences_added, licences_removed, licences_rerated, downgrades, upgrades)
+		SELECT @date::date,
+			(SELECT COUNT(*) FROM organisations o WHERE `+register.orgActive("o")+`),
+			(SELECT COUNT(*) FROM licences l JOIN organisations o ON o.id = l.organisation_id
+			 WHERE `+register.licenceActive("l")+` AND `+register.orgActive("o")+`),
+			(SELECT COUNT(DISTINCT o.id) FROM licences l JOIN organisations o ON o.id = l.organisation_id
+			 WHERE `+register.licenceActive("l")+` AND `+register.orgActive("o")+` AND l.rating = @rating_b),
+			COUNT(*) FILTER (WHERE event_type = 'organisation_added'),
+			COUNT(*) FILTER (WHERE event_type = 'organisation_removed'),
+			COUNT(*) FILTER (WHERE event_type IN ('licence_added', 'licence_rerated')),
+			COUNT(*) FILTER (WHERE event_type IN ('licence_removed', 'licence_rerated')),
+			COUNT(*) FILTER (WHERE event_type = 'licence_rerated'),
+			COUNT(*) FILTER (WHERE event_type = 'licence_rerated' AND previous_rating = @rating_a AND rating = @rating_b),
+			COUNT(*) FILTER (WHERE event_type = 'licence_rerated' AND previous_rating = @rating_b AND rating = @rating_a)
+		FROM day_events`, args)
+	if err != nil {
+		return fmt.Errorf("refresh daily snapshot: %w", err)
+	}
+
+	for _, dim := range Dimensions {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO daily_snapshot_counts (snapshot_date, dimension, value, organisations, licences)
+			 SELECT @date::date, @dimension, `+dimensionExprs[dim]+`, COUNT(DISTINCT o.id), COUNT(*)
+			 FROM licences l
+			 JOIN organisations o ON o.id = l.organisation_id
+			 WHERE `+register.licenceActive("l")+` AND `+register.orgActive("o")+`
+			 GROUP BY 3`,
+			pgx.NamedArgs{"date": args["date"], "as_of": at, "dimension": dim})
+		if err != nil {
+			return fmt.Errorf("refresh daily snapshot: %s counts: %w", dim, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("refresh daily snapshot: commit: %w", err)
+	}
+	return nil
+}
+
+// RefreshDailySnapshots recomputes the snapshots for every day from from to
+// to inclusive, one transaction per day, calling progress after each.
+func RefreshDailySnapshots(ctx context.Context, pool *pgxpool.Pool, from, to time.Time, progress func(day time.Time)) error {
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if err := RefreshDailySnapshot(ctx, pool, day); err != nil {
+			return fmt.Errorf("%s: %w", day.Format(time.DateOnly), err)
+		}
+		if progress != nil {
+			progress(day)
+		}
+	}
+	return nil
+}
+
+// GetFirstTrackedDay returns the UTC date of the first sync run, or false if
+// there have been none.
+func GetFirstTrackedDay(ctx context.Context, q Querier) (time.Time, bool, error) {
+	var first *time.Time
+	if err := q.QueryRow(ctx, `SELECT MIN(start_time) FROM sync_runs`).Scan(&first); err != nil {
+		return time.Time{}, false, fmt.Errorf("get first tracked day: %w", err)
+	}
+	if first == nil {
+		return time.Time{}, false, nil
+	}
+	y, m, d := first.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), true, nil
+}
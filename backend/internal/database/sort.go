@@ -0,0 +1,125 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sort fields accepted by GetAllActiveOrganisations.
+const (
+	SortName             = "name"
+	SortTown             = "town"
+	SortCounty           = "county"
+	SortFirstSeen        = "first_seen"         // created_at; organisations present before tracking sort earliest
+	SortLicenceCount     = "licence_count"      // number of active licences
+	SortLastRatingChange = "last_rating_change" // most recent re-rating of any licence; never re-rated sorts last
+	SortRelevance        = "relevance"          // fuzzy search score; only valid with a fuzzy search
+)
+
+// SortFields lists every accepted sort field.
+var SortFields = []string{SortName, SortTown, SortCounty, SortFirstSeen, SortLicenceCount, SortLastRatingChange, SortRelevance}
+
+// OrganisationSort orders a list of organisations. The zero value sorts by name ascending.
+type OrganisationSort struct {
+	Field string
+	Desc  bool
+}
+
+// sortColumn is the SQL expression for a sort field over organisations
+// aliased as o, and the type its text form is cast back to for keyset
+// comparisons. Expressions never yield NULL so that row comparisons work.
+type sortColumn struct {
+	expr    string
+	sqlType string
+}
+
+// keyLayouts are the text forms of a timestamptz in the ISO DateStyle, with
+// the offsets PostgreSQL may print for the session time zone.
+var keyLayouts = []string{"2006-01-02 15:04:05Z07", "2006-01-02 15:04:05Z07:00", "2006-01-02 15:04:05Z07:00:00"}
+
+// validKey reports whether key is a text form of a value of the column's SQL
+// type, so that a cursor key can be cast back to it.
+func (c sortColumn) validKey(key string) bool {
+	switch c.sqlType {
+	case "timestamptz":
+		if key == "infinity" || key == "-infinity" {
+			return true
+		}
+		for _, layout := range keyLayouts {
+			if _, err := time.Parse(layout, key); err == nil {
+				return true
+			}
+		}
+		return false
+	case "bigint":
+		_, err := strconv.ParseInt(key, 10, 64)
+		return err == nil
+	case "real":
+		_, err := strconv.ParseFloat(key, 32)
+		return err == nil
+	}
+	return !strings.ContainsRune(key, 0)
+}
+
+// column returns the sort expression and its SQL type. Expressions over
+// licences count those active when the filter's register view was taken.
+func (s OrganisationSort) column(f OrganisationFilter) (sortColumn, error) {
+	switch s.Field {
+	case SortName, "":
+		return sortColumn{`o.name`, "text"}, nil
+	case SortTown:
+		return sortColumn{`COALESCE(o.town_city, '')`, "text"}, nil
+	case SortCounty:
+		return sortColumn{`COALESCE(o.county, '')`, "text"}, nil
+	case SortFirstSeen:
+		// NULL created_at means present before tracking began, i.e. earliest
+		return sortColumn{`COALESCE(o.created_at, '-infinity')`, "timestamptz"}, nil
+	case SortLicenceCount:
+		return sortColumn{`(SELECT COUNT(*) FROM licences sl WHERE sl.organisation_id = o.id AND ` + f.licenceActive("sl") + `)`, "bigint"}, nil
+	case SortLastRatingChange:
+		// Never re-rated sorts last in either direction
+		sentinel := "infinity"
+		if s.Desc {
+			sentinel = "-infinity"
+		}
+		before := ""
+		if f.AsOf != nil {
+			before = ` AND sl.valid_from <= @as_of`
+		}
+		return sortColumn{`COALESCE((SELECT MAX(sl.valid_from) FROM licences sl
+		JOIN licences sp ON sp.organisation_id = sl.organisation_id
+		  AND sp.licence_type = sl.licence_type
+		  AND sp.route = sl.route
+		  AND sp.rating <> sl.rating
+		  AND sp.valid_to BETWEEN sl.valid_from - INTERVAL '` + rerateWindow + `' AND sl.valid_from
+		WHERE sl.organisation_id = o.id` + before + `), '` + sentinel + `')`, "timestamptz"}, nil
+	case SortRelevance:
+		return sortColumn{relevanceExpr, "real"}, nil
+	}
+	return sortColumn{}, fmt.Errorf("unknown sort field %q", s.Field)
+}
+
+// validFor reports an error if the sort cannot be applied with the filter.
+func (s OrganisationSort) validFor(f OrganisationFilter) error {
+	if s.Field == SortRelevance && !f.fuzzySearch() {
+		return fmt.Errorf("sort by relevance requires a fuzzy search")
+	}
+	return nil
+}
+
+// orderBy returns the ORDER BY clause for the sort with the filter, reversed if backward.
+// Organisation ID is always the final key so that pagination is stable when
+// sort values tie.
+func (s OrganisationSort) orderBy(f OrganisationFilter, backward bool) (string, error) {
+	col, err := s.column(f)
+	if err != nil {
+		return "", err
+	}
+	dir := "ASC"
+	if s.Desc != backward {
+		dir = "DESC"
+	}
+	return ` ORDER BY ` + col.expr + ` ` + dir + `, o.id ` + dir, nil
+}
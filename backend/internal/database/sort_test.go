@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestOrganisationSort_OrderBy(t *testing.T) {
+	tests := []struct {
+		sort    OrganisationSort
+		want    string
+		wantErr bool
+	}{
+		{OrganisationSort{}, " ORDER BY o.name ASC, o.id ASC", false},
+		{OrganisationSort{Field: SortCounty, Desc: true}, " ORDER BY COALESCE(o.county, '') DESC, o.id DESC", false},
+		{OrganisationSort{Field: SortFirstSeen}, " ORDER BY COALESCE(o.created_at, '-infinity') ASC, o.id ASC", false},
+		{OrganisationSort{Field: SortFirstSeen, Desc: true}, " ORDER BY COALESCE(o.created_at, '-infinity') DESC, o.id DESC", false},
+		{OrganisationSort{Field: "id"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := tt.sort.orderBy(OrganisationFilter{}, false)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%+v: err = %v, wantErr = %v", tt.sort, err, tt.wantErr)
+		}
+		if got != tt.want { t.Errorf("%+v: got %q, want %q", tt.sort, got, tt.want) }
+	}
+
+	// Never re-rated organisations sort last in both directions
+	got, _ := OrganisationSort{Field: SortLastRatingChange, Desc: true}.orderBy(OrganisationFilter{}, false)
+	if !strings.HasSuffix(got, ", '-infinity') DESC, o.id DESC") { t.Errorf("last_rating_change desc: got %q", got) }
+	got, _ = OrganisationSort{Field: SortLastRatingChange}.orderBy(OrganisationFilter{}, false)
+	if !strings.HasSuffix(got, ", 'infinity') ASC, o.id ASC") { t.Errorf("last_rating_change asc: got %q", got) }
+
+	// Paging backward reverses the order
+	got, _ = OrganisationSort{Desc: true}.orderBy(OrganisationFilter{}, true)
+	if got != " ORDER BY o.name ASC, o.id ASC" { t.Errorf("backward: got %q", got) }
+}
+
+func TestGetAllActiveOrganisations_SortByLicenceCountWithTiebreak(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+
+	one, _ := InsertOrganisation(ctx, pool, Organisation{Name: "One Ltd", TownCity: "London", County: ""}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: one, LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"}, false)
+	two, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Two Ltd", TownCity: "London", County: ""}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: two, LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: two, LicenceType: "Worker", Rating: "A rating", Route: "Scale-up"}, false)
+	also, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Also One Ltd", TownCity: "London", County: ""}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: also, LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"}, false)
+
+	orgs, err := GetAllActiveOrganisations(ctx, pool, 1, 0, OrganisationFilter{}, OrganisationSort{Field: SortLicenceCount, Desc: true})
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if len(orgs) != 3 { t.Fatalf("got %d orgs, want 3", len(orgs)) }
+	// Ties on licence count are broken by ID in the same direction
+	if orgs[0].ID != two || orgs[1].ID != also || orgs[2].ID != one {
+		t.Errorf("got order %d,%d,%d, want %d,%d,%d", orgs[0].ID, orgs[1].ID, orgs[2].ID, two, also, one)
+	}
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// StatCount is the number of active organisations and licences with a given value.
+type StatCount struct {
+	Value         string `json:"value"`
+	Organisations int    `json:"organisations"`
+	Licences      int    `json:"licences"`
+}
+
+// DailyStats is the state of the register at the end of one day (UTC), with
+// the changes made during that day, read from the daily snapshots. A
+// re-rating counts as one licence removed and one added; LicencesRerated
+// counts the re-ratings, and Downgrades and Upgrades are the A to B and B to
+// A re-ratings among them.
+type DailyStats struct {
+	Date                 string      `json:"date"`
+	Organisations        int         `json:"organisations"`
+	OrganisationsAdded   int         `json:"organisations_added"`
+	OrganisationsRemoved int         `json:"organisations_removed"`
+	Licences             int         `json:"licences"`
+	LicencesAdded        int         `json:"licences_added"`
+	LicencesRemoved      int         `json:"licences_removed"`
+	LicencesRerated      int         `json:"licences_rerated"`
+	Downgrades           int         `json:"downgrades"`
+	Upgrades             int         `json:"upgrades"`
+	BRatedSponsors       int         `json:"b_rated_sponsors"`
+	SyncRuns             int         `json:"sync_runs"`
+	Breakdown            []StatCount `json:"breakdown,omitempty"`
+}
+
+// StatsQuery selects the daily series returned with the current totals.
+// Breakdown, if set, is a snapshot dimension (see Dimensions) to break each
+// day down by.
+type StatsQuery struct {
+	From      time.Time
+	To        time.Time
+	Breakdown string
+}
+
+// Stats holds current register totals and a daily series over a date range.
+type Stats struct {
+	Organisations  int          `json:"organisations"`
+	Licences       int          `json:"licences"`
+	BRatedSponsors int          `json:"b_rated_sponsors"`
+	ByRoute        []StatCount  `json:"by_route"`
+	ByLicenceType  []StatCount  `json:"by_licence_type"`
+	ByRating       []StatCount  `json:"by_rating"`
+	ByCounty       []StatCount  `json:"by_county"`
+	From           string       `json:"from"`
+	To             string       `json:"to"`
+	Series         []DailyStats `json:"series"`
+}
+
+// GetStats computes current totals and reads the daily series from sq.From to
+// sq.To inclusive (dates, UTC) from the daily snapshots.
+func GetStats(ctx context.Context, q Querier, sq StatsQuery) (*Stats, error) {
+	stats := Stats{From: sq.From.Format(time.DateOnly), To: sq.To.Format(time.DateOnly)}
+
+	err := q.QueryRow(ctx,
+		`SELECT (SELECT COUNT(*) FROM organisations WHERE deleted_at IS NULL),
+		        (SELECT COUNT(*) FROM licences l JOIN organisations o ON o.id = l.organisation_id
+		         WHERE l.valid_to IS NULL AND o.deleted_at IS NULL),
+		        (SELECT COUNT(DISTINCT l.organisation_id) FROM licences l JOIN organisations o ON o.id = l.organisation_id
+		         WHERE l.valid_to IS NULL AND o.deleted_at IS NULL AND l.rating = $1)`,
+		RatingB,
+	).Scan(&stats.Organisations, &stats.Licences, &stats.BRatedSponsors)
+	if err != nil {
+		return nil, fmt.Errorf("get stats: %w", err)
+	}
+
+	if stats.ByRoute, err = queryStatCounts(ctx, q, "l.route"); err != nil {
+		return nil, err
+	}
+	if stats.ByLicenceType, err = queryStatCounts(ctx, q, "l.licence_type"); err != nil {
+		return nil, err
+	}
+	if stats.ByRating, err = queryStatCounts(ctx, q, "l.rating"); err != nil {
+		return nil, err
+	}
+	if stats.ByCounty, err = queryStatCounts(ctx, q, "COALESCE(o.county, '')"); err != nil {
+		return nil, err
+	}
+
+	if stats.Series, err = getDailyStats(ctx, q, sq.From, sq.To, sq.Breakdown); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// queryStatCounts counts active organisations and licences grouped by an
+// expression over licences l joined to organisations o, largest first.
+func queryStatCounts(ctx context.Context, q Querier, expr string) ([]StatCount, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+expr+`, COUNT(DISTINCT o.id), COUNT(*)
+		 FROM licences l
+		 JOIN organisations o ON o.id = l.organisation_id
+		 WHERE l.valid_to IS NULL AND o.deleted_at IS NULL
+		 GROUP BY 1
+		 ORDER BY 3 DESC, 1`)
+	if err != nil {
+		return nil, fmt.Errorf("get stats: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []StatCount{}
+	for rows.Next() {
+		var sc StatCount
+		if err := rows.Scan(&sc.Value, &sc.Organisations, &sc.Licences); err != nil {
+			return nil, fmt.Errorf("get stats: scan row: %w", err)
+		}
+		counts = append(counts, sc)
+	}
+	return counts, rows.Err()
+}
+
+// getDailyStats returns one DailyStats per day from from to to inclusive,
+// with the sync runs started on each day. The register only changes when a
+// sync runs, so a day without a snapshot has the totals of the latest
+// snapshot before it and no changes; days before the first snapshot are
+// omitted. If breakdown is a snapshot dimension, each day includes its counts
+// by that dimension, likewise carried forward.
+func getDailyStats(ctx context.Context, q Querier, from, to time.Time, breakdown string) ([]DailyStats, error) {
+	args := pgx.NamedArgs{
+		"from":      from.Format(time.DateOnly),
+		"to":        to.Format(time.DateOnly),
+		"dimension": breakdown,
+	}
+	rows, err := q.Query(ctx,
+		`SELECT g.day, s.snapshot_date, s.organisations,
+		        COALESCE(c.organisations_added, 0), COALESCE(c.organisations_removed, 0),
+		        s.licences, COALESCE(c.licences_added, 0), COALESCE(c.licences_removed, 0),
+		        COALESCE(c.licences_rerated, 0), COALESCE(c.downgrades, 0), COALESCE(c.upgrades, 0),
+		        s.b_rated_sponsors,
+		        (SELECT COUNT(*) FROM sync_runs r
+		         WHERE (r.start_time AT TIME ZONE 'UTC')::date = g.day)
+		 FROM (SELECT generate_series(@from::date, @to::date, INTERVAL '1 day')::date AS day) g
+		 CROSS JOIN LATERAL (
+			SELECT snapshot_date, organisations, licences, b_rated_sponsors
+			FROM daily_snapshots
+			WHERE snapshot_date <= g.day
+			ORDER BY snapshot_date DESC
+			LIMIT 1
+		 ) s
+		 LEFT JOIN daily_snapshots c ON c.snapshot_date = g.day
+		 ORDER BY g.day`, args)
+	if err != nil {
+		return nil, fmt.Errorf("get daily stats: %w", err)
+	}
+	defer rows.Close()
+
+	series := []DailyStats{}
+	var sources []time.Time // the snapshot each day's totals come from
+	for rows.Next() {
+		var ds DailyStats
+		var day, source time.Time
+		err := rows.Scan(&day, &source, &ds.Organisations, &ds.OrganisationsAdded, &ds.OrganisationsRemoved,
+			&ds.Licences, &ds.LicencesAdded, &ds.LicencesRemoved, &ds.LicencesRerated,
+			&ds.Downgrades, &ds.Upgrades, &ds.BRatedSponsors, &ds.SyncRuns)
+		if err != nil {
+			return nil, fmt.Errorf("get daily stats: scan row: %w", err)
+		}
+		ds.Date = day.Format(time.DateOnly)
+		series = append(series, ds)
+		sources = append(sources, source)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get daily stats: %w", err)
+	}
+	if breakdown == "" {
+		return series, nil
+	}
+
+	args["sources"] = sources
+	rows, err = q.Query(ctx,
+		`SELECT snapshot_date, value, organisations, licences
+		 FROM daily_snapshot_counts
+		 WHERE snapshot_date = ANY(@sources::date[]) AND dimension = @dimension
+		 ORDER BY snapshot_date, licences DESC, value`, args)
+	if err != nil {
+		return nil, fmt.Errorf("get daily stats: breakdown: %w", err)
+	}
+	defer rows.Close()
+
+	byDate := map[string][]StatCount{}
+	for rows.Next() {
+		var day time.Time
+		var sc StatCount
+		if err := rows.Scan(&day, &sc.Value, &sc.Organisations, &sc.Licences); err != nil {
+			return nil, fmt.Errorf("get daily stats: breakdown: scan row: %w", err)
+		}
+		date := day.Format(time.DateOnly)
+		byDate[date] = append(byDate[date], sc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get daily stats: breakdown: %w", err)
+	}
+	for i := range series {
+		series[i].Breakdown = byDate[sources[i].Format(time.DateOnly)]
+		if series[i].Breakdown == nil {
+			series[i].Breakdown = []StatCount{}
+		}
+	}
+	return series, nil
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetStats(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+	pool.Exec(ctx, `DELETE FROM sync_runs`)
+	pool.Exec(ctx, `DELETE FROM daily_snapshots`)
+
+	// Acme predates tracking; Beta joined on 2 March and left on 4 March,
+	// when Acme's Skilled Worker licence was re-rated to B
+	acme, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Dover", County: "Kent"}, true)
+	old, _ := InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, true)
+	InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Temporary Worker", Rating: RatingA, Route: "Creative Worker"}, true)
+	rerated, _ := InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: RatingB, Route: "Skilled Worker"}, false)
+	pool.Exec(ctx, `UPDATE licences SET valid_to = '2026-03-04 06:00Z' WHERE id = $1`, old)
+	pool.Exec(ctx, `UPDATE licences SET valid_from = '2026-03-04 06:00Z' WHERE id = $1`, rerated)
+
+	beta, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Leeds"}, false)
+	pool.Exec(ctx, `UPDATE organisations SET created_at = '2026-03-02 06:00Z', deleted_at = '2026-03-04 06:00Z' WHERE id = $1`, beta)
+	run := time.Date(2026, 3, 4, 6, 0, 0, 0, time.UTC)
+	InsertSyncRun(ctx, pool, SyncRun{StartTime: run, EndTime: run.Add(5 * time.Minute)})
+
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+	// 28 February precedes the first snapshot and is left out of the series;
+	// days 3 and 6 have no snapshot and carry the previous day's totals
+	for _, d := range []int{1, 2, 4, 5} {
+		if err := RefreshDailySnapshot(ctx, pool, day(d)); err != nil { t.Fatalf("refresh snapshot: %v", err) }
+	}
+	stats, err := GetStats(ctx, pool, StatsQuery{From: day(0), To: day(6), Breakdown: DimensionRating})
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+
+	if stats.Organisations != 1 || stats.Licences != 2 || stats.BRatedSponsors != 1 {
+		t.Errorf("totals = %d orgs, %d licences, %d B-rated; want 1, 2, 1", stats.Organisations, stats.Licences, stats.BRatedSponsors)
+	}
+	if len(stats.ByRating) != 2 || stats.ByRating[0] != (StatCount{RatingA, 1, 1}) {
+		t.Errorf("by rating = %+v", stats.ByRating)
+	}
+	if len(stats.ByCounty) != 1 || stats.ByCounty[0] != (StatCount{"Kent", 1, 2}) {
+		t.Errorf("by county = %+v", stats.ByCounty)
+	}
+
+	aOnly := []StatCount{{RatingA, 1, 2}}
+	aAndB := []StatCount{{RatingA, 1, 1}, {RatingB, 1, 1}}
+	want := []DailyStats{
+		{Date: "2026-03-01", Organisations: 1, Licences: 2, Breakdown: aOnly},
+		{Date: "2026-03-02", Organisations: 2, OrganisationsAdded: 1, Licences: 2, Breakdown: aOnly},
+		{Date: "2026-03-03", Organisations: 2, Licences: 2, Breakdown: aOnly},
+		{Date: "2026-03-04", Organisations: 1, OrganisationsRemoved: 1, Licences: 2, LicencesAdded: 1, LicencesRemoved: 1, LicencesRerated: 1, Downgrades: 1, BRatedSponsors: 1, SyncRuns: 1, Breakdown: aAndB},
+		{Date: "2026-03-05", Organisations: 1, Licences: 2, BRatedSponsors: 1, Breakdown: aAndB},
+		{Date: "2026-03-06", Organisations: 1, Licences: 2, BRatedSponsors: 1, Breakdown: aAndB},
+	}
+	if len(stats.Series) != len(want) { t.Fatalf("got %d days, want %d", len(stats.Series), len(want)) }
+	for i := range want {
+		if !reflect.DeepEqual(stats.Series[i], want[i]) { t.Errorf("day %d = %+v, want %+v", i, stats.Series[i], want[i]) }
+	}
+
+	// Refreshing a day replaces its snapshot rather than adding to it
+	if err := RefreshDailySnapshot(ctx, pool, day(4)); err != nil { t.Fatalf("refresh snapshot: %v", err) }
+	stats, _ = GetStats(ctx, pool, StatsQuery{From: day(4), To: day(4), Breakdown: DimensionRating})
+	if len(stats.Series) != 1 || !reflect.DeepEqual(stats.Series[0], want[3]) { t.Errorf("after refresh = %+v", stats.Series) }
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+	pool.Exec(ctx, `DELETE FROM sync_runs`)
+	pool.Exec(ctx, `DELETE FROM daily_snapshots`)
+}
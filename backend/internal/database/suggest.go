@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// OrganisationSuggestion is an active organisation whose name matches a typeahead prefix.
+type OrganisationSuggestion struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	TownCity string `json:"town_city"`
+}
+
+// Suggestions holds typeahead matches for a prefix. Towns are counted by
+// number of active organisations, most first.
+type Suggestions struct {
+	Organisations []OrganisationSuggestion `json:"organisations"`
+	Towns         []FacetCount             `json:"towns"`
+}
+
+// suggestOrganisationsQuery selects organisations by name prefix in the
+// order of idx_organisations_name_prefix, so the scan stops at the limit.
+// The index uses text_pattern_ops, whose order is the ~<~ operator's
+// (byte order) rather than the collation's.
+const suggestOrganisationsQuery = `SELECT id, name, COALESCE(town_city, '')
+	FROM organisations
+	WHERE deleted_at IS NULL AND lower(name) LIKE @pattern
+	ORDER BY lower(name) USING ~<~, id
+	LIMIT @limit`
+
+// GetSuggestions returns up to limit active organisations and up to limit
+// towns whose name starts with prefix, ignoring case.
+func GetSuggestions(ctx context.Context, q Querier, prefix string, limit int) (*Suggestions, error) {
+	args := pgx.NamedArgs{
+		"pattern": escapeLike(strings.ToLower(prefix)) + "%",
+		"limit":   limit,
+	}
+
+	rows, err := q.Query(ctx, suggestOrganisationsQuery, args)
+	if err != nil {
+		return nil, fmt.Errorf("get suggestions: %w", err)
+	}
+	defer rows.Close()
+
+	orgs := []OrganisationSuggestion{}
+	for rows.Next() {
+		var s OrganisationSuggestion
+		if err := rows.Scan(&s.ID, &s.Name, &s.TownCity); err != nil {
+			return nil, fmt.Errorf("get suggestions: scan row: %w", err)
+		}
+		orgs = append(orgs, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get suggestions: %w", err)
+	}
+
+	rows, err = q.Query(ctx,
+		`SELECT town_city, COUNT(*)
+		 FROM organisations
+		 WHERE deleted_at IS NULL AND lower(town_city) LIKE @pattern
+		 GROUP BY town_city
+		 ORDER BY 2 DESC, 1
+		 LIMIT @limit`, args)
+	if err != nil {
+		return nil, fmt.Errorf("get suggestions: %w", err)
+	}
+	defer rows.Close()
+
+	towns := []FacetCount{}
+	for rows.Next() {
+		var fc FacetCount
+		if err := rows.Scan(&fc.Value, &fc.Count); err != nil {
+			return nil, fmt.Errorf("get suggestions: scan row: %w", err)
+		}
+		towns = append(towns, fc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get suggestions: %w", err)
+	}
+	return &Suggestions{Organisations: orgs, Towns: towns}, nil
+}
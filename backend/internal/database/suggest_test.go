@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestGetSuggestions(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+
+	bath, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Bath Bakery Ltd", TownCity: "Bath"}, false)
+	InsertOrganisation(ctx, pool, Organisation{Name: "Barton Ltd", TownCity: "Barnsley"}, false)
+	InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Bath"}, false)
+	gone, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Ba% Gone Ltd", TownCity: "Leeds"}, false)
+	CloseOrganisation(ctx, pool, gone)
+
+	s, err := GetSuggestions(ctx, pool, "ba", 10)
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if len(s.Organisations) != 2 || s.Organisations[0].Name != "Barton Ltd" || s.Organisations[1].ID != bath {
+		t.Errorf("organisations = %+v, want Barton Ltd then Bath Bakery Ltd", s.Organisations)
+	}
+	if len(s.Towns) != 2 || s.Towns[0] != (FacetCount{"Bath", 2}) || s.Towns[1] != (FacetCount{"Barnsley", 1}) {
+		t.Errorf("towns = %+v, want Bath=2, Barnsley=1", s.Towns)
+	}
+
+	// LIKE wildcards in the prefix are matched literally
+	s, err = GetSuggestions(ctx, pool, "b_", 10)
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if len(s.Organisations) != 0 { t.Errorf("wildcard prefix matched %+v", s.Organisations) }
+
+	s, err = GetSuggestions(ctx, pool, "BA", 1)
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if len(s.Organisations) != 1 || len(s.Towns) != 1 { t.Errorf("limit 1: got %+v", s) }
+
+	pool.Exec(ctx, `DELETE FROM licences`)
+	pool.Exec(ctx, `DELETE FROM organisations`)
+}
+
+func TestGetSuggestions_UsesPrefixIndexOrder(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	tx, err := pool.Begin(ctx)
+	if err != nil { t.Fatalf("begin: %v", err) }
+	defer tx.Rollback(ctx)
+	// The test table is too small for the planner to prefer an index unaided
+	tx.Exec(ctx, `SET LOCAL enable_seqscan = off`)
+
+	rows, err := tx.Query(ctx, `EXPLAIN `+suggestOrganisationsQuery, pgx.NamedArgs{"pattern": "ba%", "limit": 10})
+	if err != nil { t.Fatalf("explain: %v", err) }
+	var plan []string
+	for rows.Next() {
+		var line string
+		rows.Scan(&line)
+		plan = append(plan, line)
+	}
+	rows.Close()
+	text := strings.Join(plan, "\n")
+	if !strings.Contains(text, "idx_organisations_name_prefix") || strings.Contains(text, "Sort") { t.Errorf("plan does not read matches in index order:\n%s", text) }
+}
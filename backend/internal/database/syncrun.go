@@ -2,36 +2,207 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Sync stages at which a SyncRunError can occur.
+const (
+	StageOrganisation = "organisation" // finding or inserting a record's organisation
+	StageLicence      = "licence"      // finding, inserting or re-rating a record's licence
+	StageCloseStale   = "close_stale"  // closing organisations/licences no longer in the CSV
+	StageSnapshot     = "snapshot"     // refreshing the day's aggregate snapshot
+	StageUnknown      = "unknown"      // recorded before stages were tracked
+)
+
 // SyncRun records the result of a single sync operation.
 type SyncRun struct {
-	ID                  int
-	StartTime           time.Time
-	EndTime             time.Time
-	NewOrganisations    int
-	NewLicences         int
-	ChangedLicences     int
-	ClosedOrganisations int
-	ClosedLicences      int
-	ErrorCount          int
-}
-
-// InsertSyncRun records a completed sync run and returns its ID.
+	ID                  int            `json:"id"`
+	StartTime           time.Time      `json:"start_time"`
+	EndTime             time.Time      `json:"end_time"`
+	CSVURL              string         `json:"csv_url"`
+	NewOrganisations    int            `json:"new_organisations"`
+	NewLicences         int            `json:"new_licences"`
+	ChangedLicences     int            `json:"changed_licences"`
+	ClosedOrganisations int            `json:"closed_organisations"`
+	ClosedLicences      int            `json:"closed_licences"`
+	ErrorCount          int            `json:"error_count"`
+	Errors              []SyncRunError `json:"errors"`
+}
+
+// SyncRunError is a single error encountered during a sync run, with the
+// context of the CSV record or database row it concerned.
+type SyncRunError struct {
+	Stage            string `json:"stage"`
+	OrganisationName string `json:"organisation_name,omitempty"`
+	LicenceType      string `json:"licence_type,omitempty"`
+	Route            string `json:"route,omitempty"`
+	Message          string `json:"message"`
+}
+
+// InsertSyncRun records a completed sync run and its errors, and returns its ID.
 func InsertSyncRun(ctx context.Context, pool *pgxpool.Pool, run SyncRun) (int, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("insert sync run: begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	var id int
-	err := pool.QueryRow(ctx,
-		`INSERT INTO sync_runs (start_time, end_time, new_organisations, new_licences, changed_licences, closed_organisations, closed_licences, error_count)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	err = tx.QueryRow(ctx,
+		`INSERT INTO sync_runs (start_time, end_time, csv_url, new_organisations, new_licences, changed_licences, closed_organisations, closed_licences, error_count)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		 RETURNING id`,
-		run.StartTime, run.EndTime, run.NewOrganisations, run.NewLicences, run.ChangedLicences, run.ClosedOrganisations, run.ClosedLicences, run.ErrorCount,
+		run.StartTime, run.EndTime, run.CSVURL, run.NewOrganisations, run.NewLicences, run.ChangedLicences, run.ClosedOrganisations, run.ClosedLicences, run.ErrorCount,
 	).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("insert sync run: %w", err)
 	}
+
+	for _, e := range run.Errors {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO sync_run_errors (sync_run_id, stage, organisation_name, licence_type, route, message)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			id, e.Stage, e.OrganisationName, e.LicenceType, e.Route, e.Message,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("insert sync run error: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("insert sync run: commit: %w", err)
+	}
 	return id, nil
 }
+
+const syncRunColumns = `id, start_time, end_time, csv_url, new_organisations, new_licences, changed_licences, closed_organisations, closed_licences, error_count`
+
+func scanSyncRun(row pgx.Row) (SyncRun, error) {
+	run := SyncRun{Errors: []SyncRunError{}}
+	err := row.Scan(&run.ID, &run.StartTime, &run.EndTime, &run.CSVURL, &run.NewOrganisations, &run.NewLicences,
+		&run.ChangedLicences, &run.ClosedOrganisations, &run.ClosedLicences, &run.ErrorCount)
+	return run, err
+}
+
+// CountSyncRuns returns the total number of recorded sync runs.
+func CountSyncRuns(ctx context.Context, q Querier) (int, error) {
+	var count int
+	err := q.QueryRow(ctx, `SELECT COUNT(*) FROM sync_runs`).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count sync runs: %w", err)
+	}
+	return count, nil
+}
+
+// GetSyncRuns retrieves sync runs with their errors, newest first.
+// from and to are 1-based order numbers.
+func GetSyncRuns(ctx context.Context, q Querier, from, to int) ([]SyncRun, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+syncRunColumns+`
+		 FROM sync_runs
+		 ORDER BY start_time DESC, id DESC
+		 OFFSET $1 LIMIT $2`,
+		from-1, to-from+1,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get sync runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []SyncRun{}
+	for rows.Next() {
+		run, err := scanSyncRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get sync runs: scan row: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get sync runs: %w", err)
+	}
+
+	if len(runs) == 0 {
+		return runs, nil
+	}
+	ids := make([]int, len(runs))
+	for i, run := range runs {
+		ids[i] = run.ID
+	}
+	errs, err := getSyncRunErrors(ctx, q, ids)
+	if err != nil {
+		return nil, fmt.Errorf("get sync runs: %w", err)
+	}
+	for i := range runs {
+		if e, ok := errs[runs[i].ID]; ok {
+			runs[i].Errors = e
+		}
+	}
+	return runs, nil
+}
+
+// FindSyncRunByID looks up a sync run and its errors by ID.
+// Returns the run and true if found, or empty and false if not found.
+func FindSyncRunByID(ctx context.Context, q Querier, id int) (SyncRun, bool, error) {
+	run, err := scanSyncRun(q.QueryRow(ctx,
+		`SELECT `+syncRunColumns+` FROM sync_runs WHERE id = $1`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return SyncRun{}, false, nil
+	}
+	if err != nil {
+		return SyncRun{}, false, fmt.Errorf("find sync run by id: %w", err)
+	}
+
+	errs, err := getSyncRunErrors(ctx, q, []int{id})
+	if err != nil {
+		return SyncRun{}, false, fmt.Errorf("find sync run by id: %w", err)
+	}
+	if e, ok := errs[id]; ok {
+		run.Errors = e
+	}
+	return run, true, nil
+}
+
+// getSyncRunErrors retrieves the errors for the given sync runs, keyed by run ID.
+func getSyncRunErrors(ctx context.Context, q Querier, runIDs []int) (map[int][]SyncRunError, error) {
+	rows, err := q.Query(ctx,
+		`SELECT sync_run_id, stage, organisation_name, licence_type, route, message
+		 FROM sync_run_errors
+		 WHERE sync_run_id = ANY($1)
+		 ORDER BY id`,
+		runIDs,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get sync run errors: %w", err)
+	}
+	defer rows.Close()
+
+	errs := make(map[int][]SyncRunError)
+	for rows.Next() {
+		var runID int
+		var e SyncRunError
+		if err := rows.Scan(&runID, &e.Stage, &e.OrganisationName, &e.LicenceType, &e.Route, &e.Message); err != nil {
+			return nil, fmt.Errorf("get sync run errors: scan row: %w", err)
+		}
+		errs[runID] = append(errs[runID], e)
+	}
+	return errs, rows.Err()
+}
+
+// GetLastSyncTime returns the end time of the most recent successful sync run:
+// one that completed, as every recorded run did, without a record error.
+// Returns nil if there has been none.
+func GetLastSyncTime(ctx context.Context, q Querier) (*time.Time, error) {
+	var t *time.Time
+	err := q.QueryRow(ctx, `SELECT MAX(end_time) FROM sync_runs WHERE error_count = 0`).Scan(&t)
+	if err != nil {
+		return nil, fmt.Errorf("get last sync time: %w", err)
+	}
+	return t, nil
+}
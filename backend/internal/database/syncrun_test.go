@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInsertAndGetSyncRuns(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	pool.Exec(ctx, `DELETE FROM sync_runs`)
+
+	start := time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)
+	olderID, err := InsertSyncRun(ctx, pool, SyncRun{StartTime: start, EndTime: start.Add(time.Minute), CSVURL: "https://example.test/1.csv"})
+	if err != nil { t.Fatalf("InsertSyncRun failed: %v", err) }
+	newerID, err := InsertSyncRun(ctx, pool, SyncRun{
+		StartTime: start.Add(24 * time.Hour), EndTime: start.Add(24*time.Hour + time.Minute),
+		CSVURL: "https://example.test/2.csv", ErrorCount: 1,
+		Errors: []SyncRunError{{Stage: StageLicence, OrganisationName: "X", LicenceType: "Worker", Route: "Skilled Worker", Message: "insert licence: boom"}},
+	})
+	if err != nil { t.Fatalf("InsertSyncRun failed: %v", err) }
+
+	runs, err := GetSyncRuns(ctx, pool, 1, 10)
+	if err != nil { t.Fatalf("GetSyncRuns failed: %v", err) }
+	if len(runs) != 2 { t.Fatalf("got %d runs, want 2", len(runs)) }
+	if runs[0].ID != newerID || runs[1].ID != olderID { t.Error("runs not sorted newest first") }
+
+	run, found, err := FindSyncRunByID(ctx, pool, newerID)
+	if err != nil { t.Fatalf("FindSyncRunByID failed: %v", err) }
+	if !found { t.Fatal("sync run not found") }
+	if run.CSVURL != "https://example.test/2.csv" { t.Errorf("CSVURL = %q", run.CSVURL) }
+	if len(run.Errors) != 1 { t.Fatalf("got %d errors, want 1", len(run.Errors)) }
+	if run.Errors[0].Stage != StageLicence || run.Errors[0].OrganisationName != "X" { t.Errorf("error = %+v", run.Errors[0]) }
+	if len(runs[1].Errors) != 0 { t.Errorf("older run: got %d errors, want 0", len(runs[1].Errors)) }
+
+	_, found, err = FindSyncRunByID(ctx, pool, newerID+1000)
+	if err != nil { t.Fatalf("FindSyncRunByID failed: %v", err) }
+	if found { t.Error("expected found=false for unknown ID") }
+
+	last, err := GetLastSyncTime(ctx, pool)
+	if err != nil { t.Fatalf("GetLastSyncTime failed: %v", err) }
+	// The newer run had an error, so the older one was the last successful sync
+	if last == nil || !last.Equal(start.Add(time.Minute)) { t.Errorf("last sync = %v", last) }
+
+	pool.Exec(ctx, `DELETE FROM sync_runs`)
+}
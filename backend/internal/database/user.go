@@ -9,16 +9,30 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
-// User represents an application user.
+// ErrUsernameTaken is returned when another user already has the username.
+var ErrUsernameTaken = errors.New("a user with this username already exists")
+
+// User represents an application user. DisabledAt is set while the user is
+// disabled and cannot log in.
 type User struct {
-	ID           int
-	Username     string
-	PasswordHash string
-	Role         int
-	CreatedAt    time.Time
+	ID           int        `json:"id"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"`
+	Role         int        `json:"role"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DisabledAt   *time.Time `json:"disabled_at"`
+}
+
+const userColumns = `id, username, password_hash, role, created_at, disabled_at`
+
+func scanUser(row pgx.Row) (User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt, &u.DisabledAt)
+	return u, err
 }
 
 // InsertUser inserts a new user and returns their ID.
+// It returns ErrUsernameTaken if the username is in use.
 func InsertUser(ctx context.Context, q Querier, u User) (int, error) {
 	var id int
 	err := q.QueryRow(ctx,
@@ -27,22 +41,43 @@ func InsertUser(ctx context.Context, q Querier, u User) (int, error) {
 		 RETURNING id`,
 		u.Username, u.PasswordHash, u.Role,
 	).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrUsernameTaken
+	}
 	if err != nil {
 		return 0, fmt.Errorf("insert user: %w", err)
 	}
 	return id, nil
 }
 
-// FindUserByID looks up a user by their ID.
+// GetUsers returns every user, disabled or not, ordered by username.
+func GetUsers(ctx context.Context, q Querier) ([]User, error) {
+	rows, err := q.Query(ctx, `SELECT `+userColumns+` FROM users ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("get users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get users: scan row: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// FindUserByID looks up a user by their ID, disabled or not.
 // Returns the user and true if found, or empty and false if not found.
 func FindUserByID(ctx context.Context, q Querier, id int) (User, bool, error) {
-	var u User
-	err := q.QueryRow(ctx,
-		`SELECT id, username, password_hash, role, created_at
+	u, err := scanUser(q.QueryRow(ctx,
+		`SELECT `+userColumns+`
 		 FROM users
 		 WHERE id = $1`,
 		id,
-	).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt)
+	))
 	if errors.Is(err, pgx.ErrNoRows) {
 		return User{}, false, nil
 	}
@@ -55,13 +90,12 @@ func FindUserByID(ctx context.Context, q Querier, id int) (User, bool, error) {
 // FindUserByUsername looks up an active user by username.
 // Returns the user and true if found, or empty and false if not found.
 func FindUserByUsername(ctx context.Context, q Querier, username string) (User, bool, error) {
-	var u User
-	err := q.QueryRow(ctx,
-		`SELECT id, username, password_hash, role, created_at
+	u, err := scanUser(q.QueryRow(ctx,
+		`SELECT `+userColumns+`
 		 FROM users
-		 WHERE username = $1`,
+		 WHERE username = $1 AND disabled_at IS NULL`,
 		username,
-	).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt)
+	))
 	if errors.Is(err, pgx.ErrNoRows) {
 		return User{}, false, nil
 	}
@@ -70,3 +104,42 @@ func FindUserByUsername(ctx context.Context, q Querier, username string) (User,
 	}
 	return u, true, nil
 }
+
+// UpdateUserPassword sets a user's password hash, returning false if they do
+// not exist.
+func UpdateUserPassword(ctx context.Context, q Querier, id int, passwordHash string) (bool, error) {
+	tag, err := q.Exec(ctx, `UPDATE users SET password_hash = $2 WHERE id = $1`, id, passwordHash)
+	if err != nil {
+		return false, fmt.Errorf("update user password: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// UpdateUser sets a user's role and disables or re-enables them in one
+// statement, leaving nil fields unchanged, and returns false if they do not
+// exist. Disabling an already disabled user keeps the original time.
+// Disabling does not end the user's sessions; see DeleteUserSessions.
+func UpdateUser(ctx context.Context, q Querier, id int, role *int, disabled *bool) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`UPDATE users SET
+			role = COALESCE($2, role),
+			disabled_at = CASE WHEN $3::boolean IS NULL THEN disabled_at WHEN $3 THEN COALESCE(disabled_at, NOW()) END
+		 WHERE id = $1`,
+		id, role, disabled,
+	)
+	if err != nil {
+		return false, fmt.Errorf("update user: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteUser deletes a user with their sessions, watchlists, saved searches
+// and settings, returning false if they do not exist. Their notes and tags
+// are kept without an author.
+func DeleteUser(ctx context.Context, q Querier, id int) (bool, error) {
+	tag, err := q.Exec(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete user: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
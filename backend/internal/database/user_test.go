@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestUserManagement(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	cleanup := func() {
+		pool.Exec(ctx, `DELETE FROM users WHERE username LIKE 'user-test-%'`)
+	}
+	cleanup()
+	defer cleanup()
+
+	id, err := InsertUser(ctx, pool, User{Username: "user-test-alice", PasswordHash: "x", Role: 50})
+	if err != nil { t.Fatalf("insert: %v", err) }
+	if _, err := InsertUser(ctx, pool, User{Username: "user-test-alice", PasswordHash: "y", Role: 50}); err != ErrUsernameTaken { t.Errorf("duplicate: err = %v", err) }
+	CreateSession(ctx, pool, id, time.Hour)
+
+	admin, yes, no := 10, true, false
+	if found, err := UpdateUser(ctx, pool, id, &admin, nil); err != nil || !found { t.Errorf("update role = %v, %v", found, err) }
+	if found, err := UpdateUserPassword(ctx, pool, id, "z"); err != nil || !found { t.Errorf("update password = %v, %v", found, err) }
+	if found, err := UpdateUser(ctx, pool, id, nil, &yes); err != nil || !found { t.Errorf("disable = %v, %v", found, err) }
+
+	u, _, _ := FindUserByID(ctx, pool, id)
+	if u.Role != 10 || u.PasswordHash != "z" || u.DisabledAt == nil { t.Errorf("updated %+v", u) }
+	if _, found, _ := FindUserByUsername(ctx, pool, "user-test-alice"); found { t.Error("disabled user found by username") }
+	users, _ := GetUsers(ctx, pool)
+	if !slices.ContainsFunc(users, func(u User) bool { return u.ID == id }) { t.Error("disabled user not listed") }
+
+	viewer := 50
+	UpdateUser(ctx, pool, id, &viewer, &no)
+	if u, _, _ := FindUserByID(ctx, pool, id); u.Role != 50 || u.DisabledAt != nil { t.Errorf("re-enabled %+v", u) }
+	if _, found, _ := FindUserByUsername(ctx, pool, "user-test-alice"); !found { t.Error("re-enabled user not found by username") }
+
+	if found, err := DeleteUser(ctx, pool, id); err != nil || !found { t.Errorf("delete = %v, %v", found, err) }
+	if found, _ := UpdateUser(ctx, pool, id, &admin, nil); found { t.Error("updated a deleted user") }
+}
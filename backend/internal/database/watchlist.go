@@ -0,0 +1,414 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MaxWatchlistSize is the most organisations a watchlist may hold.
+const MaxWatchlistSize = 1000
+
+// Watchlist errors.
+var (
+	ErrWatchlistNameTaken = errors.New("a watchlist with this name already exists")
+	ErrWatchlistFull      = fmt.Errorf("a watchlist may hold at most %d organisations", MaxWatchlistSize)
+)
+
+// Watched organisation statuses.
+const (
+	WatchActive  = "active"  // the watched organisation is on the register
+	WatchMoved   = "moved"   // it was removed and re-added at a new address
+	WatchRemoved = "removed" // it is no longer on the register
+)
+
+// Watchlist is a named list of organisations followed by a user.
+type Watchlist struct {
+	ID                int        `json:"id"`
+	UserID            int        `json:"-"`
+	Name              string     `json:"name"`
+	CreatedAt         time.Time  `json:"created_at"`
+	LastViewedAt      *time.Time `json:"last_viewed_at"`
+	OrganisationCount int        `json:"organisation_count"`
+}
+
+// WatchedOrganisation is a watched organisation with its current licences and
+// its changes since the watchlist was last viewed. The name, address and
+// licences are those of the current version, found by CurrentID, after a move.
+type WatchedOrganisation struct {
+	OrganisationID int            `json:"organisation_id"`
+	CurrentID      *int           `json:"current_organisation_id"`
+	Status         string         `json:"status"`
+	Name           string         `json:"name"`
+	TownCity       string         `json:"town_city"`
+	County         string         `json:"county"`
+	AddedAt        time.Time      `json:"added_at"`
+	Licences       []RatedLicence `json:"licences"`
+	Changes        []ChangeEvent  `json:"changes"`
+}
+
+// WatchlistView is a watchlist with its organisations. Changes are those
+// after the previous view, or after each organisation was added if the
+// watchlist had not been viewed.
+type WatchlistView struct {
+	Watchlist
+	Organisations []WatchedOrganisation `json:"organisations"`
+}
+
+const watchlistColumns = `w.id, w.user_id, w.name, w.created_at, w.last_viewed_at,
+	(SELECT COUNT(*) FROM watchlist_organisations wo WHERE wo.watchlist_id = w.id)`
+
+func scanWatchlist(row pgx.Row) (Watchlist, error) {
+	var wl Watchlist
+	err := row.Scan(&wl.ID, &wl.UserID, &wl.Name, &wl.CreatedAt, &wl.LastViewedAt, &wl.OrganisationCount)
+	return wl, err
+}
+
+// InsertWatchlist creates an empty watchlist for a user and returns its ID.
+// It returns ErrWatchlistNameTaken if the user already has one with the name.
+func InsertWatchlist(ctx context.Context, q Querier, userID int, name string) (int, error) {
+	var id int
+	err := q.QueryRow(ctx,
+		`INSERT INTO watchlists (user_id, name) VALUES ($1, $2) RETURNING id`,
+		userID, name,
+	).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrWatchlistNameTaken
+	}
+	if err != nil {
+		return 0, fmt.Errorf("insert watchlist: %w", err)
+	}
+	return id, nil
+}
+
+// GetWatchlists returns a user's watchlists ordered by name.
+func GetWatchlists(ctx context.Context, q Querier, userID int) ([]Watchlist, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+watchlistColumns+` FROM watchlists w WHERE w.user_id = $1 ORDER BY w.name`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get watchlists: %w", err)
+	}
+	defer rows.Close()
+
+	watchlists := []Watchlist{}
+	for rows.Next() {
+		wl, err := scanWatchlist(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get watchlists: scan row: %w", err)
+		}
+		watchlists = append(watchlists, wl)
+	}
+	return watchlists, rows.Err()
+}
+
+// FindWatchlist looks up one of a user's watchlists by ID.
+// Returns the watchlist and true if found, or empty and false if not found.
+func FindWatchlist(ctx context.Context, q Querier, userID, id int) (Watchlist, bool, error) {
+	wl, err := scanWatchlist(q.QueryRow(ctx,
+		`SELECT `+watchlistColumns+` FROM watchlists w WHERE w.id = $1 AND w.user_id = $2`,
+		id, userID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Watchlist{}, false, nil
+	}
+	if err != nil {
+		return Watchlist{}, false, fmt.Errorf("find watchlist: %w", err)
+	}
+	return wl, true, nil
+}
+
+// RenameWatchlist renames one of a user's watchlists, returning false if it
+// does not exist and ErrWatchlistNameTaken if the name is in use.
+func RenameWatchlist(ctx context.Context, q Querier, userID, id int, name string) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`UPDATE watchlists SET name = $3 WHERE id = $1 AND user_id = $2`,
+		id, userID, name,
+	)
+	if isUniqueViolation(err) {
+		return false, ErrWatchlistNameTaken
+	}
+	if err != nil {
+		return false, fmt.Errorf("rename watchlist: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteWatchlist deletes one of a user's watchlists, returning false if it
+// does not exist.
+func DeleteWatchlist(ctx context.Context, q Querier, userID, id int) (bool, error) {
+	tag, err := q.Exec(ctx, `DELETE FROM watchlists WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("delete watchlist: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// AddWatchlistOrganisations adds the organisations that exist among orgIDs to
+// a watchlist, ignoring any already on it, and returns how many were added.
+func AddWatchlistOrganisations(ctx context.Context, q Querier, watchlistID int, orgIDs []int) (int, error) {
+	tag, err := q.Exec(ctx,
+		`INSERT INTO watchlist_organisations (watchlist_id, organisation_id)
+		 SELECT $1, o.id FROM organisations o WHERE o.id = ANY($2)
+		 ON CONFLICT DO NOTHING`,
+		watchlistID, orgIDs,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("add watchlist organisations: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// RemoveWatchlistOrganisation removes an organisation from a watchlist,
+// returning false if it was not on it.
+func RemoveWatchlistOrganisation(ctx context.Context, q Querier, watchlistID, orgID int) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`DELETE FROM watchlist_organisations WHERE watchlist_id = $1 AND organisation_id = $2`,
+		watchlistID, orgID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("remove watchlist organisation: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// MarkWatchlistViewed sets a watchlist's last viewed time.
+func MarkWatchlistViewed(ctx context.Context, q Querier, id int, at time.Time) error {
+	if _, err := q.Exec(ctx, `UPDATE watchlists SET last_viewed_at = $2 WHERE id = $1`, id, at); err != nil {
+		return fmt.Errorf("mark watchlist viewed: %w", err)
+	}
+	return nil
+}
+
+// GetWatchedOrganisations returns the organisations on a watchlist ordered by
+// name, each resolved to its current version with its active licences and
+// its changes after since (or after it was added, if since is nil or earlier).
+// A removed organisation's current version is the active organisation added
+// under the same name by the sync that removed it (see successorOf), if any.
+func GetWatchedOrganisations(ctx context.Context, q Querier, watchlistID int, since *time.Time) ([]WatchedOrganisation, error) {
+	rows, err := q.Query(ctx,
+		`SELECT wo.organisation_id, wo.added_at, cur.id,
+		        COALESCE(cur.name, o.name), COALESCE(cur.town_city, o.town_city), COALESCE(cur.county, o.county)
+		 FROM watchlist_organisations wo
+		 JOIN organisations o ON o.id = wo.organisation_id
+		 LEFT JOIN LATERAL (
+			SELECT c.id, c.name, c.town_city, c.county FROM organisations c
+			WHERE c.deleted_at IS NULL AND (c.id = o.id OR (`+successorOf("c", "o")+`))
+			ORDER BY c.id = o.id DESC, c.created_at DESC
+			LIMIT 1
+		 ) cur ON true
+		 WHERE wo.watchlist_id = $1
+		 ORDER BY o.name, wo.organisation_id`,
+		watchlistID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get watched organisations: %w", err)
+	}
+	defer rows.Close()
+
+	watched := []WatchedOrganisation{}
+	var ids []int
+	var earliest time.Time
+	for rows.Next() {
+		w := WatchedOrganisation{Licences: []RatedLicence{}, Changes: []ChangeEvent{}}
+		if err := rows.Scan(&w.OrganisationID, &w.AddedAt, &w.CurrentID, &w.Name, &w.TownCity, &w.County); err != nil {
+			return nil, fmt.Errorf("get watched organisations: scan row: %w", err)
+		}
+		switch {
+		case w.CurrentID == nil:
+			w.Status = WatchRemoved
+		case *w.CurrentID == w.OrganisationID:
+			w.Status = WatchActive
+		default:
+			w.Status = WatchMoved
+			ids = append(ids, *w.CurrentID)
+		}
+		ids = append(ids, w.OrganisationID)
+		from := watchSince(w, since)
+		if earliest.IsZero() || from.Before(earliest) {
+			earliest = from
+		}
+		watched = append(watched, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get watched organisations: %w", err)
+	}
+	if len(watched) == 0 {
+		return watched, nil
+	}
+
+	licences, err := GetActiveLicencesByOrgIDs(ctx, q, ids)
+	if err != nil {
+		return nil, fmt.Errorf("get watched organisations: %w", err)
+	}
+	byOrg := map[int][]RatedLicence{}
+	for _, l := range licences {
+		byOrg[l.OrganisationID] = append(byOrg[l.OrganisationID], RatedLicence{l.LicenceType, l.Route, l.Rating})
+	}
+
+	changes, err := GetOrganisationChanges(ctx, q, ids, earliest)
+	if err != nil {
+		return nil, fmt.Errorf("get watched organisations: %w", err)
+	}
+	for i := range watched {
+		w := &watched[i]
+		if w.CurrentID != nil && byOrg[*w.CurrentID] != nil {
+			w.Licences = byOrg[*w.CurrentID]
+			sortRatedLicences(w.Licences)
+		}
+		from := watchSince(*w, since)
+		for _, ev := range changes {
+			ours := ev.OrganisationID == w.OrganisationID || (w.CurrentID != nil && ev.OrganisationID == *w.CurrentID)
+			if ours && ev.OccurredAt.After(from) {
+				w.Changes = append(w.Changes, ev)
+			}
+		}
+	}
+	return watched, nil
+}
+
+// watchSince returns the instant after which a watched organisation's changes
+// are reported: the previous view, or when it was added if that is later.
+func watchSince(w WatchedOrganisation, since *time.Time) time.Time {
+	if since == nil || since.Before(w.AddedAt) {
+		return w.AddedAt
+	}
+	return *since
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// PostgresWatchlistStore manages users' watchlists in PostgreSQL.
+type PostgresWatchlistStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresWatchlistStore(pool *pgxpool.Pool) *PostgresWatchlistStore {
+	return &PostgresWatchlistStore{pool: pool}
+}
+
+// ListWatchlists returns a user's watchlists.
+func (s *PostgresWatchlistStore) ListWatchlists(ctx context.Context, userID int) ([]Watchlist, error) {
+	return GetWatchlists(ctx, s.pool, userID)
+}
+
+// CreateWatchlist creates a watchlist holding the existing organisations among
+// orgIDs and returns it.
+func (s *PostgresWatchlistStore) CreateWatchlist(ctx context.Context, userID int, name string, orgIDs []int) (Watchlist, error) {
+	if len(orgIDs) > MaxWatchlistSize {
+		return Watchlist{}, ErrWatchlistFull
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return Watchlist{}, fmt.Errorf("create watchlist: begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	id, err := InsertWatchlist(ctx, tx, userID, name)
+	if err != nil {
+		return Watchlist{}, err
+	}
+	if _, err := AddWatchlistOrganisations(ctx, tx, id, orgIDs); err != nil {
+		return Watchlist{}, err
+	}
+	wl, _, err := FindWatchlist(ctx, tx, userID, id)
+	if err != nil {
+		return Watchlist{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Watchlist{}, fmt.Errorf("create watchlist: commit: %w", err)
+	}
+	return wl, nil
+}
+
+// RenameWatchlist renames a user's watchlist; see RenameWatchlist.
+func (s *PostgresWatchlistStore) RenameWatchlist(ctx context.Context, userID, id int, name string) (bool, error) {
+	return RenameWatchlist(ctx, s.pool, userID, id, name)
+}
+
+// DeleteWatchlist deletes a user's watchlist; see DeleteWatchlist.
+func (s *PostgresWatchlistStore) DeleteWatchlist(ctx context.Context, userID, id int) (bool, error) {
+	return DeleteWatchlist(ctx, s.pool, userID, id)
+}
+
+// AddToWatchlist adds organisations to a user's watchlist and returns how
+// many were added. It returns false if the watchlist does not exist and
+// ErrWatchlistFull if it would exceed MaxWatchlistSize.
+func (s *PostgresWatchlistStore) AddToWatchlist(ctx context.Context, userID, id int, orgIDs []int) (int, bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("add to watchlist: begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the watchlist so concurrent additions cannot exceed the limit
+	var locked int
+	err = tx.QueryRow(ctx, `SELECT id FROM watchlists WHERE id = $1 AND user_id = $2 FOR UPDATE`, id, userID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("add to watchlist: %w", err)
+	}
+	added, err := AddWatchlistOrganisations(ctx, tx, id, orgIDs)
+	if err != nil {
+		return 0, false, err
+	}
+	wl, _, err := FindWatchlist(ctx, tx, userID, id)
+	if err != nil {
+		return 0, false, err
+	}
+	if wl.OrganisationCount > MaxWatchlistSize {
+		return 0, true, ErrWatchlistFull
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, false, fmt.Errorf("add to watchlist: commit: %w", err)
+	}
+	return added, true, nil
+}
+
+// RemoveFromWatchlist removes an organisation from a user's watchlist,
+// returning false if the watchlist does not exist or does not hold it.
+func (s *PostgresWatchlistStore) RemoveFromWatchlist(ctx context.Context, userID, id, orgID int) (bool, error) {
+	if _, found, err := FindWatchlist(ctx, s.pool, userID, id); err != nil || !found {
+		return false, err
+	}
+	return RemoveWatchlistOrganisation(ctx, s.pool, id, orgID)
+}
+
+// ViewWatchlist returns a user's watchlist with its organisations and their
+// changes since it was last viewed, and records this view. It returns false
+// if the watchlist does not exist.
+func (s *PostgresWatchlistStore) ViewWatchlist(ctx context.Context, userID, id int) (*WatchlistView, bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("view watchlist: begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	wl, found, err := FindWatchlist(ctx, tx, userID, id)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	watched, err := GetWatchedOrganisations(ctx, tx, id, wl.LastViewedAt)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := MarkWatchlistViewed(ctx, tx, id, time.Now().UTC()); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, fmt.Errorf("view watchlist: commit: %w", err)
+	}
+	return &WatchlistView{Watchlist: wl, Organisations: watched}, true, nil
+}
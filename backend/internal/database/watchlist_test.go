@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWatchlistStore(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	cleanup := func() {
+		pool.Exec(ctx, `DELETE FROM watchlists`)
+		pool.Exec(ctx, `DELETE FROM users WHERE username LIKE 'watchlist-test-%'`)
+		pool.Exec(ctx, `DELETE FROM licences`)
+		pool.Exec(ctx, `DELETE FROM organisations`)
+	}
+	cleanup()
+	defer cleanup()
+
+	alice, _ := InsertUser(ctx, pool, User{Username: "watchlist-test-alice", PasswordHash: "x", Role: 50})
+	bob, _ := InsertUser(ctx, pool, User{Username: "watchlist-test-bob", PasswordHash: "x", Role: 50})
+
+	acme, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Dover", County: "Kent"}, true)
+	InsertLicence(ctx, pool, Licence{OrganisationID: acme, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, true)
+	beta, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Leeds", County: "West Yorkshire"}, true)
+	betaLic, _ := InsertLicence(ctx, pool, Licence{OrganisationID: beta, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, true)
+
+	store := NewPostgresWatchlistStore(pool)
+	wl, err := store.CreateWatchlist(ctx, alice, "Clients", []int{acme, beta, 999999})
+	if err != nil { t.Fatalf("create: %v", err) }
+	if wl.OrganisationCount != 2 { t.Errorf("organisation count = %d, want 2 (unknown IDs ignored)", wl.OrganisationCount) }
+	if _, err := store.CreateWatchlist(ctx, alice, "Clients", nil); !errors.Is(err, ErrWatchlistNameTaken) { t.Errorf("duplicate name err = %v", err) }
+	if _, found, _ := store.ViewWatchlist(ctx, bob, wl.ID); found { t.Error("bob can view alice's watchlist") }
+
+	// First view: no changes since the organisations were added
+	view, found, err := store.ViewWatchlist(ctx, alice, wl.ID)
+	if err != nil || !found { t.Fatalf("view: found=%v err=%v", found, err) }
+	if view.LastViewedAt != nil { t.Errorf("last viewed = %v, want nil on first view", view.LastViewedAt) }
+	if len(view.Organisations) != 2 || view.Organisations[0].Name != "Acme Ltd" || len(view.Organisations[0].Licences) != 1 {
+		t.Fatalf("organisations = %+v", view.Organisations)
+	}
+	for _, w := range view.Organisations {
+		if w.Status != WatchActive || len(w.Changes) != 0 { t.Errorf("%s = %s with %d changes", w.Name, w.Status, len(w.Changes)) }
+	}
+
+	// Beta moves to Wakefield, in the same county, and Acme leaves the register
+	time.Sleep(10 * time.Millisecond)
+	moved, _ := InsertOrganisation(ctx, pool, Organisation{Name: "Beta Ltd", TownCity: "Wakefield", County: "West Yorkshire"}, false)
+	InsertLicence(ctx, pool, Licence{OrganisationID: moved, LicenceType: "Worker", Rating: RatingA, Route: "Skilled Worker"}, false)
+	CloseOrganisation(ctx, pool, beta)
+	CloseLicence(ctx, pool, betaLic)
+	CloseOrganisation(ctx, pool, acme)
+
+	view, _, _ = store.ViewWatchlist(ctx, alice, wl.ID)
+	if view.LastViewedAt == nil { t.Error("last viewed not recorded") }
+	acmeView, betaView := view.Organisations[0], view.Organisations[1]
+	if acmeView.Status != WatchRemoved || acmeView.CurrentID != nil || len(acmeView.Changes) != 1 || acmeView.Changes[0].EventType != EventOrganisationRemoved {
+		t.Errorf("acme = %+v", acmeView)
+	}
+	if betaView.Status != WatchMoved || betaView.CurrentID == nil || *betaView.CurrentID != moved || betaView.TownCity != "Wakefield" || len(betaView.Licences) != 1 {
+		t.Errorf("beta = %+v", betaView)
+	}
+	if len(betaView.Changes) == 0 { t.Error("beta has no changes") }
+
+	// Nothing has changed since the last view
+	view, _, _ = store.ViewWatchlist(ctx, alice, wl.ID)
+	for _, w := range view.Organisations {
+		if len(w.Changes) != 0 { t.Errorf("%s has %d changes after re-viewing", w.Name, len(w.Changes)) }
+	}
+
+	// A same-name organisation added after Acme's removal is not Acme moving
+	time.Sleep(10 * time.Millisecond)
+	InsertOrganisation(ctx, pool, Organisation{Name: "Acme Ltd", TownCity: "Leeds"}, false)
+	view, _, _ = store.ViewWatchlist(ctx, alice, wl.ID)
+	if acmeView := view.Organisations[0]; acmeView.Status != WatchRemoved || acmeView.CurrentID != nil { t.Errorf("acme after unrelated same-name sponsor = %+v", acmeView) }
+
+	if found, _ := store.RemoveFromWatchlist(ctx, bob, wl.ID, acme); found { t.Error("bob removed from alice's watchlist") }
+	if found, _ := store.RemoveFromWatchlist(ctx, alice, wl.ID, acme); !found { t.Error("remove failed") }
+	if found, _ := store.DeleteWatchlist(ctx, alice, wl.ID); !found { t.Error("delete failed") }
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Webhook is a subscription to register changes, delivered to URL as JSON
+// signed with Secret. Empty EventTypes or Routes match every event. Failures
+// counts the batches in a row whose delivery failed.
+type Webhook struct {
+	ID         int       `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`
+	EventTypes []string  `json:"event_types"`
+	Routes     []string  `json:"routes"`
+	Active     bool      `json:"active"`
+	Failures   int       `json:"failures"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is a single attempt to deliver a payload to a webhook.
+// Retries of a payload share its DeliveryID. StatusCode is nil if no
+// response was received.
+type WebhookDelivery struct {
+	ID          int       `json:"id"`
+	WebhookID   int       `json:"webhook_id"`
+	DeliveryID  string    `json:"delivery_id"`
+	Event       string    `json:"event"`
+	EventCount  int       `json:"event_count"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  *int      `json:"status_code"`
+	Error       string    `json:"error,omitempty"`
+	Succeeded   bool      `json:"succeeded"`
+	DurationMS  int       `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+const webhookColumns = `id, url, secret, event_types, routes, active, failures, created_at`
+
+func scanWebhook(row pgx.Row) (Webhook, error) {
+	var wh Webhook
+	err := row.Scan(&wh.ID, &wh.URL, &wh.Secret, &wh.EventTypes, &wh.Routes, &wh.Active, &wh.Failures, &wh.CreatedAt)
+	return wh, err
+}
+
+const webhookDeliveryColumns = `id, webhook_id, delivery_id, event, event_count, attempt, status_code, error, succeeded, duration_ms, attempted_at`
+
+func scanWebhookDelivery(row pgx.Row) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := row.Scan(&d.ID, &d.WebhookID, &d.DeliveryID, &d.Event, &d.EventCount, &d.Attempt,
+		&d.StatusCode, &d.Error, &d.Succeeded, &d.DurationMS, &d.AttemptedAt)
+	return d, err
+}
+
+// InsertWebhook creates a webhook and returns its ID.
+func InsertWebhook(ctx context.Context, q Querier, wh Webhook) (int, error) {
+	var id int
+	err := q.QueryRow(ctx,
+		`INSERT INTO webhooks (url, secret, event_types, routes, active)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING id`,
+		wh.URL, wh.Secret, nonNil(wh.EventTypes), nonNil(wh.Routes), wh.Active,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("insert webhook: %w", err)
+	}
+	return id, nil
+}
+
+// GetWebhooks returns all webhooks ordered by ID, or only the active ones.
+func GetWebhooks(ctx context.Context, q Querier, activeOnly bool) ([]Webhook, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+webhookColumns+` FROM webhooks WHERE active OR NOT $1 ORDER BY id`,
+		activeOnly,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		wh, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get webhooks: scan row: %w", err)
+		}
+		webhooks = append(webhooks, wh)
+	}
+	return webhooks, rows.Err()
+}
+
+// FindWebhook looks up a webhook by ID.
+// Returns the webhook and true if found, or empty and false if not found.
+func FindWebhook(ctx context.Context, q Querier, id int) (Webhook, bool, error) {
+	wh, err := scanWebhook(q.QueryRow(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Webhook{}, false, nil
+	}
+	if err != nil {
+		return Webhook{}, false, fmt.Errorf("find webhook: %w", err)
+	}
+	return wh, true, nil
+}
+
+// UpdateWebhook replaces a webhook's settings, keeping its secret if
+// wh.Secret is empty, and resets its failure count. It returns false if the
+// webhook does not exist.
+func UpdateWebhook(ctx context.Context, q Querier, wh Webhook) (bool, error) {
+	tag, err := q.Exec(ctx,
+		`UPDATE webhooks
+		 SET url = $2, secret = COALESCE(NULLIF($3, ''), secret), event_types = $4, routes = $5, active = $6, failures = 0
+		 WHERE id = $1`,
+		wh.ID, wh.URL, wh.Secret, nonNil(wh.EventTypes), nonNil(wh.Routes), wh.Active,
+	)
+	if err != nil {
+		return false, fmt.Errorf("update webhook: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// RecordWebhookFailure counts a failed batch delivery against a webhook and
+// deactivates it once limit batches in a row have failed. It returns true if
+// the webhook is now inactive.
+func RecordWebhookFailure(ctx context.Context, q Querier, id, limit int) (bool, error) {
+	var active bool
+	err := q.QueryRow(ctx,
+		`UPDATE webhooks SET failures = failures + 1, active = active AND failures + 1 < $2
+		 WHERE id = $1
+		 RETURNING active`,
+		id, limit,
+	).Scan(&active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("record webhook failure: %w", err)
+	}
+	return !active, nil
+}
+
+// ResetWebhookFailures clears a webhook's failure count after a successful
+// delivery.
+func ResetWebhookFailures(ctx context.Context, q Querier, id int) error {
+	if _, err := q.Exec(ctx, `UPDATE webhooks SET failures = 0 WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("reset webhook failures: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebhook deletes a webhook and its delivery log, returning false if it
+// does not exist.
+func DeleteWebhook(ctx context.Context, q Querier, id int) (bool, error) {
+	tag, err := q.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete webhook: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// InsertWebhookDelivery records a delivery attempt and returns its ID.
+func InsertWebhookDelivery(ctx context.Context, q Querier, d WebhookDelivery) (int, error) {
+	var id int
+	err := q.QueryRow(ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, delivery_id, event, event_count, attempt, status_code, error, succeeded, duration_ms, attempted_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		 RETURNING id`,
+		d.WebhookID, d.DeliveryID, d.Event, d.EventCount, d.Attempt, d.StatusCode, d.Error, d.Succeeded, d.DurationMS, d.AttemptedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("insert webhook delivery: %w", err)
+	}
+	return id, nil
+}
+
+// FindLastWebhookDelivery looks up the latest attempt of a delivery to a
+// webhook. Returns it and true if found, or empty and false if not found.
+func FindLastWebhookDelivery(ctx context.Context, q Querier, webhookID int, deliveryID string) (WebhookDelivery, bool, error) {
+	d, err := scanWebhookDelivery(q.QueryRow(ctx,
+		`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+		 WHERE webhook_id = $1 AND delivery_id = $2
+		 ORDER BY id DESC
+		 LIMIT 1`,
+		webhookID, deliveryID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return WebhookDelivery{}, false, nil
+	}
+	if err != nil {
+		return WebhookDelivery{}, false, fmt.Errorf("find last webhook delivery: %w", err)
+	}
+	return d, true, nil
+}
+
+// GetWebhookDeliveries returns up to limit of a webhook's most recent
+// delivery attempts, newest first.
+func GetWebhookDeliveries(ctx context.Context, q Querier, webhookID, limit int) ([]WebhookDelivery, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+webhookDeliveryColumns+`
+		 FROM webhook_deliveries
+		 WHERE webhook_id = $1
+		 ORDER BY id DESC
+		 LIMIT $2`,
+		webhookID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get webhook deliveries: scan row: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// nonNil returns s, or an empty slice if s is nil, so that it is stored as
+// an empty array rather than NULL.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+	ctx := context.Background()
+
+	cleanup := func() { pool.Exec(ctx, `DELETE FROM webhooks`) }
+	cleanup()
+	defer cleanup()
+
+	id, err := InsertWebhook(ctx, pool, Webhook{URL: "https://example.test/a", Secret: "0123456789abcdef", Active: true})
+	if err != nil { t.Fatalf("insert: %v", err) }
+	inactive, _ := InsertWebhook(ctx, pool, Webhook{URL: "https://example.test/b", Secret: "fedcba9876543210", Routes: []string{"Scale-up"}})
+
+	wh, found, err := FindWebhook(ctx, pool, id)
+	if err != nil || !found { t.Fatalf("find: found=%v err=%v", found, err) }
+	if wh.Secret != "0123456789abcdef" || !wh.Active || wh.EventTypes == nil || len(wh.EventTypes) != 0 { t.Errorf("found %+v", wh) }
+
+	all, _ := GetWebhooks(ctx, pool, false)
+	active, _ := GetWebhooks(ctx, pool, true)
+	if len(all) != 2 || len(active) != 1 || active[0].ID != id { t.Errorf("all = %d, active = %+v", len(all), active) }
+
+	// An empty secret on update keeps the existing one
+	wh.URL, wh.Secret, wh.EventTypes = "https://example.test/c", "", []string{EventLicenceRerated}
+	if found, err := UpdateWebhook(ctx, pool, wh); err != nil || !found { t.Fatalf("update: found=%v err=%v", found, err) }
+	got, _, _ := FindWebhook(ctx, pool, id)
+	if got.URL != "https://example.test/c" || got.Secret != "0123456789abcdef" || !reflect.DeepEqual(got.EventTypes, []string{EventLicenceRerated}) { t.Errorf("updated %+v", got) }
+	if found, _ := UpdateWebhook(ctx, pool, Webhook{ID: 999999}); found { t.Error("updated unknown webhook") }
+
+	at := time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)
+	code := 503
+	InsertWebhookDelivery(ctx, pool, WebhookDelivery{WebhookID: id, DeliveryID: "d1", Event: "changes", EventCount: 2, Attempt: 1, StatusCode: &code, Error: "503 Service Unavailable", DurationMS: 12, AttemptedAt: at})
+	InsertWebhookDelivery(ctx, pool, WebhookDelivery{WebhookID: id, DeliveryID: "d1", Event: "changes", EventCount: 2, Attempt: 2, Error: "connection refused", AttemptedAt: at.Add(time.Second)})
+	InsertWebhookDelivery(ctx, pool, WebhookDelivery{WebhookID: inactive, DeliveryID: "d2", Event: "test", Attempt: 1, Succeeded: true, AttemptedAt: at})
+
+	deliveries, err := GetWebhookDeliveries(ctx, pool, id, 10)
+	if err != nil { t.Fatalf("get deliveries: %v", err) }
+	if len(deliveries) != 2 { t.Fatalf("got %d deliveries, want 2", len(deliveries)) }
+	if d := deliveries[0]; d.Attempt != 2 || d.StatusCode != nil || d.Error != "connection refused" { t.Errorf("newest = %+v", d) }
+	if d := deliveries[1]; d.Attempt != 1 || d.StatusCode == nil || *d.StatusCode != 503 || d.DurationMS != 12 || !d.AttemptedAt.Equal(at) { t.Errorf("oldest = %+v", d) }
+	if limited, _ := GetWebhookDeliveries(ctx, pool, id, 1); len(limited) != 1 { t.Errorf("limit 1 returned %d", len(limited)) }
+	if d, found, err := FindLastWebhookDelivery(ctx, pool, id, "d1"); err != nil || !found || d.Attempt != 2 { t.Errorf("find last = %+v, %v, %v", d, found, err) }
+	if _, found, _ := FindLastWebhookDelivery(ctx, pool, inactive, "d1"); found { t.Error("found another webhook's delivery") }
+
+	// Failures in a row deactivate the webhook at the limit; an update resets them
+	if off, err := RecordWebhookFailure(ctx, pool, id, 2); err != nil || off { t.Errorf("first failure: deactivated = %v, %v", off, err) }
+	if off, _ := RecordWebhookFailure(ctx, pool, id, 2); !off { t.Error("not deactivated at the limit") }
+	if got, _, _ := FindWebhook(ctx, pool, id); got.Active || got.Failures != 2 { t.Errorf("after failures = %+v", got) }
+	ResetWebhookFailures(ctx, pool, id)
+	if got, _, _ := FindWebhook(ctx, pool, id); got.Failures != 0 { t.Errorf("failures after reset = %d", got.Failures) }
+	RecordWebhookFailure(ctx, pool, id, 2)
+	got.Active = true
+	UpdateWebhook(ctx, pool, got)
+	if got, _, _ := FindWebhook(ctx, pool, id); !got.Active || got.Failures != 0 { t.Errorf("after update = %+v", got) }
+
+	if found, _ := DeleteWebhook(ctx, pool, id); !found { t.Error("delete: not found") }
+	if deliveries, _ := GetWebhookDeliveries(ctx, pool, id, 10); len(deliveries) != 0 { t.Errorf("deliveries survived delete: %d", len(deliveries)) }
+	if found, _ := DeleteWebhook(ctx, pool, id); found { t.Error("deleted twice") }
+}
@@ -0,0 +1,316 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"sponsor-tracker/internal/database"
+	"sponsor-tracker/internal/outbox"
+)
+
+// maxDigestEvents bounds the changes listed in a digest; the rest are counted.
+const maxDigestEvents = 200
+
+// Store is the subset of database operations needed to queue and send email.
+type Store interface {
+	GetNotificationSettings(ctx context.Context) ([]database.NotificationSettings, error)
+	GetWatchedOrganisations(ctx context.Context, userID int) ([]database.WatchedOrganisation, error)
+	GetNotifyingSavedSearches(ctx context.Context) ([]database.SavedSearch, error)
+	MatchOrganisations(ctx context.Context, filter database.OrganisationFilter, orgIDs []int) ([]int, error)
+	GetChanges(ctx context.Context, from, to time.Time) ([]database.ChangeEvent, error)
+	Enqueue(ctx context.Context, e database.QueuedEmail) (bool, error)
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]database.QueuedEmail, error)
+	MarkSent(ctx context.Context, id int, at time.Time) error
+	Reschedule(ctx context.Context, id int, errMsg string, next time.Time) error
+	Abandon(ctx context.Context, id int, errMsg string, at time.Time) error
+}
+
+// QueryParser parses a saved search's query into the organisations it selects.
+type QueryParser func(query string) (database.OrganisationFilter, error)
+
+// Notifier queues watchlist alerts, saved search alerts and daily digests for
+// the users who have opted in to them. Queued email is sent by a Worker.
+type Notifier struct {
+	store Store
+	parse QueryParser
+}
+
+func NewNotifier(store Store, parse QueryParser) *Notifier {
+	return &Notifier{store: store, parse: parse}
+}
+
+// alertItem is a watched organisation and the changes to it in an alert.
+type alertItem struct {
+	Organisation database.WatchedOrganisation
+	Moved        bool
+	Changes      []database.ChangeEvent
+}
+
+// Deliver queues the watch alerts and saved search alerts for a batch of
+// changes. An alert already queued for the batch is not queued again. It
+// implements outbox.Sink.
+func (n *Notifier) Deliver(ctx context.Context, b outbox.Batch) error {
+	settings, err := n.store.GetNotificationSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("deliver alerts: %w", err)
+	}
+	if err := n.queueWatchAlerts(ctx, b, settings); err != nil {
+		return err
+	}
+	return n.queueSearchAlerts(ctx, b, settings)
+}
+
+// queueWatchAlerts queues an alert for each user with watch alerts on whose
+// watched organisations were removed, re-rated, or gained or lost a route in
+// a batch of changes.
+func (n *Notifier) queueWatchAlerts(ctx context.Context, b outbox.Batch, settings []database.NotificationSettings) error {
+	for _, s := range settings {
+		if !s.WatchAlerts {
+			continue
+		}
+		watched, err := n.store.GetWatchedOrganisations(ctx, s.UserID)
+		if err != nil {
+			return fmt.Errorf("queue watch alerts: %w", err)
+		}
+		var items []alertItem
+		for _, w := range watched {
+			w.Changes = watchedChanges(w, b.Events)
+			if item := newAlertItem(w); len(item.Changes) > 0 || item.Moved {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		subject, body, err := render("watch_alert", struct {
+			SyncedAt time.Time
+			Items    []alertItem
+		}{b.At, items})
+		if err != nil {
+			return fmt.Errorf("queue watch alerts: %w", err)
+		}
+		key := fmt.Sprintf("watch:%d:%s", s.UserID, b.Key)
+		if _, err := n.store.Enqueue(ctx, database.QueuedEmail{DedupeKey: key, Recipient: s.Email, Subject: subject, Body: body}); err != nil {
+			return fmt.Errorf("queue watch alerts: %w", err)
+		}
+	}
+	return nil
+}
+
+// watchedChanges returns the events of a watched organisation or its current
+// version made after it was added to the watchlist.
+func watchedChanges(w database.WatchedOrganisation, events []database.ChangeEvent) []database.ChangeEvent {
+	var changes []database.ChangeEvent
+	for _, ev := range events {
+		ours := ev.OrganisationID == w.OrganisationID || (w.CurrentID != nil && ev.OrganisationID == *w.CurrentID)
+		if ours && ev.OccurredAt.After(w.AddedAt) {
+			changes = append(changes, ev)
+		}
+	}
+	return changes
+}
+
+// newAlertItem selects the changes to a watched organisation worth an alert:
+// its removal, re-ratings, and licences gained or lost. When an organisation
+// moves, its removal and the licences moved with it are reported as the move.
+func newAlertItem(w database.WatchedOrganisation) alertItem {
+	type licenceKey struct{ licenceType, route string }
+	added, removed := map[licenceKey]bool{}, map[licenceKey]bool{}
+	for _, ev := range w.Changes {
+		switch ev.EventType {
+		case database.EventLicenceAdded:
+			added[licenceKey{ev.LicenceType, ev.Route}] = true
+		case database.EventLicenceRemoved:
+			removed[licenceKey{ev.LicenceType, ev.Route}] = true
+		}
+	}
+
+	item := alertItem{Organisation: w}
+	for _, ev := range w.Changes {
+		k := licenceKey{ev.LicenceType, ev.Route}
+		switch {
+		case ev.EventType == database.EventOrganisationRemoved && w.Status == database.WatchMoved:
+			item.Moved = true
+		case ev.EventType == database.EventOrganisationRemoved,
+			ev.EventType == database.EventLicenceRerated,
+			ev.EventType == database.EventLicenceAdded && !removed[k],
+			ev.EventType == database.EventLicenceRemoved && !added[k]:
+			item.Changes = append(item.Changes, ev)
+		}
+	}
+	return item
+}
+
+// searchResult is an organisation that entered or left a saved search's results.
+type searchResult struct {
+	Name     string
+	TownCity string
+	County   string
+}
+
+// queueSearchAlerts queues an alert for each saved search with notifications
+// on whose results gained or lost organisations in a batch of changes, sent to
+// the address in its owner's notification settings. Only the organisations
+// changed by the batch can enter or leave a search's results, so each search
+// is tested against those, on the register as it stood just before and just
+// after the sync; every change a sync makes is stamped with the same time.
+// A search whose query no longer parses is logged and skipped.
+func (n *Notifier) queueSearchAlerts(ctx context.Context, b outbox.Batch, settings []database.NotificationSettings) error {
+	searches, err := n.store.GetNotifyingSavedSearches(ctx)
+	if err != nil {
+		return fmt.Errorf("queue search alerts: %w", err)
+	}
+	if len(searches) == 0 || len(b.Events) == 0 {
+		return nil
+	}
+	recipients := map[int]string{}
+	for _, s := range settings {
+		recipients[s.UserID] = s.Email
+	}
+	changed := map[int]searchResult{}
+	var orgIDs []int
+	for _, ev := range b.Events {
+		if _, ok := changed[ev.OrganisationID]; !ok {
+			changed[ev.OrganisationID] = searchResult{ev.OrganisationName, ev.TownCity, ev.County}
+			orgIDs = append(orgIDs, ev.OrganisationID)
+		}
+	}
+	before, after := b.At.Add(-time.Microsecond), b.At
+
+	for _, search := range searches {
+		recipient, ok := recipients[search.UserID]
+		if !ok {
+			continue
+		}
+		f, err := n.parse(search.Query)
+		if err != nil {
+			slog.Warn("skip saved search alert", "search_id", search.ID, "error", err)
+			continue
+		}
+		f.AsOf = &before
+		was, err := n.store.MatchOrganisations(ctx, f, orgIDs)
+		if err != nil {
+			return fmt.Errorf("queue search alerts: %w", err)
+		}
+		f.AsOf = &after
+		is, err := n.store.MatchOrganisations(ctx, f, orgIDs)
+		if err != nil {
+			return fmt.Errorf("queue search alerts: %w", err)
+		}
+		entered, left := difference(is, was, changed), difference(was, is, changed)
+		if len(entered) == 0 && len(left) == 0 {
+			continue
+		}
+
+		subject, body, err := render("search_alert", struct {
+			Search   database.SavedSearch
+			SyncedAt time.Time
+			Entered  []searchResult
+			Left     []searchResult
+		}{search, b.At, entered, left})
+		if err != nil {
+			return fmt.Errorf("queue search alerts: %w", err)
+		}
+		key := fmt.Sprintf("search:%d:%s", search.ID, b.Key)
+		if _, err := n.store.Enqueue(ctx, database.QueuedEmail{DedupeKey: key, Recipient: recipient, Subject: subject, Body: body}); err != nil {
+			return fmt.Errorf("queue search alerts: %w", err)
+		}
+	}
+	return nil
+}
+
+// difference returns the organisations among a but not b, in a's order.
+func difference(a, b []int, orgs map[int]searchResult) []searchResult {
+	var results []searchResult
+	for _, id := range a {
+		if !slices.Contains(b, id) {
+			results = append(results, orgs[id])
+		}
+	}
+	return results
+}
+
+// eventCount is the number of changes of one type in a digest.
+type eventCount struct {
+	Label string
+	Count int
+}
+
+// eventLabels name the event types in digest counts, in display order.
+var eventLabels = []struct{ eventType, label string }{
+	{database.EventOrganisationAdded, "organisations added"},
+	{database.EventOrganisationRemoved, "organisations removed"},
+	{database.EventLicenceAdded, "licences added"},
+	{database.EventLicenceRemoved, "licences removed"},
+	{database.EventLicenceRerated, "licences re-rated"},
+}
+
+// QueueDigests queues, for each user with the daily digest on, an email
+// listing the register changes during day (UTC) that match their digest
+// criteria. Users with no matching changes get no email. A digest already
+// queued for the day is not queued again.
+func (n *Notifier) QueueDigests(ctx context.Context, day time.Time) error {
+	settings, err := n.store.GetNotificationSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("queue digests: %w", err)
+	}
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	var events []database.ChangeEvent
+	loaded := false
+
+	for _, s := range settings {
+		if !s.DailyDigest {
+			continue
+		}
+		if !loaded {
+			if events, err = n.store.GetChanges(ctx, from, from.AddDate(0, 0, 1)); err != nil {
+				return fmt.Errorf("queue digests: %w", err)
+			}
+			loaded = true
+		}
+		matched := s.DigestFilter().Apply(events)
+		if len(matched) == 0 {
+			continue
+		}
+
+		subject, body, err := render("daily_digest", newDigest(from, matched))
+		if err != nil {
+			return fmt.Errorf("queue digests: %w", err)
+		}
+		key := fmt.Sprintf("digest:%d:%s", s.UserID, from.Format("2006-01-02"))
+		if _, err := n.store.Enqueue(ctx, database.QueuedEmail{DedupeKey: key, Recipient: s.Email, Subject: subject, Body: body}); err != nil {
+			return fmt.Errorf("queue digests: %w", err)
+		}
+	}
+	return nil
+}
+
+// digest is the template data of a daily digest.
+type digest struct {
+	Day    time.Time
+	Events []database.ChangeEvent
+	Counts []eventCount
+	Shown  []database.ChangeEvent
+	More   int
+}
+
+func newDigest(day time.Time, events []database.ChangeEvent) digest {
+	d := digest{Day: day, Events: events, Shown: events}
+	counts := map[string]int{}
+	for _, ev := range events {
+		counts[ev.EventType]++
+	}
+	for _, l := range eventLabels {
+		if counts[l.eventType] > 0 {
+			d.Counts = append(d.Counts, eventCount{l.label, counts[l.eventType]})
+		}
+	}
+	if len(events) > maxDigestEvents {
+		d.Shown, d.More = events[:maxDigestEvents], len(events)-maxDigestEvents
+	}
+	return d
+}
@@ -0,0 +1,348 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"sponsor-tracker/internal/database"
+	"sponsor-tracker/internal/outbox"
+)
+
+// fakeStore is an in-memory Store.
+type fakeStore struct {
+	settings []database.NotificationSettings
+	watched  map[int][]database.WatchedOrganisation
+	searches []database.SavedSearch
+	matches  func(f database.OrganisationFilter) []int // the organisations a filter selects
+	changes  []database.ChangeEvent
+	queue    []database.QueuedEmail
+	from, to time.Time
+}
+
+func (f *fakeStore) GetNotificationSettings(_ context.Context) ([]database.NotificationSettings, error) {
+	return f.settings, nil
+}
+
+func (f *fakeStore) GetWatchedOrganisations(_ context.Context, userID int) ([]database.WatchedOrganisation, error) {
+	return f.watched[userID], nil
+}
+
+func (f *fakeStore) GetNotifyingSavedSearches(_ context.Context) ([]database.SavedSearch, error) {
+	return f.searches, nil
+}
+
+func (f *fakeStore) MatchOrganisations(_ context.Context, filter database.OrganisationFilter, orgIDs []int) ([]int, error) {
+	var ids []int
+	for _, id := range f.matches(filter) {
+		if slices.Contains(orgIDs, id) { ids = append(ids, id) }
+	}
+	return ids, nil
+}
+
+func (f *fakeStore) GetChanges(_ context.Context, from, to time.Time) ([]database.ChangeEvent, error) {
+	f.from, f.to = from, to
+	return f.changes, nil
+}
+
+func (f *fakeStore) Enqueue(_ context.Context, e database.QueuedEmail) (bool, error) {
+	for _, q := range f.queue {
+		if q.DedupeKey == e.DedupeKey { return false, nil }
+	}
+	e.ID = len(f.queue) + 1
+	f.queue = append(f.queue, e)
+	return true, nil
+}
+
+func (f *fakeStore) ClaimDue(_ context.Context, now time.Time, lease time.Duration, limit int) ([]database.QueuedEmail, error) {
+	var due []database.QueuedEmail
+	for i := range f.queue {
+		e := &f.queue[i]
+		if e.SentAt == nil && e.FailedAt == nil && !e.NextAttemptAt.After(now) && len(due) < limit {
+			e.Attempts++
+			e.NextAttemptAt = now.Add(lease)
+			due = append(due, *e)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeStore) MarkSent(_ context.Context, id int, at time.Time) error {
+	f.queue[id-1].SentAt = &at
+	return nil
+}
+
+func (f *fakeStore) Reschedule(_ context.Context, id int, errMsg string, next time.Time) error {
+	f.queue[id-1].LastError, f.queue[id-1].NextAttemptAt = errMsg, next
+	return nil
+}
+
+func (f *fakeStore) Abandon(_ context.Context, id int, errMsg string, at time.Time) error {
+	f.queue[id-1].LastError, f.queue[id-1].FailedAt = errMsg, &at
+	return nil
+}
+
+// parseCounty is a QueryParser that reads only the county parameter.
+func parseCounty(query string) (database.OrganisationFilter, error) {
+	q, err := url.ParseQuery(query)
+	return database.OrganisationFilter{County: q.Get("county")}, err
+}
+
+func licence(eventType, route, rating, previous string) database.ChangeEvent {
+	id := 1
+	return database.ChangeEvent{EventType: eventType, LicenceID: &id, LicenceType: "Worker", Route: route, Rating: rating, PreviousRating: previous}
+}
+
+func TestDeliver_QueuesWatchAlerts(t *testing.T) {
+	at := time.Date(2026, 3, 12, 6, 0, 0, 0, time.UTC)
+	added := at.AddDate(0, -1, 0)
+	acme, staffCo, newStaffCo := 1, 2, 21
+	event := func(orgID int, ev database.ChangeEvent) database.ChangeEvent {
+		ev.OrganisationID, ev.OccurredAt = orgID, at
+		return ev
+	}
+	b := outbox.Batch{Key: "sync:2026-03-12T06:00:00Z", At: at, Events: []database.ChangeEvent{
+		event(1, licence(database.EventLicenceRerated, "Skilled Worker", "B rating", "A rating")),
+		event(1, licence(database.EventLicenceAdded, "Scale-up", "A rating", "")),
+		// StaffCo moved: the removal and the licence moved with it become one line
+		event(2, database.ChangeEvent{EventType: database.EventOrganisationRemoved}),
+		event(2, licence(database.EventLicenceRemoved, "Skilled Worker", "A rating", "")),
+		event(21, database.ChangeEvent{EventType: database.EventOrganisationAdded}),
+		event(21, licence(database.EventLicenceAdded, "Skilled Worker", "A rating", "")),
+		event(3, database.ChangeEvent{EventType: database.EventOrganisationRemoved}),
+		event(3, licence(database.EventLicenceRemoved, "Skilled Worker", "A rating", "")),
+		// Watched only after the change, and not watched at all
+		event(5, database.ChangeEvent{EventType: database.EventOrganisationRemoved}),
+		event(9, database.ChangeEvent{EventType: database.EventOrganisationRemoved}),
+	}}
+	store := &fakeStore{
+		settings: []database.NotificationSettings{
+			{UserID: 1, Email: "alice@example.test", WatchAlerts: true},
+			{UserID: 2, Email: "bob@example.test", WatchAlerts: false, DailyDigest: true},
+			{UserID: 3, Email: "carol@example.test", WatchAlerts: true},
+		},
+		watched: map[int][]database.WatchedOrganisation{
+			1: {
+				{OrganisationID: 1, CurrentID: &acme, AddedAt: added, Name: "Acme Ltd", TownCity: "Dover", County: "Kent", Status: database.WatchActive},
+				{OrganisationID: 2, CurrentID: &newStaffCo, AddedAt: added, Name: "StaffCo", TownCity: "Newcastle", Status: database.WatchMoved},
+				{OrganisationID: 3, AddedAt: added, Name: "Gone Ltd", TownCity: "Leeds", Status: database.WatchRemoved},
+				{OrganisationID: 4, AddedAt: added, Name: "Quiet Ltd", TownCity: "York", Status: database.WatchActive},
+				{OrganisationID: 5, AddedAt: at.Add(time.Hour), Name: "Late Ltd", TownCity: "Hull", Status: database.WatchRemoved},
+			},
+			// Carol's watched organisations did not change: no email
+			3: {{OrganisationID: 2, CurrentID: &staffCo, AddedAt: at, Name: "StaffCo", TownCity: "Leeds", Status: database.WatchActive}},
+		},
+	}
+
+	n := NewNotifier(store, parseCounty)
+	if err := n.Deliver(context.Background(), b); err != nil { t.Fatalf("deliver: %v", err) }
+	if len(store.queue) != 1 { t.Fatalf("queued %d emails, want 1", len(store.queue)) }
+
+	e := store.queue[0]
+	if e.Recipient != "alice@example.test" || e.DedupeKey != "watch:1:sync:2026-03-12T06:00:00Z" { t.Errorf("queued %+v", e) }
+	if e.Subject != "3 watched sponsors changed" { t.Errorf("subject = %q", e.Subject) }
+	want := `Changes to sponsors on your watchlists found by the sync of 12 March 2026 06:00 UTC:
+
+Acme Ltd, Dover, Kent
+  - Skilled Worker licence (Worker) re-rated from A rating to B rating
+  - gained a Scale-up licence (Worker, A rating)
+
+StaffCo, Newcastle
+  - moved to Newcastle
+
+Gone Ltd, Leeds
+  - removed from the register
+  - lost its Skilled Worker licence (Worker)
+
+You receive these alerts because watchlist alerts are on in your notification settings.
+`
+	if e.Body != want { t.Errorf("body =\n%s\nwant\n%s", e.Body, want) }
+
+	// Redelivering the batch queues nothing new
+	n.Deliver(context.Background(), b)
+	if len(store.queue) != 1 { t.Errorf("queued %d emails after repeat, want 1", len(store.queue)) }
+}
+
+func TestDeliver_QueuesSearchAlerts(t *testing.T) {
+	at := time.Date(2026, 3, 12, 6, 0, 0, 0, time.UTC)
+	event := func(orgID int, name, town string, ev database.ChangeEvent) database.ChangeEvent {
+		ev.OrganisationID, ev.OrganisationName, ev.TownCity, ev.County, ev.OccurredAt = orgID, name, town, "Kent", at
+		return ev
+	}
+	b := outbox.Batch{Key: "sync:2026-03-12T06:00:00Z", At: at, Events: []database.ChangeEvent{
+		event(7, "Acme Ltd", "Dover", licence(database.EventLicenceAdded, "Skilled Worker", "A rating", "")),
+		event(8, "Beta Ltd", "Ashford", database.ChangeEvent{EventType: database.EventOrganisationRemoved}),
+		event(9, "Gamma Ltd", "Deal", licence(database.EventLicenceRerated, "Skilled Worker", "B rating", "A rating")),
+	}}
+	store := &fakeStore{
+		settings: []database.NotificationSettings{{UserID: 1, Email: "alice@example.test"}},
+		searches: []database.SavedSearch{
+			{ID: 4, UserID: 1, Name: "Kent sponsors", Query: "county=Kent", Notify: true},
+			// Results unchanged: no email
+			{ID: 5, UserID: 1, Name: "Everyone", Notify: true},
+			// No notification settings, so nowhere to send it
+			{ID: 6, UserID: 2, Name: "Kent sponsors", Query: "county=Kent", Notify: true},
+			// A query that no longer parses is skipped
+			{ID: 7, UserID: 1, Name: "Broken", Query: "county=%zz", Notify: true},
+		},
+		// Acme gained a licence and entered the Kent results; Beta was removed and left them
+		matches: func(f database.OrganisationFilter) []int {
+			if f.County == "" { return []int{8, 9} }
+			if f.AsOf.Before(at) { return []int{8, 9} }
+			return []int{7, 9}
+		},
+	}
+
+	n := NewNotifier(store, parseCounty)
+	if err := n.Deliver(context.Background(), b); err != nil { t.Fatalf("deliver: %v", err) }
+	if len(store.queue) != 1 { t.Fatalf("queued %d emails, want 1", len(store.queue)) }
+
+	e := store.queue[0]
+	if e.Recipient != "alice@example.test" || e.DedupeKey != "search:4:sync:2026-03-12T06:00:00Z" { t.Errorf("queued %+v", e) }
+	if e.Subject != `Saved search "Kent sponsors": 1 sponsor in, 1 out` { t.Errorf("subject = %q", e.Subject) }
+	want := `Changes to the results of your saved search "Kent sponsors" (county=Kent) found by the sync of 12 March 2026 06:00 UTC:
+
+Now in the results:
+  - Acme Ltd, Dover, Kent
+
+No longer in the results:
+  - Beta Ltd, Ashford, Kent
+
+You receive these alerts because notifications are on for this saved search.
+`
+	if e.Body != want { t.Errorf("body =\n%s\nwant\n%s", e.Body, want) }
+
+	// Redelivering the batch queues nothing new
+	n.Deliver(context.Background(), b)
+	if len(store.queue) != 1 { t.Errorf("queued %d emails after repeat, want 1", len(store.queue)) }
+}
+
+func TestQueueDigests_FiltersByCriteria(t *testing.T) {
+	kent := func(ev database.ChangeEvent) database.ChangeEvent { ev.OrganisationName, ev.TownCity, ev.County = "Acme Ltd", "Dover", "Kent"; return ev }
+	store := &fakeStore{
+		settings: []database.NotificationSettings{
+			{UserID: 1, Email: "alice@example.test", DailyDigest: true, DigestCounties: []string{"Kent"}},
+			{UserID: 2, Email: "bob@example.test", DailyDigest: true, DigestRoutes: []string{"Global Business Mobility"}},
+			{UserID: 3, Email: "carol@example.test", WatchAlerts: true},
+		},
+		changes: []database.ChangeEvent{
+			kent(licence(database.EventLicenceRerated, "Skilled Worker", "B rating", "A rating")),
+			{EventType: database.EventOrganisationAdded, OrganisationName: "Beta Ltd", TownCity: "Leeds"},
+		},
+	}
+
+	day := time.Date(2026, 3, 12, 15, 30, 0, 0, time.UTC)
+	if err := NewNotifier(store, parseCounty).QueueDigests(context.Background(), day); err != nil { t.Fatalf("queue digests: %v", err) }
+
+	if !store.from.Equal(time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC)) || !store.to.Equal(time.Date(2026, 3, 13, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("changes from %v to %v, want the whole day", store.from, store.to)
+	}
+	if len(store.queue) != 1 { t.Fatalf("queued %d emails, want 1 (bob has no matching changes)", len(store.queue)) }
+	e := store.queue[0]
+	if e.Recipient != "alice@example.test" || e.DedupeKey != "digest:1:2026-03-12" { t.Errorf("queued %+v", e) }
+	if e.Subject != "Sponsor register digest for 12 March 2026: 1 change" { t.Errorf("subject = %q", e.Subject) }
+	want := `Register changes on 12 March 2026 (UTC) matching your digest criteria:
+
+  1 licences re-rated
+
+Acme Ltd, Dover, Kent: Skilled Worker licence (Worker) re-rated from A rating to B rating
+
+You receive this digest because the daily digest is on in your notification settings.
+`
+	if e.Body != want { t.Errorf("body =\n%s\nwant\n%s", e.Body, want) }
+}
+
+func TestNewDigest_TruncatesLongLists(t *testing.T) {
+	events := make([]database.ChangeEvent, maxDigestEvents+5)
+	for i := range events {
+		events[i] = database.ChangeEvent{EventType: database.EventOrganisationAdded, OrganisationName: "Org"}
+	}
+	_, body, err := render("daily_digest", newDigest(time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC), events))
+	if err != nil { t.Fatalf("render: %v", err) }
+	if got := strings.Count(body, "added to the register"); got != maxDigestEvents { t.Errorf("listed %d events, want %d", got, maxDigestEvents) }
+	if !strings.Contains(body, "205 organisations added") || !strings.Contains(body, "...and 5 more.") { t.Errorf("body:\n%s", body) }
+}
+
+// fakeSender fails with the given errors in turn, then succeeds.
+type fakeSender struct {
+	errs []error
+	sent []string
+}
+
+func (f *fakeSender) Send(_ context.Context, to, _, _ string) error {
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	f.sent = append(f.sent, to)
+	return nil
+}
+
+func TestSendDue_RetriesWithBackoffThenSends(t *testing.T) {
+	store := &fakeStore{}
+	store.Enqueue(context.Background(), database.QueuedEmail{DedupeKey: "k", Recipient: "alice@example.test"})
+	sender := &fakeSender{errs: []error{errors.New("connection refused"), errors.New("connection refused")}}
+	w := NewWorker(store, sender, NewNotifier(store, parseCounty))
+
+	now := time.Date(2026, 3, 12, 6, 0, 0, 0, time.UTC)
+	for i, wantDelay := range []time.Duration{time.Minute, 2 * time.Minute} {
+		if sent, err := w.SendDue(context.Background(), now); sent != 0 || err != nil { t.Fatalf("attempt %d: sent=%d err=%v", i+1, sent, err) }
+		e := store.queue[0]
+		if e.LastError != "connection refused" || !e.NextAttemptAt.Equal(now.Add(wantDelay)) { t.Errorf("attempt %d: %+v", i+1, e) }
+		if sent, _ := w.SendDue(context.Background(), now.Add(wantDelay-time.Second)); sent != 0 { t.Errorf("attempt %d: retried early", i+1) }
+		now = now.Add(wantDelay)
+	}
+
+	if sent, err := w.SendDue(context.Background(), now); sent != 1 || err != nil { t.Fatalf("third attempt: sent=%d err=%v", sent, err) }
+	if e := store.queue[0]; e.SentAt == nil || e.Attempts != 3 { t.Errorf("after sending: %+v", e) }
+	if len(sender.sent) != 1 { t.Errorf("sent %d emails, want 1", len(sender.sent)) }
+	if sent, _ := w.SendDue(context.Background(), now.Add(time.Hour)); sent != 0 { t.Error("sent email was sent again") }
+}
+
+func TestSendDue_Abandons(t *testing.T) {
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+	}{
+		{"permanent rejection", []error{&textproto.Error{Code: 550, Msg: "no such user"}}, 1},
+		{"too many attempts", []error{errors.New("a"), errors.New("b"), errors.New("c"), errors.New("d"), errors.New("e"), errors.New("f")}, maxAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{}
+			store.Enqueue(context.Background(), database.QueuedEmail{DedupeKey: "k", Recipient: "nobody@example.test"})
+			w := NewWorker(store, &fakeSender{errs: tt.errs}, NewNotifier(store, parseCounty))
+
+			now := time.Date(2026, 3, 12, 6, 0, 0, 0, time.UTC)
+			for i := 0; i < 10 && store.queue[0].FailedAt == nil; i++ {
+				w.SendDue(context.Background(), now)
+				now = now.Add(time.Hour)
+			}
+			if e := store.queue[0]; e.FailedAt == nil || e.SentAt != nil || e.Attempts != tt.attempts { t.Errorf("queued email = %+v", e) }
+		})
+	}
+}
+
+func TestPoll_QueuesPreviousDaysDigestsOnce(t *testing.T) {
+	store := &fakeStore{
+		settings: []database.NotificationSettings{{UserID: 1, Email: "alice@example.test", DailyDigest: true}},
+		changes:  []database.ChangeEvent{{EventType: database.EventOrganisationAdded, OrganisationName: "Acme Ltd"}},
+	}
+	sender := &fakeSender{}
+	w := NewWorker(store, sender, NewNotifier(store, parseCounty))
+
+	now := time.Date(2026, 3, 13, 0, 1, 0, 0, time.UTC)
+	w.poll(context.Background(), now)
+	w.poll(context.Background(), now.Add(time.Minute))
+
+	if len(store.queue) != 1 || store.queue[0].DedupeKey != "digest:1:2026-03-12" { t.Fatalf("queue = %+v", store.queue) }
+	if len(sender.sent) != 1 { t.Errorf("sent %d emails, want 1", len(sender.sent)) }
+	if !w.lastDigest.Equal(time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC)) { t.Errorf("last digest = %v", w.lastDigest) }
+}
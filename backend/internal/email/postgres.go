@@ -0,0 +1,91 @@
+package email
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"sponsor-tracker/internal/database"
+)
+
+// PostgresStore implements Store using PostgreSQL.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+func (s *PostgresStore) GetNotificationSettings(ctx context.Context) ([]database.NotificationSettings, error) {
+	return database.GetNotificationSettings(ctx, s.pool)
+}
+
+// GetWatchedOrganisations returns the organisations on any of a user's
+// watchlists, each once, resolved to their current versions. Their changes
+// are left empty.
+func (s *PostgresStore) GetWatchedOrganisations(ctx context.Context, userID int) ([]database.WatchedOrganisation, error) {
+	watchlists, err := database.GetWatchlists(ctx, s.pool, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	seen := map[int]bool{}
+	var watched []database.WatchedOrganisation
+	for _, wl := range watchlists {
+		orgs, err := database.GetWatchedOrganisations(ctx, s.pool, wl.ID, &now)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range orgs {
+			if !seen[o.OrganisationID] {
+				seen[o.OrganisationID] = true
+				watched = append(watched, o)
+			}
+		}
+	}
+	return watched, nil
+}
+
+func (s *PostgresStore) GetNotifyingSavedSearches(ctx context.Context) ([]database.SavedSearch, error) {
+	return database.GetNotifyingSavedSearches(ctx, s.pool)
+}
+
+func (s *PostgresStore) MatchOrganisations(ctx context.Context, filter database.OrganisationFilter, orgIDs []int) ([]int, error) {
+	return database.MatchOrganisations(ctx, s.pool, filter, orgIDs)
+}
+
+// GetChanges returns the change events in [from, to). A cursor with only a
+// timestamp includes the events at that instant.
+func (s *PostgresStore) GetChanges(ctx context.Context, from, to time.Time) ([]database.ChangeEvent, error) {
+	events, err := database.GetChanges(ctx, s.pool, database.ChangeQuery{After: database.ChangeCursor{OccurredAt: from}})
+	if err != nil {
+		return nil, err
+	}
+	for i, ev := range events {
+		if !ev.OccurredAt.Before(to) {
+			return events[:i], nil
+		}
+	}
+	return events, nil
+}
+
+func (s *PostgresStore) Enqueue(ctx context.Context, e database.QueuedEmail) (bool, error) {
+	return database.EnqueueEmail(ctx, s.pool, e)
+}
+
+func (s *PostgresStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]database.QueuedEmail, error) {
+	return database.ClaimDueEmails(ctx, s.pool, now, lease, limit)
+}
+
+func (s *PostgresStore) MarkSent(ctx context.Context, id int, at time.Time) error {
+	return database.MarkEmailSent(ctx, s.pool, id, at)
+}
+
+func (s *PostgresStore) Reschedule(ctx context.Context, id int, errMsg string, next time.Time) error {
+	return database.RescheduleEmail(ctx, s.pool, id, errMsg, next)
+}
+
+func (s *PostgresStore) Abandon(ctx context.Context, id int, errMsg string, at time.Time) error {
+	return database.AbandonEmail(ctx, s.pool, id, errMsg, at)
+}
@@ -0,0 +1,107 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"sponsor-tracker/internal/config"
+)
+
+// sendTimeout bounds a whole SMTP conversation.
+const sendTimeout = 30 * time.Second
+
+// Sender sends a plain text email.
+type Sender interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// SMTPSender sends email through the configured SMTP server, upgrading to
+// TLS when the server offers STARTTLS and authenticating when a username is
+// configured.
+type SMTPSender struct {
+	cfg config.SMTPConfig
+}
+
+func NewSMTPSender(cfg config.SMTPConfig) *SMTPSender {
+	return &SMTPSender{cfg: cfg}
+}
+
+// Send delivers one email to a single recipient.
+func (s *SMTPSender) Send(ctx context.Context, to, subject, body string) error {
+	from, err := mail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("send email: invalid from address: %w", err)
+	}
+
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", s.cfg.Address())
+	if err != nil {
+		return fmt.Errorf("send email: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("send email: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return fmt.Errorf("send email: starttls: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password(), s.cfg.Host)); err != nil {
+			return fmt.Errorf("send email: auth: %w", err)
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("send email: %w", err)
+	}
+	if err := c.Rcpt(to); err != nil {
+		return fmt.Errorf("send email: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("send email: %w", err)
+	}
+	if _, err := w.Write(formatMessage(from.String(), to, subject, body, time.Now())); err != nil {
+		return fmt.Errorf("send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("send email: %w", err)
+	}
+	return c.Quit()
+}
+
+// formatMessage builds a UTF-8 plain text message with its headers.
+func formatMessage(from, to, subject, body string, date time.Time) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + date.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// permanent reports whether a send error is a permanent SMTP failure (a 5xx
+// reply), which retrying will not fix.
+func permanent(err error) bool {
+	var tpErr *textproto.Error
+	return errors.As(err, &tpErr) && tpErr.Code >= 500
+}
@@ -0,0 +1,127 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"sponsor-tracker/internal/config"
+)
+
+// smtpSink is a minimal local SMTP server that accepts every message, or
+// rejects every recipient with rejectCode, and records what it received.
+type smtpSink struct {
+	ln         net.Listener
+	rejectCode int
+	mu         sync.Mutex
+	rcpts      []string
+	messages   []string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatalf("listen: %v", err) }
+	s := &smtpSink{ln: ln}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *smtpSink) config() config.SMTPConfig {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return config.SMTPConfig{Host: addr.IP.String(), Port: addr.Port, From: "Sponsor Tracker <alerts@example.test>"}
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 sink ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			if s.rejectCode != 0 {
+				reply(strconv.Itoa(s.rejectCode) + " mailbox unavailable")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.Trim(strings.TrimSpace(line)[8:], "<>"))
+			s.mu.Unlock()
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				msg.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPSender_DeliversToLocalSink(t *testing.T) {
+	sink := newSMTPSink(t)
+	sender := NewSMTPSender(sink.config())
+
+	err := sender.Send(context.Background(), "alice@example.test", "3 watched sponsors changed – Kent", "Acme Ltd\n  - removed\n")
+	if err != nil { t.Fatalf("send: %v", err) }
+
+	if len(sink.messages) != 1 { t.Fatalf("sink received %d messages, want 1", len(sink.messages)) }
+	if len(sink.rcpts) != 1 || sink.rcpts[0] != "alice@example.test" { t.Errorf("recipients = %v", sink.rcpts) }
+	msg := sink.messages[0]
+	for _, want := range []string{
+		"From: \"Sponsor Tracker\" <alerts@example.test>\r\n",
+		"To: alice@example.test\r\n",
+		"Subject: =?utf-8?q?3_watched_sponsors_changed_=E2=80=93_Kent?=\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"\r\n\r\nAcme Ltd\r\n  - removed\r\n",
+	} {
+		if !strings.Contains(msg, want) { t.Errorf("message does not contain %q:\n%s", want, msg) }
+	}
+}
+
+func TestSMTPSender_RejectionIsPermanentOnlyFor5xx(t *testing.T) {
+	for _, tt := range []struct {
+		code int
+		want bool
+	}{{550, true}, {450, false}} {
+		sink := newSMTPSink(t)
+		sink.rejectCode = tt.code
+		err := NewSMTPSender(sink.config()).Send(context.Background(), "alice@example.test", "s", "b")
+		if err == nil { t.Fatalf("%d: expected error", tt.code) }
+		if got := permanent(err); got != tt.want { t.Errorf("%d: permanent = %v, want %v", tt.code, got, tt.want) }
+	}
+}
@@ -0,0 +1,55 @@
+package email
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"sponsor-tracker/internal/database"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// templates are parsed once; each file defines a "subject" and a "body".
+var templates = map[string]*template.Template{
+	"watch_alert":  mustParse("templates/watch_alert.tmpl"),
+	"search_alert": mustParse("templates/search_alert.tmpl"),
+	"daily_digest": mustParse("templates/daily_digest.tmpl"),
+}
+
+var templateFuncs = template.FuncMap{
+	"date":     func(t time.Time) string { return t.UTC().Format("2 January 2006") },
+	"datetime": func(t time.Time) string { return t.UTC().Format("2 January 2006 15:04 MST") },
+	"place":    place,
+	"describe": database.ChangeEvent.Describe,
+}
+
+func mustParse(name string) *template.Template {
+	return template.Must(template.New("").Funcs(templateFuncs).ParseFS(templateFS, name))
+}
+
+// render executes a template's subject and body with data.
+func render(name string, data any) (string, string, error) {
+	var subject, body strings.Builder
+	if err := templates[name].ExecuteTemplate(&subject, "subject", data); err != nil {
+		return "", "", fmt.Errorf("render %s subject: %w", name, err)
+	}
+	if err := templates[name].ExecuteTemplate(&body, "body", data); err != nil {
+		return "", "", fmt.Errorf("render %s body: %w", name, err)
+	}
+	return strings.TrimSpace(subject.String()), body.String(), nil
+}
+
+// place joins a town and county, omitting either if empty.
+func place(townCity, county string) string {
+	switch {
+	case townCity == "":
+		return county
+	case county == "":
+		return townCity
+	}
+	return townCity + ", " + county
+}
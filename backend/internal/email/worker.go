@@ -0,0 +1,90 @@
+package email
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// pollInterval is how often the worker looks for email to send.
+	pollInterval = time.Minute
+	// claimLease is how long a claimed email is reserved for its sender.
+	claimLease = 5 * time.Minute
+	// batchSize is the most emails sent per poll.
+	batchSize = 50
+	// maxAttempts is how many times an email is tried before it is abandoned.
+	maxAttempts = 6
+)
+
+// Worker sends queued email, retrying failures with exponential backoff,
+// and queues each day's digests once the day has ended.
+type Worker struct {
+	store      Store
+	sender     Sender
+	notifier   *Notifier
+	lastDigest time.Time
+}
+
+func NewWorker(store Store, sender Sender, notifier *Notifier) *Worker {
+	return &Worker{store: store, sender: sender, notifier: notifier}
+}
+
+// Run polls until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		w.poll(ctx, time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll queues the previous day's digests if not yet done by this worker,
+// then sends the email due at now. Errors are logged and retried next poll.
+func (w *Worker) poll(ctx context.Context, now time.Time) {
+	yesterday := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, time.UTC)
+	if yesterday.After(w.lastDigest) {
+		if err := w.notifier.QueueDigests(ctx, yesterday); err != nil {
+			slog.Error("queue daily digests", "error", err)
+		} else {
+			w.lastDigest = yesterday
+		}
+	}
+	if _, err := w.SendDue(ctx, now); err != nil {
+		slog.Error("send queued email", "error", err)
+	}
+}
+
+// SendDue sends the queued email due at now and returns how many were sent.
+// A failed email is retried after 1, 2, 4, 8 and 16 minutes, then abandoned;
+// one the server rejects permanently is abandoned at once.
+func (w *Worker) SendDue(ctx context.Context, now time.Time) (int, error) {
+	emails, err := w.store.ClaimDue(ctx, now, claimLease, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, e := range emails {
+		err := w.sender.Send(ctx, e.Recipient, e.Subject, e.Body)
+		switch {
+		case err == nil:
+			err = w.store.MarkSent(ctx, e.ID, time.Now().UTC())
+			sent++
+		case permanent(err) || e.Attempts >= maxAttempts:
+			slog.Warn("email abandoned", "id", e.ID, "attempts", e.Attempts, "error", err)
+			err = w.store.Abandon(ctx, e.ID, err.Error(), now)
+		default:
+			err = w.store.Reschedule(ctx, e.ID, err.Error(), now.Add(time.Minute<<(e.Attempts-1)))
+		}
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
@@ -0,0 +1,125 @@
+// Package export writes register extracts as CSV, XLSX or NDJSON, one row
+// at a time so that large extracts can be streamed.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"sponsor-tracker/internal/database"
+)
+
+// Supported formats.
+const (
+	FormatCSV    = "csv"
+	FormatXLSX   = "xlsx"
+	FormatNDJSON = "ndjson"
+)
+
+// Formats lists every supported format.
+var Formats = []string{FormatCSV, FormatXLSX, FormatNDJSON}
+
+// Writer writes export rows in one format. Close must be called after the
+// last row to complete the output; it does not close the underlying writer.
+type Writer interface {
+	Write(row database.ExportRow) error
+	Close() error
+}
+
+// NewWriter returns a Writer for the format. Formats with a header write it immediately.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// ContentType returns the MIME type for the format.
+func ContentType(format string) string {
+	switch format {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	}
+	return "text/csv"
+}
+
+// cell is one export value: numeric cells are written as numbers in XLSX.
+type cell struct {
+	value   string
+	numeric bool
+}
+
+// cells returns the row's values in database.ExportColumns order. Times are
+// RFC 3339 in UTC; nil times are empty.
+func cells(row database.ExportRow) []cell {
+	return []cell{
+		{strconv.Itoa(row.OrganisationID), true},
+		{row.Name, false},
+		{row.TownCity, false},
+		{row.County, false},
+		{formatTime(row.OrganisationCreatedAt), false},
+		{formatTime(row.OrganisationDeletedAt), false},
+		{strconv.Itoa(row.LicenceID), true},
+		{row.LicenceType, false},
+		{row.Route, false},
+		{row.Rating, false},
+		{formatTime(row.ValidFrom), false},
+		{formatTime(row.ValidTo), false},
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(database.ExportColumns); err != nil {
+		return nil, fmt.Errorf("write CSV header: %w", err)
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) Write(row database.ExportRow) error {
+	cs := cells(row)
+	record := make([]string, len(cs))
+	for i, c := range cs {
+		record[i] = c.value
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (nw *ndjsonWriter) Write(row database.ExportRow) error {
+	return nw.enc.Encode(row)
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
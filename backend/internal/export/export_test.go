@@ -0,0 +1,118 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"sponsor-tracker/internal/database"
+)
+
+var (
+	created = time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)
+	rows    = []database.ExportRow{
+		{OrganisationID: 1, Name: "Acme & Sons, Ltd", TownCity: "Dover", County: "Kent", LicenceID: 10,
+			LicenceType: "Worker", Route: "Skilled Worker", Rating: "A rating"},
+		{OrganisationID: 2, Name: "Beta Ltd", TownCity: "Leeds", OrganisationCreatedAt: &created, LicenceID: 11,
+			LicenceType: "Temporary Worker", Route: "Creative Worker", Rating: "B rating", ValidFrom: &created},
+	}
+)
+
+func writeAll(t *testing.T, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf)
+	if err != nil { t.Fatalf("NewWriter: %v", err) }
+	for _, row := range rows {
+		if err := w.Write(row); err != nil { t.Fatalf("Write: %v", err) }
+	}
+	if err := w.Close(); err != nil { t.Fatalf("Close: %v", err) }
+	return buf.Bytes()
+}
+
+func TestCSV(t *testing.T) {
+	got := string(writeAll(t, FormatCSV))
+	want := strings.Join(database.ExportColumns, ",") + "\n" +
+		`1,"Acme & Sons, Ltd",Dover,Kent,,,10,Worker,Skilled Worker,A rating,,` + "\n" +
+		`2,Beta Ltd,Leeds,,2026-03-01T06:00:00Z,,11,Temporary Worker,Creative Worker,B rating,2026-03-01T06:00:00Z,` + "\n"
+	if got != want { t.Errorf("got:\n%s\nwant:\n%s", got, want) }
+}
+
+func TestNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(string(writeAll(t, FormatNDJSON))), "\n")
+	if len(lines) != 2 { t.Fatalf("got %d lines, want 2", len(lines)) }
+	var got database.ExportRow
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil { t.Fatalf("decode: %v", err) }
+	if got.LicenceID != 11 || got.ValidFrom == nil || !got.ValidFrom.Equal(created) || got.ValidTo != nil {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	data := writeAll(t, FormatXLSX)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil { t.Fatalf("not a zip: %v", err) }
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil { t.Fatalf("open %s: %v", f.Name, err) }
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+	for _, p := range xlsxParts {
+		if _, ok := files[p.name]; !ok { t.Errorf("missing part %s", p.name) }
+	}
+
+	sheet := files[xlsxSheetPath]
+	for _, want := range []string{
+		`<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">organisation_id</t></is></c>`,
+		`<c r="A2"><v>1</v></c><c r="B2" t="inlineStr"><is><t xml:space="preserve">Acme &amp; Sons, Ltd</t></is></c>`,
+		`<c r="E3" t="inlineStr"><is><t xml:space="preserve">2026-03-01T06:00:00Z</t></is></c>`,
+		`</row></sheetData></worksheet>`,
+	} {
+		if !strings.Contains(sheet, want) { t.Errorf("sheet missing %s", want) }
+	}
+	// Empty cells are omitted
+	if strings.Contains(sheet, `r="E2"`) { t.Errorf("sheet has a cell for an empty value") }
+}
+
+func TestXLSX_StripsCharactersInvalidInXML(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(FormatXLSX, &buf)
+	w.Write(database.ExportRow{OrganisationID: 1, Name: "Acme\x01 \x0bLtd\uFFFE", TownCity: "Dover\tEast"})
+	w.Close()
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil { t.Fatalf("not a zip: %v", err) }
+	var sheet []byte
+	for _, f := range zr.File {
+		if f.Name == xlsxSheetPath {
+			rc, _ := f.Open()
+			sheet, _ = io.ReadAll(rc)
+			rc.Close()
+		}
+	}
+	if !strings.Contains(string(sheet), `>Acme Ltd</t>`) || !strings.Contains(string(sheet), `>Dover&#x9;East</t>`) { t.Errorf("sheet = %s", sheet) }
+	d := xml.NewDecoder(bytes.NewReader(sheet))
+	for {
+		_, err := d.Token()
+		if err == io.EOF { break }
+		if err != nil { t.Fatalf("sheet is not valid XML: %v", err) }
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 11: "L", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want { t.Errorf("columnName(%d) = %q, want %q", i, got, want) }
+	}
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	if _, err := NewWriter("pdf", io.Discard); err == nil { t.Error("expected error for unknown format") }
+}
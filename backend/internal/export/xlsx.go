@@ -0,0 +1,137 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"sponsor-tracker/internal/database"
+)
+
+// The fixed parts of a single-sheet workbook. Cells use inline strings, so
+// no shared string table or styles are needed and the sheet can be written
+// as rows arrive.
+var xlsxParts = []struct{ name, body string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Register" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+const xlsxSheetPath = "xl/worksheets/sheet1.xml"
+
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	row   int
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, p := range xlsxParts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, fmt.Errorf("write XLSX %s: %w", p.name, err)
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return nil, fmt.Errorf("write XLSX %s: %w", p.name, err)
+		}
+	}
+	// The sheet is the last entry, so it can stay open while rows are written
+	f, err := zw.Create(xlsxSheetPath)
+	if err != nil {
+		return nil, fmt.Errorf("write XLSX sheet: %w", err)
+	}
+	xw := &xlsxWriter{zip: zw, sheet: bufio.NewWriter(f)}
+	xw.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]cell, len(database.ExportColumns))
+	for i, name := range database.ExportColumns {
+		header[i] = cell{value: name}
+	}
+	if err := xw.writeRow(header); err != nil {
+		return nil, err
+	}
+	return xw, nil
+}
+
+func (xw *xlsxWriter) Write(row database.ExportRow) error {
+	return xw.writeRow(cells(row))
+}
+
+// writeRow writes one sheet row. Empty cells are omitted.
+func (xw *xlsxWriter) writeRow(cs []cell) error {
+	xw.row++
+	n := strconv.Itoa(xw.row)
+	xw.sheet.WriteString(`<row r="` + n + `">`)
+	for i, c := range cs {
+		if c.value == "" {
+			continue
+		}
+		ref := columnName(i) + n
+		if c.numeric {
+			xw.sheet.WriteString(`<c r="` + ref + `"><v>` + c.value + `</v></c>`)
+			continue
+		}
+		xw.sheet.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(xw.sheet, []byte(xmlChars(c.value))); err != nil {
+			return fmt.Errorf("write XLSX row %d: %w", xw.row, err)
+		}
+		xw.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := xw.sheet.WriteString(`</row>`)
+	if err != nil {
+		return fmt.Errorf("write XLSX row %d: %w", xw.row, err)
+	}
+	return nil
+}
+
+func (xw *xlsxWriter) Close() error {
+	xw.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := xw.sheet.Flush(); err != nil {
+		return fmt.Errorf("write XLSX sheet: %w", err)
+	}
+	if err := xw.zip.Close(); err != nil {
+		return fmt.Errorf("close XLSX: %w", err)
+	}
+	return nil
+}
+
+// xmlChars removes the runes XML 1.0 does not allow, such as most C0 control
+// characters, which spreadsheet applications refuse to open.
+func xmlChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t', r == '\n', r == '\r',
+			r >= 0x20 && r <= 0xD7FF,
+			r >= 0xE000 && r <= 0xFFFD,
+			r >= 0x10000 && r <= 0x10FFFF:
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// columnName returns the spreadsheet column letters for a 0-based index (0 = A, 26 = AA).
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
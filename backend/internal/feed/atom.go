@@ -0,0 +1,133 @@
+// Package feed renders register change events as Atom 1.0 feeds (RFC 4287).
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"sponsor-tracker/internal/database"
+)
+
+// ContentType is the media type of an Atom feed.
+const ContentType = "application/atom+xml; charset=utf-8"
+
+// idPrefix starts every feed and entry ID. IDs are tag URIs (RFC 4151) so
+// they stay the same whatever host or path the feed is served from.
+const idPrefix = "tag:sponsor-tracker,2026:"
+
+// Feed is an Atom feed document.
+type Feed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Author  Person   `xml:"author"`
+	Links   []Link   `xml:"link"`
+	Entries []Entry  `xml:"entry"`
+}
+
+// Person is an Atom person construct.
+type Person struct {
+	Name string `xml:"name"`
+}
+
+// Link is an Atom link.
+type Link struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// Entry is a single change event in a feed.
+type Entry struct {
+	ID       string     `xml:"id"`
+	Title    string     `xml:"title"`
+	Updated  string     `xml:"updated"`
+	Category []Category `xml:"category"`
+	Content  Content    `xml:"content"`
+}
+
+// Category labels an entry with its event type and route.
+type Category struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+// Content is the plain text body of an entry.
+type Content struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// New builds a feed of events, newest first. key distinguishes the feed's ID
+// from other feeds' and must not change between requests for the same feed.
+// The feed's updated time is that of its newest event, or the Unix epoch if
+// it has none, so an unchanged feed renders identically.
+func New(key, title, selfURL string, events []database.ChangeEvent) Feed {
+	f := Feed{
+		ID:      idPrefix + key,
+		Title:   title,
+		Updated: formatTime(time.Unix(0, 0)),
+		Author:  Person{Name: "Sponsor Tracker"},
+		Links:   []Link{{Rel: "self", Href: selfURL, Type: "application/atom+xml"}},
+		Entries: []Entry{},
+	}
+	if len(events) > 0 {
+		f.Updated = formatTime(events[0].OccurredAt)
+	}
+	for _, ev := range events {
+		f.Entries = append(f.Entries, newEntry(ev))
+	}
+	return f
+}
+
+// Write writes the feed as an XML document.
+func Write(w io.Writer, f Feed) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("write feed: %w", err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return fmt.Errorf("write feed: %w", err)
+	}
+	return nil
+}
+
+// EntryID returns the stable ID of an event's entry; see database.ChangeEvent.Key.
+func EntryID(ev database.ChangeEvent) string {
+	return idPrefix + "change/" + ev.Key()
+}
+
+func newEntry(ev database.ChangeEvent) Entry {
+	e := Entry{
+		ID:       EntryID(ev),
+		Title:    ev.OrganisationName + " " + ev.Describe(),
+		Updated:  formatTime(ev.OccurredAt),
+		Category: []Category{{Term: ev.EventType}},
+		Content:  Content{Type: "text", Body: content(ev)},
+	}
+	if ev.Route != "" {
+		e.Category = append(e.Category, Category{Term: "route:" + ev.Route, Label: ev.Route})
+	}
+	return e
+}
+
+// content describes an event in full: the organisation, where it is, what
+// changed and when.
+func content(ev database.ChangeEvent) string {
+	s := ev.OrganisationName
+	switch {
+	case ev.TownCity != "" && ev.County != "":
+		s += " (" + ev.TownCity + ", " + ev.County + ")"
+	case ev.TownCity != "" || ev.County != "":
+		s += " (" + ev.TownCity + ev.County + ")"
+	}
+	return fmt.Sprintf("%s %s on %s.", s, ev.Describe(), ev.OccurredAt.UTC().Format("2 January 2006 at 15:04 MST"))
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
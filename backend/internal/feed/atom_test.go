@@ -0,0 +1,65 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"sponsor-tracker/internal/database"
+)
+
+func TestWrite(t *testing.T) {
+	lic := 70
+	events := []database.ChangeEvent{
+		{EventType: database.EventLicenceRerated, OccurredAt: time.Date(2026, 3, 2, 6, 0, 0, 123456000, time.UTC), OrganisationID: 7, OrganisationName: "Acme & Sons", TownCity: "Dover", County: "Kent",
+			LicenceID: &lic, LicenceType: "Worker", Route: "Skilled Worker", Rating: "B rating", PreviousRating: "A rating"},
+		{EventType: database.EventOrganisationAdded, OccurredAt: time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC), OrganisationID: 8, OrganisationName: "Beta Ltd", TownCity: "Leeds"},
+	}
+
+	var sb strings.Builder
+	if err := Write(&sb, New("changes", "Sponsor register changes", "http://example.test/api/feeds/changes.atom", events)); err != nil { t.Fatalf("write: %v", err) }
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <id>tag:sponsor-tracker,2026:changes</id>
+  <title>Sponsor register changes</title>
+  <updated>2026-03-02T06:00:00Z</updated>
+  <author>
+    <name>Sponsor Tracker</name>
+  </author>
+  <link rel="self" href="http://example.test/api/feeds/changes.atom" type="application/atom+xml"></link>
+  <entry>
+    <id>tag:sponsor-tracker,2026:change/licence_rerated/70/1772431200123456</id>
+    <title>Acme &amp; Sons Skilled Worker licence (Worker) re-rated from A rating to B rating</title>
+    <updated>2026-03-02T06:00:00Z</updated>
+    <category term="licence_rerated"></category>
+    <category term="route:Skilled Worker" label="Skilled Worker"></category>
+    <content type="text">Acme &amp; Sons (Dover, Kent) Skilled Worker licence (Worker) re-rated from A rating to B rating on 2 March 2026 at 06:00 UTC.</content>
+  </entry>
+  <entry>
+    <id>tag:sponsor-tracker,2026:change/organisation_added/8/1772344800000000</id>
+    <title>Beta Ltd added to the register</title>
+    <updated>2026-03-01T06:00:00Z</updated>
+    <category term="organisation_added"></category>
+    <content type="text">Beta Ltd (Leeds) added to the register on 1 March 2026 at 06:00 UTC.</content>
+  </entry>
+</feed>`
+	if got := sb.String(); got != want { t.Errorf("got:\n%s\nwant:\n%s", got, want) }
+}
+
+func TestNew_EmptyFeedHasFixedUpdatedTime(t *testing.T) {
+	f := New("changes", "t", "http://example.test/", nil)
+	if f.Updated != "1970-01-01T00:00:00Z" || len(f.Entries) != 0 { t.Errorf("feed = %+v", f) }
+}
+
+func TestEntryID_IsStable(t *testing.T) {
+	at := time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)
+	ev := database.ChangeEvent{EventType: database.EventOrganisationRemoved, OccurredAt: at, OrganisationID: 8, OrganisationName: "Beta Ltd"}
+	moved := ev
+	moved.OrganisationName, moved.TownCity, moved.OccurredAt = "Beta Limited", "York", at.In(time.FixedZone("BST", 3600))
+	if EntryID(ev) != EntryID(moved) { t.Errorf("ID changed with organisation details or time zone: %s != %s", EntryID(ev), EntryID(moved)) }
+
+	lic := 80
+	licEvent := database.ChangeEvent{EventType: database.EventLicenceRemoved, OccurredAt: at, OrganisationID: 8, LicenceID: &lic}
+	if EntryID(ev) == EntryID(licEvent) { t.Error("organisation and licence events share an ID") }
+}
@@ -0,0 +1,142 @@
+// Package lookup reads employer lists for bulk register lookups and writes
+// the results, in CSV or JSON.
+package lookup
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"sponsor-tracker/internal/database"
+)
+
+// Header names accepted for each input column, compared case-insensitively.
+var (
+	nameHeaders     = []string{"name", "employer", "organisation", "organisation name", "company"}
+	townHeaders     = []string{"town", "town_city", "town/city", "city"}
+	postcodeHeaders = []string{"postcode", "post code"}
+)
+
+// ReadCSV reads employers from CSV with a header row. A name column is
+// required; town and postcode columns are optional. Every data row is
+// returned, including blank ones, so results line up with the input rows.
+func ReadCSV(r io.Reader) ([]database.LookupInput, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	nameCol := findColumn(header, nameHeaders)
+	if nameCol < 0 {
+		return nil, fmt.Errorf("header has no name column (expected one of: %s)", strings.Join(nameHeaders, ", "))
+	}
+	townCol := findColumn(header, townHeaders)
+	postcodeCol := findColumn(header, postcodeHeaders)
+
+	inputs := []database.LookupInput{}
+	lineNumber := 1 // Header was line 1
+	for {
+		lineNumber++
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row %d: %w", lineNumber, err)
+		}
+		inputs = append(inputs, database.LookupInput{
+			Name:     field(row, nameCol),
+			TownCity: field(row, townCol),
+			Postcode: field(row, postcodeCol),
+		})
+	}
+	return inputs, nil
+}
+
+// findColumn returns the index of the first header matching one of names, or -1.
+func findColumn(header []string, names []string) int {
+	for i, h := range header {
+		// Excel prefixes UTF-8 CSV files with a byte order mark
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		for _, name := range names {
+			if h == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// field returns the trimmed value at index i, or "" if the row is too short.
+func field(row []string, i int) string {
+	if i < 0 || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// ReadJSON reads employers from a JSON array of objects with name, town and
+// postcode fields, or of plain name strings.
+func ReadJSON(r io.Reader) ([]database.LookupInput, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON: expected an array: %w", err)
+	}
+
+	inputs := make([]database.LookupInput, len(raw))
+	for i, item := range raw {
+		var name string
+		if err := json.Unmarshal(item, &name); err == nil {
+			inputs[i].Name = strings.TrimSpace(name)
+			continue
+		}
+		var in database.LookupInput
+		if err := json.Unmarshal(item, &in); err != nil {
+			return nil, fmt.Errorf("invalid JSON: item %d: expected a name or an object", i+1)
+		}
+		inputs[i] = database.LookupInput{
+			Name:     strings.TrimSpace(in.Name),
+			TownCity: strings.TrimSpace(in.TownCity),
+			Postcode: strings.TrimSpace(in.Postcode),
+		}
+	}
+	return inputs, nil
+}
+
+// WriteCSV writes one row per lookup result with its best match, if any.
+func WriteCSV(w io.Writer, results []database.LookupResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"row", "name", "town", "postcode", "status", "confidence",
+		"matched_name", "matched_town", "matched_county", "licences",
+	})
+	for _, res := range results {
+		record := []string{
+			strconv.Itoa(res.Row), res.Input.Name, res.Input.TownCity, res.Input.Postcode, res.Status,
+			"", "", "", "", "",
+		}
+		if len(res.Matches) > 0 {
+			m := res.Matches[0]
+			record[5] = strconv.FormatFloat(m.Confidence, 'f', 2, 64)
+			record[6], record[7], record[8] = m.Name, m.TownCity, m.County
+			record[9] = formatLicences(m.Licences)
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatLicences renders licences as "Worker: Skilled Worker (A rating); ...".
+func formatLicences(licences []database.RatedLicence) string {
+	parts := make([]string, len(licences))
+	for i, l := range licences {
+		parts[i] = fmt.Sprintf("%s: %s (%s)", l.LicenceType, l.Route, l.Rating)
+	}
+	return strings.Join(parts, "; ")
+}
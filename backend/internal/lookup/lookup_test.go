@@ -0,0 +1,58 @@
+package lookup
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sponsor-tracker/internal/database"
+)
+
+func TestReadCSV(t *testing.T) {
+	input := "\ufeffPostcode,Employer,Town/City\nCT17 9AA, Acme Ltd ,Dover\n,,\nLS1 1AA,Beta Ltd\n"
+	got, err := ReadCSV(strings.NewReader(input))
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	want := []database.LookupInput{
+		{Name: "Acme Ltd", TownCity: "Dover", Postcode: "CT17 9AA"},
+		{},
+		{Name: "Beta Ltd", Postcode: "LS1 1AA"},
+	}
+	if !reflect.DeepEqual(got, want) { t.Errorf("got %+v, want %+v", got, want) }
+
+	if _, err := ReadCSV(strings.NewReader("town,postcode\nDover,CT17\n")); err == nil {
+		t.Error("expected error when there is no name column")
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	got, err := ReadJSON(strings.NewReader(`["Acme Ltd", {"name": "Beta Ltd", "town": "Leeds", "postcode": "LS1 1AA"}]`))
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	want := []database.LookupInput{
+		{Name: "Acme Ltd"},
+		{Name: "Beta Ltd", TownCity: "Leeds", Postcode: "LS1 1AA"},
+	}
+	if !reflect.DeepEqual(got, want) { t.Errorf("got %+v, want %+v", got, want) }
+
+	for _, bad := range []string{`{"name": "Acme"}`, `[42]`, `not json`} {
+		if _, err := ReadJSON(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadJSON(%s): expected error", bad)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	results := []database.LookupResult{
+		{Row: 1, Input: database.LookupInput{Name: "Acme"}, Status: database.LookupMatched, Matches: []database.LookupMatch{{
+			Name: "Acme Ltd", TownCity: "Dover", County: "Kent", Confidence: 1,
+			Licences: []database.RatedLicence{{LicenceType: "Worker", Route: "Skilled Worker", Rating: "A rating"}},
+		}}},
+		{Row: 2, Input: database.LookupInput{Name: "Nobody"}, Status: database.LookupNotFound, Matches: []database.LookupMatch{}},
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, results); err != nil { t.Fatalf("unexpected error: %v", err) }
+	want := "row,name,town,postcode,status,confidence,matched_name,matched_town,matched_county,licences\n" +
+		"1,Acme,,,matched,1.00,Acme Ltd,Dover,Kent,Worker: Skilled Worker (A rating)\n" +
+		"2,Nobody,,,not_found,,,,,\n"
+	if buf.String() != want { t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want) }
+}
@@ -0,0 +1,171 @@
+// Package outbox delivers the change events that each sync writes to the
+// outbox table to the registered sinks, such as webhooks and email alerts.
+//
+// Each sink has its own cursor into the outbox and receives the events one
+// batch (one sync's changes) at a time. A sink's cursor only advances once it
+// has accepted a batch, so a batch is delivered at least once and may be
+// delivered again after a failure or restart; sinks use Batch.Key and the
+// events' keys to ignore repeats.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"sponsor-tracker/internal/database"
+)
+
+// Batch is the change events written by one sync.
+type Batch struct {
+	Key    string    // the same on every delivery of the batch
+	At     time.Time // when the sync made the changes
+	Events []database.ChangeEvent
+}
+
+// Sink receives batches of change events. Deliver returns an error if the
+// batch should be delivered again later.
+type Sink interface {
+	Deliver(ctx context.Context, b Batch) error
+}
+
+// Store is the subset of database operations needed by the dispatcher.
+type Store interface {
+	// Dispatch passes the next batch after a sink's cursor to deliver and
+	// advances the cursor past it if deliver succeeds. It returns false if
+	// there was no batch, or another dispatcher is delivering to the sink.
+	// A batch that is not acknowledged within the lease may be passed to
+	// another dispatcher.
+	Dispatch(ctx context.Context, sink string, deliver func(Batch) error) (bool, error)
+	// Prune deletes events written before cutoff that every sink has received.
+	Prune(ctx context.Context, sinks []string, cutoff time.Time) (int64, error)
+}
+
+const (
+	pollInterval  = 15 * time.Second
+	maxRetryDelay = 30 * time.Minute
+	retention     = 30 * 24 * time.Hour
+	// lease is how long a dispatcher has to deliver a batch before another
+	// may take it over. It covers a webhook delivery's retries of every chunk.
+	lease = 15 * time.Minute
+)
+
+// registration is a sink and its delivery state.
+type registration struct {
+	name     string
+	sink     Sink
+	failures int
+	retryAt  time.Time
+}
+
+// Dispatcher delivers outbox events to registered sinks.
+type Dispatcher struct {
+	store      Store
+	sinks      []*registration
+	lastPruned time.Time
+}
+
+func NewDispatcher(store Store) *Dispatcher {
+	return &Dispatcher{store: store}
+}
+
+// Register adds a sink under a name that identifies its cursor, so the name
+// must stay the same across restarts. A newly named sink starts with the
+// events written after it was first registered.
+func (d *Dispatcher) Register(name string, sink Sink) {
+	d.sinks = append(d.sinks, &registration{name: name, sink: sink})
+}
+
+// Run dispatches events every poll interval until ctx is cancelled, and
+// prunes delivered events older than the retention period once a day.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now().UTC()
+		if err := d.Dispatch(ctx, now); err != nil {
+			slog.Error("dispatch outbox", "error", err)
+		}
+		if now.Sub(d.lastPruned) >= 24*time.Hour {
+			d.prune(ctx, now)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch delivers every pending batch to each sink in turn. A sink that
+// fails is retried from the failed batch after a delay that doubles with each
+// consecutive failure, without holding up the other sinks.
+func (d *Dispatcher) Dispatch(ctx context.Context, now time.Time) error {
+	var errs []error
+	for _, reg := range d.sinks {
+		if now.Before(reg.retryAt) {
+			continue
+		}
+		if err := d.drain(ctx, reg); err != nil {
+			reg.failures++
+			reg.retryAt = now.Add(retryDelay(reg.failures))
+			errs = append(errs, fmt.Errorf("sink %s: %w", reg.name, err))
+			continue
+		}
+		reg.failures, reg.retryAt = 0, time.Time{}
+	}
+	return errors.Join(errs...)
+}
+
+// drain delivers batches to a sink until there are none left.
+func (d *Dispatcher) drain(ctx context.Context, reg *registration) error {
+	for {
+		delivered, err := d.store.Dispatch(ctx, reg.name, func(b Batch) error {
+			return reg.sink.Deliver(ctx, b)
+		})
+		if err != nil || !delivered {
+			return err
+		}
+	}
+}
+
+func (d *Dispatcher) prune(ctx context.Context, now time.Time) {
+	names := make([]string, len(d.sinks))
+	for i, reg := range d.sinks {
+		names[i] = reg.name
+	}
+	n, err := d.store.Prune(ctx, names, now.Add(-retention))
+	if err != nil {
+		slog.Error("prune outbox", "error", err)
+		return
+	}
+	d.lastPruned = now
+	if n > 0 {
+		slog.Info("pruned outbox", "events", n)
+	}
+}
+
+// retryDelay is the wait before retrying a sink after its nth consecutive failure.
+func retryDelay(n int) time.Duration {
+	delay := pollInterval << min(n-1, 10)
+	return min(delay, maxRetryDelay)
+}
+
+// LogSink writes every change event to the log.
+type LogSink struct{}
+
+func (LogSink) Deliver(_ context.Context, b Batch) error {
+	for _, ev := range b.Events {
+		slog.Info("register change",
+			"batch", b.Key,
+			"key", ev.Key(),
+			"event_type", ev.EventType,
+			"organisation_id", ev.OrganisationID,
+			"organisation", ev.OrganisationName,
+			"route", ev.Route,
+		)
+	}
+	return nil
+}
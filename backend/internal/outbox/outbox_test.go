@@ -0,0 +1,105 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeStore is an in-memory Store holding a queue of batches and each sink's position in it.
+type fakeStore struct {
+	batches []Batch
+	cursors map[string]int
+	pruned  []string
+}
+
+func (f *fakeStore) Dispatch(_ context.Context, sink string, deliver func(Batch) error) (bool, error) {
+	i := f.cursors[sink]
+	if i >= len(f.batches) {
+		return false, nil
+	}
+	if err := deliver(f.batches[i]); err != nil {
+		return false, err
+	}
+	f.cursors[sink] = i + 1
+	return true, nil
+}
+
+func (f *fakeStore) Prune(_ context.Context, sinks []string, _ time.Time) (int64, error) {
+	f.pruned = sinks
+	return 0, nil
+}
+
+type fakeSink struct {
+	received []string
+	err      error
+}
+
+func (f *fakeSink) Deliver(_ context.Context, b Batch) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.received = append(f.received, b.Key)
+	return nil
+}
+
+func TestDispatch_DeliversEveryBatchToEachSink(t *testing.T) {
+	store := &fakeStore{batches: []Batch{{Key: "sync:1"}, {Key: "sync:2"}}, cursors: map[string]int{}}
+	webhooks, email := &fakeSink{}, &fakeSink{}
+	d := NewDispatcher(store)
+	d.Register("webhook", webhooks)
+	d.Register("email", email)
+
+	if err := d.Dispatch(context.Background(), time.Now()); err != nil { t.Fatalf("dispatch: %v", err) }
+	for name, s := range map[string]*fakeSink{"webhook": webhooks, "email": email} {
+		if strings.Join(s.received, ",") != "sync:1,sync:2" { t.Errorf("%s received %v", name, s.received) }
+	}
+
+	// Nothing is delivered twice
+	if err := d.Dispatch(context.Background(), time.Now()); err != nil || len(webhooks.received) != 2 { t.Errorf("redispatch: %v, received %v", err, webhooks.received) }
+}
+
+func TestDispatch_FailingSinkBacksOffWithoutBlockingOthers(t *testing.T) {
+	store := &fakeStore{batches: []Batch{{Key: "sync:1"}}, cursors: map[string]int{}}
+	down, up := &fakeSink{err: errors.New("receiver down")}, &fakeSink{}
+	d := NewDispatcher(store)
+	d.Register("down", down)
+	d.Register("up", up)
+
+	now := time.Date(2026, 3, 12, 6, 0, 0, 0, time.UTC)
+	err := d.Dispatch(context.Background(), now)
+	if err == nil || !strings.Contains(err.Error(), "sink down: receiver down") { t.Errorf("err = %v", err) }
+	if len(up.received) != 1 { t.Errorf("healthy sink received %v", up.received) }
+
+	// The failed sink is not retried until its delay has passed, then resumes from the failed batch
+	down.err = nil
+	if err := d.Dispatch(context.Background(), now.Add(pollInterval-time.Second)); err != nil || len(down.received) != 0 { t.Errorf("retried early: %v, %v", err, down.received) }
+	if err := d.Dispatch(context.Background(), now.Add(pollInterval)); err != nil || len(down.received) != 1 { t.Errorf("retry: %v, %v", err, down.received) }
+}
+
+func TestRetryDelay(t *testing.T) {
+	for _, tt := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 15 * time.Second},
+		{2, 30 * time.Second},
+		{4, 2 * time.Minute},
+		{7, 16 * time.Minute},
+		{8, 30 * time.Minute},
+		{100, 30 * time.Minute},
+	} {
+		if got := retryDelay(tt.failures); got != tt.want { t.Errorf("retryDelay(%d) = %v, want %v", tt.failures, got, tt.want) }
+	}
+}
+
+func TestPrune_KeepsEventsForEverySink(t *testing.T) {
+	store := &fakeStore{cursors: map[string]int{}}
+	d := NewDispatcher(store)
+	d.Register("log", LogSink{})
+	d.Register("webhook", &fakeSink{})
+	d.prune(context.Background(), time.Now())
+	if strings.Join(store.pruned, ",") != "log,webhook" { t.Errorf("pruned for sinks %v", store.pruned) }
+}
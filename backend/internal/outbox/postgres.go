@@ -0,0 +1,54 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"sponsor-tracker/internal/database"
+)
+
+// PostgresStore implements Store using PostgreSQL.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+// Dispatch leases the sink's cursor, so each batch goes to one dispatcher at
+// a time, and delivers the batch outside any transaction before advancing
+// the cursor. If delivery fails the lease is released for a later retry; if
+// the process stops, the lease runs out and the batch is delivered again.
+func (s *PostgresStore) Dispatch(ctx context.Context, sink string, deliver func(Batch) error) (bool, error) {
+	if err := database.StartOutboxCursor(ctx, s.pool, sink); err != nil {
+		return false, err
+	}
+	claim, claimed, err := database.ClaimOutboxCursor(ctx, s.pool, sink, lease)
+	if err != nil || !claimed {
+		return false, err
+	}
+	events, err := database.GetOutboxBatch(ctx, s.pool, claim.LastEventID)
+	if err != nil || len(events) == 0 {
+		return false, errors.Join(err, database.ReleaseOutboxCursor(ctx, s.pool, claim))
+	}
+
+	b := Batch{Key: events[0].BatchKey, At: events[0].Event.OccurredAt, Events: make([]database.ChangeEvent, len(events))}
+	for i, e := range events {
+		b.Events[i] = e.Event
+	}
+	if err := deliver(b); err != nil {
+		return false, errors.Join(fmt.Errorf("deliver batch %s: %w", b.Key, err), database.ReleaseOutboxCursor(ctx, s.pool, claim))
+	}
+	if err := database.AdvanceOutboxCursor(ctx, s.pool, claim, events[len(events)-1].ID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, sinks []string, cutoff time.Time) (int64, error) {
+	return database.PruneOutbox(ctx, s.pool, sinks, cutoff)
+}
@@ -1,6 +1,8 @@
 package sync
 
 import (
+	"fmt"
+
 	"sponsor-tracker/internal/csvfetch"
 )
 
@@ -11,6 +13,14 @@ func NewGovUKFetcher() *GovUKFetcher {
 	return &GovUKFetcher{}
 }
 
-func (f *GovUKFetcher) FetchRecords() ([]csvfetch.Record, error) {
-	return csvfetch.DiscoverAndFetch()
+func (f *GovUKFetcher) FetchRecords() ([]csvfetch.Record, string, error) {
+	url, err := csvfetch.DiscoverCSVURL()
+	if err != nil {
+		return nil, "", fmt.Errorf("discover CSV URL: %w", err)
+	}
+	records, err := csvfetch.FetchAndParse(url)
+	if err != nil {
+		return nil, url, err
+	}
+	return records, url, nil
 }
@@ -13,8 +13,8 @@ type switchableFetcher struct {
 	records []csvfetch.Record
 }
 
-func (f *switchableFetcher) FetchRecords() ([]csvfetch.Record, error) {
-	return f.records, nil
+func (f *switchableFetcher) FetchRecords() ([]csvfetch.Record, string, error) {
+	return f.records, "https://example.test/sponsors.csv", nil
 }
 
 func TestIntegration_OrgMovesAndReturns(t *testing.T) {
@@ -27,9 +27,10 @@ func TestIntegration_OrgMovesAndReturns(t *testing.T) {
 	licences := NewPostgresLicenceRepository(pool)
 	cfg := NewPostgresConfigRepository(pool)
 	runs := NewPostgresSyncRunRepository(pool)
+	snapshots := NewPostgresSnapshotRepository(pool)
 
 	fetcher := &switchableFetcher{}
-	s := NewSyncer(fetcher, orgs, licences, cfg, runs)
+	s := NewSyncer(fetcher, orgs, licences, cfg, runs, snapshots, NewPostgresTransactor(pool), NewPostgresOutboxRepository(pool))
 
 	// Day 1: initial run — StaffCo in Leeds
 	fetcher.records = []csvfetch.Record{
@@ -210,4 +211,14 @@ func TestIntegration_OrgMovesAndReturns(t *testing.T) {
 	if lics[2].validTo != nil {
 		t.Error("licence 3: valid_to should be NULL (still active)")
 	}
+
+	// Day 1 loaded the register without changes; days 2 and 3 each wrote a batch
+	var events, batches int
+	err = pool.QueryRow(ctx, "SELECT COUNT(*), COUNT(DISTINCT batch_key) FROM outbox_events").Scan(&events, &batches)
+	if err != nil {
+		t.Fatalf("count outbox events: %v", err)
+	}
+	if events == 0 || batches != 2 {
+		t.Errorf("got %d outbox events in %d batches, want 2 batches", events, batches)
+	}
 }
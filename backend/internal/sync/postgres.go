@@ -2,11 +2,50 @@ package sync
 
 import (
 	"context"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"sponsor-tracker/internal/database"
 )
 
+// txKey is the context key of the transaction started by PostgresTransactor.
+type txKey struct{}
+
+// PostgresTransactor implements Transactor using PostgreSQL. The outermost
+// transaction takes the register lock (see database.LockRegister) and nested
+// ones are savepoints. The Postgres repositories write through the
+// transaction carried by the context, if any.
+type PostgresTransactor struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresTransactor(pool *pgxpool.Pool) *PostgresTransactor {
+	return &PostgresTransactor{pool: pool}
+}
+
+func (t *PostgresTransactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return pgx.BeginFunc(ctx, tx, func(sp pgx.Tx) error {
+			return fn(context.WithValue(ctx, txKey{}, sp))
+		})
+	}
+	return pgx.BeginFunc(ctx, t.pool, func(tx pgx.Tx) error {
+		if err := database.LockRegister(ctx, tx); err != nil {
+			return err
+		}
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// querier returns the transaction carried by ctx, or pool outside one.
+func querier(ctx context.Context, pool *pgxpool.Pool) database.Querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return pool
+}
+
 // PostgresOrgRepository implements OrgRepository using PostgreSQL.
 type PostgresOrgRepository struct {
 	pool *pgxpool.Pool
@@ -17,19 +56,26 @@ func NewPostgresOrgRepository(pool *pgxpool.Pool) *PostgresOrgRepository {
 }
 
 func (r *PostgresOrgRepository) Find(ctx context.Context, name, townCity, county string) (database.Organisation, bool, error) {
-	return database.FindActiveOrganisation(ctx, r.pool, name, townCity, county)
+	return database.FindActiveOrganisation(ctx, querier(ctx, r.pool), name, townCity, county)
 }
 
 func (r *PostgresOrgRepository) Insert(ctx context.Context, org database.Organisation, initialRun bool) (int, error) {
-	return database.InsertOrganisation(ctx, r.pool, org, initialRun)
+	return database.InsertOrganisation(ctx, querier(ctx, r.pool), org, initialRun)
 }
 
+// Close closes an organisation and carries its team notes and tags over to
+// its new version if it was closed because it moved.
 func (r *PostgresOrgRepository) Close(ctx context.Context, orgID int) error {
-	return database.CloseOrganisation(ctx, r.pool, orgID)
+	q := querier(ctx, r.pool)
+	if err := database.CloseOrganisation(ctx, q, orgID); err != nil {
+		return err
+	}
+	_, _, err := database.CarryAnnotations(ctx, q, orgID)
+	return err
 }
 
 func (r *PostgresOrgRepository) GetAllActive(ctx context.Context) ([]database.Organisation, error) {
-	return database.GetAllActiveOrganisationsUnfiltered(ctx, r.pool)
+	return database.GetAllActiveOrganisationsUnfiltered(ctx, querier(ctx, r.pool))
 }
 
 // PostgresLicenceRepository implements LicenceRepository using PostgreSQL.
@@ -42,19 +88,19 @@ func NewPostgresLicenceRepository(pool *pgxpool.Pool) *PostgresLicenceRepository
 }
 
 func (r *PostgresLicenceRepository) FindActive(ctx context.Context, orgID int, licenceType, route string) (database.Licence, bool, error) {
-	return database.FindActiveLicence(ctx, r.pool, orgID, licenceType, route)
+	return database.FindActiveLicence(ctx, querier(ctx, r.pool), orgID, licenceType, route)
 }
 
 func (r *PostgresLicenceRepository) Insert(ctx context.Context, lic database.Licence, initialRun bool) (int, error) {
-	return database.InsertLicence(ctx, r.pool, lic, initialRun)
+	return database.InsertLicence(ctx, querier(ctx, r.pool), lic, initialRun)
 }
 
 func (r *PostgresLicenceRepository) Close(ctx context.Context, licenceID int) error {
-	return database.CloseLicence(ctx, r.pool, licenceID)
+	return database.CloseLicence(ctx, querier(ctx, r.pool), licenceID)
 }
 
 func (r *PostgresLicenceRepository) GetAllActive(ctx context.Context) ([]database.Licence, error) {
-	return database.GetAllActiveLicences(ctx, r.pool)
+	return database.GetAllActiveLicences(ctx, querier(ctx, r.pool))
 }
 
 // PostgresConfigRepository implements ConfigRepository using PostgreSQL.
@@ -67,15 +113,15 @@ func NewPostgresConfigRepository(pool *pgxpool.Pool) *PostgresConfigRepository {
 }
 
 func (r *PostgresConfigRepository) GetValue(ctx context.Context, name, key string) (string, bool, error) {
-	return database.GetConfigValue(ctx, r.pool, name, key)
+	return database.GetConfigValue(ctx, querier(ctx, r.pool), name, key)
 }
 
 func (r *PostgresConfigRepository) SetValue(ctx context.Context, name, key, value string) error {
-	return database.SetConfigValue(ctx, r.pool, name, key, value)
+	return database.SetConfigValue(ctx, querier(ctx, r.pool), name, key, value)
 }
 
 func (r *PostgresConfigRepository) GetInitialRunTime(ctx context.Context) (string, bool, error) {
-	return database.GetInitialRunTime(ctx, r.pool)
+	return database.GetInitialRunTime(ctx, querier(ctx, r.pool))
 }
 
 // PostgresSyncRunRepository implements SyncRunRepository using PostgreSQL.
@@ -91,3 +137,28 @@ func (r *PostgresSyncRunRepository) Insert(ctx context.Context, run database.Syn
 	return database.InsertSyncRun(ctx, r.pool, run)
 }
 
+// PostgresSnapshotRepository implements SnapshotRepository using PostgreSQL.
+type PostgresSnapshotRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresSnapshotRepository(pool *pgxpool.Pool) *PostgresSnapshotRepository {
+	return &PostgresSnapshotRepository{pool: pool}
+}
+
+func (r *PostgresSnapshotRepository) Refresh(ctx context.Context, date time.Time) error {
+	return database.RefreshDailySnapshot(ctx, r.pool, date)
+}
+
+// PostgresOutboxRepository implements OutboxRepository using PostgreSQL.
+type PostgresOutboxRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresOutboxRepository(pool *pgxpool.Pool) *PostgresOutboxRepository {
+	return &PostgresOutboxRepository{pool: pool}
+}
+
+func (r *PostgresOutboxRepository) Write(ctx context.Context) (int, error) {
+	return database.WriteOutbox(ctx, querier(ctx, r.pool))
+}
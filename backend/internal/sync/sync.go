@@ -2,8 +2,10 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	"sponsor-tracker/internal/csvfetch"
@@ -21,17 +23,43 @@ const (
 
 // Result holds statistics from a sync operation.
 type Result struct {
-	NewOrganisations    int
-	NewLicences         int
-	ChangedLicences     int
-	ClosedOrganisations int
-	ClosedLicences      int
-	Errors              []error
+	CSVURL              string                  `json:"csv_url"`
+	NewOrganisations    int                     `json:"new_organisations"`
+	NewLicences         int                     `json:"new_licences"`
+	ChangedLicences     int                     `json:"changed_licences"`
+	ClosedOrganisations int                     `json:"closed_organisations"`
+	ClosedLicences      int                     `json:"closed_licences"`
+	Errors              []database.SyncRunError `json:"errors"`
 }
 
-// CSVFetcher fetches sponsor licence records
+// stageError tags an error with the sync stage it occurred in.
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string { return e.err.Error() }
+func (e *stageError) Unwrap() error { return e.err }
+
+// recordError describes a failure to sync a CSV record.
+func recordError(rec csvfetch.Record, err error) database.SyncRunError {
+	stage := database.StageUnknown
+	var se *stageError
+	if errors.As(err, &se) {
+		stage = se.stage
+	}
+	return database.SyncRunError{
+		Stage:            stage,
+		OrganisationName: rec.OrganisationName,
+		LicenceType:      rec.LicenceType,
+		Route:            rec.Route,
+		Message:          err.Error(),
+	}
+}
+
+// CSVFetcher fetches sponsor licence records and reports the URL they came from.
 type CSVFetcher interface {
-	FetchRecords() ([]csvfetch.Record, error)
+	FetchRecords() ([]csvfetch.Record, string, error)
 }
 
 // OrgRepository handles organisation database operations
@@ -62,23 +90,48 @@ type SyncRunRepository interface {
 	Insert(ctx context.Context, run database.SyncRun) (int, error)
 }
 
+// SnapshotRepository refreshes the daily aggregate snapshots.
+type SnapshotRepository interface {
+	Refresh(ctx context.Context, date time.Time) error
+}
+
+// Transactor runs functions in a database transaction carried by the context
+// passed to them. A call made inside another's transaction runs in a nested
+// transaction, so its failure is rolled back without aborting the outer one.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// OutboxRepository records register changes for delivery to subscribers.
+type OutboxRepository interface {
+	// Write writes the change events made in the current transaction to the
+	// outbox and returns how many it wrote.
+	Write(ctx context.Context) (int, error)
+}
+
 // Syncer synchronises the database with gov.uk data
 type Syncer struct {
-	fetcher  CSVFetcher
-	orgs     OrgRepository
-	licences LicenceRepository
-	config   ConfigRepository
-	runs     SyncRunRepository
+	fetcher   CSVFetcher
+	orgs      OrgRepository
+	licences  LicenceRepository
+	config    ConfigRepository
+	runs      SyncRunRepository
+	snapshots SnapshotRepository
+	tx        Transactor
+	outbox    OutboxRepository
 }
 
 // NewSyncer creates a Syncer with the given dependencies.
-func NewSyncer(fetcher CSVFetcher, orgs OrgRepository, licences LicenceRepository, config ConfigRepository, runs SyncRunRepository) *Syncer {
+func NewSyncer(fetcher CSVFetcher, orgs OrgRepository, licences LicenceRepository, config ConfigRepository, runs SyncRunRepository, snapshots SnapshotRepository, tx Transactor, outbox OutboxRepository) *Syncer {
 	return &Syncer{
-		fetcher:  fetcher,
-		orgs:     orgs,
-		licences: licences,
-		config:   config,
-		runs:     runs,
+		fetcher:   fetcher,
+		orgs:      orgs,
+		licences:  licences,
+		config:    config,
+		runs:      runs,
+		snapshots: snapshots,
+		tx:        tx,
+		outbox:    outbox,
 	}
 }
 
@@ -86,7 +139,7 @@ func NewSyncer(fetcher CSVFetcher, orgs OrgRepository, licences LicenceRepositor
 // It checks the config table to determine if this is the initial run.
 func (s *Syncer) Run(ctx context.Context) (*Result, error) {
 	startTime := time.Now().UTC()
-	result := &Result{}
+	result := &Result{Errors: []database.SyncRunError{}}
 
 	_, initialRunTimeHasValue, err := s.config.GetInitialRunTime(ctx)
 	initialRun := !initialRunTimeHasValue
@@ -95,33 +148,52 @@ func (s *Syncer) Run(ctx context.Context) (*Result, error) {
 	}
 	slog.Info("sync starting", "initial_run", initialRun)
 
-	records, err := s.fetcher.FetchRecords()
+	records, csvURL, err := s.fetcher.FetchRecords()
 	if err != nil {
 		return nil, fmt.Errorf("fetch CSV: %w", err)
 	}
-	slog.Info("fetched sponsor list", "count", len(records))
+	result.CSVURL = csvURL
+	slog.Info("fetched sponsor list", "count", len(records), "url", csvURL)
 
-	seenOrgs := make(map[int]bool)
-	seenLicences := make(map[int]bool)
-	for _, rec := range records {
-		orgID, licID, err := s.processRecord(ctx, rec, initialRun, result)
-		if err != nil {
-			result.Errors = append(result.Errors, err)
-			continue
+	// The register update and its change events are committed together, so
+	// no change is visible without its event or recorded without the change
+	var written int
+	err = s.tx.InTx(ctx, func(ctx context.Context) error {
+		seenOrgs := make(map[int]bool)
+		seenLicences := make(map[int]bool)
+		inChunks(ctx, s.tx, records, recordChunks,
+			func(ctx context.Context, rec csvfetch.Record) (func(), error) {
+				return s.syncRecord(ctx, rec, initialRun, result, seenOrgs, seenLicences)
+			},
+			func(rec csvfetch.Record, err error) { result.Errors = append(result.Errors, recordError(rec, err)) },
+		)
+
+		if !initialRun {
+			s.closeStale(ctx, seenOrgs, seenLicences, result)
 		}
-		seenOrgs[orgID] = true
-		seenLicences[licID] = true
-	}
 
-	if !initialRun {
-		s.closeStale(ctx, seenOrgs, seenLicences, result)
-	}
+		if initialRun {
+			now := time.Now().UTC().Format(time.RFC3339)
+			if err := s.config.SetValue(ctx, "InitialRunDateTime", "Default", now); err != nil {
+				return fmt.Errorf("set initial run time: %w", err)
+			}
+		}
 
-	if initialRun {
-		now := time.Now().UTC().Format(time.RFC3339)
-		if err := s.config.SetValue(ctx, "InitialRunDateTime", "Default", now); err != nil {
-			return result, fmt.Errorf("set initial run time: %w", err)
+		var err error
+		if written, err = s.outbox.Write(ctx); err != nil {
+			return fmt.Errorf("write outbox: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("update register: %w", err)
+	}
+
+	// A stale snapshot is corrected by the next run or a backfill, so a
+	// failure here is recorded against the run rather than failing it
+	if err := s.snapshots.Refresh(ctx, time.Now().UTC()); err != nil {
+		slog.Error("refresh daily snapshot", "error", err)
+		result.Errors = append(result.Errors, database.SyncRunError{Stage: database.StageSnapshot, Message: err.Error()})
 	}
 
 	slog.Info("sync complete",
@@ -130,18 +202,21 @@ func (s *Syncer) Run(ctx context.Context) (*Result, error) {
 		"changed_licences", result.ChangedLicences,
 		"closed_organisations", result.ClosedOrganisations,
 		"closed_licences", result.ClosedLicences,
+		"outbox_events", written,
 		"errors", len(result.Errors),
 	)
 
 	run := database.SyncRun{
 		StartTime:           startTime,
 		EndTime:             time.Now().UTC(),
+		CSVURL:              result.CSVURL,
 		NewOrganisations:    result.NewOrganisations,
 		NewLicences:         result.NewLicences,
 		ChangedLicences:     result.ChangedLicences,
 		ClosedOrganisations: result.ClosedOrganisations,
 		ClosedLicences:      result.ClosedLicences,
 		ErrorCount:          len(result.Errors),
+		Errors:              result.Errors,
 	}
 	if _, err := s.runs.Insert(ctx, run); err != nil {
 		return result, fmt.Errorf("record sync run: %w", err)
@@ -150,12 +225,30 @@ func (s *Syncer) Run(ctx context.Context) (*Result, error) {
 	return result, nil
 }
 
+// syncRecord processes a record and returns a function that counts its
+// outcome and marks its organisation and licence as seen, to be called once
+// the record's writes are committed.
+func (s *Syncer) syncRecord(ctx context.Context, rec csvfetch.Record, initialRun bool, result *Result, seenOrgs, seenLicences map[int]bool) (func(), error) {
+	counts := &Result{}
+	orgID, licID, err := s.processRecord(ctx, rec, initialRun, counts)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		result.NewOrganisations += counts.NewOrganisations
+		result.NewLicences += counts.NewLicences
+		result.ChangedLicences += counts.ChangedLicences
+		seenOrgs[orgID] = true
+		seenLicences[licID] = true
+	}, nil
+}
+
 // processRecord syncs a single CSV record. Returns the active orgID and licenceID
 // for stale record detection, or an error.
 func (s *Syncer) processRecord(ctx context.Context, rec csvfetch.Record, initialRun bool, result *Result) (int, int, error) {
 	orgID, isNew, err := s.processOrg(ctx, rec, initialRun)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, &stageError{database.StageOrganisation, err}
 	}
 	if isNew {
 		result.NewOrganisations++
@@ -163,7 +256,7 @@ func (s *Syncer) processRecord(ctx context.Context, rec csvfetch.Record, initial
 
 	licID, outcome, err := s.processLicence(ctx, orgID, rec, initialRun)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, &stageError{database.StageLicence, err}
 	}
 	switch outcome {
 	case LicenceNew:
@@ -224,31 +317,98 @@ func (s *Syncer) processLicence(ctx context.Context, orgID int, rec csvfetch.Rec
 func (s *Syncer) closeStale(ctx context.Context, seenOrgs, seenLicences map[int]bool, result *Result) {
 	activeOrgs, err := s.orgs.GetAllActive(ctx)
 	if err != nil {
-		result.Errors = append(result.Errors, fmt.Errorf("get active orgs: %w", err))
+		result.Errors = append(result.Errors, staleError(fmt.Errorf("get active orgs: %w", err)))
 		return
 	}
-	for _, org := range activeOrgs {
-		if !seenOrgs[org.ID] {
+	staleOrgs := slices.DeleteFunc(activeOrgs, func(org database.Organisation) bool { return seenOrgs[org.ID] })
+	inChunks(ctx, s.tx, staleOrgs, staleChunks,
+		func(ctx context.Context, org database.Organisation) (func(), error) {
 			if err := s.orgs.Close(ctx, org.ID); err != nil {
-				result.Errors = append(result.Errors, fmt.Errorf("close org %q: %w", org.Name, err))
-				continue
+				return nil, err
 			}
-			result.ClosedOrganisations++
-		}
-	}
+			return func() { result.ClosedOrganisations++ }, nil
+		},
+		func(org database.Organisation, err error) {
+			e := staleError(fmt.Errorf("close org %q: %w", org.Name, err))
+			e.OrganisationName = org.Name
+			result.Errors = append(result.Errors, e)
+		},
+	)
 
 	activeLicences, err := s.licences.GetAllActive(ctx)
 	if err != nil {
-		result.Errors = append(result.Errors, fmt.Errorf("get active licences: %w", err))
+		result.Errors = append(result.Errors, staleError(fmt.Errorf("get active licences: %w", err)))
 		return
 	}
-	for _, lic := range activeLicences {
-		if !seenLicences[lic.ID] {
+	staleLicences := slices.DeleteFunc(activeLicences, func(lic database.Licence) bool { return seenLicences[lic.ID] })
+	inChunks(ctx, s.tx, staleLicences, staleChunks,
+		func(ctx context.Context, lic database.Licence) (func(), error) {
 			if err := s.licences.Close(ctx, lic.ID); err != nil {
-				result.Errors = append(result.Errors, fmt.Errorf("close licence %d: %w", lic.ID, err))
-				continue
+				return nil, err
+			}
+			return func() { result.ClosedLicences++ }, nil
+		},
+		func(lic database.Licence, err error) {
+			e := staleError(fmt.Errorf("close licence %d: %w", lic.ID, err))
+			e.LicenceType = lic.LicenceType
+			e.Route = lic.Route
+			result.Errors = append(result.Errors, e)
+		},
+	)
+}
+
+// staleError describes a failure while closing stale records.
+func staleError(err error) database.SyncRunError {
+	return database.SyncRunError{Stage: database.StageCloseStale, Message: err.Error()}
+}
+
+// The register update runs in one transaction, and each chunk of writes in a
+// nested one. PostgreSQL tracks up to 64 subtransactions per transaction
+// before spilling them to disk, so a sync uses at most recordChunks for the
+// CSV records and staleChunks for each kind of stale close, plus one per
+// failed item.
+const (
+	recordChunks = 48
+	staleChunks  = 4
+)
+
+// inChunks calls fn for each item, splitting the items into at most chunks
+// nested transactions. fn returns a function applying the item's outcome,
+// which is called only once its chunk has committed. If fn fails for an item,
+// its chunk is rolled back, skip is called with the item and the error, and
+// the items before it in the chunk are run again.
+func inChunks[T any](ctx context.Context, tx Transactor, items []T, chunks int, fn func(context.Context, T) (func(), error), skip func(T, error)) {
+	size := max((len(items)+chunks-1)/chunks, 1)
+	for len(items) > 0 {
+		chunk := items[:min(size, len(items))]
+		var applied []func()
+		var failErr error
+		failed := -1
+		err := tx.InTx(ctx, func(ctx context.Context) error {
+			for i, item := range chunk {
+				apply, err := fn(ctx, item)
+				if err != nil {
+					failed, failErr = i, err
+					return err
+				}
+				applied = append(applied, apply)
+			}
+			return nil
+		})
+		switch {
+		case err == nil:
+			for _, apply := range applied {
+				apply()
+			}
+		case failed >= 0:
+			skip(chunk[failed], failErr)
+			inChunks(ctx, tx, chunk[:failed], 1, fn, skip)
+			chunk = chunk[:failed+1]
+		default:
+			for _, item := range chunk {
+				skip(item, err)
 			}
-			result.ClosedLicences++
 		}
+		items = items[len(chunk):]
 	}
 }
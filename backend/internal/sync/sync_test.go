@@ -2,7 +2,12 @@ package sync
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"sponsor-tracker/internal/csvfetch"
 	"sponsor-tracker/internal/database"
@@ -61,8 +66,9 @@ type mockCSVFetcher struct {
 	fetchFn func() ([]csvfetch.Record, error)
 }
 
-func (m *mockCSVFetcher) FetchRecords() ([]csvfetch.Record, error) {
-	return m.fetchFn()
+func (m *mockCSVFetcher) FetchRecords() ([]csvfetch.Record, string, error) {
+	records, err := m.fetchFn()
+	return records, "https://example.test/sponsors.csv", err
 }
 
 // mockConfigRepo implements ConfigRepository for testing.
@@ -102,6 +108,52 @@ func noOpSyncRunRepo() *mockSyncRunRepo {
 	}
 }
 
+type mockSnapshotRepo struct {
+	refreshFn func(ctx context.Context, date time.Time) error
+}
+
+func (m *mockSnapshotRepo) Refresh(ctx context.Context, date time.Time) error {
+	return m.refreshFn(ctx, date)
+}
+
+// noOpSnapshotRepo returns a mock that silently accepts refreshes.
+func noOpSnapshotRepo() *mockSnapshotRepo {
+	return &mockSnapshotRepo{
+		refreshFn: func(_ context.Context, _ time.Time) error { return nil },
+	}
+}
+
+// mockTransactor implements Transactor by calling fn directly, recording
+// how deeply transactions are nested.
+type mockTransactor struct {
+	depth  int
+	nested int
+}
+
+func (m *mockTransactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if m.depth > 0 {
+		m.nested++
+	}
+	m.depth++
+	defer func() { m.depth-- }()
+	return fn(ctx)
+}
+
+type mockOutboxRepo struct {
+	writeFn func(ctx context.Context) (int, error)
+}
+
+func (m *mockOutboxRepo) Write(ctx context.Context) (int, error) {
+	return m.writeFn(ctx)
+}
+
+// noOpOutboxRepo returns a mock that silently accepts writes.
+func noOpOutboxRepo() *mockOutboxRepo {
+	return &mockOutboxRepo{
+		writeFn: func(_ context.Context) (int, error) { return 0, nil },
+	}
+}
+
 func TestProcessOrg_ExistingOrg_ReturnsIDAndFalse(t *testing.T) {
 	orgs := &mockOrgRepo{
 		findFn: func(_ context.Context, name, townCity, county string) (database.Organisation, bool, error) {
@@ -110,7 +162,7 @@ func TestProcessOrg_ExistingOrg_ReturnsIDAndFalse(t *testing.T) {
 		},
 	}
 
-	s := NewSyncer(nil, orgs, nil, nil, nil)
+	s := NewSyncer(nil, orgs, nil, nil, nil, nil, nil, nil)
 	rec := csvfetch.Record{OrganisationName: "Acme Ltd", TownCity: "London", County: "Greater London"}
 
 	id, isNew, err := s.processOrg(context.Background(), rec, false)
@@ -131,7 +183,7 @@ func TestProcessOrg_NewOrg_InsertsAndReturnsID(t *testing.T) {
 		},
 	}
 
-	s := NewSyncer(nil, orgs, nil, nil, nil)
+	s := NewSyncer(nil, orgs, nil, nil, nil, nil, nil, nil)
 	rec := csvfetch.Record{OrganisationName: "New Corp", TownCity: "Manchester", County: "Greater Manchester"}
 
 	id, isNew, err := s.processOrg(context.Background(), rec, false)
@@ -152,7 +204,7 @@ func TestProcessLicence_NewLicence_ReturnsLicenceNew(t *testing.T) {
 		},
 	}
 
-	s := NewSyncer(nil, nil, licences, nil, nil)
+	s := NewSyncer(nil, nil, licences, nil, nil, nil, nil, nil)
 	rec := csvfetch.Record{LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"}
 
 	id, result, err := s.processLicence(context.Background(), 42, rec, false)
@@ -169,7 +221,7 @@ func TestProcessLicence_Unchanged_ReturnsLicenceUnchanged(t *testing.T) {
 		},
 	}
 
-	s := NewSyncer(nil, nil, licences, nil, nil)
+	s := NewSyncer(nil, nil, licences, nil, nil, nil, nil, nil)
 	rec := csvfetch.Record{LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"}
 
 	id, result, err := s.processLicence(context.Background(), 42, rec, false)
@@ -197,7 +249,7 @@ func TestProcessLicence_ChangedRating_ClosesAndInserts(t *testing.T) {
 		},
 	}
 
-	s := NewSyncer(nil, nil, licences, nil, nil)
+	s := NewSyncer(nil, nil, licences, nil, nil, nil, nil, nil)
 	rec := csvfetch.Record{LicenceType: "Worker", Rating: "B rating", Route: "Skilled Worker"}
 
 	id, result, err := s.processLicence(context.Background(), 42, rec, false)
@@ -259,7 +311,7 @@ func TestRun_SubsequentRun_ClosesStaleRecords(t *testing.T) {
 		},
 	}
 
-	s := NewSyncer(fetcher, orgs, licences, cfg, noOpSyncRunRepo())
+	s := NewSyncer(fetcher, orgs, licences, cfg, noOpSyncRunRepo(), noOpSnapshotRepo(), &mockTransactor{}, noOpOutboxRepo())
 	result, err := s.Run(context.Background())
 	if err != nil { t.Fatalf("unexpected error: %v", err) }
 
@@ -320,7 +372,7 @@ func TestRun_InitialRun_SkipsStaleDetectionAndSetsConfig(t *testing.T) {
 		},
 	}
 
-	s := NewSyncer(fetcher, orgs, licences, cfg, noOpSyncRunRepo())
+	s := NewSyncer(fetcher, orgs, licences, cfg, noOpSyncRunRepo(), noOpSnapshotRepo(), &mockTransactor{}, noOpOutboxRepo())
 	result, err := s.Run(context.Background())
 	if err != nil { t.Fatalf("unexpected error: %v", err) }
 
@@ -330,3 +382,238 @@ func TestRun_InitialRun_SkipsStaleDetectionAndSetsConfig(t *testing.T) {
 	if result.ClosedOrganisations != 0 { t.Errorf("got %d closed orgs, want 0", result.ClosedOrganisations) }
 	if result.ClosedLicences != 0 { t.Errorf("got %d closed licences, want 0", result.ClosedLicences) }
 }
+
+func TestRun_RecordsSyncRunWithURLAndErrors(t *testing.T) {
+	var recorded database.SyncRun
+
+	fetcher := &mockCSVFetcher{
+		fetchFn: func() ([]csvfetch.Record, error) {
+			return []csvfetch.Record{
+				{OrganisationName: "Broken Ltd", TownCity: "London", LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"},
+			}, nil
+		},
+	}
+	orgs := &mockOrgRepo{
+		findFn: func(_ context.Context, _, _, _ string) (database.Organisation, bool, error) {
+			return database.Organisation{}, false, errors.New("db down")
+		},
+	}
+	cfg := &mockConfigRepo{
+		getInitialRunTimeFn: func(_ context.Context) (string, bool, error) { return "", false, nil },
+		setValueFn:          func(_ context.Context, _, _, _ string) error { return nil },
+	}
+	runs := &mockSyncRunRepo{
+		insertFn: func(_ context.Context, run database.SyncRun) (int, error) {
+			recorded = run
+			return 1, nil
+		},
+	}
+
+	s := NewSyncer(fetcher, orgs, nil, cfg, runs, noOpSnapshotRepo(), &mockTransactor{}, noOpOutboxRepo())
+	result, err := s.Run(context.Background())
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+
+	if result.CSVURL != "https://example.test/sponsors.csv" { t.Errorf("result CSVURL = %q", result.CSVURL) }
+	if recorded.CSVURL != result.CSVURL { t.Errorf("recorded CSVURL = %q, want %q", recorded.CSVURL, result.CSVURL) }
+	if recorded.ErrorCount != 1 { t.Errorf("recorded ErrorCount = %d, want 1", recorded.ErrorCount) }
+	if len(recorded.Errors) != 1 { t.Fatalf("recorded %d errors, want 1", len(recorded.Errors)) }
+	e := recorded.Errors[0]
+	if e.Stage != database.StageOrganisation { t.Errorf("stage = %q, want %q", e.Stage, database.StageOrganisation) }
+	if e.OrganisationName != "Broken Ltd" || e.LicenceType != "Worker" || e.Route != "Skilled Worker" { t.Errorf("record context = %+v", e) }
+	if !strings.Contains(e.Message, "db down") { t.Errorf("message = %q", e.Message) }
+}
+
+func TestRun_SnapshotFailureIsRecordedNotFatal(t *testing.T) {
+	var recorded database.SyncRun
+	var refreshed time.Time
+
+	fetcher := &mockCSVFetcher{
+		fetchFn: func() ([]csvfetch.Record, error) { return []csvfetch.Record{}, nil },
+	}
+	cfg := &mockConfigRepo{
+		getInitialRunTimeFn: func(_ context.Context) (string, bool, error) { return "", false, nil },
+		setValueFn:          func(_ context.Context, _, _, _ string) error { return nil },
+	}
+	runs := &mockSyncRunRepo{
+		insertFn: func(_ context.Context, run database.SyncRun) (int, error) {
+			recorded = run
+			return 1, nil
+		},
+	}
+	snapshots := &mockSnapshotRepo{
+		refreshFn: func(_ context.Context, date time.Time) error {
+			refreshed = date
+			return errors.New("db down")
+		},
+	}
+
+	s := NewSyncer(fetcher, nil, nil, cfg, runs, snapshots, &mockTransactor{}, noOpOutboxRepo())
+	if _, err := s.Run(context.Background()); err != nil { t.Fatalf("unexpected error: %v", err) }
+
+	if refreshed.IsZero() { t.Error("snapshot was not refreshed") }
+	if len(recorded.Errors) != 1 { t.Fatalf("recorded %d errors, want 1", len(recorded.Errors)) }
+	if e := recorded.Errors[0]; e.Stage != database.StageSnapshot || !strings.Contains(e.Message, "db down") {
+		t.Errorf("error = %+v", e)
+	}
+}
+
+func TestRun_WritesOutboxInRegisterTransactionBeforeRecordingRun(t *testing.T) {
+	var steps []string
+	tx := &mockTransactor{}
+
+	fetcher := &mockCSVFetcher{
+		fetchFn: func() ([]csvfetch.Record, error) {
+			return []csvfetch.Record{{OrganisationName: "Acme Ltd", TownCity: "London", LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"}}, nil
+		},
+	}
+	orgs := &mockOrgRepo{
+		findFn: func(_ context.Context, _, _, _ string) (database.Organisation, bool, error) {
+			return database.Organisation{ID: 1}, true, nil
+		},
+		getAllActiveFn: func(_ context.Context) ([]database.Organisation, error) {
+			steps = append(steps, "close stale")
+			return []database.Organisation{{ID: 1}}, nil
+		},
+	}
+	licences := &mockLicenceRepo{
+		findActiveFn: func(_ context.Context, _ int, _, _ string) (database.Licence, bool, error) {
+			if tx.nested == 0 { t.Error("record not processed in a nested transaction") }
+			return database.Licence{ID: 10, Rating: "A rating"}, true, nil
+		},
+		getAllActiveFn: func(_ context.Context) ([]database.Licence, error) {
+			return []database.Licence{{ID: 10}}, nil
+		},
+	}
+	cfg := &mockConfigRepo{
+		getInitialRunTimeFn: func(_ context.Context) (string, bool, error) { return "2026-01-01T00:00:00Z", true, nil },
+	}
+	outbox := &mockOutboxRepo{
+		writeFn: func(_ context.Context) (int, error) {
+			if tx.depth != 1 { t.Errorf("outbox written at transaction depth %d, want 1", tx.depth) }
+			steps = append(steps, "write outbox")
+			return 2, nil
+		},
+	}
+	snapshots := &mockSnapshotRepo{
+		refreshFn: func(_ context.Context, _ time.Time) error {
+			if tx.depth != 0 { t.Error("snapshot refreshed inside the register transaction") }
+			steps = append(steps, "refresh snapshot")
+			return nil
+		},
+	}
+	runs := &mockSyncRunRepo{
+		insertFn: func(_ context.Context, _ database.SyncRun) (int, error) {
+			steps = append(steps, "record run")
+			return 1, nil
+		},
+	}
+
+	s := NewSyncer(fetcher, orgs, licences, cfg, runs, snapshots, tx, outbox)
+	if _, err := s.Run(context.Background()); err != nil { t.Fatalf("unexpected error: %v", err) }
+	if got := strings.Join(steps, ", "); got != "close stale, write outbox, refresh snapshot, record run" { t.Errorf("steps = %s", got) }
+}
+
+func TestRun_OutboxFailureFailsRun(t *testing.T) {
+	recorded := false
+
+	fetcher := &mockCSVFetcher{
+		fetchFn: func() ([]csvfetch.Record, error) { return []csvfetch.Record{}, nil },
+	}
+	cfg := &mockConfigRepo{
+		getInitialRunTimeFn: func(_ context.Context) (string, bool, error) { return "", false, nil },
+		setValueFn:          func(_ context.Context, _, _, _ string) error { return nil },
+	}
+	runs := &mockSyncRunRepo{
+		insertFn: func(_ context.Context, _ database.SyncRun) (int, error) {
+			recorded = true
+			return 1, nil
+		},
+	}
+	outbox := &mockOutboxRepo{
+		writeFn: func(_ context.Context) (int, error) { return 0, errors.New("db down") },
+	}
+
+	s := NewSyncer(fetcher, nil, nil, cfg, runs, noOpSnapshotRepo(), &mockTransactor{}, outbox)
+	_, err := s.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "write outbox: db down") { t.Errorf("err = %v", err) }
+	if recorded { t.Error("run recorded although its changes were rolled back") }
+}
+
+func TestRun_FailedRecordIsNotCounted(t *testing.T) {
+	fetcher := &mockCSVFetcher{
+		fetchFn: func() ([]csvfetch.Record, error) {
+			return []csvfetch.Record{{OrganisationName: "New Ltd", TownCity: "London", LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"}}, nil
+		},
+	}
+	orgs := &mockOrgRepo{
+		findFn: func(_ context.Context, _, _, _ string) (database.Organisation, bool, error) {
+			return database.Organisation{}, false, nil
+		},
+		insertFn: func(_ context.Context, _ database.Organisation, _ bool) (int, error) { return 1, nil },
+	}
+	licences := &mockLicenceRepo{
+		findActiveFn: func(_ context.Context, _ int, _, _ string) (database.Licence, bool, error) {
+			return database.Licence{}, false, errors.New("db down")
+		},
+	}
+	cfg := &mockConfigRepo{
+		getInitialRunTimeFn: func(_ context.Context) (string, bool, error) { return "", false, nil },
+		setValueFn:          func(_ context.Context, _, _, _ string) error { return nil },
+	}
+
+	s := NewSyncer(fetcher, orgs, licences, cfg, noOpSyncRunRepo(), noOpSnapshotRepo(), &mockTransactor{}, noOpOutboxRepo())
+	result, err := s.Run(context.Background())
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	// The organisation insert was rolled back with the rest of the record
+	if result.NewOrganisations != 0 { t.Errorf("got %d new orgs, want 0", result.NewOrganisations) }
+	if len(result.Errors) != 1 || result.Errors[0].Stage != database.StageLicence { t.Errorf("errors = %+v", result.Errors) }
+}
+
+func TestRun_SyncsRecordsInChunksSkippingFailures(t *testing.T) {
+	records := make([]csvfetch.Record, 500)
+	for i := range records {
+		records[i] = csvfetch.Record{OrganisationName: fmt.Sprintf("Org %d", i), TownCity: "London", LicenceType: "Worker", Rating: "A rating", Route: "Skilled Worker"}
+	}
+	fetcher := &mockCSVFetcher{
+		fetchFn: func() ([]csvfetch.Record, error) { return records, nil },
+	}
+	nextID := 0
+	orgs := &mockOrgRepo{
+		findFn: func(_ context.Context, _, _, _ string) (database.Organisation, bool, error) {
+			return database.Organisation{}, false, nil
+		},
+		insertFn: func(_ context.Context, org database.Organisation, _ bool) (int, error) {
+			if org.Name == "Org 57" || org.Name == "Org 301" {
+				return 0, errors.New("db down")
+			}
+			nextID++
+			return nextID, nil
+		},
+	}
+	licences := &mockLicenceRepo{
+		findActiveFn: func(_ context.Context, _ int, _, _ string) (database.Licence, bool, error) {
+			return database.Licence{}, false, nil
+		},
+		insertFn: func(_ context.Context, _ database.Licence, _ bool) (int, error) { return 1, nil },
+	}
+	cfg := &mockConfigRepo{
+		getInitialRunTimeFn: func(_ context.Context) (string, bool, error) { return "", false, nil },
+		setValueFn:          func(_ context.Context, _, _, _ string) error { return nil },
+	}
+	tx := &mockTransactor{}
+
+	s := NewSyncer(fetcher, orgs, licences, cfg, noOpSyncRunRepo(), noOpSnapshotRepo(), tx, noOpOutboxRepo())
+	result, err := s.Run(context.Background())
+	if err != nil { t.Fatalf("unexpected error: %v", err) }
+	if result.NewOrganisations != 498 || result.NewLicences != 498 { t.Errorf("got %d new orgs and %d new licences, want 498 each", result.NewOrganisations, result.NewLicences) }
+	if len(result.Errors) != 2 || result.Errors[0].OrganisationName != "Org 57" || result.Errors[1].OrganisationName != "Org 301" { t.Errorf("errors = %+v", result.Errors) }
+	if tx.nested > recordChunks+2 { t.Errorf("%d nested transactions, want at most %d", tx.nested, recordChunks+2) }
+}
+
+func TestResult_JSONUsesSnakeCase(t *testing.T) {
+	b, err := json.Marshal(Result{CSVURL: "https://example.test/x.csv", NewOrganisations: 1, Errors: []database.SyncRunError{}})
+	if err != nil { t.Fatal(err) }
+	for _, key := range []string{`"csv_url":`, `"new_organisations":1`, `"closed_licences":0`, `"errors":[]`} {
+		if !strings.Contains(string(b), key) { t.Errorf("%s missing %s", b, key) }
+	}
+}
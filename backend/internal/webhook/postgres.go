@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"sponsor-tracker/internal/database"
+)
+
+// PostgresStore implements Store using PostgreSQL.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+func (s *PostgresStore) GetWebhooks(ctx context.Context, activeOnly bool) ([]database.Webhook, error) {
+	return database.GetWebhooks(ctx, s.pool, activeOnly)
+}
+
+func (s *PostgresStore) FindWebhook(ctx context.Context, id int) (database.Webhook, bool, error) {
+	return database.FindWebhook(ctx, s.pool, id)
+}
+
+func (s *PostgresStore) InsertWebhook(ctx context.Context, wh database.Webhook) (int, error) {
+	return database.InsertWebhook(ctx, s.pool, wh)
+}
+
+func (s *PostgresStore) UpdateWebhook(ctx context.Context, wh database.Webhook) (bool, error) {
+	return database.UpdateWebhook(ctx, s.pool, wh)
+}
+
+func (s *PostgresStore) DeleteWebhook(ctx context.Context, id int) (bool, error) {
+	return database.DeleteWebhook(ctx, s.pool, id)
+}
+
+func (s *PostgresStore) RecordFailure(ctx context.Context, id, limit int) (bool, error) {
+	return database.RecordWebhookFailure(ctx, s.pool, id, limit)
+}
+
+func (s *PostgresStore) ResetFailures(ctx context.Context, id int) error {
+	return database.ResetWebhookFailures(ctx, s.pool, id)
+}
+
+func (s *PostgresStore) InsertDelivery(ctx context.Context, d database.WebhookDelivery) error {
+	_, err := database.InsertWebhookDelivery(ctx, s.pool, d)
+	return err
+}
+
+func (s *PostgresStore) FindLastDelivery(ctx context.Context, webhookID int, deliveryID string) (database.WebhookDelivery, bool, error) {
+	return database.FindLastWebhookDelivery(ctx, s.pool, webhookID, deliveryID)
+}
+
+func (s *PostgresStore) GetDeliveries(ctx context.Context, webhookID, limit int) ([]database.WebhookDelivery, error) {
+	return database.GetWebhookDeliveries(ctx, s.pool, webhookID, limit)
+}
@@ -0,0 +1,360 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"sponsor-tracker/internal/database"
+	"sponsor-tracker/internal/outbox"
+)
+
+// Payload event names.
+const (
+	EventChanges = "changes" // register changes made by a sync run
+	EventTest    = "test"    // sent on request to check a webhook
+)
+
+// Request headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// maxEventsPerDelivery bounds the size of a payload; larger change sets are
+// split across several deliveries.
+const maxEventsPerDelivery = 500
+
+// maxFailures is the number of batches in a row a webhook may fail to accept
+// before it is deactivated. The outbox redelivers a failed batch after a
+// delay that doubles up to 30 minutes, so this allows several hours.
+const maxFailures = 10
+
+// defaultBackoff is the wait before each retry of a failed delivery.
+var defaultBackoff = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	DeliveryID string                 `json:"delivery_id"`
+	Event      string                 `json:"event"`
+	SentAt     time.Time              `json:"sent_at"`
+	Events     []database.ChangeEvent `json:"events"`
+}
+
+// Store is the subset of database operations needed by the webhook service.
+type Store interface {
+	GetWebhooks(ctx context.Context, activeOnly bool) ([]database.Webhook, error)
+	FindWebhook(ctx context.Context, id int) (database.Webhook, bool, error)
+	InsertWebhook(ctx context.Context, wh database.Webhook) (int, error)
+	UpdateWebhook(ctx context.Context, wh database.Webhook) (bool, error)
+	DeleteWebhook(ctx context.Context, id int) (bool, error)
+	RecordFailure(ctx context.Context, id, limit int) (bool, error)
+	ResetFailures(ctx context.Context, id int) error
+	InsertDelivery(ctx context.Context, d database.WebhookDelivery) error
+	FindLastDelivery(ctx context.Context, webhookID int, deliveryID string) (database.WebhookDelivery, bool, error)
+	GetDeliveries(ctx context.Context, webhookID, limit int) ([]database.WebhookDelivery, error)
+}
+
+// Service manages webhook subscriptions and delivers register changes to them.
+type Service struct {
+	store   Store
+	client  *http.Client
+	backoff []time.Duration
+}
+
+// NewService constructs a webhook Service.
+func NewService(store Store) *Service {
+	return &Service{
+		store:   store,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		backoff: defaultBackoff,
+	}
+}
+
+// ListWebhooks returns every webhook.
+func (s *Service) ListWebhooks(ctx context.Context) ([]database.Webhook, error) {
+	return s.store.GetWebhooks(ctx, false)
+}
+
+// GetWebhook returns a webhook, or false if it does not exist.
+func (s *Service) GetWebhook(ctx context.Context, id int) (database.Webhook, bool, error) {
+	return s.store.FindWebhook(ctx, id)
+}
+
+// CreateWebhook creates a webhook and returns it.
+func (s *Service) CreateWebhook(ctx context.Context, wh database.Webhook) (database.Webhook, error) {
+	id, err := s.store.InsertWebhook(ctx, wh)
+	if err != nil {
+		return database.Webhook{}, err
+	}
+	created, _, err := s.store.FindWebhook(ctx, id)
+	return created, err
+}
+
+// UpdateWebhook replaces a webhook's settings, keeping its secret if
+// wh.Secret is empty, and returns it. It returns false if it does not exist.
+func (s *Service) UpdateWebhook(ctx context.Context, wh database.Webhook) (database.Webhook, bool, error) {
+	found, err := s.store.UpdateWebhook(ctx, wh)
+	if err != nil || !found {
+		return database.Webhook{}, false, err
+	}
+	return s.store.FindWebhook(ctx, wh.ID)
+}
+
+// DeleteWebhook deletes a webhook, returning false if it does not exist.
+func (s *Service) DeleteWebhook(ctx context.Context, id int) (bool, error) {
+	return s.store.DeleteWebhook(ctx, id)
+}
+
+// GetDeliveries returns up to limit of a webhook's most recent delivery
+// attempts, or false if the webhook does not exist.
+func (s *Service) GetDeliveries(ctx context.Context, id, limit int) ([]database.WebhookDelivery, bool, error) {
+	if _, found, err := s.store.FindWebhook(ctx, id); err != nil || !found {
+		return nil, false, err
+	}
+	deliveries, err := s.store.GetDeliveries(ctx, id, limit)
+	return deliveries, true, err
+}
+
+// SendTest makes one attempt to deliver a test payload with no events to a
+// webhook, active or not, and returns the recorded attempt. It returns false
+// if the webhook does not exist.
+func (s *Service) SendTest(ctx context.Context, id int) (database.WebhookDelivery, bool, error) {
+	wh, found, err := s.store.FindWebhook(ctx, id)
+	if err != nil || !found {
+		return database.WebhookDelivery{}, false, err
+	}
+	testID, err := randomID()
+	if err != nil {
+		return database.WebhookDelivery{}, true, err
+	}
+	d := s.attempt(ctx, wh, newPayload(testID, EventTest, []database.ChangeEvent{}), 1)
+	if err := s.store.InsertDelivery(ctx, d); err != nil {
+		return database.WebhookDelivery{}, true, err
+	}
+	return d, true, nil
+}
+
+// Deliver sends a batch of register changes to every active webhook whose
+// filters match them. Webhooks are delivered to concurrently and each
+// delivery is retried with backoff, with every attempt recorded in the
+// delivery log. A delivery's ID is derived from the batch, webhook and chunk,
+// so the log shows which chunks each webhook has already settled, and a
+// redelivered batch goes only to the webhooks that have not. If any webhook
+// fails with an error worth retrying, it returns an error so the outbox
+// redelivers the batch later; a webhook that fails maxFailures batches in a
+// row is deactivated instead, so it cannot hold up the others for ever.
+// It implements outbox.Sink.
+func (s *Service) Deliver(ctx context.Context, b outbox.Batch) error {
+	webhooks, err := s.store.GetWebhooks(ctx, true)
+	if err != nil {
+		return fmt.Errorf("deliver webhooks: %w", err)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []error
+	)
+	for _, wh := range webhooks {
+		matched := Match(wh, b.Events)
+		if len(matched) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.deliverBatch(ctx, wh, b.Key, matched); err != nil {
+				mu.Lock()
+				failed = append(failed, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		return fmt.Errorf("deliver webhooks: %w", errors.Join(failed...))
+	}
+	return nil
+}
+
+// Match returns the events a webhook subscribes to; see database.ChangeFilter.
+func Match(wh database.Webhook, events []database.ChangeEvent) []database.ChangeEvent {
+	return database.ChangeFilter{EventTypes: wh.EventTypes, Routes: wh.Routes}.Apply(events)
+}
+
+// deliverBatch sends a webhook the events of a batch it matched, in chunks,
+// skipping those it settled on an earlier delivery of the batch. It stops at
+// the first chunk that fails and counts the failure against the webhook.
+func (s *Service) deliverBatch(ctx context.Context, wh database.Webhook, batchKey string, events []database.ChangeEvent) error {
+	chunk := 0
+	for events := range slices.Chunk(events, maxEventsPerDelivery) {
+		id := deliveryID(batchKey, wh.ID, chunk)
+		chunk++
+		last, found, err := s.store.FindLastDelivery(ctx, wh.ID, id)
+		if err != nil {
+			return fmt.Errorf("webhook %d: %w", wh.ID, err)
+		}
+		if found && settled(last) {
+			continue
+		}
+		if err := s.deliver(ctx, wh, newPayload(id, EventChanges, events)); err != nil {
+			return s.fail(ctx, wh, err)
+		}
+	}
+	if wh.Failures > 0 {
+		if err := s.store.ResetFailures(ctx, wh.ID); err != nil {
+			return fmt.Errorf("webhook %d: %w", wh.ID, err)
+		}
+	}
+	return nil
+}
+
+// fail counts a failed batch against a webhook, and returns nil if that has
+// deactivated it, so the batch is not redelivered on its account. Failures
+// caused by ctx ending are not counted.
+func (s *Service) fail(ctx context.Context, wh database.Webhook, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	deactivated, rerr := s.store.RecordFailure(ctx, wh.ID, maxFailures)
+	if rerr != nil {
+		return errors.Join(err, fmt.Errorf("webhook %d: %w", wh.ID, rerr))
+	}
+	if deactivated {
+		slog.Warn("webhook deactivated after repeated failures", "webhook_id", wh.ID, "failures", maxFailures)
+		return nil
+	}
+	return err
+}
+
+// deliver sends a payload to a webhook, retrying failed attempts after each
+// backoff interval, and records every attempt. It returns an error if the
+// last attempt failed in a way worth retrying later; a payload the receiver
+// rejects is given up on, left failed in the delivery log.
+func (s *Service) deliver(ctx context.Context, wh database.Webhook, payload Payload) error {
+	for attempt := 1; ; attempt++ {
+		d := s.attempt(ctx, wh, payload, attempt)
+		if err := s.store.InsertDelivery(ctx, d); err != nil {
+			slog.Error("record webhook delivery", "webhook_id", wh.ID, "delivery_id", d.DeliveryID, "error", err)
+		}
+		if d.Succeeded {
+			return nil
+		}
+		if !retryable(d) {
+			slog.Warn("webhook delivery rejected", "webhook_id", wh.ID, "delivery_id", d.DeliveryID, "status", d.Error)
+			return nil
+		}
+		if attempt > len(s.backoff) {
+			slog.Warn("webhook delivery failed", "webhook_id", wh.ID, "delivery_id", d.DeliveryID, "attempts", attempt)
+			return fmt.Errorf("webhook %d: delivery %s failed after %d attempts", wh.ID, d.DeliveryID, attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("webhook %d: delivery %s: %w", wh.ID, d.DeliveryID, ctx.Err())
+		case <-time.After(s.backoff[attempt-1]):
+		}
+	}
+}
+
+// attempt POSTs a payload to a webhook once and describes the outcome.
+func (s *Service) attempt(ctx context.Context, wh database.Webhook, p Payload, attempt int) database.WebhookDelivery {
+	d := database.WebhookDelivery{
+		WebhookID:   wh.ID,
+		DeliveryID:  p.DeliveryID,
+		Event:       p.Event,
+		EventCount:  len(p.Events),
+		Attempt:     attempt,
+		AttemptedAt: time.Now().UTC(),
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sponsor-tracker-webhook")
+	req.Header.Set(HeaderEvent, p.Event)
+	req.Header.Set(HeaderDelivery, p.DeliveryID)
+	req.Header.Set(HeaderSignature, Sign(wh.Secret, body))
+
+	resp, err := s.client.Do(req)
+	d.DurationMS = int(time.Since(d.AttemptedAt).Milliseconds())
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	d.StatusCode = &resp.StatusCode
+	d.Succeeded = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !d.Succeeded {
+		d.Error = resp.Status
+	}
+	return d
+}
+
+// retryable reports whether a failed attempt may succeed if repeated: the
+// request got no response, or the receiver timed out, was rate limited or
+// failed with a server error.
+func retryable(d database.WebhookDelivery) bool {
+	if d.StatusCode == nil {
+		return true
+	}
+	code := *d.StatusCode
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// settled reports whether a delivery's latest attempt ends it: it succeeded,
+// or the receiver rejected it in a way not worth retrying.
+func settled(d database.WebhookDelivery) bool {
+	return d.Succeeded || !retryable(d)
+}
+
+// Sign returns the signature header value for a body: "sha256=" followed by
+// the hex HMAC-SHA256 of the body keyed with the webhook's secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newPayload builds a payload sent now.
+func newPayload(deliveryID, event string, events []database.ChangeEvent) Payload {
+	return Payload{DeliveryID: deliveryID, Event: event, SentAt: time.Now().UTC(), Events: events}
+}
+
+// deliveryID returns the ID of the delivery of one chunk of a batch to a webhook.
+func deliveryID(batchKey string, webhookID, chunk int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d", batchKey, webhookID, chunk)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// randomID returns a new random delivery ID.
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate delivery id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,346 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"sponsor-tracker/internal/database"
+	"sponsor-tracker/internal/outbox"
+)
+
+// fakeStore is an in-memory Store.
+type fakeStore struct {
+	mu         sync.Mutex
+	webhooks   []database.Webhook
+	deliveries []database.WebhookDelivery
+}
+
+func (f *fakeStore) GetWebhooks(_ context.Context, activeOnly bool) ([]database.Webhook, error) {
+	out := []database.Webhook{}
+	for _, wh := range f.webhooks {
+		if wh.Active || !activeOnly { out = append(out, wh) }
+	}
+	return out, nil
+}
+
+func (f *fakeStore) FindWebhook(_ context.Context, id int) (database.Webhook, bool, error) {
+	for _, wh := range f.webhooks {
+		if wh.ID == id { return wh, true, nil }
+	}
+	return database.Webhook{}, false, nil
+}
+
+func (f *fakeStore) InsertWebhook(_ context.Context, wh database.Webhook) (int, error) {
+	wh.ID = len(f.webhooks) + 1
+	f.webhooks = append(f.webhooks, wh)
+	return wh.ID, nil
+}
+
+func (f *fakeStore) UpdateWebhook(_ context.Context, wh database.Webhook) (bool, error) {
+	for i := range f.webhooks {
+		if f.webhooks[i].ID == wh.ID { f.webhooks[i] = wh; return true, nil }
+	}
+	return false, nil
+}
+
+func (f *fakeStore) DeleteWebhook(_ context.Context, id int) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeStore) RecordFailure(_ context.Context, id, limit int) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.webhooks {
+		if wh := &f.webhooks[i]; wh.ID == id {
+			wh.Failures++
+			wh.Active = wh.Active && wh.Failures < limit
+			return !wh.Active, nil
+		}
+	}
+	return true, nil
+}
+
+func (f *fakeStore) ResetFailures(_ context.Context, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.webhooks {
+		if f.webhooks[i].ID == id { f.webhooks[i].Failures = 0 }
+	}
+	return nil
+}
+
+func (f *fakeStore) InsertDelivery(_ context.Context, d database.WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deliveries = append(f.deliveries, d)
+	return nil
+}
+
+func (f *fakeStore) FindLastDelivery(_ context.Context, webhookID int, deliveryID string) (database.WebhookDelivery, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.deliveries) - 1; i >= 0; i-- {
+		if d := f.deliveries[i]; d.WebhookID == webhookID && d.DeliveryID == deliveryID { return d, true, nil }
+	}
+	return database.WebhookDelivery{}, false, nil
+}
+
+func (f *fakeStore) GetDeliveries(_ context.Context, webhookID, limit int) ([]database.WebhookDelivery, error) {
+	return f.deliveries, nil
+}
+
+// receiver is a local webhook endpoint that responds with the given status
+// codes in turn, then 200, and records what it received.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	if len(rc.statuses) > 0 {
+		w.WriteHeader(rc.statuses[0])
+		rc.statuses = rc.statuses[1:]
+	}
+}
+
+func newTestService(store Store, srv *httptest.Server) *Service {
+	s := NewService(store)
+	s.client = srv.Client()
+	s.backoff = []time.Duration{0, 0, 0}
+	return s
+}
+
+func licenceEvent(orgID, licID int, eventType, route string) database.ChangeEvent {
+	return database.ChangeEvent{EventType: eventType, OrganisationID: orgID, LicenceID: &licID, Route: route}
+}
+
+func orgEvent(orgID int, eventType string) database.ChangeEvent {
+	return database.ChangeEvent{EventType: eventType, OrganisationID: orgID}
+}
+
+func batch(events ...database.ChangeEvent) outbox.Batch {
+	return outbox.Batch{Key: "sync:2026-03-01T06:00:00Z", At: time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC), Events: events}
+}
+
+func TestDeliver_SignsAndRetriesServerErrors(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	store := &fakeStore{webhooks: []database.Webhook{{ID: 1, URL: srv.URL, Secret: "0123456789abcdef", Active: true}}}
+	b := batch(licenceEvent(7, 70, database.EventLicenceAdded, "Skilled Worker"))
+	if err := newTestService(store, srv).Deliver(context.Background(), b); err != nil { t.Fatalf("deliver: %v", err) }
+
+	if len(rc.requests) != 3 { t.Fatalf("received %d requests, want 3", len(rc.requests)) }
+	for i, r := range rc.requests {
+		if got, want := r.Header.Get(HeaderSignature), Sign("0123456789abcdef", rc.bodies[i]); got != want { t.Errorf("request %d: signature = %q, want %q", i, got, want) }
+		if r.Header.Get(HeaderEvent) != EventChanges { t.Errorf("request %d: event header = %q", i, r.Header.Get(HeaderEvent)) }
+		if r.Header.Get(HeaderDelivery) != rc.requests[0].Header.Get(HeaderDelivery) { t.Errorf("request %d: retry has a different delivery ID", i) }
+	}
+
+	var p Payload
+	if err := json.Unmarshal(rc.bodies[0], &p); err != nil { t.Fatalf("decode payload: %v", err) }
+	if p.Event != EventChanges || len(p.Events) != 1 || p.Events[0].OrganisationID != 7 { t.Errorf("payload = %+v", p) }
+
+	if len(store.deliveries) != 3 { t.Fatalf("recorded %d attempts, want 3", len(store.deliveries)) }
+	for i, d := range store.deliveries {
+		if d.Attempt != i+1 || d.WebhookID != 1 || d.EventCount != 1 || d.DeliveryID != p.DeliveryID { t.Errorf("attempt %d = %+v", i+1, d) }
+	}
+	if d := store.deliveries[0]; d.Succeeded || d.StatusCode == nil || *d.StatusCode != 500 || d.Error == "" { t.Errorf("first attempt = %+v", d) }
+	if d := store.deliveries[2]; !d.Succeeded || *d.StatusCode != 200 { t.Errorf("last attempt = %+v", d) }
+}
+
+func TestDeliver_StopsRetrying(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int
+		wantErr  bool
+	}{
+		{"client error is given up on", []int{http.StatusGone}, 1, false},
+		{"gives up after the last backoff", []int{500, 500, 500, 500, 500}, 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{statuses: tt.statuses}
+			srv := httptest.NewServer(rc)
+			defer srv.Close()
+
+			store := &fakeStore{webhooks: []database.Webhook{{ID: 1, URL: srv.URL, Active: true}}}
+			err := newTestService(store, srv).Deliver(context.Background(), batch(orgEvent(7, database.EventOrganisationAdded)))
+
+			if (err != nil) != tt.wantErr { t.Errorf("err = %v, want error %v", err, tt.wantErr) }
+			if len(rc.requests) != tt.want { t.Errorf("received %d requests, want %d", len(rc.requests), tt.want) }
+			if last := store.deliveries[len(store.deliveries)-1]; last.Succeeded { t.Errorf("last attempt succeeded: %+v", last) }
+		})
+	}
+}
+
+// outboxStore is an in-memory outbox.Store holding one queue of batches and
+// the webhook sink's position in it.
+type outboxStore struct {
+	batches []outbox.Batch
+	cursor  int
+}
+
+func (f *outboxStore) Dispatch(_ context.Context, _ string, deliver func(outbox.Batch) error) (bool, error) {
+	if f.cursor >= len(f.batches) {
+		return false, nil
+	}
+	if err := deliver(f.batches[f.cursor]); err != nil {
+		return false, err
+	}
+	f.cursor++
+	return true, nil
+}
+
+func (f *outboxStore) Prune(context.Context, []string, time.Time) (int64, error) { return 0, nil }
+
+func TestDeliver_FailedDeliveryHoldsOutboxCursor(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusInternalServerError) }))
+	defer down.Close()
+	up := &receiver{}
+	upSrv := httptest.NewServer(up)
+	defer upSrv.Close()
+
+	store := &fakeStore{webhooks: []database.Webhook{{ID: 1, URL: down.URL, Active: true}, {ID: 2, URL: upSrv.URL, Active: true}}}
+	ob := &outboxStore{batches: []outbox.Batch{batch(orgEvent(7, database.EventOrganisationAdded))}}
+	d := outbox.NewDispatcher(ob)
+	d.Register("webhook", newTestService(store, down))
+
+	if err := d.Dispatch(context.Background(), time.Now()); err == nil { t.Error("dispatch succeeded with a failing receiver") }
+	if ob.cursor != 0 { t.Errorf("cursor = %d, want 0 until every webhook accepts the batch", ob.cursor) }
+	if len(up.requests) != 1 { t.Errorf("healthy receiver got %d requests, want 1", len(up.requests)) }
+	if store.webhooks[0].Failures != 1 { t.Errorf("failures = %d, want 1", store.webhooks[0].Failures) }
+
+	// Once the failing receiver recovers, the batch goes only to it
+	store.webhooks[0].URL = upSrv.URL
+	if err := d.Dispatch(context.Background(), time.Now().Add(time.Hour)); err != nil { t.Fatalf("redispatch: %v", err) }
+	if ob.cursor != 1 { t.Errorf("cursor = %d, want 1", ob.cursor) }
+	if len(up.requests) != 2 { t.Errorf("receivers got %d requests, want 2 (one redelivery)", len(up.requests)) }
+	if store.webhooks[0].Failures != 0 { t.Errorf("failures = %d after a success, want 0", store.webhooks[0].Failures) }
+}
+
+func TestDeliver_DeactivatesAfterRepeatedFailures(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusBadGateway) }))
+	defer down.Close()
+
+	store := &fakeStore{webhooks: []database.Webhook{{ID: 1, URL: down.URL, Active: true}}}
+	s := newTestService(store, down)
+	b := batch(orgEvent(7, database.EventOrganisationAdded))
+	for i := 1; i < maxFailures; i++ {
+		if err := s.Deliver(context.Background(), b); err == nil { t.Fatalf("delivery %d succeeded", i) }
+	}
+	if err := s.Deliver(context.Background(), b); err != nil { t.Errorf("last failure: err = %v, want nil once deactivated", err) }
+	if wh := store.webhooks[0]; wh.Active || wh.Failures != maxFailures { t.Errorf("webhook = %+v", wh) }
+}
+
+func TestDeliver_SkipsInactiveAndUnmatchedWebhooks(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	store := &fakeStore{webhooks: []database.Webhook{
+		{ID: 1, URL: srv.URL, Active: false},
+		{ID: 2, URL: srv.URL, Active: true, Routes: []string{"Scale-up"}},
+	}}
+	newTestService(store, srv).Deliver(context.Background(), batch(licenceEvent(7, 70, database.EventLicenceAdded, "Skilled Worker")))
+
+	if len(rc.requests) != 0 { t.Errorf("received %d requests, want 0", len(rc.requests)) }
+}
+
+func TestDeliver_RedeliverySkipsSettledDeliveries(t *testing.T) {
+	flaky := httptest.NewServer(&receiver{statuses: []int{500, 500, 500, 500}})
+	defer flaky.Close()
+	srv := httptest.NewServer(&receiver{})
+	defer srv.Close()
+
+	store := &fakeStore{webhooks: []database.Webhook{{ID: 1, URL: flaky.URL, Active: true}, {ID: 2, URL: srv.URL, Active: true}}}
+	s := newTestService(store, srv)
+	b := batch(orgEvent(7, database.EventOrganisationAdded))
+	if err := s.Deliver(context.Background(), b); err == nil { t.Fatal("first delivery succeeded") }
+	s.Deliver(context.Background(), b)
+	s.Deliver(context.Background(), b)
+	b.Key = "sync:2026-03-02T06:00:00Z"
+	s.Deliver(context.Background(), b)
+
+	ids := map[int][]string{}
+	for _, d := range store.deliveries {
+		if d.Succeeded { ids[d.WebhookID] = append(ids[d.WebhookID], d.DeliveryID) }
+	}
+	for id, got := range ids {
+		if len(got) != 2 || got[0] == got[1] { t.Errorf("webhook %d delivered %v, want each batch once", id, got) }
+	}
+	if len(store.deliveries) != 4+1+1+2 { t.Errorf("recorded %d attempts, want the failed webhook's retries plus one per delivery", len(store.deliveries)) }
+	if ids[1][0] == ids[2][0] { t.Error("webhooks share a delivery ID") }
+}
+
+func TestMatch(t *testing.T) {
+	events := []database.ChangeEvent{
+		orgEvent(1, database.EventOrganisationRemoved),
+		licenceEvent(1, 10, database.EventLicenceRemoved, "Skilled Worker"),
+		orgEvent(2, database.EventOrganisationAdded),
+		licenceEvent(2, 20, database.EventLicenceAdded, "Scale-up"),
+		licenceEvent(3, 30, database.EventLicenceRerated, "Skilled Worker"),
+	}
+
+	tests := []struct {
+		name string
+		wh   database.Webhook
+		want []int // indexes into events
+	}{
+		{"no filters", database.Webhook{}, []int{0, 1, 2, 3, 4}},
+		{"event types", database.Webhook{EventTypes: []string{database.EventLicenceRerated, database.EventOrganisationAdded}}, []int{2, 4}},
+		{"route includes organisation events with a matching licence", database.Webhook{Routes: []string{"Skilled Worker"}}, []int{0, 1, 4}},
+		{"route and event type", database.Webhook{Routes: []string{"Scale-up"}, EventTypes: []string{database.EventOrganisationAdded}}, []int{2}},
+		{"no match", database.Webhook{Routes: []string{"Global Business Mobility"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want []database.ChangeEvent
+			for _, i := range tt.want {
+				want = append(want, events[i])
+			}
+			if got := Match(tt.wh, events); !reflect.DeepEqual(got, want) { t.Errorf("got %+v, want %+v", got, want) }
+		})
+	}
+}
+
+func TestSendTest(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusInternalServerError}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	// Test events go to inactive webhooks too, and are not retried
+	store := &fakeStore{webhooks: []database.Webhook{{ID: 4, URL: srv.URL, Secret: "0123456789abcdef", Active: false}}}
+	s := newTestService(store, srv)
+
+	d, found, err := s.SendTest(context.Background(), 4)
+	if err != nil || !found { t.Fatalf("send test: found=%v err=%v", found, err) }
+	if d.Event != EventTest || d.Succeeded || *d.StatusCode != 500 || d.Attempt != 1 { t.Errorf("delivery = %+v", d) }
+	if len(rc.requests) != 1 { t.Errorf("received %d requests, want 1", len(rc.requests)) }
+	if len(store.deliveries) != 1 { t.Errorf("recorded %d attempts, want 1", len(store.deliveries)) }
+	if got, want := rc.requests[0].Header.Get(HeaderSignature), Sign("0123456789abcdef", rc.bodies[0]); got != want { t.Errorf("signature = %q, want %q", got, want) }
+
+	if _, found, _ := s.SendTest(context.Background(), 99); found { t.Error("found unknown webhook") }
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"event":"test"}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=8419ab361b37d61b696d008ef7549a18325132dae5da84c7424e8e1c590d0498"
+	if got := Sign("secret", []byte(`{"event":"test"}`)); got != want { t.Errorf("Sign = %q, want %q", got, want) }
+}
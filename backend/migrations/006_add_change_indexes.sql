@@ -0,0 +1,11 @@
+-- +goose Up
+-- The change feed derives events from these columns and reads only those
+-- after a bound; valid_from is covered by idx_licences_valid_range
+CREATE INDEX idx_organisations_created_at ON organisations(created_at);
+CREATE INDEX idx_organisations_deleted_at ON organisations(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_licences_valid_to ON licences(valid_to) WHERE valid_to IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_licences_valid_to;
+DROP INDEX idx_organisations_deleted_at;
+DROP INDEX idx_organisations_created_at;
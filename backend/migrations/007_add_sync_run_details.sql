@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE sync_runs ADD COLUMN csv_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE sync_runs ADD COLUMN error_messages TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_sync_runs_start_time ON sync_runs(start_time);
+
+-- +goose Down
+DROP INDEX idx_sync_runs_start_time;
+ALTER TABLE sync_runs DROP COLUMN error_messages;
+ALTER TABLE sync_runs DROP COLUMN csv_url;
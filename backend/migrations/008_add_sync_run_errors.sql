@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE sync_run_errors (
+    id                 SERIAL PRIMARY KEY,
+    sync_run_id        INTEGER NOT NULL REFERENCES sync_runs(id) ON DELETE CASCADE,
+    stage              VARCHAR(50) NOT NULL,
+    organisation_name  VARCHAR(500) NOT NULL DEFAULT '',
+    licence_type       VARCHAR(50) NOT NULL DEFAULT '',
+    route              VARCHAR(100) NOT NULL DEFAULT '',
+    message            TEXT NOT NULL
+);
+
+CREATE INDEX idx_sync_run_errors_run ON sync_run_errors(sync_run_id);
+
+INSERT INTO sync_run_errors (sync_run_id, stage, message)
+SELECT id, 'unknown', unnest(error_messages) FROM sync_runs;
+
+ALTER TABLE sync_runs DROP COLUMN error_messages;
+
+-- +goose Down
+ALTER TABLE sync_runs ADD COLUMN error_messages TEXT[] NOT NULL DEFAULT '{}';
+
+UPDATE sync_runs r SET error_messages = e.messages
+FROM (SELECT sync_run_id, array_agg(message ORDER BY id) AS messages
+      FROM sync_run_errors GROUP BY sync_run_id) e
+WHERE e.sync_run_id = r.id;
+
+DROP INDEX idx_sync_run_errors_run;
+DROP TABLE sync_run_errors;
@@ -0,0 +1,33 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- normalise_org_name reduces an organisation name to the form used for fuzzy
+-- matching: lower case, dots and apostrophes removed ("L.T.D." -> "ltd"),
+-- other punctuation treated as a word break, whitespace collapsed, and
+-- trailing legal suffixes (Ltd, Limited, PLC, LLP) dropped.
+-- +goose StatementBegin
+CREATE FUNCTION normalise_org_name(name TEXT) RETURNS TEXT
+LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE AS $$
+    SELECT regexp_replace(
+               btrim(regexp_replace(
+                   regexp_replace(
+                       regexp_replace(lower(name), '[.''’]', '', 'g'),
+                       '[[:punct:]]', ' ', 'g'),
+                   '\s+', ' ', 'g')),
+               '( (ltd|limited|plc|llp))+$', '')
+$$;
+-- +goose StatementEnd
+
+-- Substring search (ILIKE) on name and town
+CREATE INDEX idx_organisations_name_trgm ON organisations USING GIN (name gin_trgm_ops);
+CREATE INDEX idx_organisations_town_trgm ON organisations USING GIN (town_city gin_trgm_ops);
+
+-- Fuzzy search on the normalised name
+CREATE INDEX idx_organisations_name_norm_trgm ON organisations USING GIN (normalise_org_name(name) gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX idx_organisations_name_norm_trgm;
+DROP INDEX idx_organisations_town_trgm;
+DROP INDEX idx_organisations_name_trgm;
+DROP FUNCTION normalise_org_name(TEXT);
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Case-insensitive prefix lookups (lower(x) LIKE 'abc%') for typeahead. Name
+-- matches are read in (lower(name), id) order from the index, stopping at the
+-- limit instead of sorting every match
+CREATE INDEX idx_organisations_name_prefix ON organisations (lower(name) text_pattern_ops, id)
+    WHERE deleted_at IS NULL;
+CREATE INDEX idx_organisations_town_prefix ON organisations (lower(town_city) text_pattern_ops)
+    WHERE deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX idx_organisations_town_prefix;
+DROP INDEX idx_organisations_name_prefix;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- Register totals at the end of each day (UTC) and changes during it,
+-- refreshed after every sync and rebuilt from history by cmd/backfill. A
+-- re-rating counts as one licence removed and one added, as well as one
+-- re-rated.
+CREATE TABLE daily_snapshots (
+    snapshot_date          DATE PRIMARY KEY,
+    organisations          INTEGER NOT NULL,
+    licences               INTEGER NOT NULL,
+    b_rated_sponsors       INTEGER NOT NULL,
+    organisations_added    INTEGER NOT NULL,
+    organisations_removed  INTEGER NOT NULL,
+    licences_added         INTEGER NOT NULL,
+    licences_removed       INTEGER NOT NULL,
+    licences_rerated       INTEGER NOT NULL,
+    downgrades             INTEGER NOT NULL,
+    upgrades               INTEGER NOT NULL,
+    refreshed_at           TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Active organisations and licences per route, licence type, rating and county
+CREATE TABLE daily_snapshot_counts (
+    snapshot_date  DATE NOT NULL REFERENCES daily_snapshots(snapshot_date) ON DELETE CASCADE,
+    dimension      VARCHAR(20) NOT NULL,
+    value          VARCHAR(255) NOT NULL,
+    organisations  INTEGER NOT NULL,
+    licences       INTEGER NOT NULL,
+    PRIMARY KEY (snapshot_date, dimension, value)
+);
+
+-- +goose Down
+DROP TABLE daily_snapshot_counts;
+DROP TABLE daily_snapshots;
@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE watchlists (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_viewed_at TIMESTAMPTZ,
+    UNIQUE(user_id, name)
+);
+
+-- Organisations are followed by ID; the watchlist view follows an
+-- organisation to its current version after a move
+CREATE TABLE watchlist_organisations (
+    watchlist_id INTEGER NOT NULL REFERENCES watchlists(id) ON DELETE CASCADE,
+    organisation_id INTEGER NOT NULL REFERENCES organisations(id),
+    added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (watchlist_id, organisation_id)
+);
+
+CREATE INDEX idx_watchlist_organisations_org ON watchlist_organisations(organisation_id);
+
+-- +goose Down
+DROP INDEX idx_watchlist_organisations_org;
+DROP TABLE watchlist_organisations;
+DROP TABLE watchlists;
@@ -0,0 +1,35 @@
+-- +goose Up
+CREATE TABLE webhooks (
+    id SERIAL PRIMARY KEY,
+    url VARCHAR(2000) NOT NULL,
+    secret VARCHAR(200) NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}',  -- empty = all event types
+    routes TEXT[] NOT NULL DEFAULT '{}',       -- empty = all routes
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    failures INTEGER NOT NULL DEFAULT 0,       -- batches in a row that failed
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One row per delivery attempt; the attempts of a delivery share delivery_id
+CREATE TABLE webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    delivery_id VARCHAR(32) NOT NULL,
+    event VARCHAR(20) NOT NULL,
+    event_count INTEGER NOT NULL,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER,
+    error TEXT NOT NULL DEFAULT '',
+    succeeded BOOLEAN NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    attempted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id DESC);
+CREATE INDEX idx_webhook_deliveries_delivery ON webhook_deliveries(webhook_id, delivery_id, id DESC);
+
+-- +goose Down
+DROP INDEX idx_webhook_deliveries_delivery;
+DROP INDEX idx_webhook_deliveries_webhook;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
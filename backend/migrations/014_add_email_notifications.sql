@@ -0,0 +1,35 @@
+-- +goose Up
+-- A user's email address and what they want to be emailed about
+CREATE TABLE notification_settings (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    watch_alerts BOOLEAN NOT NULL DEFAULT TRUE,
+    daily_digest BOOLEAN NOT NULL DEFAULT FALSE,
+    digest_event_types TEXT[] NOT NULL DEFAULT '{}',  -- empty = all
+    digest_routes TEXT[] NOT NULL DEFAULT '{}',       -- empty = all
+    digest_counties TEXT[] NOT NULL DEFAULT '{}',     -- empty = all
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Outgoing email, sent and retried by the API server. dedupe_key stops the
+-- same alert or digest being queued twice
+CREATE TABLE email_queue (
+    id SERIAL PRIMARY KEY,
+    dedupe_key VARCHAR(200) NOT NULL UNIQUE,
+    recipient VARCHAR(255) NOT NULL,
+    subject VARCHAR(500) NOT NULL,
+    body TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT NOT NULL DEFAULT '',
+    sent_at TIMESTAMPTZ,
+    failed_at TIMESTAMPTZ,  -- set when delivery is abandoned
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_email_queue_due ON email_queue(next_attempt_at) WHERE sent_at IS NULL AND failed_at IS NULL;
+
+-- +goose Down
+DROP INDEX idx_email_queue_due;
+DROP TABLE email_queue;
+DROP TABLE notification_settings;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Private tokens that let feed readers fetch a user's watchlist feed without
+-- a session. Creating a new token replaces the old one
+CREATE TABLE feed_tokens (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE feed_tokens;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- Change events written by each sync in the same transaction as its register
+-- update. The events of one sync form a batch, delivered to each sink in turn
+CREATE TABLE outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    idempotency_key VARCHAR(200) NOT NULL UNIQUE,
+    batch_key VARCHAR(100) NOT NULL,
+    event JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_outbox_events_batch ON outbox_events(batch_key);
+
+-- The last event delivered to each sink. A sink is retried from here until
+-- its delivery succeeds. While a dispatcher delivers the next batch it holds
+-- the cursor until leased_until
+CREATE TABLE outbox_cursors (
+    sink VARCHAR(50) PRIMARY KEY,
+    last_event_id BIGINT NOT NULL,
+    leased_until TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE outbox_cursors;
+DROP INDEX idx_outbox_events_batch;
+DROP TABLE outbox_events;
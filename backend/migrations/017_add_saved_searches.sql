@@ -0,0 +1,20 @@
+-- +goose Up
+-- A named /api/data search. query holds its parameters as given to
+-- /api/data; they are parsed wherever the search is run, including by the
+-- search alerts after each sync
+CREATE TABLE saved_searches (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    query VARCHAR(4000) NOT NULL,
+    notify BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(user_id, name)
+);
+
+CREATE INDEX idx_saved_searches_notify ON saved_searches(user_id) WHERE notify;
+
+-- +goose Down
+DROP INDEX idx_saved_searches_notify;
+DROP TABLE saved_searches;
@@ -0,0 +1,49 @@
+-- +goose Up
+-- Team notes on organisations. A note follows its organisation to the new
+-- version when the sync re-adds it at a new address
+CREATE TABLE organisation_notes (
+    id SERIAL PRIMARY KEY,
+    organisation_id INTEGER NOT NULL REFERENCES organisations(id),
+    author_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    text TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_organisation_notes_org ON organisation_notes(organisation_id);
+
+-- The earlier texts of edited notes
+CREATE TABLE organisation_note_revisions (
+    id SERIAL PRIMARY KEY,
+    note_id INTEGER NOT NULL REFERENCES organisation_notes(id) ON DELETE CASCADE,
+    text TEXT NOT NULL,
+    written_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_organisation_note_revisions_note ON organisation_note_revisions(note_id);
+
+-- Team-wide tags, stored lower case
+CREATE TABLE tags (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE organisation_tags (
+    organisation_id INTEGER NOT NULL REFERENCES organisations(id),
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    tagged_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    tagged_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organisation_id, tag_id)
+);
+
+CREATE INDEX idx_organisation_tags_tag ON organisation_tags(tag_id);
+
+-- +goose Down
+DROP INDEX idx_organisation_tags_tag;
+DROP TABLE organisation_tags;
+DROP TABLE tags;
+DROP INDEX idx_organisation_note_revisions_note;
+DROP TABLE organisation_note_revisions;
+DROP INDEX idx_organisation_notes_org;
+DROP TABLE organisation_notes;
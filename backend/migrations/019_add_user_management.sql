@@ -0,0 +1,13 @@
+-- +goose Up
+-- Disabled users cannot log in and their sessions are deleted. Deleting a
+-- user deletes their sessions
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMPTZ;
+
+ALTER TABLE sessions DROP CONSTRAINT sessions_user_id_fkey;
+ALTER TABLE sessions ADD CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE sessions DROP CONSTRAINT sessions_user_id_fkey;
+ALTER TABLE sessions ADD CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE users DROP COLUMN disabled_at;
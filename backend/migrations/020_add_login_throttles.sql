@@ -0,0 +1,18 @@
+-- +goose Up
+-- Failed logins per username and per client IP. Logins for the key are
+-- refused until locked_until; failures older than the configured window are
+-- forgotten
+CREATE TABLE login_throttles (
+    scope VARCHAR(10) NOT NULL CHECK (scope IN ('username', 'ip')),
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX idx_login_throttles_last_failure ON login_throttles(last_failure_at);
+
+-- +goose Down
+DROP INDEX idx_login_throttles_last_failure;
+DROP TABLE login_throttles;
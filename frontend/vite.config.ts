@@ -6,7 +6,9 @@ export default defineConfig({
   plugins: [react()],
   server: {
     proxy: {
-      '/api': 'http://localhost:8080',
+      // xfwd sends X-Forwarded-For, so logins are throttled per browser
+      // rather than all as the dev server
+      '/api': { target: 'http://localhost:8080', xfwd: true },
     },
   },
 })